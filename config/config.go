@@ -1,8 +1,12 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net/url"
 	"os"
+	"regexp"
+	"time"
 
 	"github.com/pelletier/go-toml/v2"
 )
@@ -10,26 +14,235 @@ import (
 // DefaultJWTExpirationMin is the default JWT token expiration time in minutes
 const DefaultJWTExpirationMin = 10
 
+// MinJWTSecretLength is the minimum length of the jwt_secret. Login codes, link codes, 2FA challenges and the
+// OAuth flow state are always signed with keys derived from it, also when signing_keys sign the access tokens.
+const MinJWTSecretLength = 32
+
+// DefaultRefreshExpirationDays is the default lifetime of a refresh token in days
+const DefaultRefreshExpirationDays = 30
+
+// DefaultPasswordResetExpirationMin is the default lifetime of a password reset token in minutes
+const DefaultPasswordResetExpirationMin = 60
+
+// DefaultEmailVerificationExpirationHours is the default lifetime of an email verification token in hours
+const DefaultEmailVerificationExpirationHours = 48
+
+// Backends of the access token revocation store
+const (
+	RevocationStorePostgres = "postgres"
+	RevocationStoreRedis    = "redis"
+)
+
+// Drivers of the mailer
+const (
+	MailDriverLog  = "log"
+	MailDriverFile = "file"
+	MailDriverSMTP = "smtp"
+)
+
+// DefaultMailFrom is the sender address used if none is configured
+const DefaultMailFrom = "pcast <noreply@localhost>"
+
+// GoogleIssuer is the OpenID Connect issuer of Google accounts
+const GoogleIssuer = "https://accounts.google.com"
+
+// DefaultOAuthScopes are requested from providers without configured scopes
+var DefaultOAuthScopes = []string{"openid", "email", "profile"}
+
+// oauthProviderName restricts provider names to what can be used in a URL path unescaped
+var oauthProviderName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// Defaults for the background feed refresh
+const (
+	DefaultSyncInterval  = "30m"
+	DefaultSyncWorkers   = 4
+	DefaultSyncBatchSize = 100
+)
+
+// Exporters of the traces
+const (
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+)
+
+// Formats of the log output
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// DefaultTracingServiceName is the service.name of the traces if none is configured
+const DefaultTracingServiceName = "pcast-api"
+
+// DefaultShutdownTimeout is how long in-flight requests may take to finish after a SIGTERM
+const DefaultShutdownTimeout = "30s"
+
+// DefaultDrainDelay is how long requests are still accepted after a SIGTERM while /readyz fails
+const DefaultDrainDelay = "0s"
+
 type Config struct {
 	Server   Server
 	Database Database
 	Auth     Auth
+	Sync     Sync
+	Redis    Redis
+	Mail     Mail
+	OAuth    OAuth
+	Tracing  Tracing
 }
 
 type Auth struct {
-	JwtSecret          string `toml:"jwt_secret"`
-	JwtExpirationMin   int    `toml:"jwt_expiration_min"`
+	JwtSecret        string `toml:"jwt_secret"`
+	JwtExpirationMin int    `toml:"jwt_expiration_min"`
+	// RefreshExpirationDays is the lifetime of a refresh token, it is extended on every rotation
+	RefreshExpirationDays int `toml:"refresh_expiration_days"`
+	// Deprecated: configure Google in [[oauth.providers]]. If set, a provider "google" is added.
 	GoogleClientID     string `toml:"google_client_id"`
 	GoogleClientSecret string `toml:"google_client_secret"`
 	GoogleRedirectURL  string `toml:"google_redirect_url"`
+	// RevocationStore is the backend of revoked access tokens, "postgres" (default) or "redis"
+	RevocationStore string `toml:"revocation_store"`
+	// PasswordResetURL is the page of the client that sets the new password, the token is appended as query parameter
+	PasswordResetURL           string `toml:"password_reset_url"`
+	PasswordResetExpirationMin int    `toml:"password_reset_expiration_min"`
+	// RequireEmailVerification blocks the password login until the user verified the email address
+	RequireEmailVerification bool `toml:"require_email_verification"`
+	// EmailVerificationURL is the page of the client that confirms the address, the token is appended as query parameter
+	EmailVerificationURL             string `toml:"email_verification_url"`
+	EmailVerificationExpirationHours int    `toml:"email_verification_expiration_hours"`
+	// FeedCredentialsKey is the base64 encoded 32 byte AES key used to encrypt private feed credentials
+	// and TOTP secrets, each with its own key derived from it. Two-factor authentication is unavailable without it.
+	FeedCredentialsKey string `toml:"feed_credentials_key"`
+	// SigningKeys sign access tokens with RS256 or EdDSA instead of HS256, other services verify them
+	// with the public keys at /.well-known/jwks.json. The first key signs, the others are only accepted for
+	// verification, e.g. the previous key during a rotation. The jwt_secret is still required for internal tokens.
+	SigningKeys []SigningKey `toml:"signing_keys"`
+}
+
+// SigningKey is a PEM file with the PKCS#8 or PKCS#1 private key of an RSA or Ed25519 key pair.
+// Keys only kept for verification may be a PKIX public key instead.
+type SigningKey struct {
+	// ID is sent as kid header of the tokens signed with the key
+	ID   string `toml:"kid"`
+	File string
+}
+
+// GetFeedCredentialsKey decodes the feed credentials key. Returns nil if no key is configured.
+func (a *Auth) GetFeedCredentialsKey() ([]byte, error) {
+	if a.FeedCredentialsKey == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(a.FeedCredentialsKey)
+	if err != nil {
+		return nil, fmt.Errorf("feed_credentials_key is not valid base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("feed_credentials_key must be 32 bytes, got %d", len(key))
+	}
+
+	return key, nil
 }
 
+// validateSigningKeys checks that every signing key has a file and a unique kid
+func (a *Auth) validateSigningKeys() error {
+	ids := make(map[string]bool, len(a.SigningKeys))
+	for _, key := range a.SigningKeys {
+		if key.ID == "" || key.File == "" {
+			return fmt.Errorf("signing key needs a kid and a file")
+		}
+		if ids[key.ID] {
+			return fmt.Errorf("signing key '%s' is configured twice", key.ID)
+		}
+		ids[key.ID] = true
+	}
+
+	return nil
+}
+
+// Server configures the HTTP server. Logging enables the access log, LogLevel is one of "debug", "info" (default),
+// "warn" and "error" and LogFormat prints the logs as "json" (default) or "text" (logfmt).
 type Server struct {
 	Host      string
 	Port      int
 	Logging   bool
 	LogLevel  string `toml:"log_level"`
 	LogFormat string `toml:"log_format"`
+	// ShutdownTimeout bounds the graceful shutdown, requests still running afterwards are aborted
+	ShutdownTimeout string `toml:"shutdown_timeout"`
+	// AdminPort serves /metrics on a separate port, e.g. one not exposed to the internet.
+	// If 0, /metrics is served on Port.
+	AdminPort int `toml:"admin_port"`
+	// DrainDelay keeps accepting requests after a SIGTERM while /readyz fails, so the load balancer
+	// takes the server out of rotation before it stops listening. Set it to the probe interval.
+	DrainDelay string `toml:"drain_delay"`
+}
+
+// Sync configures the background feed refresh. Feeds not synced within Interval are refreshed
+// by Workers concurrent workers, at most BatchSize feeds per run.
+type Sync struct {
+	Enabled   bool
+	Interval  string
+	Workers   int
+	BatchSize int `toml:"batch_size"`
+	// AllowPrivateAddresses lets feeds be downloaded from loopback, private and link-local addresses,
+	// e.g. a podcast server in the home network of a self-hosted setup. Never enable it for public instances.
+	AllowPrivateAddresses bool `toml:"allow_private_addresses"`
+}
+
+// Tracing configures OpenTelemetry. The "none" exporter (default) disables tracing, "stdout" prints the spans
+// and "otlp" sends them via OTLP/HTTP to Endpoint, e.g. "localhost:4318" of an OpenTelemetry Collector.
+type Tracing struct {
+	Exporter    string
+	Endpoint    string
+	Insecure    bool
+	ServiceName string `toml:"service_name"`
+	// SampleRatio is the share of traces recorded, 0 means all. Requests of a sampled parent are always recorded.
+	SampleRatio float64 `toml:"sample_ratio"`
+}
+
+type Redis struct {
+	Address  string
+	Password string
+	DB       int
+}
+
+// Mail configures how mails are delivered. The "log" driver (default) prints them to stdout,
+// "file" stores them in Directory and "smtp" sends them via the server at Host:Port.
+type Mail struct {
+	Driver    string
+	From      string
+	Host      string
+	Port      int
+	Username  string
+	Password  string
+	Directory string
+}
+
+// OAuth configures the OpenID Connect providers users can sign in with
+type OAuth struct {
+	// RedirectURIs are the client pages and app schemes a login may return to, e.g. "pcast://login".
+	// Loopback URIs like "http://127.0.0.1/callback" match any port (RFC 8252).
+	RedirectURIs []string `toml:"redirect_uris"`
+	Providers    []OAuthProvider
+}
+
+// OAuthProvider is an OpenID Connect provider like Google, Keycloak or Authentik.
+// The endpoints are discovered from Issuer + "/.well-known/openid-configuration".
+type OAuthProvider struct {
+	// Name identifies the provider in the login URL /api/auth/{name} and in the linked identities
+	Name         string
+	DisplayName  string `toml:"display_name"`
+	Issuer       string
+	ClientID     string `toml:"client_id"`
+	ClientSecret string `toml:"client_secret"`
+	RedirectURL  string `toml:"redirect_url"`
+	// Scopes requested from the provider, DefaultOAuthScopes if empty
+	Scopes []string
+	// LinkByEmail signs new identities in to the verified account with the same email. Only enable it for
+	// providers that verify the addresses they report, otherwise users have to sign in and link the identity.
+	LinkByEmail bool `toml:"link_by_email"`
 }
 
 type Database struct {
@@ -67,13 +280,221 @@ func New(file string) (*Config, error) {
 		return nil, fmt.Errorf("config file '%s' is not valid: %w", file, err)
 	}
 
+	if _, err := cfg.Auth.GetFeedCredentialsKey(); err != nil {
+		return nil, fmt.Errorf("config file '%s' is not valid: %w", file, err)
+	}
+
 	if cfg.Auth.JwtExpirationMin == 0 {
 		cfg.Auth.JwtExpirationMin = DefaultJWTExpirationMin
 	}
+	if cfg.Auth.RefreshExpirationDays == 0 {
+		cfg.Auth.RefreshExpirationDays = DefaultRefreshExpirationDays
+	}
+
+	if cfg.Auth.PasswordResetExpirationMin == 0 {
+		cfg.Auth.PasswordResetExpirationMin = DefaultPasswordResetExpirationMin
+	}
+
+	if cfg.Auth.EmailVerificationExpirationHours == 0 {
+		cfg.Auth.EmailVerificationExpirationHours = DefaultEmailVerificationExpirationHours
+	}
+
+	if err := cfg.Auth.validateSigningKeys(); err != nil {
+		return nil, fmt.Errorf("config file '%s' is not valid: %w", file, err)
+	}
+
+	switch cfg.Auth.RevocationStore {
+	case "":
+		cfg.Auth.RevocationStore = RevocationStorePostgres
+	case RevocationStorePostgres, RevocationStoreRedis:
+	default:
+		return nil, fmt.Errorf("config file '%s' is not valid: unknown revocation_store '%s'", file, cfg.Auth.RevocationStore)
+	}
+
+	switch cfg.Mail.Driver {
+	case "":
+		cfg.Mail.Driver = MailDriverLog
+	case MailDriverLog, MailDriverFile, MailDriverSMTP:
+	default:
+		return nil, fmt.Errorf("config file '%s' is not valid: unknown mail driver '%s'", file, cfg.Mail.Driver)
+	}
+	if cfg.Mail.From == "" {
+		cfg.Mail.From = DefaultMailFrom
+	}
+
+	if err := cfg.OAuth.setDefaults(&cfg.Auth); err != nil {
+		return nil, fmt.Errorf("config file '%s' is not valid: %w", file, err)
+	}
+
+	switch cfg.Tracing.Exporter {
+	case "":
+		cfg.Tracing.Exporter = TracingExporterNone
+	case TracingExporterNone, TracingExporterStdout, TracingExporterOTLP:
+	default:
+		return nil, fmt.Errorf("config file '%s' is not valid: unknown tracing exporter '%s'", file, cfg.Tracing.Exporter)
+	}
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = DefaultTracingServiceName
+	}
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		return nil, fmt.Errorf("config file '%s' is not valid: tracing sample_ratio must be between 0 and 1", file)
+	}
+
+	switch cfg.Server.LogFormat {
+	case "":
+		cfg.Server.LogFormat = LogFormatJSON
+	case LogFormatJSON, LogFormatText:
+	default:
+		return nil, fmt.Errorf("config file '%s' is not valid: unknown log_format '%s'", file, cfg.Server.LogFormat)
+	}
+
+	if cfg.Server.ShutdownTimeout == "" {
+		cfg.Server.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if _, err := cfg.Server.GetShutdownTimeout(); err != nil {
+		return nil, fmt.Errorf("config file '%s' is not valid: %w", file, err)
+	}
+	if cfg.Server.DrainDelay == "" {
+		cfg.Server.DrainDelay = DefaultDrainDelay
+	}
+	if _, err := cfg.Server.GetDrainDelay(); err != nil {
+		return nil, fmt.Errorf("config file '%s' is not valid: %w", file, err)
+	}
+
+	if cfg.Sync.Interval == "" {
+		cfg.Sync.Interval = DefaultSyncInterval
+	}
+	if cfg.Sync.Workers == 0 {
+		cfg.Sync.Workers = DefaultSyncWorkers
+	}
+	if cfg.Sync.BatchSize == 0 {
+		cfg.Sync.BatchSize = DefaultSyncBatchSize
+	}
+	if err := cfg.Sync.validate(); err != nil {
+		return nil, fmt.Errorf("config file '%s' is not valid: %w", file, err)
+	}
+
+	if len(cfg.Auth.JwtSecret) < MinJWTSecretLength {
+		return nil, fmt.Errorf("config file '%s' is not valid: auth jwt_secret must be at least %d characters", file, MinJWTSecretLength)
+	}
 
 	return &cfg, nil
 }
 
+// setDefaults adds the provider of the deprecated google_* settings, fills in the default scopes
+// and checks that every provider has a unique name, an issuer and a client ID
+func (o *OAuth) setDefaults(a *Auth) error {
+	for _, uri := range o.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || u.Scheme == "" || u.Fragment != "" {
+			return fmt.Errorf("oauth redirect uri '%s' must be an absolute URI without fragment", uri)
+		}
+	}
+
+	if a.GoogleClientID != "" && a.GoogleClientSecret != "" && o.Provider("google") == nil {
+		o.Providers = append(o.Providers, OAuthProvider{
+			Name:         "google",
+			DisplayName:  "Google",
+			Issuer:       GoogleIssuer,
+			ClientID:     a.GoogleClientID,
+			ClientSecret: a.GoogleClientSecret,
+			RedirectURL:  a.GoogleRedirectURL,
+		})
+	}
+
+	names := make(map[string]bool, len(o.Providers))
+	for i := range o.Providers {
+		p := &o.Providers[i]
+		if !oauthProviderName.MatchString(p.Name) {
+			return fmt.Errorf("oauth provider name '%s' must only contain a-z, 0-9, _ and -", p.Name)
+		}
+		// /api/auth/providers lists the providers
+		if p.Name == "providers" {
+			return fmt.Errorf("oauth provider name '%s' is reserved", p.Name)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("oauth provider '%s' is configured twice", p.Name)
+		}
+		names[p.Name] = true
+
+		if p.Issuer == "" || p.ClientID == "" {
+			return fmt.Errorf("oauth provider '%s' needs an issuer and a client_id", p.Name)
+		}
+		if p.DisplayName == "" {
+			p.DisplayName = p.Name
+		}
+		if len(p.Scopes) == 0 {
+			p.Scopes = DefaultOAuthScopes
+		}
+	}
+
+	return nil
+}
+
+// Provider returns the provider with the given name, nil if there is none
+func (o *OAuth) Provider(name string) *OAuthProvider {
+	for i := range o.Providers {
+		if o.Providers[i].Name == name {
+			return &o.Providers[i]
+		}
+	}
+	return nil
+}
+
 func (s *Server) GetAddress() string {
 	return fmt.Sprintf("%s:%d", s.Host, s.Port)
 }
+
+// GetAdminAddress returns the address of the admin port
+func (s *Server) GetAdminAddress() string {
+	return fmt.Sprintf("%s:%d", s.Host, s.AdminPort)
+}
+
+// GetInterval parses the sync interval
+func (s *Sync) GetInterval() (time.Duration, error) {
+	interval, err := time.ParseDuration(s.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("sync interval '%s' is not a valid duration: %w", s.Interval, err)
+	}
+
+	return interval, nil
+}
+
+// validate rejects values the scheduler cannot run with, a ticker needs a positive interval
+func (s *Sync) validate() error {
+	interval, err := s.GetInterval()
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return fmt.Errorf("sync interval '%s' must be positive", s.Interval)
+	}
+	if s.Workers < 0 {
+		return fmt.Errorf("sync workers must be positive")
+	}
+	if s.BatchSize < 0 {
+		return fmt.Errorf("sync batch_size must be positive")
+	}
+
+	return nil
+}
+
+// GetShutdownTimeout parses the shutdown timeout
+func (s *Server) GetShutdownTimeout() (time.Duration, error) {
+	timeout, err := time.ParseDuration(s.ShutdownTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("shutdown_timeout '%s' is not a valid duration: %w", s.ShutdownTimeout, err)
+	}
+
+	return timeout, nil
+}
+
+// GetDrainDelay parses the drain delay
+func (s *Server) GetDrainDelay() (time.Duration, error) {
+	delay, err := time.ParseDuration(s.DrainDelay)
+	if err != nil {
+		return 0, fmt.Errorf("drain_delay '%s' is not a valid duration: %w", s.DrainDelay, err)
+	}
+
+	return delay, nil
+}
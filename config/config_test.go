@@ -1,12 +1,18 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// validAuth is the smallest [auth] section config.New accepts
+const validAuth = "[auth]\njwt_secret = \"0123456789abcdef0123456789abcdef\"\n"
+
 func TestNew(t *testing.T) {
 	cfg, err := New("./../fixtures/test/config.toml")
 	require.NoError(t, err)
@@ -16,7 +22,7 @@ func TestNew(t *testing.T) {
 	assert.Equal(t, 3000, cfg.Server.Port)
 	assert.Equal(t, true, cfg.Server.Logging)
 	assert.Equal(t, "log_level", cfg.Server.LogLevel)
-	assert.Equal(t, "log_format", cfg.Server.LogFormat)
+	assert.Equal(t, LogFormatText, cfg.Server.LogFormat)
 	assert.Equal(t, false, cfg.Database.Logging)
 	assert.Equal(t, "localhost:3000", cfg.Server.GetAddress())
 	assert.Equal(t, "host=localhost port=1337 user=pcast password=pcast dbname=pcast sslmode=disable TimeZone=Europe/Berlin", cfg.Database.GetPostgresDSN())
@@ -27,6 +33,31 @@ func TestNew(t *testing.T) {
 	assert.Equal(t, 10, cfg.Database.MaxConnections)
 	assert.Equal(t, 5, cfg.Database.MaxIdleConnections)
 	assert.Equal(t, "5m", cfg.Database.MaxLifetime)
+	assert.Equal(t, true, cfg.Sync.Enabled)
+	assert.Equal(t, "15m", cfg.Sync.Interval)
+	assert.Equal(t, RevocationStoreRedis, cfg.Auth.RevocationStore)
+	assert.Equal(t, "localhost:6379", cfg.Redis.Address)
+	assert.Equal(t, 1, cfg.Redis.DB)
+	assert.Equal(t, MailDriverFile, cfg.Mail.Driver)
+	assert.Equal(t, "pcast test <test@pcast.local>", cfg.Mail.From)
+	assert.Equal(t, "tmp/mails", cfg.Mail.Directory)
+	assert.Equal(t, "http://localhost:3000/reset-password", cfg.Auth.PasswordResetURL)
+	assert.Equal(t, true, cfg.Auth.RequireEmailVerification)
+	assert.Equal(t, "http://localhost:3000/verify-email", cfg.Auth.EmailVerificationURL)
+	assert.Equal(t, DefaultEmailVerificationExpirationHours, cfg.Auth.EmailVerificationExpirationHours)
+	assert.Equal(t, []SigningKey{{ID: "2026-02", File: "keys/2026-02.pem"}, {ID: "2026-01", File: "keys/2026-01.pem"}}, cfg.Auth.SigningKeys)
+	assert.Equal(t, []string{"pcast://login", "http://127.0.0.1/callback"}, cfg.OAuth.RedirectURIs)
+	require.Len(t, cfg.OAuth.Providers, 1)
+	assert.Equal(t, OAuthProvider{
+		Name:         "keycloak",
+		DisplayName:  "Keycloak",
+		Issuer:       "http://localhost:8180/realms/pcast",
+		ClientID:     "pcast",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:3000/api/auth/keycloak/callback",
+		Scopes:       DefaultOAuthScopes,
+		LinkByEmail:  true,
+	}, cfg.OAuth.Providers[0])
 }
 
 func TestNew_FileNotFound(t *testing.T) {
@@ -40,4 +71,238 @@ func TestNew_DefaultJWTExpiration(t *testing.T) {
 	cfg, err := New("./../fixtures/test/config.toml")
 	require.NoError(t, err)
 	assert.Equal(t, DefaultJWTExpirationMin, cfg.Auth.JwtExpirationMin)
+	assert.Equal(t, DefaultRefreshExpirationDays, cfg.Auth.RefreshExpirationDays)
+}
+
+func TestNew_DefaultSync(t *testing.T) {
+	cfg, err := New("./../fixtures/test/config.toml")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultSyncWorkers, cfg.Sync.Workers)
+	assert.Equal(t, DefaultSyncBatchSize, cfg.Sync.BatchSize)
+}
+
+func TestNew_InvalidSync(t *testing.T) {
+	for name, content := range map[string]string{
+		"interval":      "[sync]\ninterval = \"often\"\n",
+		"zero interval": "[sync]\ninterval = \"0s\"\n",
+		"negative":      "[sync]\ninterval = \"-1m\"\n",
+		"workers":       "[sync]\nworkers = -1\n",
+		"batch_size":    "[sync]\nbatch_size = -10\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "config.toml")
+			require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+
+			cfg, err := New(file)
+			assert.Error(t, err)
+			assert.Nil(t, cfg)
+			assert.Contains(t, err.Error(), "sync")
+		})
+	}
+}
+
+func TestNew_DefaultShutdownTimeout(t *testing.T) {
+	cfg, err := New("./../fixtures/test/config.toml")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultShutdownTimeout, cfg.Server.ShutdownTimeout)
+
+	timeout, err := cfg.Server.GetShutdownTimeout()
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, timeout)
+
+	delay, err := cfg.Server.GetDrainDelay()
+	require.NoError(t, err)
+	assert.Zero(t, delay)
+}
+
+func TestNew_InvalidShutdownTimeout(t *testing.T) {
+	for name, content := range map[string]string{
+		"shutdown_timeout": "[server]\nshutdown_timeout = \"soon\"\n",
+		"drain_delay":      "[server]\ndrain_delay = \"10\"\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "config.toml")
+			require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+
+			cfg, err := New(file)
+			assert.Error(t, err)
+			assert.Nil(t, cfg)
+			assert.Contains(t, err.Error(), name)
+		})
+	}
+}
+
+func TestAuth_GetFeedCredentialsKey(t *testing.T) {
+	cfg, err := New("./../fixtures/test/config.toml")
+	require.NoError(t, err)
+
+	key, err := cfg.Auth.GetFeedCredentialsKey()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("0123456789abcdef0123456789abcdef"), key)
+}
+
+func TestAuth_GetFeedCredentialsKey_Invalid(t *testing.T) {
+	key, err := (&Auth{}).GetFeedCredentialsKey()
+	assert.NoError(t, err)
+	assert.Nil(t, key)
+
+	_, err = (&Auth{FeedCredentialsKey: "not base64!"}).GetFeedCredentialsKey()
+	assert.Error(t, err)
+
+	_, err = (&Auth{FeedCredentialsKey: "c2hvcnQ="}).GetFeedCredentialsKey()
+	assert.Error(t, err)
+}
+
+func TestNew_InvalidRevocationStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(file, []byte("[auth]\nrevocation_store = \"memcached\"\n"), 0o600))
+
+	cfg, err := New(file)
+	assert.Error(t, err)
+	assert.Nil(t, cfg)
+	assert.Contains(t, err.Error(), "revocation_store")
+}
+
+func TestNew_InvalidSigningKeys(t *testing.T) {
+	for name, content := range map[string]string{
+		"kid":       "[[auth.signing_keys]]\nfile = \"key.pem\"\n",
+		"file":      "[[auth.signing_keys]]\nkid = \"2026-01\"\n",
+		"duplicate": "[[auth.signing_keys]]\nkid = \"2026-01\"\nfile = \"a.pem\"\n[[auth.signing_keys]]\nkid = \"2026-01\"\nfile = \"b.pem\"\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "config.toml")
+			require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+
+			cfg, err := New(file)
+			assert.Error(t, err)
+			assert.Nil(t, cfg)
+			assert.Contains(t, err.Error(), "signing key")
+		})
+	}
+}
+
+func TestNew_InvalidJWTSecret(t *testing.T) {
+	for name, content := range map[string]string{
+		// Only signing keys, the internal tokens would be signed with a key anyone can compute
+		"missing": "[[auth.signing_keys]]\nkid = \"2026-01\"\nfile = \"key.pem\"\n",
+		"short":   "[auth]\njwt_secret = \"secret\"\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "config.toml")
+			require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+
+			cfg, err := New(file)
+			assert.Error(t, err)
+			assert.Nil(t, cfg)
+			assert.Contains(t, err.Error(), "jwt_secret")
+		})
+	}
+}
+
+func TestNew_DefaultRevocationStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(file, []byte(validAuth), 0o600))
+
+	cfg, err := New(file)
+	require.NoError(t, err)
+	assert.Equal(t, RevocationStorePostgres, cfg.Auth.RevocationStore)
+}
+
+func TestNew_DefaultMail(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(file, []byte(validAuth), 0o600))
+
+	cfg, err := New(file)
+	require.NoError(t, err)
+	assert.Equal(t, MailDriverLog, cfg.Mail.Driver)
+	assert.Equal(t, DefaultMailFrom, cfg.Mail.From)
+	assert.Equal(t, DefaultPasswordResetExpirationMin, cfg.Auth.PasswordResetExpirationMin)
+}
+
+func TestNew_DefaultLogFormat(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(file, []byte(validAuth+"[server]\nport = 8080\n"), 0o600))
+
+	cfg, err := New(file)
+	require.NoError(t, err)
+	assert.Equal(t, LogFormatJSON, cfg.Server.LogFormat)
+}
+
+func TestNew_InvalidLogFormat(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(file, []byte(validAuth+"[server]\nlog_format = \"${remote_ip} ${status}\"\n"), 0o600))
+
+	cfg, err := New(file)
+	assert.Error(t, err)
+	assert.Nil(t, cfg)
+	assert.Contains(t, err.Error(), "log_format")
+}
+
+func TestNew_DefaultTracing(t *testing.T) {
+	cfg, err := New("./../fixtures/test/config.toml")
+	require.NoError(t, err)
+	assert.Equal(t, TracingExporterNone, cfg.Tracing.Exporter)
+	assert.Equal(t, DefaultTracingServiceName, cfg.Tracing.ServiceName)
+}
+
+func TestNew_InvalidTracing(t *testing.T) {
+	for name, content := range map[string]string{
+		"exporter":     "[tracing]\nexporter = \"zipkin\"\n",
+		"sample_ratio": "[tracing]\nsample_ratio = 2.0\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "config.toml")
+			require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+
+			cfg, err := New(file)
+			assert.Error(t, err)
+			assert.Nil(t, cfg)
+			assert.Contains(t, err.Error(), "tracing")
+		})
+	}
+}
+
+func TestNew_InvalidMailDriver(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(file, []byte("[mail]\ndriver = \"pigeon\"\n"), 0o600))
+
+	cfg, err := New(file)
+	assert.Error(t, err)
+	assert.Nil(t, cfg)
+	assert.Contains(t, err.Error(), "mail driver")
+}
+
+func TestNew_LegacyGoogleProvider(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.toml")
+	content := validAuth + "google_client_id = \"id\"\ngoogle_client_secret = \"secret\"\ngoogle_redirect_url = \"http://localhost/callback\"\n"
+	require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+
+	cfg, err := New(file)
+	require.NoError(t, err)
+	google := cfg.OAuth.Provider("google")
+	require.NotNil(t, google)
+	assert.Equal(t, GoogleIssuer, google.Issuer)
+	assert.Equal(t, "id", google.ClientID)
+	assert.Equal(t, "http://localhost/callback", google.RedirectURL)
+	assert.Equal(t, DefaultOAuthScopes, google.Scopes)
+}
+
+func TestNew_InvalidOAuthProvider(t *testing.T) {
+	for name, content := range map[string]string{
+		"name":      "[[oauth.providers]]\nname = \"Key Cloak\"\nissuer = \"http://localhost\"\nclient_id = \"id\"\n",
+		"issuer":    "[[oauth.providers]]\nname = \"keycloak\"\nclient_id = \"id\"\n",
+		"reserved":  "[[oauth.providers]]\nname = \"providers\"\nissuer = \"http://localhost\"\nclient_id = \"id\"\n",
+		"duplicate": "[[oauth.providers]]\nname = \"a\"\nissuer = \"http://localhost\"\nclient_id = \"id\"\n[[oauth.providers]]\nname = \"a\"\nissuer = \"http://localhost\"\nclient_id = \"id\"\n",
+		"redirect":  "[oauth]\nredirect_uris = [\"/login\"]\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "config.toml")
+			require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+
+			cfg, err := New(file)
+			assert.Error(t, err)
+			assert.Nil(t, cfg)
+			assert.Contains(t, err.Error(), "oauth ")
+		})
+	}
 }
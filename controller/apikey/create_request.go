@@ -0,0 +1,13 @@
+package apikey
+
+import "time"
+
+// CreateRequest creates an API key with the given scopes
+// @model CreateRequest
+type CreateRequest struct {
+	Name string `json:"name" validate:"required,max=255"`
+	// Scopes are any of feeds:read, feeds:write, episodes:read and episodes:write
+	Scopes []string `json:"scopes" validate:"required,min=1"`
+	// ExpiresAt is empty for a key that does not expire
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,127 @@
+package apikey
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/samber/lo"
+
+	serviceInterface "pcast-api/controller/service_interface"
+	authMiddleware "pcast-api/middleware/auth"
+	apikeyService "pcast-api/service/apikey"
+	"pcast-api/store/apikey"
+)
+
+type Handler struct {
+	service    serviceInterface.APIKey
+	middleware *authMiddleware.JWTMiddleware
+}
+
+func NewHandler(service serviceInterface.APIKey, middleware *authMiddleware.JWTMiddleware) *Handler {
+	return &Handler{service: service, middleware: middleware}
+}
+
+// Register adds the routes to manage API keys. They have no scope, so API keys cannot manage API keys.
+func (h *Handler) Register(g *echo.Group) {
+	g.GET("/user/api-keys", h.getAPIKeys)
+	g.POST("/user/api-keys", h.createAPIKey)
+	g.DELETE("/user/api-keys/:id", h.deleteAPIKey)
+}
+
+// getAPIKeys godoc
+// @Summary List API keys
+// @Description Lists the personal API keys of the user
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "User ID"
+// @Success 200 {array} Presenter
+// @Router /user/api-keys [get]
+func (h *Handler) getAPIKeys(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	keys, err := h.service.List(c.Request().Context(), *userID)
+	if err != nil {
+		slog.ErrorContext(c.Request().Context(), "store error", "error", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	return c.JSON(http.StatusOK, lo.Map(keys, func(key apikey.APIKey, _ int) *Presenter {
+		return NewPresenter(&key)
+	}))
+}
+
+// createAPIKey godoc
+// @Summary Create an API key
+// @Description Creates a personal API key for scripts and integrations. It is sent as "Authorization: Bearer <key>"
+// @Description and can only access the routes of its scopes. The key is only returned in this response.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User ID"
+// @Param key body CreateRequest true "CreateRequest data"
+// @Success 201 {object} CreatedPresenter
+// @Failure 400 {object} map[string]string
+// @Router /user/api-keys [post]
+func (h *Handler) createAPIKey(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	req := new(CreateRequest)
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	apiKey, key, err := h.service.Create(c.Request().Context(), *userID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, apikeyService.ErrInvalidScope) || errors.Is(err, apikeyService.ErrNoScopes) || errors.Is(err, apikeyService.ErrExpiryInPast) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		slog.ErrorContext(c.Request().Context(), "store error", "error", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	return c.JSON(http.StatusCreated, &CreatedPresenter{Presenter: *NewPresenter(apiKey), Key: key})
+}
+
+// deleteAPIKey godoc
+// @Summary Delete an API key
+// @Description Revokes the API key, requests with it are rejected immediately
+// @Tags user
+// @Param Authorization header string true "User ID"
+// @Param id path string true "API key ID"
+// @Success 204 "API key deleted"
+// @Failure 404 "API key not found"
+// @Router /user/api-keys/{id} [delete]
+func (h *Handler) deleteAPIKey(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+
+	if err := h.service.Delete(c.Request().Context(), *userID, id); err != nil {
+		if errors.Is(err, apikeyService.ErrAPIKeyNotFound) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		slog.ErrorContext(c.Request().Context(), "store error", "error", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
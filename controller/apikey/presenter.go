@@ -0,0 +1,41 @@
+package apikey
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"pcast-api/store/apikey"
+)
+
+// Presenter represents an API key, the key itself is only returned on creation
+// @model Presenter
+type Presenter struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	// Prefix is the start of the key, so users can tell their keys apart
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+func NewPresenter(key *apikey.APIKey) *Presenter {
+	return &Presenter{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.KeyPrefix,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+	}
+}
+
+// CreatedPresenter represents a new API key. Key is shown only once, it is sent as "Authorization: Bearer <key>".
+// @model CreatedPresenter
+type CreatedPresenter struct {
+	Presenter
+	Key string `json:"key"`
+}
@@ -1,67 +1,291 @@
 package controller
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
 
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
 
 	"pcast-api/config"
+	"pcast-api/controller/apikey"
+	"pcast-api/controller/episode"
+	"pcast-api/controller/export"
 	"pcast-api/controller/feed"
+	"pcast-api/controller/health"
+	"pcast-api/controller/jwks"
 	"pcast-api/controller/oauth"
 	"pcast-api/controller/user"
+	"pcast-api/db"
 	authMiddleware "pcast-api/middleware/auth"
+	apikeyService "pcast-api/service/apikey"
+	"pcast-api/service/auth"
+	episodeService "pcast-api/service/episode"
+	exportService "pcast-api/service/export"
 	feedService "pcast-api/service/feed"
+	healthService "pcast-api/service/health"
+	"pcast-api/service/mail"
+	modelInterface "pcast-api/service/model_interface"
 	oauthService "pcast-api/service/oauth"
 	userService "pcast-api/service/user"
+	apiKeyStore "pcast-api/store/apikey"
+	emailVerificationStore "pcast-api/store/emailverification"
+	episodeStore "pcast-api/store/episode"
 	feedStore "pcast-api/store/feed"
+	identityStore "pcast-api/store/identity"
+	passwordResetStore "pcast-api/store/passwordreset"
+	recoveryCodeStore "pcast-api/store/recoverycode"
+	revocationStore "pcast-api/store/revocation"
+	tokenStore "pcast-api/store/token"
 	userStore "pcast-api/store/user"
+	"pcast-api/tracing"
 )
 
-// NewController initializes all handlers
-func NewController(config *config.Config, db *sql.DB, g *echo.Group) {
-	middleware := authMiddleware.NewJWTMiddleware([]byte(config.Auth.JwtSecret))
+// feedFetchTimeout bounds the download of a single feed during sync
+const feedFetchTimeout = 30 * time.Second
+
+// oauthTimeout bounds every request to an OpenID Connect provider
+const oauthTimeout = 10 * time.Second
+
+// NewController initializes all handlers, the API is served below /api
+func NewController(config *config.Config, db *sql.DB, e *echo.Echo) error {
+	g := e.Group("/api")
+	middleware := authMiddleware.NewJWTMiddleware()
+
+	keys, err := newKeys(config)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := newTokenService(config, db, keys)
+	if err != nil {
+		return err
+	}
+
+	apiKeys := apikeyService.NewService(apiKeyStore.New(db))
 
 	protected := g.Group("")
 	protected.Use(echojwt.WithConfig(echojwt.Config{
-		SigningKey: []byte(config.Auth.JwtSecret),
+		KeyFunc: keys.Keyfunc,
+		// API keys are checked below
+		Skipper: func(c echo.Context) bool {
+			return apikeyService.IsAPIKey(authMiddleware.BearerToken(c))
+		},
 	}))
 	protected.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			userID, err := middleware.ExtractUserID(c)
+			if key := authMiddleware.BearerToken(c); apikeyService.IsAPIKey(key) {
+				apiKey, err := apiKeys.Authenticate(c.Request().Context(), key)
+				if err != nil {
+					return echo.ErrUnauthorized
+				}
+
+				middleware.SetAPIKey(c, &authMiddleware.APIKeyClaims{UserID: apiKey.UserID, Scopes: apiKey.Scopes})
+				return next(c)
+			}
+
+			claims, err := middleware.ExtractClaims(c)
 			if err != nil {
 				return err
 			}
-			middleware.SetUserID(c, *userID)
+
+			revoked, err := tokens.IsRevoked(c.Request().Context(), claims.UserID, claims.ID, claims.IssuedAt)
+			if err != nil {
+				return err
+			}
+			if revoked {
+				return echo.ErrUnauthorized
+			}
+
+			middleware.SetUserID(c, claims.UserID)
+			middleware.SetClaims(c, claims)
 			return next(c)
 		}
 	})
 
-	newFeedHandler(db, protected, middleware)
-	newUserHandler(config, db, g, protected, middleware)
-	newOAuthHandler(config, db, g)
+	if err := newFeedHandler(config, db, protected, middleware); err != nil {
+		return err
+	}
+	newEpisodeHandler(db, protected, middleware)
+	if err := newUserHandler(config, db, tokens, g, protected, middleware); err != nil {
+		return err
+	}
+	newOAuthHandler(config, db, tokens, g, protected, middleware)
+	apiKeyHandler := apikey.NewHandler(apiKeys, middleware)
+	apiKeyHandler.Register(protected)
+	newExportHandler(db, protected, middleware)
+	jwksHandler := jwks.NewHandler(keys)
+	jwksHandler.Register(e)
+
+	return nil
 }
 
-func newFeedHandler(db *sql.DB, g *echo.Group, middleware *authMiddleware.JWTMiddleware) {
+// NewFeedScheduler creates the background feed refresh configured in the [sync] section
+func NewFeedScheduler(config *config.Config, db *sql.DB) (*feedService.Scheduler, error) {
+	interval, err := config.Sync.GetInterval()
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := newFeedService(config, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return feedService.NewScheduler(service, interval, config.Sync.Workers, config.Sync.BatchSize), nil
+}
+
+// NewHealthHandler adds the liveness and readiness probes. The returned service reports the server
+// as unavailable once it is drained.
+func NewHealthHandler(database *sql.DB, e *echo.Echo) (*healthService.Service, error) {
+	expected, err := db.ExpectedMigrationVersion()
+	if err != nil {
+		return nil, err
+	}
+	migrationVersion := func(ctx context.Context) (int64, error) {
+		return db.MigrationVersion(ctx, database)
+	}
+
+	service := healthService.NewService(healthService.DatabaseCheck(database), healthService.MigrationCheck(migrationVersion, expected))
+	handler := health.NewHandler(service)
+
+	handler.Register(e)
+	return service, nil
+}
+
+// newCipher creates the cipher for secrets of purpose from auth.feed_credentials_key, nil if no key is configured
+func newCipher(config *config.Config, purpose string) (*auth.Cipher, error) {
+	key, err := config.Auth.GetFeedCredentialsKey()
+	if err != nil || key == nil {
+		return nil, err
+	}
+
+	return auth.NewCipher(key, purpose)
+}
+
+func newFeedService(config *config.Config, db *sql.DB) (*feedService.Service, error) {
+	cipher, err := newCipher(config, auth.PurposeFeedCredentials)
+	if err != nil {
+		return nil, err
+	}
+
 	store := feedStore.New(db)
-	service := feedService.NewService(store)
+	fetcher := feedService.NewFetcher(&http.Client{
+		Timeout:   feedFetchTimeout,
+		Transport: tracing.Transport(feedService.NewTransport(config.Sync.AllowPrivateAddresses)),
+	})
+
+	return feedService.NewService(store, episodeStore.New(db), fetcher, cipher), nil
+}
+
+func newFeedHandler(config *config.Config, db *sql.DB, g *echo.Group, middleware *authMiddleware.JWTMiddleware) error {
+	service, err := newFeedService(config, db)
+	if err != nil {
+		return err
+	}
 	handler := feed.NewHandler(service, middleware)
 
 	handler.Register(g)
+	return nil
+}
+
+func newEpisodeHandler(db *sql.DB, g *echo.Group, middleware *authMiddleware.JWTMiddleware) {
+	store := episodeStore.New(db)
+	service := episodeService.NewService(store, feedStore.New(db))
+	handler := episode.NewHandler(service, middleware)
+
+	handler.Register(g)
+}
+
+func newExportHandler(db *sql.DB, g *echo.Group, middleware *authMiddleware.JWTMiddleware) {
+	service := exportService.NewService(userStore.New(db), identityStore.New(db), feedStore.New(db), episodeStore.New(db))
+	handler := export.NewHandler(service, middleware)
+
+	handler.Register(g)
+}
+
+func newTokenService(config *config.Config, db *sql.DB, keys *auth.Keys) (*auth.TokenService, error) {
+	revocations, err := newRevocationStore(config, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.NewTokenService(tokenStore.New(db), revocations, keys, config.Auth.JwtExpirationMin, config.Auth.RefreshExpirationDays), nil
 }
 
-func newUserHandler(config *config.Config, db *sql.DB, public *echo.Group, protected *echo.Group, middleware *authMiddleware.JWTMiddleware) {
+// newKeys loads the signing keys configured in auth.signing_keys
+func newKeys(config *config.Config) (*auth.Keys, error) {
+	signingKeys := make([]*auth.SigningKey, len(config.Auth.SigningKeys))
+	for i, key := range config.Auth.SigningKeys {
+		signingKey, err := auth.LoadSigningKey(key.ID, key.File)
+		if err != nil {
+			return nil, err
+		}
+		signingKeys[i] = signingKey
+	}
+
+	return auth.NewKeys(config.Auth.JwtSecret, signingKeys...)
+}
+
+// newRevocationStore creates the store of revoked access tokens configured in auth.revocation_store
+func newRevocationStore(cfg *config.Config, db *sql.DB) (modelInterface.Revocation, error) {
+	switch cfg.Auth.RevocationStore {
+	case "", config.RevocationStorePostgres:
+		return revocationStore.New(db), nil
+	case config.RevocationStoreRedis:
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Address,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		tokenLifetime := time.Duration(cfg.Auth.JwtExpirationMin) * time.Minute
+		return revocationStore.NewRedis(client, tokenLifetime), nil
+	default:
+		return nil, fmt.Errorf("unknown revocation store '%s'", cfg.Auth.RevocationStore)
+	}
+}
+
+// newMailer creates the mailer configured in the [mail] section
+func newMailer(cfg *config.Config) (mail.Mailer, error) {
+	switch cfg.Mail.Driver {
+	case "", config.MailDriverLog:
+		return mail.NewLogMailer(os.Stdout, cfg.Mail.From), nil
+	case config.MailDriverFile:
+		return mail.NewFileMailer(cfg.Mail.Directory, cfg.Mail.From), nil
+	case config.MailDriverSMTP:
+		return mail.NewSMTPMailer(cfg.Mail.Host, cfg.Mail.Port, cfg.Mail.Username, cfg.Mail.Password, cfg.Mail.From), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver '%s'", cfg.Mail.Driver)
+	}
+}
+
+func newUserHandler(config *config.Config, db *sql.DB, tokens *auth.TokenService, public *echo.Group, protected *echo.Group, middleware *authMiddleware.JWTMiddleware) error {
+	mailer, err := newMailer(config)
+	if err != nil {
+		return err
+	}
+	cipher, err := newCipher(config, auth.PurposeTOTPSecret)
+	if err != nil {
+		return err
+	}
+
 	store := userStore.New(db)
-	service := userService.NewService(store, config.Auth.JwtSecret, config.Auth.JwtExpirationMin)
+	service := userService.NewService(config, store, tokens, passwordResetStore.New(db), emailVerificationStore.New(db), recoveryCodeStore.New(db), cipher, mailer)
 	handler := user.NewHandler(service, middleware)
 
 	handler.Register(public, protected)
+	return nil
 }
 
-func newOAuthHandler(config *config.Config, db *sql.DB, public *echo.Group) {
-	store := userStore.New(db)
-	service := oauthService.NewService(config, store)
-	handler := oauth.NewHandler(service)
+func newOAuthHandler(config *config.Config, db *sql.DB, tokens *auth.TokenService, public *echo.Group, protected *echo.Group, middleware *authMiddleware.JWTMiddleware) {
+	client := &http.Client{Timeout: oauthTimeout, Transport: tracing.Transport(http.DefaultTransport)}
+	service := oauthService.NewService(config, userStore.New(db), identityStore.New(db), tokens, client)
+	handler := oauth.NewHandler(service, tokens, middleware)
 
-	handler.Register(public)
+	handler.Register(public, protected)
 }
@@ -0,0 +1,189 @@
+package episode
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/samber/lo"
+
+	serviceInterface "pcast-api/controller/service_interface"
+	authMiddleware "pcast-api/middleware/auth"
+	"pcast-api/service/apikey"
+	episodeService "pcast-api/service/episode"
+	model "pcast-api/store/episode"
+)
+
+type Handler struct {
+	service    serviceInterface.Episode
+	middleware *authMiddleware.JWTMiddleware
+}
+
+func NewHandler(service serviceInterface.Episode, middleware *authMiddleware.JWTMiddleware) *Handler {
+	return &Handler{service: service, middleware: middleware}
+}
+
+// GetEpisodes godoc
+// @Summary Get all episodes of a feed
+// @Description Retrieve all episodes of the feed with the given feed ID
+// @Tags episodes
+// @Produce json
+// @Param id path string true "Feed ID"
+// @Param Authorization header string true "User ID"
+// @Success 200 {array} Presenter
+// @Failure 404 "Feed not found"
+// @Router /feeds/{id}/episodes [get]
+func (h *Handler) GetEpisodes(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	feedID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+
+	episodes, err := h.service.GetEpisodesByFeedID(c.Request().Context(), *userID, feedID)
+	if err != nil {
+		if errors.Is(err, episodeService.ErrFeedNotFound) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	res := lo.Map(episodes, func(item model.Episode, index int) *Presenter {
+		return NewPresenter(&item)
+	})
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// GetEpisode godoc
+// @Summary Get an episode
+// @Description Retrieve the episode with the given episode ID
+// @Tags episodes
+// @Produce json
+// @Param id path string true "Episode ID"
+// @Param Authorization header string true "User ID"
+// @Success 200 {object} Presenter
+// @Failure 404 "Episode not found"
+// @Router /episodes/{id} [get]
+func (h *Handler) GetEpisode(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	episodeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+
+	ep, err := h.service.GetEpisode(c.Request().Context(), *userID, episodeID)
+	if err != nil {
+		return c.NoContent(http.StatusNotFound)
+	}
+
+	return c.JSON(http.StatusOK, NewPresenter(ep))
+}
+
+// UpdateEpisode godoc
+// @Summary Update an episode
+// @Description Update the playback state of the episode with the given episode ID
+// @Tags episodes
+// @Accept json
+// @Produce json
+// @Param id path string true "Episode ID"
+// @Param episode body UpdateRequest true "UpdateRequest data"
+// @Param Authorization header string true "User ID"
+// @Success 200 {object} Presenter
+// @Failure 404 "Episode not found"
+// @Failure 409 {object} Presenter "Newer progress already stored"
+// @Router /episodes/{id} [patch]
+func (h *Handler) UpdateEpisode(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	episodeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	r := new(UpdateRequest)
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+
+	ep, err := h.service.UpdateEpisode(c.Request().Context(), *userID, episodeID, r.CurrentPosition, r.Played)
+	if err != nil {
+		switch {
+		case errors.Is(err, episodeService.ErrStaleProgress):
+			return c.JSON(http.StatusConflict, NewPresenter(ep))
+		case errors.Is(err, episodeService.ErrEpisodeNotFound):
+			return c.NoContent(http.StatusNotFound)
+		default:
+			return c.NoContent(http.StatusInternalServerError)
+		}
+	}
+
+	return c.JSON(http.StatusOK, NewPresenter(ep))
+}
+
+// UpdateProgress godoc
+// @Summary Sync the playback progress of an episode
+// @Description Store the playback position of the episode with the given episode ID.
+// @Description Updates older than the stored state are rejected and the current server state is returned.
+// @Tags episodes
+// @Accept json
+// @Produce json
+// @Param id path string true "Episode ID"
+// @Param progress body ProgressRequest true "ProgressRequest data"
+// @Param Authorization header string true "User ID"
+// @Success 200 {object} Presenter
+// @Failure 404 "Episode not found"
+// @Failure 409 {object} Presenter "Newer progress already stored"
+// @Router /episodes/{id}/progress [put]
+func (h *Handler) UpdateProgress(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	episodeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	r := new(ProgressRequest)
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+
+	ep, err := h.service.UpdateProgress(c.Request().Context(), *userID, episodeID, *r.Position, r.Played, r.Timestamp)
+	if err != nil {
+		switch {
+		case errors.Is(err, episodeService.ErrStaleProgress):
+			return c.JSON(http.StatusConflict, NewPresenter(ep))
+		case errors.Is(err, episodeService.ErrEpisodeNotFound):
+			return c.NoContent(http.StatusNotFound)
+		default:
+			return c.NoContent(http.StatusInternalServerError)
+		}
+	}
+
+	return c.JSON(http.StatusOK, NewPresenter(ep))
+}
+
+func (h *Handler) Register(g *echo.Group) {
+	read := h.middleware.RequireScope(apikey.ScopeEpisodesRead)
+	write := h.middleware.RequireScope(apikey.ScopeEpisodesWrite)
+
+	g.GET("/feeds/:id/episodes", h.GetEpisodes, read)
+	g.GET("/episodes/:id", h.GetEpisode, read)
+	g.PATCH("/episodes/:id", h.UpdateEpisode, write)
+	g.PUT("/episodes/:id/progress", h.UpdateProgress, write)
+}
@@ -0,0 +1,39 @@
+package episode
+
+import (
+	"github.com/google/uuid"
+	"pcast-api/store/episode"
+	"time"
+)
+
+// Presenter represents an episode presenter
+// @model Presenter
+type Presenter struct {
+	ID              uuid.UUID  `json:"id"`
+	FeedID          uuid.UUID  `json:"feedId"`
+	GUID            string     `json:"guid"`
+	Title           string     `json:"title"`
+	Description     string     `json:"description"`
+	URL             string     `json:"url"`
+	Duration        *int       `json:"duration"`
+	PublishedAt     *time.Time `json:"publishedAt"`
+	CurrentPosition *int       `json:"currentPosition"`
+	Played          bool       `json:"played"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+}
+
+func NewPresenter(episode *episode.Episode) *Presenter {
+	return &Presenter{
+		ID:              episode.ID,
+		FeedID:          episode.FeedID,
+		GUID:            episode.FeedGUID,
+		Title:           episode.Title,
+		Description:     episode.Description,
+		URL:             episode.URL,
+		Duration:        episode.Duration,
+		PublishedAt:     episode.PublishedAt,
+		CurrentPosition: episode.CurrentPosition,
+		Played:          episode.Played,
+		UpdatedAt:       episode.UpdatedAt,
+	}
+}
@@ -0,0 +1,11 @@
+package episode
+
+import "time"
+
+// ProgressRequest represents a playback progress sync request
+// @model ProgressRequest
+type ProgressRequest struct {
+	Position  *int      `json:"position" validate:"required,min=0,max=2147483647"`
+	Played    bool      `json:"played"`
+	Timestamp time.Time `json:"timestamp" validate:"required"`
+}
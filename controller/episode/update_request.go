@@ -0,0 +1,8 @@
+package episode
+
+// UpdateRequest represents an episode update request, omitted fields are left unchanged
+// @model UpdateRequest
+type UpdateRequest struct {
+	CurrentPosition *int  `json:"currentPosition" validate:"omitempty,min=0,max=2147483647"`
+	Played          *bool `json:"played"`
+}
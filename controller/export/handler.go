@@ -0,0 +1,63 @@
+package export
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	serviceInterface "pcast-api/controller/service_interface"
+	authMiddleware "pcast-api/middleware/auth"
+)
+
+type Handler struct {
+	service    serviceInterface.Export
+	middleware *authMiddleware.JWTMiddleware
+}
+
+func NewHandler(service serviceInterface.Export, middleware *authMiddleware.JWTMiddleware) *Handler {
+	return &Handler{service: service, middleware: middleware}
+}
+
+// Register adds the data export. It has no scope, so API keys cannot export the account.
+func (h *Handler) Register(g *echo.Group) {
+	g.GET("/user/export", h.exportData)
+}
+
+// exportData godoc
+// @Summary Export personal data
+// @Description Download all data stored about the user as ZIP archive. pcast-data.json holds the profile,
+// @Description linked identities, feeds and episodes with their playback state, subscriptions.opml the feeds.
+// @Description Passwords, 2FA secrets and feed credentials are not exported.
+// @Tags user
+// @Produce application/zip
+// @Param Authorization header string true "User ID"
+// @Success 200 {file} file "ZIP archive"
+// @Router /user/export [get]
+func (h *Handler) exportData(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	export, err := h.service.NewExport(c.Request().Context(), *userID)
+	if err != nil {
+		slog.ErrorContext(c.Request().Context(), "store error", "error", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	filename := fmt.Sprintf("pcast-export-%s.zip", time.Now().Format(time.DateOnly))
+	c.Response().Header().Set(echo.HeaderContentType, "application/zip")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Response().WriteHeader(http.StatusOK)
+
+	// The archive is streamed, an error after the first byte can only abort the response
+	if err := export.Write(c.Request().Context(), c.Response()); err != nil {
+		slog.ErrorContext(c.Request().Context(), "export error", "error", err)
+		return err
+	}
+
+	return nil
+}
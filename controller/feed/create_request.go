@@ -5,4 +5,6 @@ package feed
 type CreateRequest struct {
 	Title string `json:"title" validate:"required"`
 	URL   string `json:"url" validate:"required,url"`
+	// Credentials are only needed for private feeds
+	Credentials *CredentialsRequest `json:"credentials"`
 }
@@ -0,0 +1,18 @@
+package feed
+
+import "pcast-api/store/feed"
+
+// CredentialsRequest represents the credentials of a private feed, either username and password or a bearer token
+// @model CredentialsRequest
+type CredentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Token    string `json:"token"`
+}
+
+func (r *CredentialsRequest) toModel() *feed.Credentials {
+	if r == nil {
+		return nil
+	}
+	return &feed.Credentials{Username: r.Username, Password: r.Password, Token: r.Token}
+}
@@ -1,6 +1,9 @@
 package feed
 
 import (
+	"bytes"
+	"errors"
+	"log/slog"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -9,6 +12,9 @@ import (
 
 	serviceInterface "pcast-api/controller/service_interface"
 	authMiddleware "pcast-api/middleware/auth"
+	"pcast-api/service/apikey"
+	"pcast-api/service/auth"
+	feedService "pcast-api/service/feed"
 	model "pcast-api/store/feed"
 )
 
@@ -55,6 +61,8 @@ func (h *Handler) GetFeeds(c echo.Context) error {
 // @Param feed body CreateRequest true "CreateRequest data"
 // @Param Authorization header string true "User ID"
 // @Success 201 {object} Presenter
+// @Failure 400 "Invalid credentials"
+// @Failure 501 "Private feeds are not configured"
 // @Router /feeds [post]
 func (h *Handler) CreateFeed(c echo.Context) error {
 	userID, err := h.middleware.GetUserID(c)
@@ -70,10 +78,13 @@ func (h *Handler) CreateFeed(c echo.Context) error {
 	}
 
 	fd := model.Feed{UserID: *userID, URL: r.URL, Title: r.Title, SyncedAt: nil}
+	if err := h.service.SetCredentials(&fd, r.Credentials.toModel()); err != nil {
+		return credentialsError(c, err)
+	}
 
 	err = h.service.CreateFeed(c.Request().Context(), &fd)
 	if err != nil {
-		c.Logger().Error("store error", err.Error())
+		slog.ErrorContext(c.Request().Context(), "store error", "error", err)
 		return c.NoContent(http.StatusBadRequest)
 	}
 
@@ -109,11 +120,14 @@ func (h *Handler) DeleteFeed(c echo.Context) error {
 
 // SyncFeed godoc
 // @Summary Sync a feed
-// @Description Sync a feed with the given feed ID
+// @Description Download and parse the feed with the given feed ID and upsert its episodes
 // @Tags feeds
 // @Param id path string true "Feed ID"
 // @Param Authorization header string true "User ID"
 // @Success 204 "Feed synced successfully"
+// @Failure 404 "Feed not found"
+// @Failure 500 "Feed credentials could not be decrypted"
+// @Failure 502 "Feed could not be fetched or parsed"
 // @Router /feeds/{id}/sync [put]
 func (h *Handler) SyncFeed(c echo.Context) error {
 	userID, err := h.middleware.GetUserID(c)
@@ -127,15 +141,161 @@ func (h *Handler) SyncFeed(c echo.Context) error {
 
 	err = h.service.SyncFeed(c.Request().Context(), *userID, feedID)
 	if err != nil {
+		if errors.Is(err, feedService.ErrFetchFailed) || errors.Is(err, feedService.ErrInvalidFeed) {
+			return c.NoContent(http.StatusBadGateway)
+		}
+		if errors.Is(err, feedService.ErrCredentialsUnsupported) || errors.Is(err, auth.ErrDecryptFailed) {
+			slog.ErrorContext(c.Request().Context(), "feed credentials error", "error", err)
+			return c.NoContent(http.StatusInternalServerError)
+		}
 		return c.NoContent(http.StatusNotFound)
 	}
 
 	return c.NoContent(http.StatusNoContent)
 }
 
+// ImportFeeds godoc
+// @Summary Import feeds from OPML
+// @Description Subscribe to every feed of an OPML 1.0/2.0 document, including nested folders.
+// @Description Feeds the user is already subscribed to are skipped.
+// @Tags feeds
+// @Accept xml
+// @Produce json
+// @Param opml body string true "OPML document"
+// @Param Authorization header string true "User ID"
+// @Success 200 {object} ImportPresenter
+// @Failure 400 "Invalid OPML document"
+// @Router /feeds/import [post]
+func (h *Handler) ImportFeeds(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	results, err := h.service.ImportOPML(c.Request().Context(), *userID, c.Request().Body)
+	if err != nil {
+		if errors.Is(err, feedService.ErrInvalidOPML) {
+			return c.NoContent(http.StatusBadRequest)
+		}
+		slog.ErrorContext(c.Request().Context(), "store error", "error", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	return c.JSON(http.StatusOK, NewImportPresenter(results))
+}
+
+// ExportFeeds godoc
+// @Summary Export feeds as OPML
+// @Description Export all feeds of the user as an OPML 2.0 document
+// @Tags feeds
+// @Produce xml
+// @Param Authorization header string true "User ID"
+// @Success 200 {string} string "OPML document"
+// @Router /feeds/export.opml [get]
+func (h *Handler) ExportFeeds(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	var buf bytes.Buffer
+	if err := h.service.ExportOPML(c.Request().Context(), *userID, &buf); err != nil {
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="pcast-subscriptions.opml"`)
+
+	return c.Blob(http.StatusOK, "text/x-opml; charset=UTF-8", buf.Bytes())
+}
+
+// UpdateCredentials godoc
+// @Summary Set the credentials of a private feed
+// @Description Store HTTP Basic credentials or a bearer token used to download the feed.
+// @Description The credentials are encrypted at rest and never returned.
+// @Tags feeds
+// @Accept json
+// @Produce json
+// @Param id path string true "Feed ID"
+// @Param credentials body CredentialsRequest true "CredentialsRequest data"
+// @Param Authorization header string true "User ID"
+// @Success 200 {object} Presenter
+// @Failure 400 "Invalid credentials"
+// @Failure 404 "Feed not found"
+// @Failure 501 "Private feeds are not configured"
+// @Router /feeds/{id}/credentials [put]
+func (h *Handler) UpdateCredentials(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	feedID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	r := new(CredentialsRequest)
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+
+	fd, err := h.service.UpdateCredentials(c.Request().Context(), *userID, feedID, r.toModel())
+	if err != nil {
+		return credentialsError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, NewPresenter(fd))
+}
+
+// DeleteCredentials godoc
+// @Summary Remove the credentials of a feed
+// @Description Remove the stored credentials, the feed is downloaded without authentication afterwards
+// @Tags feeds
+// @Param id path string true "Feed ID"
+// @Param Authorization header string true "User ID"
+// @Success 204 "Credentials removed"
+// @Failure 404 "Feed not found"
+// @Router /feeds/{id}/credentials [delete]
+func (h *Handler) DeleteCredentials(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	feedID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+
+	if _, err := h.service.UpdateCredentials(c.Request().Context(), *userID, feedID, nil); err != nil {
+		return credentialsError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// credentialsError maps errors of storing feed credentials to a response
+func credentialsError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, feedService.ErrInvalidCredentials):
+		return c.NoContent(http.StatusBadRequest)
+	case errors.Is(err, feedService.ErrFeedNotFound):
+		return c.NoContent(http.StatusNotFound)
+	case errors.Is(err, feedService.ErrCredentialsUnsupported):
+		return c.NoContent(http.StatusNotImplemented)
+	default:
+		slog.ErrorContext(c.Request().Context(), "store error", "error", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+}
+
 func (h *Handler) Register(g *echo.Group) {
-	g.GET("/feeds", h.GetFeeds)
-	g.POST("/feeds", h.CreateFeed)
-	g.PUT("/feeds/:id/sync", h.SyncFeed)
-	g.DELETE("/feeds/:id", h.DeleteFeed)
+	read := h.middleware.RequireScope(apikey.ScopeFeedsRead)
+	write := h.middleware.RequireScope(apikey.ScopeFeedsWrite)
+
+	g.GET("/feeds", h.GetFeeds, read)
+	g.POST("/feeds", h.CreateFeed, write)
+	g.POST("/feeds/import", h.ImportFeeds, write)
+	g.GET("/feeds/export.opml", h.ExportFeeds, read)
+	g.PUT("/feeds/:id/sync", h.SyncFeed, write)
+	g.DELETE("/feeds/:id", h.DeleteFeed, write)
+	g.PUT("/feeds/:id/credentials", h.UpdateCredentials, write)
+	g.DELETE("/feeds/:id/credentials", h.DeleteCredentials, write)
 }
@@ -0,0 +1,51 @@
+package feed
+
+import (
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	feedService "pcast-api/service/feed"
+)
+
+// ImportPresenter represents the report of an OPML import
+// @model ImportPresenter
+type ImportPresenter struct {
+	Created    int                      `json:"created"`
+	Duplicates int                      `json:"duplicates"`
+	Invalid    int                      `json:"invalid"`
+	Results    []*ImportResultPresenter `json:"results"`
+}
+
+// ImportResultPresenter represents the import outcome of a single OPML outline
+// @model ImportResultPresenter
+type ImportResultPresenter struct {
+	Title  string     `json:"title"`
+	URL    string     `json:"url"`
+	Status string     `json:"status" enums:"created,duplicate,invalid"`
+	FeedID *uuid.UUID `json:"feedId"`
+}
+
+func NewImportPresenter(results []feedService.ImportResult) *ImportPresenter {
+	p := &ImportPresenter{
+		Results: lo.Map(results, func(item feedService.ImportResult, index int) *ImportResultPresenter {
+			return &ImportResultPresenter{
+				Title:  item.Title,
+				URL:    item.URL,
+				Status: string(item.Status),
+				FeedID: item.FeedID,
+			}
+		}),
+	}
+
+	for _, result := range results {
+		switch result.Status {
+		case feedService.ImportStatusCreated:
+			p.Created++
+		case feedService.ImportStatusDuplicate:
+			p.Duplicates++
+		case feedService.ImportStatusInvalid:
+			p.Invalid++
+		}
+	}
+
+	return p
+}
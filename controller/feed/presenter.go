@@ -13,6 +13,8 @@ type Presenter struct {
 	Title    string     `json:"title"`
 	URL      string     `json:"url"`
 	SyncedAt *time.Time `json:"syncedAt"`
+	// Private is set when credentials are stored, the credentials themselves are never returned
+	Private bool `json:"private"`
 }
 
 func NewPresenter(feed *feed.Feed) *Presenter {
@@ -21,5 +23,6 @@ func NewPresenter(feed *feed.Feed) *Presenter {
 		Title:    feed.Title,
 		URL:      feed.URL,
 		SyncedAt: feed.SyncedAt,
+		Private:  feed.Credentials != nil,
 	}
 }
@@ -0,0 +1,47 @@
+package health
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	serviceInterface "pcast-api/controller/service_interface"
+)
+
+type Handler struct {
+	service serviceInterface.Health
+}
+
+func NewHandler(service serviceInterface.Health) *Handler {
+	return &Handler{service: service}
+}
+
+// Register adds the probes of the load balancer at the server root, outside of /api
+func (h *Handler) Register(e *echo.Echo) {
+	e.GET("/healthz", h.getLiveness)
+	e.GET("/readyz", h.getReadiness)
+}
+
+// getLiveness answers as long as the server handles requests at all, it does not check dependencies
+func (h *Handler) getLiveness(c echo.Context) error {
+	return c.JSON(http.StatusOK, &Presenter{Status: StatusOK})
+}
+
+// getReadiness checks the database and its migration version. It answers 503 if a dependency fails
+// or the server is draining. Errors are only logged, the probe is public.
+func (h *Handler) getReadiness(c echo.Context) error {
+	status := h.service.Ready(c.Request().Context())
+	for _, result := range status.Results {
+		if result.Err != nil {
+			slog.ErrorContext(c.Request().Context(), "readiness check failed", "check", result.Name, "error", result.Err)
+		}
+	}
+
+	code := http.StatusOK
+	if !status.Ready() {
+		code = http.StatusServiceUnavailable
+	}
+
+	return c.JSON(code, NewPresenter(status))
+}
@@ -0,0 +1,35 @@
+package health
+
+import (
+	healthService "pcast-api/service/health"
+)
+
+// Status values of the server and its dependencies
+const (
+	StatusOK       = "ok"
+	StatusFailing  = "failing"
+	StatusDraining = "draining"
+)
+
+// Presenter is the readiness of the server with the status of every dependency
+type Presenter struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func NewPresenter(status *healthService.Status) *Presenter {
+	if status.Draining {
+		return &Presenter{Status: StatusDraining}
+	}
+
+	p := &Presenter{Status: StatusOK, Checks: make(map[string]string, len(status.Results))}
+	for _, result := range status.Results {
+		p.Checks[result.Name] = StatusOK
+		if result.Err != nil {
+			p.Checks[result.Name] = StatusFailing
+			p.Status = StatusFailing
+		}
+	}
+
+	return p
+}
@@ -0,0 +1,34 @@
+package jwks
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	serviceInterface "pcast-api/controller/service_interface"
+)
+
+// cacheControl lets verifiers cache the keys. A new signing key must be published at least this long
+// before it signs tokens.
+const cacheControl = "public, max-age=300"
+
+type Handler struct {
+	keys serviceInterface.Keys
+}
+
+func NewHandler(keys serviceInterface.Keys) *Handler {
+	return &Handler{keys: keys}
+}
+
+// Register adds the JWKS at the well-known path of the server root, outside of /api
+func (h *Handler) Register(e *echo.Echo) {
+	e.GET("/.well-known/jwks.json", h.getKeys)
+}
+
+// getKeys returns the public keys access tokens are verified with, selected by the kid header of a token.
+// The set is empty while access tokens are signed with the jwt_secret.
+func (h *Handler) getKeys(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", cacheControl)
+
+	return c.JSON(http.StatusOK, NewPresenter(h.keys.PublicKeys()))
+}
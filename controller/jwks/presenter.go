@@ -0,0 +1,55 @@
+package jwks
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+
+	"pcast-api/service/auth"
+)
+
+// Presenter is a JSON Web Key Set (RFC 7517)
+type Presenter struct {
+	Keys []*KeyPresenter `json:"keys"`
+}
+
+// KeyPresenter is the JSON Web Key of an RSA or Ed25519 (RFC 8037) public key
+type KeyPresenter struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	ID        string `json:"kid"`
+	// N and E are the modulus and exponent of RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Curve and X are the curve and public key of Ed25519 keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+func NewPresenter(keys []auth.PublicKey) *Presenter {
+	presenter := &Presenter{Keys: make([]*KeyPresenter, 0, len(keys))}
+	for _, key := range keys {
+		presenter.Keys = append(presenter.Keys, NewKeyPresenter(key))
+	}
+
+	return presenter
+}
+
+func NewKeyPresenter(key auth.PublicKey) *KeyPresenter {
+	presenter := &KeyPresenter{Use: "sig", Algorithm: key.Algorithm, ID: key.ID}
+
+	switch public := key.Key.(type) {
+	case *rsa.PublicKey:
+		presenter.KeyType = "RSA"
+		presenter.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		presenter.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		presenter.KeyType = "OKP"
+		presenter.Curve = "Ed25519"
+		presenter.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+
+	return presenter
+}
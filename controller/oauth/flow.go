@@ -0,0 +1,54 @@
+package oauth
+
+import (
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+
+	oauthService "pcast-api/service/oauth"
+)
+
+// flowCookie keeps the login between the redirect to the provider and the callback
+const flowCookie = "oauth_flow"
+
+// authFlow is the content of the flow cookie
+type authFlow struct {
+	*oauthService.AuthRequest
+	// ClientState is the state of the app, it is passed back with the login code
+	ClientState string `json:"clientState,omitempty"`
+}
+
+// encodeFlow signs the flow, the browser must not be able to change the verifier or the redirect URI
+func (h *Handler) encodeFlow(flow *authFlow) (string, error) {
+	return h.tokens.SealFlow(flow)
+}
+
+func (h *Handler) readFlow(c echo.Context) (*authFlow, error) {
+	cookie, err := c.Cookie(flowCookie)
+	if err != nil {
+		return nil, err
+	}
+
+	flow := &authFlow{}
+	if err := h.tokens.OpenFlow(cookie.Value, flow); err != nil {
+		return nil, err
+	}
+	if flow.AuthRequest == nil {
+		flow.AuthRequest = &oauthService.AuthRequest{}
+	}
+	return flow, nil
+}
+
+// appRedirectURL adds the params to the query of the redirect URI of an app
+func appRedirectURL(redirectURI string, params url.Values) string {
+	// The URI passed the allow-list, so it parses
+	u, _ := url.Parse(redirectURI)
+	query := u.Query()
+	for name, values := range params {
+		if values[0] != "" {
+			query[name] = values
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -1,45 +1,107 @@
 package oauth
 
 import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
 	"net/http"
+	"net/url"
 
 	"github.com/labstack/echo/v4"
 
 	serviceInterface "pcast-api/controller/service_interface"
+	authMiddleware "pcast-api/middleware/auth"
+	"pcast-api/service/auth"
 	oauthService "pcast-api/service/oauth"
 )
 
 type Handler struct {
-	service serviceInterface.OAuth
+	service    serviceInterface.OAuth
+	tokens     *auth.TokenService
+	middleware *authMiddleware.JWTMiddleware
 }
 
-func NewHandler(service serviceInterface.OAuth) *Handler {
-	return &Handler{service: service}
+// NewHandler creates the handler, tokens signs the flow cookie between the redirect to a provider and the callback
+func NewHandler(service serviceInterface.OAuth, tokens *auth.TokenService, middleware *authMiddleware.JWTMiddleware) *Handler {
+	return &Handler{service: service, tokens: tokens, middleware: middleware}
 }
 
-func (h *Handler) Register(public *echo.Group) {
-	public.GET("/auth/google", h.initiateGoogleAuth)
-	public.GET("/auth/google/callback", h.handleGoogleCallback)
+func (h *Handler) Register(public *echo.Group, protected *echo.Group) {
+	public.GET("/auth/providers", h.getProviders)
+	public.GET("/auth/:provider", h.initiateAuth)
+	public.GET("/auth/:provider/callback", h.handleCallback)
+	public.POST("/auth/token", h.exchangeToken)
+	protected.GET("/user/identities", h.getIdentities)
+	protected.POST("/user/identities", h.linkIdentity)
+	protected.DELETE("/user/identities/:provider", h.unlinkIdentity)
 }
 
-// initiateGoogleAuth godoc
-// @Summary Initiate Google OAuth
-// @Description Redirects to Google OAuth consent screen
+// getProviders godoc
+// @Summary List OAuth providers
+// @Description Lists the OpenID Connect providers users can sign in with
 // @Tags auth
 // @Produce json
-// @Success 302 {string} string "Redirect to Google"
-// @Failure 500 {object} map[string]string
-// @Router /auth/google [get]
-func (h *Handler) initiateGoogleAuth(c echo.Context) error {
-	state, err := oauthService.GenerateState()
+// @Success 200 {array} ProviderPresenter
+// @Router /auth/providers [get]
+func (h *Handler) getProviders(c echo.Context) error {
+	return c.JSON(http.StatusOK, NewProviderPresenters(h.service.Providers()))
+}
+
+// initiateAuth godoc
+// @Summary Initiate OAuth login
+// @Description Redirects to the consent screen of the OpenID Connect provider. Apps pass an allow-listed redirect_uri,
+// @Description e.g. a custom scheme, with the S256 challenge of their own PKCE verifier. Their login ends with a redirect
+// @Description to redirect_uri with a login code, which they exchange for the tokens at /auth/token.
+// @Description With intent=link nobody is signed in, the login ends with a link code for POST /user/identities.
+// @Description Links also need the S256 challenge, the link code is bound to it.
+// @Tags auth
+// @Produce json
+// @Param provider path string true "Provider name, e.g. google"
+// @Param intent query string false "login (default) or link"
+// @Param redirect_uri query string false "Allow-listed URI the login returns to with ?code= and ?state="
+// @Param code_challenge query string false "S256 PKCE challenge, required with redirect_uri or intent=link"
+// @Param code_challenge_method query string false "Must be S256, required with redirect_uri or intent=link"
+// @Param state query string false "State of the app, returned with the login code"
+// @Success 307 {string} string "Redirect to the provider"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Router /auth/{provider} [get]
+func (h *Handler) initiateAuth(c echo.Context) error {
+	intent := c.QueryParam("intent")
+	if intent != "" && intent != "login" && intent != "link" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "intent must be login or link",
+		})
+	}
+
+	link := intent == "link"
+	redirectURI := c.QueryParam("redirect_uri")
+	if (redirectURI != "" || link) && c.QueryParam("code_challenge_method") != "S256" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "code_challenge_method must be S256",
+		})
+	}
+
+	req, err := h.service.NewAuthRequest(redirectURI, c.QueryParam("code_challenge"), link)
+	if err != nil {
+		return oauthError(c, err)
+	}
+
+	authURL, err := h.service.GetAuthURL(c.Request().Context(), c.Param("provider"), req)
+	if err != nil {
+		return oauthError(c, err)
+	}
+
+	value, err := h.encodeFlow(&authFlow{AuthRequest: req, ClientState: c.QueryParam("state")})
 	if err != nil {
 		return c.NoContent(http.StatusInternalServerError)
 	}
 
-	// Store state in a cookie for validation on callback
+	// Keep the flow in a cookie for the callback, the verifier never leaves the API and the browser
 	c.SetCookie(&http.Cookie{
-		Name:     "oauth_state",
-		Value:    state,
+		Name:     flowCookie,
+		Value:    value,
 		Path:     "/",
 		HttpOnly: true,
 		Secure:   c.Request().TLS != nil, // Only secure in HTTPS
@@ -47,28 +109,32 @@ func (h *Handler) initiateGoogleAuth(c echo.Context) error {
 		SameSite: http.SameSiteLaxMode,
 	})
 
-	url, err := h.service.GetGoogleAuthURL(state)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": err.Error(),
-		})
-	}
-
-	return c.Redirect(http.StatusTemporaryRedirect, url)
+	return c.Redirect(http.StatusTemporaryRedirect, authURL)
 }
 
-// handleGoogleCallback godoc
-// @Summary Google OAuth callback
-// @Description Handles Google OAuth callback and returns JWT token
+// handleCallback godoc
+// @Summary OAuth callback
+// @Description Handles the callback of the OpenID Connect provider and returns an access token with a refresh token.
+// @Description If two-factor authentication is enabled, the response only contains a challenge token for /user/login/2fa.
+// @Description A new identity with the email of an existing account is refused with 403, unless the provider has link_by_email enabled.
+// @Description Logins started with a redirect_uri are redirected there with ?code= and ?state=, or ?error= if the login failed.
+// @Description Logins with intent=link return a link code instead, as linkCode or as ?code= for the redirect_uri.
 // @Tags auth
 // @Produce json
-// @Param code query string true "Authorization code from Google"
+// @Param provider path string true "Provider name, e.g. google"
+// @Param code query string true "Authorization code from the provider"
 // @Param state query string true "State parameter for CSRF validation"
 // @Success 200 {object} LoginResponse
+// @Success 201 {object} LinkResponse
+// @Success 302 {string} string "Redirect to the redirect_uri of the app"
 // @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
-// @Router /auth/google/callback [get]
-func (h *Handler) handleGoogleCallback(c echo.Context) error {
+// @Failure 502 {object} map[string]string
+// @Router /auth/{provider}/callback [get]
+func (h *Handler) handleCallback(c echo.Context) error {
 	code := c.QueryParam("code")
 	state := c.QueryParam("state")
 
@@ -79,28 +145,225 @@ func (h *Handler) handleGoogleCallback(c echo.Context) error {
 	}
 
 	// Validate state from cookie
-	cookie, err := c.Cookie("oauth_state")
-	if err != nil || cookie.Value != state {
+	flow, err := h.readFlow(c)
+	if err != nil || subtle.ConstantTimeCompare([]byte(flow.State), []byte(state)) != 1 {
 		return c.JSON(http.StatusBadRequest, map[string]string{
 			"error": "invalid state parameter",
 		})
 	}
 
-	// Clear the state cookie
+	// Clear the flow cookie
 	c.SetCookie(&http.Cookie{
-		Name:     "oauth_state",
+		Name:     flowCookie,
 		Value:    "",
 		Path:     "/",
 		HttpOnly: true,
 		MaxAge:   -1,
 	})
 
-	token, err := h.service.HandleGoogleCallback(c.Request().Context(), code)
+	result, err := h.service.HandleCallback(c.Request().Context(), c.Param("provider"), code, flow.AuthRequest)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": err.Error(),
-		})
+		if flow.RedirectURI != "" && !errors.Is(err, oauthService.ErrRedirectURINotAllowed) {
+			return c.Redirect(http.StatusFound, appRedirectURL(flow.RedirectURI, url.Values{
+				"error":             {oauthErrorCode(err)},
+				"error_description": {err.Error()},
+				"state":             {flow.ClientState},
+			}))
+		}
+		return oauthError(c, err)
+	}
+
+	if result.RedirectURI != "" {
+		code := result.LoginCode
+		if result.LinkCode != "" {
+			code = result.LinkCode
+		}
+		return c.Redirect(http.StatusFound, appRedirectURL(result.RedirectURI, url.Values{
+			"code":  {code},
+			"state": {flow.ClientState},
+		}))
+	}
+
+	if result.LinkCode != "" {
+		return c.JSON(http.StatusCreated, LinkResponse{LinkCode: result.LinkCode})
+	}
+
+	if result.Login.ChallengeToken != "" {
+		return c.JSON(http.StatusOK, NewChallengeResponse(result.Login.ChallengeToken))
+	}
+
+	return c.JSON(http.StatusOK, NewLoginResponse(result.Login.Tokens))
+}
+
+// exchangeToken godoc
+// @Summary Redeem login code
+// @Description Exchanges the login code an app received at its redirect_uri for an access token with a refresh token.
+// @Description If two-factor authentication is enabled, the response only contains a challenge token for /user/login/2fa.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body TokenRequest true "TokenRequest data"
+// @Success 200 {object} LoginResponse
+// @Failure 400 "Invalid request"
+// @Failure 401 "Invalid or expired code, or wrong code verifier"
+// @Router /auth/token [post]
+func (h *Handler) exchangeToken(c echo.Context) error {
+	req := new(TokenRequest)
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	result, err := h.service.ExchangeLoginCode(c.Request().Context(), req.Code, req.CodeVerifier)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidLoginCode) {
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		slog.ErrorContext(c.Request().Context(), "store error", "error", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	if result.ChallengeToken != "" {
+		return c.JSON(http.StatusOK, NewChallengeResponse(result.ChallengeToken))
 	}
 
-	return c.JSON(http.StatusOK, LoginResponse{Token: token})
+	return c.JSON(http.StatusOK, NewLoginResponse(result.Tokens))
+}
+
+// getIdentities godoc
+// @Summary List linked identities
+// @Description Lists the accounts at OpenID Connect providers the user can sign in with
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "User ID"
+// @Success 200 {array} IdentityPresenter
+// @Router /user/identities [get]
+func (h *Handler) getIdentities(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	identities, err := h.service.Identities(c.Request().Context(), *userID)
+	if err != nil {
+		slog.ErrorContext(c.Request().Context(), "store error", "error", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	return c.JSON(http.StatusOK, NewIdentityPresenters(identities, h.service.Providers()))
+}
+
+// linkIdentity godoc
+// @Summary Link an identity
+// @Description Links the account of a login with intent=link to the user, independent of its email
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User ID"
+// @Param identity body LinkIdentityRequest true "LinkIdentityRequest data"
+// @Success 201 {object} IdentityPresenter
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /user/identities [post]
+func (h *Handler) linkIdentity(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	req := new(LinkIdentityRequest)
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	identity, err := h.service.LinkIdentity(c.Request().Context(), *userID, req.Code, req.CodeVerifier)
+	if err != nil {
+		return identityError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, NewIdentityPresenter(identity, h.service.Providers()))
+}
+
+// unlinkIdentity godoc
+// @Summary Unlink an identity
+// @Description Removes the identity of the provider. The last identity of an account without password cannot be removed.
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "User ID"
+// @Param provider path string true "Provider name, e.g. google"
+// @Success 204 "Unlinked"
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /user/identities/{provider} [delete]
+func (h *Handler) unlinkIdentity(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	if err := h.service.UnlinkIdentity(c.Request().Context(), *userID, c.Param("provider")); err != nil {
+		return identityError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// identityError maps errors of linking and unlinking identities to a response
+func identityError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, auth.ErrInvalidLinkCode):
+		status = http.StatusBadRequest
+	case errors.Is(err, oauthService.ErrIdentityNotFound), errors.Is(err, oauthService.ErrUnknownProvider):
+		status = http.StatusNotFound
+	case errors.Is(err, oauthService.ErrIdentityLinked), errors.Is(err, oauthService.ErrProviderLinked), errors.Is(err, oauthService.ErrLastLoginMethod):
+		status = http.StatusConflict
+	default:
+		slog.ErrorContext(c.Request().Context(), "store error", "error", err)
+	}
+
+	return c.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
+
+// oauthStatus maps errors of the OAuth flow to a status code
+func oauthStatus(err error) int {
+	switch {
+	case errors.Is(err, oauthService.ErrRedirectURINotAllowed), errors.Is(err, oauthService.ErrInvalidCodeChallenge):
+		return http.StatusBadRequest
+	case errors.Is(err, oauthService.ErrUnknownProvider):
+		return http.StatusNotFound
+	case errors.Is(err, oauthService.ErrFailedExchange), errors.Is(err, oauthService.ErrInvalidIDToken):
+		return http.StatusUnauthorized
+	case errors.Is(err, oauthService.ErrUnverifiedEmail), errors.Is(err, oauthService.ErrUnverifiedAccount), errors.Is(err, oauthService.ErrAccountExists):
+		return http.StatusForbidden
+	case errors.Is(err, oauthService.ErrProviderUnavailable), errors.Is(err, oauthService.ErrFailedUserInfo):
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// oauthError maps errors of the OAuth flow to a response
+func oauthError(c echo.Context, err error) error {
+	return c.JSON(oauthStatus(err), map[string]string{
+		"error": err.Error(),
+	})
+}
+
+// oauthErrorCode maps errors of the OAuth flow to the error codes of RFC 6749, section 4.1.2.1
+func oauthErrorCode(err error) string {
+	switch oauthStatus(err) {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "access_denied"
+	case http.StatusBadGateway:
+		return "temporarily_unavailable"
+	}
+	return "server_error"
 }
@@ -2,207 +2,763 @@ package oauth
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"pcast-api/config"
+	authMiddleware "pcast-api/middleware/auth"
+	"pcast-api/router/validator"
+	"pcast-api/service/auth"
 	oauthService "pcast-api/service/oauth"
+	userService "pcast-api/service/user"
+	identityStore "pcast-api/store/identity"
 )
 
+// testTokens signs the flow cookies of the tests
+var testTokens = auth.NewTokenService(nil, nil, auth.NewHMACKeys("testsecret"), 10, 30)
+
 // mockOAuthService implements serviceInterface.OAuth for testing
 type mockOAuthService struct {
-	authURL       string
-	authURLErr    error
-	callbackToken string
-	callbackErr   error
+	providers      []*oauthService.Provider
+	authRequestErr error
+	authURL        string
+	authURLErr     error
+	callbackResult *oauthService.CallbackResult
+	callbackErr    error
+	exchangeResult *userService.LoginResult
+	exchangeErr    error
+	identities     []identityStore.Identity
+	linkErr        error
+	unlinkErr      error
+	// provider and request are the provider and auth request of the last call
+	provider string
+	request  *oauthService.AuthRequest
+}
+
+func (m *mockOAuthService) Providers() []*oauthService.Provider {
+	return m.providers
+}
+
+func (m *mockOAuthService) NewAuthRequest(redirectURI string, codeChallenge string, link bool) (*oauthService.AuthRequest, error) {
+	if m.authRequestErr != nil {
+		return nil, m.authRequestErr
+	}
+	return &oauthService.AuthRequest{
+		State:         "generated-state",
+		Verifier:      "generated-verifier",
+		Nonce:         "generated-nonce",
+		RedirectURI:   redirectURI,
+		CodeChallenge: codeChallenge,
+		Link:          link,
+	}, nil
 }
 
-func (m *mockOAuthService) GetGoogleAuthURL(state string) (string, error) {
+func (m *mockOAuthService) GetAuthURL(ctx context.Context, provider string, req *oauthService.AuthRequest) (string, error) {
+	m.provider = provider
+	m.request = req
 	if m.authURLErr != nil {
 		return "", m.authURLErr
 	}
 	return m.authURL, nil
 }
 
-func (m *mockOAuthService) HandleGoogleCallback(ctx context.Context, code string) (string, error) {
+func (m *mockOAuthService) HandleCallback(ctx context.Context, provider string, code string, req *oauthService.AuthRequest) (*oauthService.CallbackResult, error) {
+	m.provider = provider
+	m.request = req
 	if m.callbackErr != nil {
-		return "", m.callbackErr
+		return nil, m.callbackErr
 	}
-	return m.callbackToken, nil
+	return m.callbackResult, nil
 }
 
-func TestHandler_InitiateGoogleAuth_Success(t *testing.T) {
-	e := echo.New()
-	req := httptest.NewRequest(http.MethodGet, "/auth/google", nil)
+func (m *mockOAuthService) ExchangeLoginCode(ctx context.Context, code string, verifier string) (*userService.LoginResult, error) {
+	if m.exchangeErr != nil {
+		return nil, m.exchangeErr
+	}
+	return m.exchangeResult, nil
+}
+
+func (m *mockOAuthService) Identities(ctx context.Context, userID uuid.UUID) ([]identityStore.Identity, error) {
+	return m.identities, nil
+}
+
+func (m *mockOAuthService) LinkIdentity(ctx context.Context, userID uuid.UUID, code string, verifier string) (*identityStore.Identity, error) {
+	if m.linkErr != nil {
+		return nil, m.linkErr
+	}
+	identity := identityStore.Identity{UserID: userID, Provider: "keycloak", Subject: "subject-123", Email: "foo@example.com"}
+	m.identities = append(m.identities, identity)
+	return &identity, nil
+}
+
+func (m *mockOAuthService) UnlinkIdentity(ctx context.Context, userID uuid.UUID, provider string) error {
+	m.provider = provider
+	return m.unlinkErr
+}
+
+// newContext creates the context of a request to a route with a :provider parameter
+func newContext(req *http.Request, rec *httptest.ResponseRecorder, provider string) echo.Context {
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("provider")
+	c.SetParamValues(provider)
+	return c
+}
+
+func TestHandler_GetProviders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/auth/providers", nil)
 	rec := httptest.NewRecorder()
-	c := e.NewContext(req, rec)
+	c := echo.New().NewContext(req, rec)
 
 	mockService := &mockOAuthService{
-		authURL: "https://accounts.google.com/o/oauth2/auth?client_id=test",
+		providers: []*oauthService.Provider{
+			oauthService.NewProvider(config.OAuthProvider{Name: "google", DisplayName: "Google"}, http.DefaultClient),
+			oauthService.NewProvider(config.OAuthProvider{Name: "keycloak", DisplayName: "Keycloak"}, http.DefaultClient),
+		},
 	}
-	handler := NewHandler(mockService)
+	handler := NewHandler(mockService, testTokens, nil)
 
-	err := handler.initiateGoogleAuth(c)
+	err := handler.getProviders(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[{"name": "google", "displayName": "Google"}, {"name": "keycloak", "displayName": "Keycloak"}]`, rec.Body.String())
+}
+
+func TestHandler_InitiateAuth_Success(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/auth/keycloak", nil)
+	rec := httptest.NewRecorder()
+	c := newContext(req, rec, "keycloak")
+
+	mockService := &mockOAuthService{
+		authURL: "https://keycloak.example.com/auth?client_id=test",
+	}
+	handler := NewHandler(mockService, testTokens, nil)
+
+	err := handler.initiateAuth(c)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusTemporaryRedirect, rec.Code)
-	assert.Equal(t, "https://accounts.google.com/o/oauth2/auth?client_id=test", rec.Header().Get("Location"))
+	assert.Equal(t, "https://keycloak.example.com/auth?client_id=test", rec.Header().Get("Location"))
+	assert.Equal(t, "keycloak", mockService.provider)
 
-	// Verify the state cookie was set
+	// Verify the flow cookie was set
 	cookies := rec.Result().Cookies()
-	var stateCookie *http.Cookie
-	for _, cookie := range cookies {
-		if cookie.Name == "oauth_state" {
-			stateCookie = cookie
+	var cookie *http.Cookie
+	for _, c := range cookies {
+		if c.Name == "oauth_flow" {
+			cookie = c
 			break
 		}
 	}
-	assert.NotNil(t, stateCookie)
-	assert.NotEmpty(t, stateCookie.Value)
-	assert.True(t, stateCookie.HttpOnly)
+	require.NotNil(t, cookie)
+	assert.True(t, cookie.HttpOnly)
+
+	// The callback gets the request back from the cookie
+	callback := httptest.NewRequest(http.MethodGet, "/auth/keycloak/callback", nil)
+	callback.AddCookie(cookie)
+	flow, err := handler.readFlow(echo.New().NewContext(callback, httptest.NewRecorder()))
+	require.NoError(t, err)
+	assert.Equal(t, mockService.request, flow.AuthRequest)
+	assert.Equal(t, "generated-verifier", flow.Verifier)
+	assert.Empty(t, flow.RedirectURI)
 }
 
-func TestHandler_InitiateGoogleAuth_NotConfigured(t *testing.T) {
-	e := echo.New()
-	req := httptest.NewRequest(http.MethodGet, "/auth/google", nil)
+func TestHandler_InitiateAuth_RedirectURI(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/auth/keycloak?redirect_uri=pcast%3A%2F%2Flogin&code_challenge=challenge&code_challenge_method=S256&state=app-state", nil)
 	rec := httptest.NewRecorder()
-	c := e.NewContext(req, rec)
+	c := newContext(req, rec, "keycloak")
 
 	mockService := &mockOAuthService{
-		authURLErr: oauthService.ErrGoogleNotConfigured,
+		authURL: "https://keycloak.example.com/auth?client_id=test",
 	}
-	handler := NewHandler(mockService)
+	handler := NewHandler(mockService, testTokens, nil)
+
+	err := handler.initiateAuth(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTemporaryRedirect, rec.Code)
+	assert.Equal(t, "pcast://login", mockService.request.RedirectURI)
+	assert.Equal(t, "challenge", mockService.request.CodeChallenge)
 
-	err := handler.initiateGoogleAuth(c)
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	callback := httptest.NewRequest(http.MethodGet, "/auth/keycloak/callback", nil)
+	callback.AddCookie(cookies[0])
+	flow, err := handler.readFlow(echo.New().NewContext(callback, httptest.NewRecorder()))
+	require.NoError(t, err)
+	assert.Equal(t, "app-state", flow.ClientState)
+	assert.Equal(t, "pcast://login", flow.RedirectURI)
+}
+
+func TestHandler_InitiateAuth_InvalidRedirect(t *testing.T) {
+	for name, tc := range map[string]struct {
+		query string
+		err   error
+	}{
+		"plain challenge":   {"redirect_uri=pcast%3A%2F%2Flogin&code_challenge=challenge&code_challenge_method=plain", nil},
+		"not allowed":       {"redirect_uri=evil%3A%2F%2Flogin&code_challenge=challenge&code_challenge_method=S256", oauthService.ErrRedirectURINotAllowed},
+		"invalid challenge": {"redirect_uri=pcast%3A%2F%2Flogin&code_challenge_method=S256", oauthService.ErrInvalidCodeChallenge},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/auth/keycloak?"+tc.query, nil)
+			rec := httptest.NewRecorder()
+			c := newContext(req, rec, "keycloak")
+
+			handler := NewHandler(&mockOAuthService{authRequestErr: tc.err}, testTokens, nil)
+
+			err := handler.initiateAuth(c)
+			assert.NoError(t, err) // Handler returns nil, writes JSON error
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Empty(t, rec.Result().Cookies())
+		})
+	}
+}
+
+func TestHandler_InitiateAuth_UnknownProvider(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/auth/unknown", nil)
+	rec := httptest.NewRecorder()
+	c := newContext(req, rec, "unknown")
+
+	mockService := &mockOAuthService{
+		authURLErr: oauthService.ErrUnknownProvider,
+	}
+	handler := NewHandler(mockService, testTokens, nil)
+
+	err := handler.initiateAuth(c)
 	assert.NoError(t, err) // Handler returns nil, writes JSON error
-	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Empty(t, rec.Result().Cookies())
 }
 
-func TestHandler_HandleGoogleCallback_Success(t *testing.T) {
-	e := echo.New()
-	req := httptest.NewRequest(http.MethodGet, "/auth/google/callback?code=valid-code&state=test-state", nil)
-	req.AddCookie(&http.Cookie{
-		Name:  "oauth_state",
-		Value: "test-state",
-	})
+func TestHandler_InitiateAuth_ProviderUnavailable(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/auth/keycloak", nil)
 	rec := httptest.NewRecorder()
-	c := e.NewContext(req, rec)
+	c := newContext(req, rec, "keycloak")
 
 	mockService := &mockOAuthService{
-		callbackToken: "jwt-token-here",
+		authURLErr: fmt.Errorf("%w: keycloak: connection refused", oauthService.ErrProviderUnavailable),
 	}
-	handler := NewHandler(mockService)
+	handler := NewHandler(mockService, testTokens, nil)
 
-	err := handler.handleGoogleCallback(c)
+	err := handler.initiateAuth(c)
+	assert.NoError(t, err) // Handler returns nil, writes JSON error
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+}
+
+func newCallbackRequest(query string, state string) *http.Request {
+	return newFlowCallbackRequest(query, &authFlow{AuthRequest: &oauthService.AuthRequest{State: state}})
+}
+
+// newFlowCallbackRequest creates a callback with the flow in the cookie, no cookie if the state of the flow is empty
+func newFlowCallbackRequest(query string, flow *authFlow) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/auth/google/callback?"+query, nil)
+	if flow.State != "" {
+		value, _ := testTokens.SealFlow(flow)
+		req.AddCookie(&http.Cookie{
+			Name:  "oauth_flow",
+			Value: value,
+		})
+	}
+	return req
+}
+
+func TestHandler_HandleCallback_Success(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := newContext(newCallbackRequest("code=valid-code&state=test-state", "test-state"), rec, "google")
+
+	mockService := &mockOAuthService{
+		callbackResult: &oauthService.CallbackResult{Login: &userService.LoginResult{
+			Tokens: &auth.TokenPair{AccessToken: "jwt-token-here", RefreshToken: "refresh-token-here", ExpiresIn: 600},
+		}},
+	}
+	handler := NewHandler(mockService, testTokens, nil)
+
+	err := handler.handleCallback(c)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "google", mockService.provider)
+	assert.Equal(t, "test-state", mockService.request.State)
 	assert.Contains(t, rec.Body.String(), "jwt-token-here")
+	assert.Contains(t, rec.Body.String(), "refresh-token-here")
 }
 
-func TestHandler_HandleGoogleCallback_MissingCode(t *testing.T) {
-	e := echo.New()
-	req := httptest.NewRequest(http.MethodGet, "/auth/google/callback?state=test-state", nil)
+func TestHandler_HandleCallback_TwoFactor(t *testing.T) {
 	rec := httptest.NewRecorder()
-	c := e.NewContext(req, rec)
+	c := newContext(newCallbackRequest("code=valid-code&state=test-state", "test-state"), rec, "google")
+
+	mockService := &mockOAuthService{
+		callbackResult: &oauthService.CallbackResult{Login: &userService.LoginResult{ChallengeToken: "challenge-here"}},
+	}
+	handler := NewHandler(mockService, testTokens, nil)
+
+	err := handler.handleCallback(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"twoFactorRequired": true, "challengeToken": "challenge-here"}`, rec.Body.String())
+}
+
+func TestHandler_HandleCallback_MissingCode(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := newContext(newCallbackRequest("state=test-state", ""), rec, "google")
 
-	handler := NewHandler(&mockOAuthService{})
+	handler := NewHandler(&mockOAuthService{}, testTokens, nil)
 
-	err := handler.handleGoogleCallback(c)
+	err := handler.handleCallback(c)
 	assert.NoError(t, err) // Handler returns nil, writes JSON error
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 	assert.Contains(t, rec.Body.String(), "missing code or state parameter")
 }
 
-func TestHandler_HandleGoogleCallback_MissingState(t *testing.T) {
-	e := echo.New()
-	req := httptest.NewRequest(http.MethodGet, "/auth/google/callback?code=valid-code", nil)
+func TestHandler_HandleCallback_MissingState(t *testing.T) {
 	rec := httptest.NewRecorder()
-	c := e.NewContext(req, rec)
+	c := newContext(newCallbackRequest("code=valid-code", ""), rec, "google")
 
-	handler := NewHandler(&mockOAuthService{})
+	handler := NewHandler(&mockOAuthService{}, testTokens, nil)
 
-	err := handler.handleGoogleCallback(c)
+	err := handler.handleCallback(c)
 	assert.NoError(t, err) // Handler returns nil, writes JSON error
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 	assert.Contains(t, rec.Body.String(), "missing code or state parameter")
 }
 
-func TestHandler_HandleGoogleCallback_InvalidState(t *testing.T) {
-	e := echo.New()
-	req := httptest.NewRequest(http.MethodGet, "/auth/google/callback?code=valid-code&state=wrong-state", nil)
-	req.AddCookie(&http.Cookie{
-		Name:  "oauth_state",
-		Value: "correct-state",
-	})
+func TestHandler_HandleCallback_InvalidState(t *testing.T) {
 	rec := httptest.NewRecorder()
-	c := e.NewContext(req, rec)
+	c := newContext(newCallbackRequest("code=valid-code&state=wrong-state", "correct-state"), rec, "google")
 
-	handler := NewHandler(&mockOAuthService{})
+	handler := NewHandler(&mockOAuthService{}, testTokens, nil)
 
-	err := handler.handleGoogleCallback(c)
+	err := handler.handleCallback(c)
 	assert.NoError(t, err) // Handler returns nil, writes JSON error
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 	assert.Contains(t, rec.Body.String(), "invalid state parameter")
 }
 
-func TestHandler_HandleGoogleCallback_MissingStateCookie(t *testing.T) {
-	e := echo.New()
-	req := httptest.NewRequest(http.MethodGet, "/auth/google/callback?code=valid-code&state=test-state", nil)
-	// No cookie set
+func TestHandler_HandleCallback_UnsignedStateCookie(t *testing.T) {
+	flow := &authFlow{AuthRequest: &oauthService.AuthRequest{State: "test-state", RedirectURI: "evil://login", Link: true}}
+	data, err := json.Marshal(flow)
+	require.NoError(t, err)
+	otherTokens := auth.NewTokenService(nil, nil, auth.NewHMACKeys("othersecret"), 10, 30)
+	signedByOther, err := otherTokens.SealFlow(flow)
+	require.NoError(t, err)
+
+	for name, value := range map[string]string{
+		"unsigned":        base64.RawURLEncoding.EncodeToString(data),
+		"signed by other": signedByOther,
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/auth/google/callback?code=valid-code&state=test-state", nil)
+			req.AddCookie(&http.Cookie{Name: "oauth_flow", Value: value})
+			rec := httptest.NewRecorder()
+			c := newContext(req, rec, "google")
+
+			mockService := &mockOAuthService{}
+			handler := NewHandler(mockService, testTokens, nil)
+
+			err := handler.handleCallback(c)
+			assert.NoError(t, err) // Handler returns nil, writes JSON error
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), "invalid state parameter")
+			assert.Nil(t, mockService.request)
+		})
+	}
+}
+
+func TestHandler_HandleCallback_MissingStateCookie(t *testing.T) {
 	rec := httptest.NewRecorder()
-	c := e.NewContext(req, rec)
+	// No cookie set
+	c := newContext(newCallbackRequest("code=valid-code&state=test-state", ""), rec, "google")
 
-	handler := NewHandler(&mockOAuthService{})
+	handler := NewHandler(&mockOAuthService{}, testTokens, nil)
 
-	err := handler.handleGoogleCallback(c)
+	err := handler.handleCallback(c)
 	assert.NoError(t, err) // Handler returns nil, writes JSON error
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 	assert.Contains(t, rec.Body.String(), "invalid state parameter")
 }
 
-func TestHandler_HandleGoogleCallback_ServiceError(t *testing.T) {
-	e := echo.New()
-	req := httptest.NewRequest(http.MethodGet, "/auth/google/callback?code=invalid-code&state=test-state", nil)
-	req.AddCookie(&http.Cookie{
-		Name:  "oauth_state",
-		Value: "test-state",
-	})
+func TestHandler_HandleCallback_ServiceError(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		status int
+	}{
+		{errors.New("service error"), http.StatusInternalServerError},
+		{oauthService.ErrUnknownProvider, http.StatusNotFound},
+		{oauthService.ErrFailedExchange, http.StatusUnauthorized},
+		{oauthService.ErrInvalidIDToken, http.StatusUnauthorized},
+		{oauthService.ErrUnverifiedEmail, http.StatusForbidden},
+		{oauthService.ErrUnverifiedAccount, http.StatusForbidden},
+		{oauthService.ErrAccountExists, http.StatusForbidden},
+		{oauthService.ErrFailedUserInfo, http.StatusBadGateway},
+	} {
+		t.Run(tc.err.Error(), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := newContext(newCallbackRequest("code=invalid-code&state=test-state", "test-state"), rec, "google")
+
+			mockService := &mockOAuthService{
+				callbackErr: tc.err,
+			}
+			handler := NewHandler(mockService, testTokens, nil)
+
+			err := handler.handleCallback(c)
+			assert.NoError(t, err) // Handler returns nil, writes JSON error
+			assert.Equal(t, tc.status, rec.Code)
+			assert.Contains(t, rec.Body.String(), tc.err.Error())
+		})
+	}
+}
+
+func TestHandler_HandleCallback_RedirectURI(t *testing.T) {
 	rec := httptest.NewRecorder()
-	c := e.NewContext(req, rec)
+	flow := &authFlow{
+		AuthRequest: &oauthService.AuthRequest{State: "test-state", RedirectURI: "pcast://login"},
+		ClientState: "app-state",
+	}
+	c := newContext(newFlowCallbackRequest("code=valid-code&state=test-state", flow), rec, "google")
 
 	mockService := &mockOAuthService{
-		callbackErr: errors.New("service error"),
+		callbackResult: &oauthService.CallbackResult{LoginCode: "login-code", RedirectURI: "pcast://login"},
+	}
+	handler := NewHandler(mockService, testTokens, nil)
+
+	err := handler.handleCallback(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "pcast://login?code=login-code&state=app-state", rec.Header().Get("Location"))
+	assert.Equal(t, "pcast://login", mockService.request.RedirectURI)
+}
+
+func TestHandler_HandleCallback_RedirectURIError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		code string
+	}{
+		{oauthService.ErrUnverifiedEmail, "access_denied"},
+		{oauthService.ErrInvalidIDToken, "access_denied"},
+		{oauthService.ErrFailedUserInfo, "temporarily_unavailable"},
+		{errors.New("service error"), "server_error"},
+	} {
+		t.Run(tc.err.Error(), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			flow := &authFlow{AuthRequest: &oauthService.AuthRequest{State: "test-state", RedirectURI: "http://127.0.0.1:51234/callback"}}
+			c := newContext(newFlowCallbackRequest("code=valid-code&state=test-state", flow), rec, "google")
+
+			handler := NewHandler(&mockOAuthService{callbackErr: tc.err}, testTokens, nil)
+
+			err := handler.handleCallback(c)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusFound, rec.Code)
+			location, err := url.Parse(rec.Header().Get("Location"))
+			require.NoError(t, err)
+			assert.Equal(t, "127.0.0.1:51234", location.Host)
+			assert.Equal(t, tc.code, location.Query().Get("error"))
+			assert.Equal(t, tc.err.Error(), location.Query().Get("error_description"))
+			assert.False(t, location.Query().Has("state"))
+		})
 	}
-	handler := NewHandler(mockService)
+}
+
+func TestHandler_HandleCallback_RedirectURINotAllowed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	flow := &authFlow{AuthRequest: &oauthService.AuthRequest{State: "test-state", RedirectURI: "evil://login"}}
+	c := newContext(newFlowCallbackRequest("code=valid-code&state=test-state", flow), rec, "google")
+
+	handler := NewHandler(&mockOAuthService{callbackErr: oauthService.ErrRedirectURINotAllowed}, testTokens, nil)
+
+	err := handler.handleCallback(c)
+	assert.NoError(t, err)
+	// Never redirect to a URI that is not allow-listed
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Empty(t, rec.Header().Get("Location"))
+}
+
+func newTokenContext(body string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	e.Validator = validator.New()
+	req := httptest.NewRequest(http.MethodPost, "/auth/token", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	return e.NewContext(req, rec), rec
+}
+
+func TestHandler_ExchangeToken(t *testing.T) {
+	c, rec := newTokenContext(`{"code": "login-code", "codeVerifier": "verifier"}`)
+
+	handler := NewHandler(&mockOAuthService{
+		exchangeResult: &userService.LoginResult{
+			Tokens: &auth.TokenPair{AccessToken: "jwt-token-here", RefreshToken: "refresh-token-here", ExpiresIn: 600},
+		},
+	}, testTokens, nil)
+
+	err := handler.exchangeToken(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"token": "jwt-token-here", "refreshToken": "refresh-token-here", "expiresIn": 600}`, rec.Body.String())
+}
+
+func TestHandler_ExchangeToken_TwoFactor(t *testing.T) {
+	c, rec := newTokenContext(`{"code": "login-code", "codeVerifier": "verifier"}`)
+
+	handler := NewHandler(&mockOAuthService{
+		exchangeResult: &userService.LoginResult{ChallengeToken: "challenge-here"},
+	}, testTokens, nil)
+
+	err := handler.exchangeToken(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"twoFactorRequired": true, "challengeToken": "challenge-here"}`, rec.Body.String())
+}
+
+func TestHandler_ExchangeToken_InvalidCode(t *testing.T) {
+	c, rec := newTokenContext(`{"code": "login-code", "codeVerifier": "wrong"}`)
+
+	handler := NewHandler(&mockOAuthService{exchangeErr: auth.ErrInvalidLoginCode}, testTokens, nil)
+
+	err := handler.exchangeToken(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestHandler_ExchangeToken_MissingVerifier(t *testing.T) {
+	c, _ := newTokenContext(`{"code": "login-code"}`)
+
+	handler := NewHandler(&mockOAuthService{}, testTokens, nil)
+
+	err := handler.exchangeToken(c)
+	assert.Error(t, err)
+}
+
+func TestHandler_InitiateAuth_Link(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/auth/keycloak?intent=link&code_challenge=challenge&code_challenge_method=S256", nil)
+	rec := httptest.NewRecorder()
+	c := newContext(req, rec, "keycloak")
+
+	mockService := &mockOAuthService{authURL: "https://keycloak.example.com/auth?client_id=test"}
+	handler := NewHandler(mockService, testTokens, nil)
+
+	err := handler.initiateAuth(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTemporaryRedirect, rec.Code)
+	assert.True(t, mockService.request.Link)
+	assert.Equal(t, "challenge", mockService.request.CodeChallenge)
+}
+
+func TestHandler_InitiateAuth_LinkWithoutChallenge(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/auth/keycloak?intent=link", nil)
+	rec := httptest.NewRecorder()
+	c := newContext(req, rec, "keycloak")
+
+	mockService := &mockOAuthService{}
+	handler := NewHandler(mockService, testTokens, nil)
+
+	err := handler.initiateAuth(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Nil(t, mockService.request)
+}
 
-	err := handler.handleGoogleCallback(c)
+func TestHandler_InitiateAuth_InvalidIntent(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/auth/keycloak?intent=delete", nil)
+	rec := httptest.NewRecorder()
+	c := newContext(req, rec, "keycloak")
+
+	handler := NewHandler(&mockOAuthService{}, testTokens, nil)
+
+	err := handler.initiateAuth(c)
 	assert.NoError(t, err) // Handler returns nil, writes JSON error
-	assert.Equal(t, http.StatusInternalServerError, rec.Code)
-	assert.Contains(t, rec.Body.String(), "service error")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandler_HandleCallback_Link(t *testing.T) {
+	rec := httptest.NewRecorder()
+	flow := &authFlow{AuthRequest: &oauthService.AuthRequest{State: "test-state", Link: true}}
+	c := newContext(newFlowCallbackRequest("code=valid-code&state=test-state", flow), rec, "google")
+
+	mockService := &mockOAuthService{callbackResult: &oauthService.CallbackResult{LinkCode: "link-code"}}
+	handler := NewHandler(mockService, testTokens, nil)
+
+	err := handler.handleCallback(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.JSONEq(t, `{"linkCode": "link-code"}`, rec.Body.String())
+	assert.True(t, mockService.request.Link)
+}
+
+func TestHandler_HandleCallback_LinkRedirectURI(t *testing.T) {
+	rec := httptest.NewRecorder()
+	flow := &authFlow{AuthRequest: &oauthService.AuthRequest{State: "test-state", RedirectURI: "pcast://link", Link: true}}
+	c := newContext(newFlowCallbackRequest("code=valid-code&state=test-state", flow), rec, "google")
+
+	handler := NewHandler(&mockOAuthService{
+		callbackResult: &oauthService.CallbackResult{LinkCode: "link-code", RedirectURI: "pcast://link"},
+	}, testTokens, nil)
+
+	err := handler.handleCallback(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "pcast://link?code=link-code", rec.Header().Get("Location"))
+}
+
+// newUserContext creates the context of a signed in user
+func newUserContext(method string, target string, body string, userID uuid.UUID) (echo.Context, *httptest.ResponseRecorder, *authMiddleware.JWTMiddleware) {
+	e := echo.New()
+	e.Validator = validator.New()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	middleware := authMiddleware.NewJWTMiddleware()
+	middleware.SetUserID(c, userID)
+	return c, rec, middleware
+}
+
+func TestHandler_GetIdentities(t *testing.T) {
+	userID := uuid.Must(uuid.NewV7())
+	c, rec, middleware := newUserContext(http.MethodGet, "/user/identities", "", userID)
+	linkedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	handler := NewHandler(&mockOAuthService{
+		providers: []*oauthService.Provider{
+			oauthService.NewProvider(config.OAuthProvider{Name: "keycloak", DisplayName: "Keycloak"}, http.DefaultClient),
+		},
+		identities: []identityStore.Identity{
+			{UserID: userID, Provider: "keycloak", Subject: "subject-123", Email: "foo@example.com", CreatedAt: linkedAt},
+			{UserID: userID, Provider: "removed", Subject: "subject-456", Email: "bar@example.com", CreatedAt: linkedAt},
+		},
+	}, testTokens, middleware)
+
+	err := handler.getIdentities(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[
+		{"provider": "keycloak", "displayName": "Keycloak", "email": "foo@example.com", "linkedAt": "2026-01-02T03:04:05Z"},
+		{"provider": "removed", "displayName": "removed", "email": "bar@example.com", "linkedAt": "2026-01-02T03:04:05Z"}
+	]`, rec.Body.String())
+}
+
+func TestHandler_LinkIdentity(t *testing.T) {
+	userID := uuid.Must(uuid.NewV7())
+	c, rec, middleware := newUserContext(http.MethodPost, "/user/identities", `{"code": "link-code", "codeVerifier": "verifier"}`, userID)
+
+	mockService := &mockOAuthService{}
+	handler := NewHandler(mockService, testTokens, middleware)
+
+	err := handler.linkIdentity(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	require.Len(t, mockService.identities, 1)
+	assert.Equal(t, userID, mockService.identities[0].UserID)
+	assert.Contains(t, rec.Body.String(), `"provider":"keycloak"`)
+}
+
+func TestHandler_LinkIdentity_MissingVerifier(t *testing.T) {
+	c, _, middleware := newUserContext(http.MethodPost, "/user/identities", `{"code": "link-code"}`, uuid.Must(uuid.NewV7()))
+
+	mockService := &mockOAuthService{}
+	handler := NewHandler(mockService, testTokens, middleware)
+
+	err := handler.linkIdentity(c)
+	assert.Error(t, err)
+	assert.Empty(t, mockService.identities)
+}
+
+func TestHandler_LinkIdentity_Error(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		status int
+	}{
+		{auth.ErrInvalidLinkCode, http.StatusBadRequest},
+		{oauthService.ErrUnknownProvider, http.StatusNotFound},
+		{oauthService.ErrIdentityLinked, http.StatusConflict},
+		{oauthService.ErrProviderLinked, http.StatusConflict},
+		{errors.New("service error"), http.StatusInternalServerError},
+	} {
+		t.Run(tc.err.Error(), func(t *testing.T) {
+			c, rec, middleware := newUserContext(http.MethodPost, "/user/identities", `{"code": "link-code", "codeVerifier": "verifier"}`, uuid.Must(uuid.NewV7()))
+
+			handler := NewHandler(&mockOAuthService{linkErr: tc.err}, testTokens, middleware)
+
+			err := handler.linkIdentity(c)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.status, rec.Code)
+		})
+	}
+}
+
+func TestHandler_UnlinkIdentity(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		status int
+	}{
+		{nil, http.StatusNoContent},
+		{oauthService.ErrIdentityNotFound, http.StatusNotFound},
+		{oauthService.ErrLastLoginMethod, http.StatusConflict},
+	} {
+		t.Run(http.StatusText(tc.status), func(t *testing.T) {
+			c, rec, middleware := newUserContext(http.MethodDelete, "/user/identities/keycloak", "", uuid.Must(uuid.NewV7()))
+			c.SetParamNames("provider")
+			c.SetParamValues("keycloak")
+
+			mockService := &mockOAuthService{unlinkErr: tc.err}
+			handler := NewHandler(mockService, testTokens, middleware)
+
+			err := handler.unlinkIdentity(c)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.status, rec.Code)
+			assert.Equal(t, "keycloak", mockService.provider)
+		})
+	}
 }
 
 func TestHandler_Register(t *testing.T) {
 	e := echo.New()
 	g := e.Group("/api")
 
-	handler := NewHandler(&mockOAuthService{})
-	handler.Register(g)
+	handler := NewHandler(&mockOAuthService{}, testTokens, nil)
+	handler.Register(g, g)
 
 	// Verify routes are registered
 	routes := e.Routes()
-	var foundGoogleAuth, foundGoogleCallback bool
+	var foundProviders, foundAuth, foundCallback, foundToken, foundIdentities, foundLink, foundUnlink bool
 	for _, route := range routes {
-		if route.Path == "/api/auth/google" && route.Method == http.MethodGet {
-			foundGoogleAuth = true
+		if route.Path == "/api/auth/providers" && route.Method == http.MethodGet {
+			foundProviders = true
+		}
+		if route.Path == "/api/auth/:provider" && route.Method == http.MethodGet {
+			foundAuth = true
+		}
+		if route.Path == "/api/auth/:provider/callback" && route.Method == http.MethodGet {
+			foundCallback = true
+		}
+		if route.Path == "/api/auth/token" && route.Method == http.MethodPost {
+			foundToken = true
+		}
+		if route.Path == "/api/user/identities" && route.Method == http.MethodGet {
+			foundIdentities = true
+		}
+		if route.Path == "/api/user/identities" && route.Method == http.MethodPost {
+			foundLink = true
 		}
-		if route.Path == "/api/auth/google/callback" && route.Method == http.MethodGet {
-			foundGoogleCallback = true
+		if route.Path == "/api/user/identities/:provider" && route.Method == http.MethodDelete {
+			foundUnlink = true
 		}
 	}
 
-	assert.True(t, foundGoogleAuth, "GET /api/auth/google route should be registered")
-	assert.True(t, foundGoogleCallback, "GET /api/auth/google/callback route should be registered")
+	assert.True(t, foundProviders, "GET /api/auth/providers route should be registered")
+	assert.True(t, foundAuth, "GET /api/auth/:provider route should be registered")
+	assert.True(t, foundCallback, "GET /api/auth/:provider/callback route should be registered")
+	assert.True(t, foundToken, "POST /api/auth/token route should be registered")
+	assert.True(t, foundIdentities, "GET /api/user/identities route should be registered")
+	assert.True(t, foundLink, "POST /api/user/identities route should be registered")
+	assert.True(t, foundUnlink, "DELETE /api/user/identities/:provider route should be registered")
 }
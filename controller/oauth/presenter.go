@@ -1,7 +1,84 @@
 package oauth
 
-// LoginResponse represents a successful OAuth login response
+import (
+	"time"
+
+	"pcast-api/service/auth"
+	oauthService "pcast-api/service/oauth"
+	identityStore "pcast-api/store/identity"
+)
+
+// LoginResponse represents a successful OAuth login response. If the user enabled two-factor authentication,
+// only TwoFactorRequired and ChallengeToken are set and the login continues at /user/login/2fa.
 // @model LoginResponse
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	// ExpiresIn is the lifetime of the access token in seconds
+	ExpiresIn         int    `json:"expiresIn,omitempty"`
+	TwoFactorRequired bool   `json:"twoFactorRequired,omitempty"`
+	ChallengeToken    string `json:"challengeToken,omitempty"`
+}
+
+func NewLoginResponse(pair *auth.TokenPair) LoginResponse {
+	return LoginResponse{Token: pair.AccessToken, RefreshToken: pair.RefreshToken, ExpiresIn: pair.ExpiresIn}
+}
+
+func NewChallengeResponse(challenge string) LoginResponse {
+	return LoginResponse{TwoFactorRequired: true, ChallengeToken: challenge}
+}
+
+// ProviderPresenter represents a provider users can sign in with at /auth/{name}
+// @model ProviderPresenter
+type ProviderPresenter struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+func NewProviderPresenters(providers []*oauthService.Provider) []ProviderPresenter {
+	presenters := make([]ProviderPresenter, len(providers))
+	for i, p := range providers {
+		presenters[i] = ProviderPresenter{Name: p.Name, DisplayName: p.DisplayName}
+	}
+	return presenters
+}
+
+// LinkResponse represents the result of a login with intent=link, the code is redeemed at POST /user/identities
+// @model LinkResponse
+type LinkResponse struct {
+	LinkCode string `json:"linkCode"`
+}
+
+// IdentityPresenter represents an account at a provider that is linked to the user
+// @model IdentityPresenter
+type IdentityPresenter struct {
+	Provider    string `json:"provider"`
+	DisplayName string `json:"displayName"`
+	// Email is the address reported by the provider when the identity was linked
+	Email    string    `json:"email"`
+	LinkedAt time.Time `json:"linkedAt"`
+}
+
+// NewIdentityPresenter presents the identity, the display name is the provider name if the provider was removed from the config
+func NewIdentityPresenter(identity *identityStore.Identity, providers []*oauthService.Provider) IdentityPresenter {
+	presenter := IdentityPresenter{
+		Provider:    identity.Provider,
+		DisplayName: identity.Provider,
+		Email:       identity.Email,
+		LinkedAt:    identity.CreatedAt,
+	}
+	for _, p := range providers {
+		if p.Name == identity.Provider {
+			presenter.DisplayName = p.DisplayName
+		}
+	}
+	return presenter
+}
+
+func NewIdentityPresenters(identities []identityStore.Identity, providers []*oauthService.Provider) []IdentityPresenter {
+	presenters := make([]IdentityPresenter, len(identities))
+	for i := range identities {
+		presenters[i] = NewIdentityPresenter(&identities[i], providers)
+	}
+	return presenters
 }
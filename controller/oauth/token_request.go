@@ -0,0 +1,17 @@
+package oauth
+
+// TokenRequest redeems the login code an app received at its redirect URI
+// @model TokenRequest
+type TokenRequest struct {
+	Code string `json:"code" validate:"required"`
+	// CodeVerifier is the PKCE verifier of the code_challenge the app started the login with
+	CodeVerifier string `json:"codeVerifier" validate:"required"`
+}
+
+// LinkIdentityRequest links the identity of a login with intent=link to the signed in user
+// @model LinkIdentityRequest
+type LinkIdentityRequest struct {
+	Code string `json:"code" validate:"required"`
+	// CodeVerifier is the PKCE verifier of the code_challenge the link login was started with
+	CodeVerifier string `json:"codeVerifier" validate:"required"`
+}
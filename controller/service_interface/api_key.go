@@ -0,0 +1,16 @@
+package service_interface
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	store "pcast-api/store/apikey"
+)
+
+type APIKey interface {
+	Create(ctx context.Context, userID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (*store.APIKey, string, error)
+	List(ctx context.Context, userID uuid.UUID) ([]store.APIKey, error)
+	Delete(ctx context.Context, userID uuid.UUID, id uuid.UUID) error
+}
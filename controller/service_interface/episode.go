@@ -0,0 +1,17 @@
+package service_interface
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	store "pcast-api/store/episode"
+)
+
+type Episode interface {
+	GetEpisodesByFeedID(ctx context.Context, userID uuid.UUID, feedID uuid.UUID) ([]store.Episode, error)
+	GetEpisode(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*store.Episode, error)
+	UpdateEpisode(ctx context.Context, userID uuid.UUID, id uuid.UUID, currentPosition *int, played *bool) (*store.Episode, error)
+	UpdateProgress(ctx context.Context, userID uuid.UUID, id uuid.UUID, position int, played bool, timestamp time.Time) (*store.Episode, error)
+}
@@ -0,0 +1,13 @@
+package service_interface
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	exportService "pcast-api/service/export"
+)
+
+type Export interface {
+	NewExport(ctx context.Context, userID uuid.UUID) (*exportService.Export, error)
+}
@@ -3,6 +3,8 @@ package service_interface
 import (
 	"context"
 	"github.com/google/uuid"
+	"io"
+	feedService "pcast-api/service/feed"
 	store "pcast-api/store/feed"
 )
 
@@ -12,4 +14,8 @@ type Feed interface {
 	DeleteFeed(ctx context.Context, userID uuid.UUID, id uuid.UUID) error
 	SyncFeed(ctx context.Context, userID uuid.UUID, id uuid.UUID) error
 	GetFeedsByUserID(ctx context.Context, userID uuid.UUID) ([]store.Feed, error)
+	ImportOPML(ctx context.Context, userID uuid.UUID, r io.Reader) ([]feedService.ImportResult, error)
+	ExportOPML(ctx context.Context, userID uuid.UUID, w io.Writer) error
+	SetCredentials(feed *store.Feed, credentials *store.Credentials) error
+	UpdateCredentials(ctx context.Context, userID uuid.UUID, id uuid.UUID, credentials *store.Credentials) (*store.Feed, error)
 }
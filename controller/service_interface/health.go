@@ -0,0 +1,11 @@
+package service_interface
+
+import (
+	"context"
+
+	healthService "pcast-api/service/health"
+)
+
+type Health interface {
+	Ready(ctx context.Context) *healthService.Status
+}
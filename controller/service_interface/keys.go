@@ -0,0 +1,9 @@
+package service_interface
+
+import (
+	"pcast-api/service/auth"
+)
+
+type Keys interface {
+	PublicKeys() []auth.PublicKey
+}
@@ -1,8 +1,22 @@
 package service_interface
 
-import "context"
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	oauthService "pcast-api/service/oauth"
+	userService "pcast-api/service/user"
+	identityStore "pcast-api/store/identity"
+)
 
 type OAuth interface {
-	GetGoogleAuthURL(state string) (string, error)
-	HandleGoogleCallback(ctx context.Context, code string) (string, error)
+	Providers() []*oauthService.Provider
+	NewAuthRequest(redirectURI string, codeChallenge string, link bool) (*oauthService.AuthRequest, error)
+	GetAuthURL(ctx context.Context, provider string, req *oauthService.AuthRequest) (string, error)
+	HandleCallback(ctx context.Context, provider string, code string, req *oauthService.AuthRequest) (*oauthService.CallbackResult, error)
+	ExchangeLoginCode(ctx context.Context, code string, verifier string) (*userService.LoginResult, error)
+	Identities(ctx context.Context, userID uuid.UUID) ([]identityStore.Identity, error)
+	LinkIdentity(ctx context.Context, userID uuid.UUID, code string, verifier string) (*identityStore.Identity, error)
+	UnlinkIdentity(ctx context.Context, userID uuid.UUID, provider string) error
 }
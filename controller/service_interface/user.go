@@ -2,14 +2,32 @@ package service_interface
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 
+	"pcast-api/service/auth"
+	userService "pcast-api/service/user"
 	store "pcast-api/store/user"
 )
 
 type User interface {
 	CreateUser(ctx context.Context, email, password string) (*store.User, error)
-	Login(ctx context.Context, email string, password string) (string, error)
+	Login(ctx context.Context, email string, password string) (*userService.LoginResult, error)
+	LoginTwoFactor(ctx context.Context, challenge string, code string) (*auth.TokenPair, error)
+	RefreshToken(ctx context.Context, refreshToken string) (*auth.TokenPair, error)
+	Logout(ctx context.Context, userID uuid.UUID, tokenID string, expiresAt time.Time, refreshToken string) error
+	LogoutAll(ctx context.Context, userID uuid.UUID) error
 	UpdatePassword(ctx context.Context, userID uuid.UUID, oldPassword string, newPassword string) error
+	DeleteAccount(ctx context.Context, userID uuid.UUID, password string, authenticatedAt time.Time) error
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token string, newPassword string) error
+	SendVerification(ctx context.Context, user *store.User) error
+	ResendVerification(ctx context.Context, email string) error
+	VerifyEmail(ctx context.Context, token string) error
+	EnrollTwoFactor(ctx context.Context, userID uuid.UUID) (*userService.TwoFactorEnrollment, error)
+	ConfirmTwoFactor(ctx context.Context, userID uuid.UUID, code string) ([]string, error)
+	DisableTwoFactor(ctx context.Context, userID uuid.UUID, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error)
+	GetTwoFactorStatus(ctx context.Context, userID uuid.UUID) (*userService.TwoFactorStatus, error)
 }
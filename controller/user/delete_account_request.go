@@ -0,0 +1,8 @@
+package user
+
+// DeleteAccountRequest confirms the deletion of the account. The password may be left out within
+// 5 minutes of signing in, users without password sign in again instead.
+// @model DeleteAccountRequest
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
@@ -0,0 +1,13 @@
+package user
+
+// VerifyEmailRequest confirms the email address with the token from the verification mail
+// @model VerifyEmailRequest
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// ResendVerificationRequest represents a request to mail a new verification link
+// @model ResendVerificationRequest
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
@@ -2,12 +2,14 @@ package user
 
 import (
 	"errors"
+	"log/slog"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
 
 	serviceInterface "pcast-api/controller/service_interface"
 	authMiddleware "pcast-api/middleware/auth"
+	"pcast-api/service/auth"
 	userService "pcast-api/service/user"
 )
 
@@ -22,7 +24,7 @@ func NewHandler(service serviceInterface.User, middleware *authMiddleware.JWTMid
 
 // RegisterUser godoc
 // @Summary Create a new user
-// @Description Register a new user with the data provided in the request
+// @Description Register a new user with the data provided in the request. A link to verify the email address is mailed to the user.
 // @Tags user
 // @Accept json
 // @Produce json
@@ -43,6 +45,11 @@ func (h *Handler) registerUser(c echo.Context) error {
 		return c.NoContent(http.StatusBadRequest)
 	}
 
+	// The account exists at this point, the user can request another mail if sending fails
+	if err := h.service.SendVerification(c.Request().Context(), ud); err != nil {
+		slog.ErrorContext(c.Request().Context(), "email verification error", "error", err)
+	}
+
 	res := NewPresenter(ud)
 
 	return c.JSON(http.StatusCreated, res)
@@ -55,7 +62,10 @@ func (h *Handler) registerUser(c echo.Context) error {
 // @Accept json
 // @Produce json
 // @Param user body LoginRequest true "LoginRequest data"
+// @Description If two-factor authentication is enabled, the response only contains a challenge token for /user/login/2fa.
 // @Success 200 {object} LoginResponse
+// @Failure 401 "Invalid email or password"
+// @Failure 403 "Email address not verified"
 // @Router /user/login [post]
 func (h *Handler) loginUser(c echo.Context) error {
 	req := new(LoginRequest)
@@ -66,12 +76,91 @@ func (h *Handler) loginUser(c echo.Context) error {
 		return err
 	}
 
-	token, err := h.service.Login(c.Request().Context(), req.Email, req.Password)
+	result, err := h.service.Login(c.Request().Context(), req.Email, req.Password)
 	if err != nil {
+		if errors.Is(err, userService.ErrEmailNotVerified) {
+			return c.NoContent(http.StatusForbidden)
+		}
 		return c.NoContent(http.StatusUnauthorized)
 	}
 
-	return c.JSON(http.StatusOK, LoginResponse{Token: token})
+	if result.ChallengeToken != "" {
+		return c.JSON(http.StatusOK, NewChallengeResponse(result.ChallengeToken))
+	}
+
+	return c.JSON(http.StatusOK, NewLoginResponse(result.Tokens))
+}
+
+// LoginTwoFactor godoc
+// @Summary Complete a two-factor login
+// @Description Exchange the challenge token of a password login and a TOTP or recovery code for an access token and refresh token.
+// @Description The challenge token is valid for 5 minutes, every code is accepted once.
+// @Description After 5 invalid codes, all codes of the user are refused for 15 minutes.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param user body TwoFactorLoginRequest true "TwoFactorLoginRequest data"
+// @Success 200 {object} LoginResponse
+// @Failure 401 "Invalid or expired challenge token or invalid code"
+// @Failure 429 "Too many invalid codes"
+// @Router /user/login/2fa [post]
+func (h *Handler) loginTwoFactor(c echo.Context) error {
+	req := new(TwoFactorLoginRequest)
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	tokens, err := h.service.LoginTwoFactor(c.Request().Context(), req.ChallengeToken, req.Code)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidChallenge) || errors.Is(err, userService.ErrInvalidTwoFactorCode) {
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		if errors.Is(err, userService.ErrTwoFactorLocked) {
+			return c.NoContent(http.StatusTooManyRequests)
+		}
+		slog.ErrorContext(c.Request().Context(), "store error", "error", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	return c.JSON(http.StatusOK, NewLoginResponse(tokens))
+}
+
+// RefreshToken godoc
+// @Summary Refresh access token
+// @Description Exchange a refresh token for a new access token and refresh token. Every refresh token can be used once,
+// @Description reusing a rotated refresh token revokes all tokens of the login.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param token body RefreshTokenRequest true "RefreshTokenRequest data"
+// @Success 200 {object} LoginResponse
+// @Failure 401 "Invalid, expired or reused refresh token"
+// @Router /user/token/refresh [post]
+func (h *Handler) refreshToken(c echo.Context) error {
+	req := new(RefreshTokenRequest)
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	tokens, err := h.service.RefreshToken(c.Request().Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		if errors.Is(err, userService.ErrTwoFactorLocked) {
+			return c.NoContent(http.StatusTooManyRequests)
+		}
+		slog.ErrorContext(c.Request().Context(), "store error", "error", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	return c.JSON(http.StatusOK, NewLoginResponse(tokens))
 }
 
 // UpdatePassword godoc
@@ -109,8 +198,393 @@ func (h *Handler) updatePassword(c echo.Context) error {
 	return c.NoContent(http.StatusOK)
 }
 
+// Logout godoc
+// @Summary Logout user
+// @Description Revoke the access token of the request and, if given, the refresh token of the same login
+// @Tags user
+// @Accept json
+// @Param Authorization header string true "User ID"
+// @Param logout body LogoutRequest false "LogoutRequest data"
+// @Success 204 "Logged out"
+// @Failure 400 "The access token has no ID and cannot be revoked, sign in again"
+// @Router /user/logout [post]
+func (h *Handler) logout(c echo.Context) error {
+	claims, err := h.middleware.GetClaims(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	req := new(LogoutRequest)
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+
+	err = h.service.Logout(c.Request().Context(), claims.UserID, claims.ID, claims.ExpiresAt, req.RefreshToken)
+	if err != nil {
+		// The client must not believe the session was revoked
+		if errors.Is(err, auth.ErrTokenNotRevocable) {
+			return c.NoContent(http.StatusBadRequest)
+		}
+		slog.ErrorContext(c.Request().Context(), "store error", "error", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// LogoutAll godoc
+// @Summary Logout all sessions
+// @Description Revoke all access and refresh tokens of the user
+// @Tags user
+// @Param Authorization header string true "User ID"
+// @Success 204 "Logged out everywhere"
+// @Router /user/logout/all [post]
+func (h *Handler) logoutAll(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	if err := h.service.LogoutAll(c.Request().Context(), *userID); err != nil {
+		slog.ErrorContext(c.Request().Context(), "store error", "error", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DeleteAccount godoc
+// @Summary Delete the account
+// @Description Delete the user with all feeds, episodes, linked identities and API keys, and revoke all tokens.
+// @Description Requires the password or, without it, a login within the last 5 minutes.
+// @Tags user
+// @Accept json
+// @Param Authorization header string true "User ID"
+// @Param user body DeleteAccountRequest false "DeleteAccountRequest data"
+// @Success 204 "Account deleted"
+// @Failure 401 "Invalid password"
+// @Failure 403 "Sign in again to delete the account"
+// @Router /user [delete]
+func (h *Handler) deleteAccount(c echo.Context) error {
+	claims, err := h.middleware.GetClaims(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	req := new(DeleteAccountRequest)
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+
+	err = h.service.DeleteAccount(c.Request().Context(), claims.UserID, req.Password, claims.AuthenticatedAt)
+	if err != nil {
+		if errors.Is(err, userService.ErrInvalidPassword) {
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		if errors.Is(err, userService.ErrReauthenticationRequired) {
+			return c.NoContent(http.StatusForbidden)
+		}
+		slog.ErrorContext(c.Request().Context(), "store error", "error", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Mail a link to reset the password. The response is the same whether or not the email belongs to an account.
+// @Tags user
+// @Accept json
+// @Param user body ForgotPasswordRequest true "ForgotPasswordRequest data"
+// @Success 202 "Reset mail sent if the account exists"
+// @Router /user/password/forgot [post]
+func (h *Handler) forgotPassword(c echo.Context) error {
+	req := new(ForgotPasswordRequest)
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	if err := h.service.ForgotPassword(c.Request().Context(), req.Email); err != nil {
+		slog.ErrorContext(c.Request().Context(), "password reset error", "error", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password with the token from the reset mail. Logs out all sessions of the user.
+// @Tags user
+// @Accept json
+// @Param user body ResetPasswordRequest true "ResetPasswordRequest data"
+// @Success 204 "Password changed"
+// @Failure 400 "Invalid, expired or used token"
+// @Router /user/password/reset [post]
+func (h *Handler) resetPassword(c echo.Context) error {
+	req := new(ResetPasswordRequest)
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	err := h.service.ResetPassword(c.Request().Context(), req.Token, req.Password)
+	if err != nil {
+		if errors.Is(err, userService.ErrInvalidResetToken) {
+			return c.NoContent(http.StatusBadRequest)
+		}
+		slog.ErrorContext(c.Request().Context(), "store error", "error", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// VerifyEmail godoc
+// @Summary Verify email address
+// @Description Confirm the email address with the token from the verification mail
+// @Tags user
+// @Accept json
+// @Param user body VerifyEmailRequest true "VerifyEmailRequest data"
+// @Success 204 "Email verified"
+// @Failure 400 "Invalid, expired or used token"
+// @Router /user/email/verify [post]
+func (h *Handler) verifyEmail(c echo.Context) error {
+	req := new(VerifyEmailRequest)
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	err := h.service.VerifyEmail(c.Request().Context(), req.Token)
+	if err != nil {
+		if errors.Is(err, userService.ErrInvalidVerificationToken) {
+			return c.NoContent(http.StatusBadRequest)
+		}
+		slog.ErrorContext(c.Request().Context(), "store error", "error", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ResendVerification godoc
+// @Summary Resend verification mail
+// @Description Mail a new link to verify the email address. The response is the same whether or not the email belongs to an account.
+// @Tags user
+// @Accept json
+// @Param user body ResendVerificationRequest true "ResendVerificationRequest data"
+// @Success 202 "Verification mail sent if the account exists and is not verified"
+// @Router /user/email/verify/resend [post]
+func (h *Handler) resendVerification(c echo.Context) error {
+	req := new(ResendVerificationRequest)
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	if err := h.service.ResendVerification(c.Request().Context(), req.Email); err != nil {
+		slog.ErrorContext(c.Request().Context(), "email verification error", "error", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+// GetTwoFactor godoc
+// @Summary Get two-factor authentication status
+// @Description Tell whether two-factor authentication is enabled and how many unused recovery codes are left
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "User ID"
+// @Success 200 {object} TwoFactorStatusPresenter
+// @Router /user/2fa [get]
+func (h *Handler) getTwoFactor(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	status, err := h.service.GetTwoFactorStatus(c.Request().Context(), *userID)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, NewTwoFactorStatusPresenter(status))
+}
+
+// EnrollTwoFactor godoc
+// @Summary Enroll an authenticator
+// @Description Create a new TOTP secret. Two-factor authentication is enabled once a code is confirmed at /user/2fa/confirm.
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "User ID"
+// @Success 200 {object} TwoFactorEnrollmentPresenter
+// @Failure 409 "Two-factor authentication is already enabled"
+// @Failure 501 "Two-factor authentication is not configured"
+// @Router /user/2fa/enroll [post]
+func (h *Handler) enrollTwoFactor(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	enrollment, err := h.service.EnrollTwoFactor(c.Request().Context(), *userID)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, NewTwoFactorEnrollmentPresenter(enrollment))
+}
+
+// ConfirmTwoFactor godoc
+// @Summary Enable two-factor authentication
+// @Description Enable two-factor authentication with a code of the enrolled authenticator.
+// @Description Returns the recovery codes, they cannot be shown again.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User ID"
+// @Param code body TwoFactorCodeRequest true "TwoFactorCodeRequest data"
+// @Success 200 {object} RecoveryCodesPresenter
+// @Failure 400 "Invalid code"
+// @Failure 409 "Not enrolled or already enabled"
+// @Router /user/2fa/confirm [post]
+func (h *Handler) confirmTwoFactor(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	req := new(TwoFactorCodeRequest)
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	codes, err := h.service.ConfirmTwoFactor(c.Request().Context(), *userID, req.Code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, RecoveryCodesPresenter{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor godoc
+// @Summary Disable two-factor authentication
+// @Description Disable two-factor authentication with a TOTP or recovery code. All recovery codes are deleted.
+// @Tags user
+// @Accept json
+// @Param Authorization header string true "User ID"
+// @Param code body TwoFactorCodeRequest true "TwoFactorCodeRequest data"
+// @Success 204 "Two-factor authentication disabled"
+// @Failure 400 "Invalid code"
+// @Failure 409 "Two-factor authentication is not enabled"
+// @Failure 429 "Too many invalid codes"
+// @Router /user/2fa/disable [post]
+func (h *Handler) disableTwoFactor(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	req := new(TwoFactorCodeRequest)
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	if err := h.service.DisableTwoFactor(c.Request().Context(), *userID, req.Code); err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes after checking a TOTP or recovery code
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "User ID"
+// @Param code body TwoFactorCodeRequest true "TwoFactorCodeRequest data"
+// @Success 200 {object} RecoveryCodesPresenter
+// @Failure 400 "Invalid code"
+// @Failure 409 "Two-factor authentication is not enabled"
+// @Failure 429 "Too many invalid codes"
+// @Router /user/2fa/recovery-codes [post]
+func (h *Handler) regenerateRecoveryCodes(c echo.Context) error {
+	userID, err := h.middleware.GetUserID(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	req := new(TwoFactorCodeRequest)
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	codes, err := h.service.RegenerateRecoveryCodes(c.Request().Context(), *userID, req.Code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, RecoveryCodesPresenter{RecoveryCodes: codes})
+}
+
+// twoFactorError maps errors of managing two-factor authentication to a response
+func twoFactorError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, userService.ErrInvalidTwoFactorCode):
+		return c.NoContent(http.StatusBadRequest)
+	case errors.Is(err, userService.ErrTwoFactorEnabled), errors.Is(err, userService.ErrTwoFactorNotEnrolled):
+		return c.NoContent(http.StatusConflict)
+	case errors.Is(err, userService.ErrTwoFactorLocked):
+		return c.NoContent(http.StatusTooManyRequests)
+	case errors.Is(err, userService.ErrTwoFactorUnsupported):
+		return c.NoContent(http.StatusNotImplemented)
+	case errors.Is(err, userService.ErrUserNotFound):
+		return c.NoContent(http.StatusUnauthorized)
+	default:
+		slog.ErrorContext(c.Request().Context(), "store error", "error", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+}
+
 func (h *Handler) Register(public *echo.Group, protected *echo.Group) {
 	public.POST("/user/register", h.registerUser)
 	public.POST("/user/login", h.loginUser)
+	public.POST("/user/login/2fa", h.loginTwoFactor)
+	public.POST("/user/token/refresh", h.refreshToken)
+	public.POST("/user/password/forgot", h.forgotPassword)
+	public.POST("/user/password/reset", h.resetPassword)
+	public.POST("/user/email/verify", h.verifyEmail)
+	public.POST("/user/email/verify/resend", h.resendVerification)
 	protected.PUT("/user/password", h.updatePassword)
+	protected.DELETE("/user", h.deleteAccount)
+	protected.POST("/user/logout", h.logout)
+	protected.POST("/user/logout/all", h.logoutAll)
+	protected.GET("/user/2fa", h.getTwoFactor)
+	protected.POST("/user/2fa/enroll", h.enrollTwoFactor)
+	protected.POST("/user/2fa/confirm", h.confirmTwoFactor)
+	protected.POST("/user/2fa/disable", h.disableTwoFactor)
+	protected.POST("/user/2fa/recovery-codes", h.regenerateRecoveryCodes)
 }
@@ -1,7 +1,23 @@
 package user
 
-// LoginResponse represents a login response
+import "pcast-api/service/auth"
+
+// LoginResponse represents a login response. If the user enabled two-factor authentication,
+// only TwoFactorRequired and ChallengeToken are set and the login continues at /user/login/2fa.
 // @model LoginResponse
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	// ExpiresIn is the lifetime of the access token in seconds
+	ExpiresIn         int    `json:"expiresIn,omitempty"`
+	TwoFactorRequired bool   `json:"twoFactorRequired,omitempty"`
+	ChallengeToken    string `json:"challengeToken,omitempty"`
+}
+
+func NewLoginResponse(pair *auth.TokenPair) LoginResponse {
+	return LoginResponse{Token: pair.AccessToken, RefreshToken: pair.RefreshToken, ExpiresIn: pair.ExpiresIn}
+}
+
+func NewChallengeResponse(challenge string) LoginResponse {
+	return LoginResponse{TwoFactorRequired: true, ChallengeToken: challenge}
 }
@@ -0,0 +1,7 @@
+package user
+
+// LogoutRequest represents a logout request. The refresh token is optional, if given it is revoked as well.
+// @model LogoutRequest
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
@@ -0,0 +1,14 @@
+package user
+
+// ForgotPasswordRequest represents a request to mail a password reset link
+// @model ForgotPasswordRequest
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResetPasswordRequest sets a new password with the token from the reset mail
+// @model ResetPasswordRequest
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
@@ -8,11 +8,13 @@ import (
 // Presenter represents a user presenter
 // @model Presenter
 type Presenter struct {
-	ID uuid.UUID `json:"id"`
+	ID            uuid.UUID `json:"id"`
+	EmailVerified bool      `json:"emailVerified"`
 }
 
 func NewPresenter(user *store.User) *Presenter {
 	return &Presenter{
-		ID: user.ID,
+		ID:            user.ID,
+		EmailVerified: user.EmailVerifiedAt != nil,
 	}
 }
@@ -0,0 +1,7 @@
+package user
+
+// RefreshTokenRequest represents a refresh token request
+// @model RefreshTokenRequest
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
@@ -0,0 +1,33 @@
+package user
+
+import userService "pcast-api/service/user"
+
+// TwoFactorEnrollmentPresenter represents the secret of a new authenticator
+// @model TwoFactorEnrollmentPresenter
+type TwoFactorEnrollmentPresenter struct {
+	// Secret is the base32 encoded secret for manual entry
+	Secret string `json:"secret"`
+	// URI is the otpauth:// URI, usually shown as QR code
+	URI string `json:"uri"`
+}
+
+func NewTwoFactorEnrollmentPresenter(enrollment *userService.TwoFactorEnrollment) *TwoFactorEnrollmentPresenter {
+	return &TwoFactorEnrollmentPresenter{Secret: enrollment.Secret, URI: enrollment.URI}
+}
+
+// RecoveryCodesPresenter represents newly generated recovery codes, they are shown only once
+// @model RecoveryCodesPresenter
+type RecoveryCodesPresenter struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// TwoFactorStatusPresenter represents the 2FA state of a user
+// @model TwoFactorStatusPresenter
+type TwoFactorStatusPresenter struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recoveryCodesRemaining"`
+}
+
+func NewTwoFactorStatusPresenter(status *userService.TwoFactorStatus) *TwoFactorStatusPresenter {
+	return &TwoFactorStatusPresenter{Enabled: status.Enabled, RecoveryCodesRemaining: status.RecoveryCodesRemaining}
+}
@@ -0,0 +1,14 @@
+package user
+
+// TwoFactorLoginRequest completes a login with the challenge token and a TOTP or recovery code
+// @model TwoFactorLoginRequest
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+// TwoFactorCodeRequest confirms a 2FA change with a TOTP or recovery code
+// @model TwoFactorCodeRequest
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
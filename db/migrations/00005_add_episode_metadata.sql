@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE episodes ADD COLUMN title VARCHAR(500) NOT NULL DEFAULT '';
+ALTER TABLE episodes ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE episodes ADD COLUMN url VARCHAR(1000) NOT NULL DEFAULT '';
+ALTER TABLE episodes ADD COLUMN duration INTEGER;
+ALTER TABLE episodes ADD COLUMN published_at TIMESTAMP;
+
+-- Episodes are upserted per feed on sync, keyed on the item GUID
+CREATE UNIQUE INDEX idx_episodes_feed_id_feed_guid ON episodes(feed_id, feed_guid);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_episodes_feed_id_feed_guid;
+ALTER TABLE episodes DROP COLUMN published_at;
+ALTER TABLE episodes DROP COLUMN duration;
+ALTER TABLE episodes DROP COLUMN url;
+ALTER TABLE episodes DROP COLUMN description;
+ALTER TABLE episodes DROP COLUMN title;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Cache validators of the last feed download, sent back to make refreshes conditional
+ALTER TABLE feeds ADD COLUMN etag VARCHAR(500) NOT NULL DEFAULT '';
+ALTER TABLE feeds ADD COLUMN last_modified VARCHAR(100) NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE feeds DROP COLUMN last_modified;
+ALTER TABLE feeds DROP COLUMN etag;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- HTTP credentials of private feeds, encrypted with AES-GCM
+ALTER TABLE feeds ADD COLUMN credentials BYTEA;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE feeds DROP COLUMN credentials;
+-- +goose StatementEnd
@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Accounts of OpenID Connect providers, identified by the issuer's subject
+CREATE TABLE user_identities (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- Name of the provider in the [[oauth.providers]] config
+    provider VARCHAR(64) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_user_identities_provider_subject ON user_identities(provider, subject);
+CREATE UNIQUE INDEX idx_user_identities_user_id_provider ON user_identities(user_id, provider);
+
+INSERT INTO user_identities (id, created_at, updated_at, user_id, provider, subject, email)
+SELECT gen_random_uuid(), created_at, updated_at, id, 'google', google_id, email
+FROM users WHERE google_id IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_users_google_id;
+ALTER TABLE users DROP COLUMN google_id;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN google_id VARCHAR(255) UNIQUE;
+CREATE INDEX idx_users_google_id ON users(google_id);
+
+UPDATE users SET google_id = user_identities.subject
+FROM user_identities
+WHERE user_identities.user_id = users.id AND user_identities.provider = 'google';
+
+DROP INDEX IF EXISTS idx_user_identities_user_id_provider;
+DROP INDEX IF EXISTS idx_user_identities_provider_subject;
+DROP TABLE IF EXISTS user_identities;
+-- +goose StatementEnd
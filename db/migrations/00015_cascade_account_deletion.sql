@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Episodes of deleted feeds were left behind, remove them before adding the constraint
+DELETE FROM episodes WHERE NOT EXISTS (SELECT 1 FROM feeds WHERE feeds.id = episodes.feed_id);
+ALTER TABLE episodes ADD CONSTRAINT fk_episodes_feed
+    FOREIGN KEY (feed_id) REFERENCES feeds(id) ON DELETE CASCADE;
+
+-- The revocation of all tokens of a deleted account must outlive the account until the tokens expired
+ALTER TABLE user_token_revocations DROP CONSTRAINT IF EXISTS user_token_revocations_user_id_fkey;
+
+-- Time of the login a refresh token family was issued for, NULL for tokens issued before it was tracked
+ALTER TABLE refresh_tokens ADD COLUMN authenticated_at TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE refresh_tokens DROP COLUMN authenticated_at;
+
+DELETE FROM user_token_revocations WHERE NOT EXISTS (SELECT 1 FROM users WHERE users.id = user_token_revocations.user_id);
+ALTER TABLE user_token_revocations ADD CONSTRAINT user_token_revocations_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE episodes DROP CONSTRAINT IF EXISTS fk_episodes_feed;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Feeds are not under our control: one over-long title, tracking URL or GUID must not fail the whole sync
+ALTER TABLE episodes ALTER COLUMN feed_guid TYPE TEXT;
+ALTER TABLE episodes ALTER COLUMN title TYPE TEXT;
+ALTER TABLE episodes ALTER COLUMN url TYPE TEXT;
+ALTER TABLE feeds ALTER COLUMN title TYPE TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE feeds ALTER COLUMN title TYPE VARCHAR(500) USING left(title, 500);
+ALTER TABLE episodes ALTER COLUMN url TYPE VARCHAR(1000) USING left(url, 1000);
+ALTER TABLE episodes ALTER COLUMN title TYPE VARCHAR(500) USING left(title, 500);
+ALTER TABLE episodes ALTER COLUMN feed_guid TYPE VARCHAR(255) USING left(feed_guid, 255);
+-- +goose StatementEnd
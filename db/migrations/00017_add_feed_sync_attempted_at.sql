@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Set on every sync, also failed ones, so broken feeds do not stay at the front of the scheduler queue
+ALTER TABLE feeds ADD COLUMN sync_attempted_at TIMESTAMP;
+UPDATE feeds SET sync_attempted_at = synced_at;
+CREATE INDEX idx_feeds_sync_attempted_at ON feeds(sync_attempted_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_feeds_sync_attempted_at;
+ALTER TABLE feeds DROP COLUMN sync_attempted_at;
+-- +goose StatementEnd
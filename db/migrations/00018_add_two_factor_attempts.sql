@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Second factor checks since the last successful one, limited to stop guessing codes. The count starts over
+-- once totp_attempted_at is older than the lockout.
+ALTER TABLE users ADD COLUMN totp_attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN totp_attempted_at TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN totp_attempted_at;
+ALTER TABLE users DROP COLUMN totp_attempts;
+-- +goose StatementEnd
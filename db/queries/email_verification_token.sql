@@ -0,0 +1,12 @@
+-- name: CreateEmailVerificationToken :one
+INSERT INTO email_verification_tokens (id, created_at, updated_at, user_id, token_hash, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: FindEmailVerificationTokenByHash :one
+SELECT * FROM email_verification_tokens WHERE token_hash = $1;
+
+-- name: MarkEmailVerificationTokenUsed :execrows
+UPDATE email_verification_tokens
+SET updated_at = $2, used_at = $2
+WHERE id = $1 AND used_at IS NULL;
@@ -4,15 +4,42 @@ SELECT * FROM episodes ORDER BY created_at DESC;
 -- name: FindEpisodeByID :one
 SELECT * FROM episodes WHERE id = $1;
 
+-- name: FindEpisodesByFeedID :many
+SELECT * FROM episodes WHERE feed_id = $1 ORDER BY published_at DESC NULLS LAST, created_at DESC;
+
+-- name: FindEpisodeByIDAndUserID :one
+SELECT episodes.* FROM episodes
+JOIN feeds ON feeds.id = episodes.feed_id
+WHERE episodes.id = $1 AND feeds.user_id = $2;
+
 -- name: CreateEpisode :one
-INSERT INTO episodes (id, created_at, updated_at, feed_id, feed_guid, current_position, played)
-VALUES ($1, $2, $3, $4, $5, $6, $7)
+INSERT INTO episodes (id, created_at, updated_at, feed_id, feed_guid, title, description, url, duration, published_at, current_position, played)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 RETURNING *;
 
 -- name: UpdateEpisode :exec
 UPDATE episodes 
-SET updated_at = $2, feed_id = $3, feed_guid = $4, current_position = $5, played = $6
+SET updated_at = $2, feed_id = $3, feed_guid = $4, title = $5, description = $6, url = $7, duration = $8, published_at = $9, current_position = $10, played = $11
 WHERE id = $1;
 
+-- name: UpdateEpisodeProgress :execrows
+UPDATE episodes
+SET updated_at = $2, current_position = $3, played = $4
+WHERE id = $1 AND updated_at <= $2;
+
+-- name: PatchEpisodeProgress :execrows
+UPDATE episodes
+SET updated_at = sqlc.arg(updated_at),
+    current_position = COALESCE(sqlc.narg(current_position), current_position),
+    played = COALESCE(sqlc.narg(played), played)
+WHERE id = sqlc.arg(id) AND updated_at <= sqlc.arg(updated_at);
+
+-- name: UpsertEpisode :one
+INSERT INTO episodes (id, created_at, updated_at, feed_id, feed_guid, title, description, url, duration, published_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+ON CONFLICT (feed_id, feed_guid) DO UPDATE
+SET title = EXCLUDED.title, description = EXCLUDED.description, url = EXCLUDED.url, duration = EXCLUDED.duration, published_at = EXCLUDED.published_at
+RETURNING *;
+
 -- name: DeleteEpisode :exec
 DELETE FROM episodes WHERE id = $1;
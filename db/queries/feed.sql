@@ -10,14 +10,28 @@ SELECT * FROM feeds WHERE user_id = $1 ORDER BY created_at DESC;
 -- name: FindFeedByIDAndUserID :one
 SELECT * FROM feeds WHERE id = $1 AND user_id = $2;
 
+-- name: FindFeedsToSync :many
+SELECT * FROM feeds
+WHERE sync_attempted_at IS NULL OR sync_attempted_at < $1
+ORDER BY sync_attempted_at ASC NULLS FIRST, created_at ASC
+LIMIT $2;
+
 -- name: CreateFeed :one
-INSERT INTO feeds (id, created_at, updated_at, user_id, title, url, synced_at)
-VALUES ($1, $2, $3, $4, $5, $6, $7)
+INSERT INTO feeds (id, created_at, updated_at, user_id, title, url, synced_at, sync_attempted_at, credentials)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 RETURNING *;
 
+-- name: MarkFeedSyncAttempted :exec
+UPDATE feeds SET sync_attempted_at = $2 WHERE id = $1;
+
 -- name: UpdateFeed :exec
 UPDATE feeds
-SET updated_at = $2, user_id = $3, title = $4, url = $5, synced_at = $6
+SET updated_at = $2, user_id = $3, title = $4, url = $5, synced_at = $6, etag = $7, last_modified = $8, credentials = $9
+WHERE id = $1;
+
+-- name: UpdateFeedSyncResult :exec
+UPDATE feeds
+SET updated_at = $2, title = $3, synced_at = $4, etag = $5, last_modified = $6
 WHERE id = $1;
 
 -- name: DeleteFeed :exec
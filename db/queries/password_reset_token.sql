@@ -0,0 +1,17 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (id, created_at, updated_at, user_id, token_hash, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: FindPasswordResetTokenByHash :one
+SELECT * FROM password_reset_tokens WHERE token_hash = $1;
+
+-- name: MarkPasswordResetTokenUsed :execrows
+UPDATE password_reset_tokens
+SET updated_at = $2, used_at = $2
+WHERE id = $1 AND used_at IS NULL;
+
+-- name: InvalidatePasswordResetTokensByUserID :exec
+UPDATE password_reset_tokens
+SET updated_at = $2, used_at = $2
+WHERE user_id = $1 AND used_at IS NULL;
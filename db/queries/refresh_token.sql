@@ -0,0 +1,22 @@
+-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (id, created_at, updated_at, user_id, family_id, token_hash, expires_at, authenticated_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING *;
+
+-- name: FindRefreshTokenByHash :one
+SELECT * FROM refresh_tokens WHERE token_hash = $1;
+
+-- name: MarkRefreshTokenUsed :execrows
+UPDATE refresh_tokens
+SET updated_at = $2, used_at = $2
+WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET updated_at = $2, revoked_at = $2
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokensByUserID :exec
+UPDATE refresh_tokens
+SET updated_at = $2, revoked_at = $2
+WHERE user_id = $1 AND revoked_at IS NULL;
@@ -0,0 +1,21 @@
+-- name: RevokeToken :exec
+INSERT INTO revoked_tokens (jti, expires_at)
+VALUES ($1, $2)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: DeleteExpiredRevokedTokens :exec
+DELETE FROM revoked_tokens WHERE expires_at < $1;
+
+-- name: RevokeUserTokens :exec
+INSERT INTO user_token_revocations (user_id, revoked_before)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE SET revoked_before = EXCLUDED.revoked_before;
+
+-- name: IsTokenRevoked :one
+SELECT (
+    EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = sqlc.arg(jti))
+    OR EXISTS (
+        SELECT 1 FROM user_token_revocations
+        WHERE user_id = sqlc.arg(user_id) AND revoked_before >= sqlc.arg(issued_at)
+    )
+)::BOOLEAN AS revoked;
@@ -20,13 +20,51 @@ WHERE id = $1;
 -- name: DeleteUser :exec
 DELETE FROM users WHERE id = $1;
 
--- name: FindUserByGoogleID :one
-SELECT * FROM users WHERE google_id = $1;
-
--- name: UpdateUserGoogleID :exec
-UPDATE users SET google_id = $1, updated_at = NOW() WHERE id = $2;
-
 -- name: CreateOAuthUser :one
-INSERT INTO users (id, created_at, updated_at, email, google_id)
+INSERT INTO users (id, created_at, updated_at, email, email_verified_at)
 VALUES ($1, $2, $3, $4, $5)
 RETURNING *;
+
+-- name: MarkUserEmailVerified :exec
+UPDATE users
+SET email_verified_at = COALESCE(email_verified_at, $2), updated_at = $2
+WHERE id = $1;
+
+-- name: SetUserTOTPSecret :exec
+-- Starts a new enrollment, 2FA stays disabled until the first code is confirmed
+UPDATE users
+SET totp_secret = $2, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = $3
+WHERE id = $1;
+
+-- name: EnableUserTOTP :exec
+UPDATE users
+SET totp_enabled_at = $2, updated_at = $2
+WHERE id = $1 AND totp_secret IS NOT NULL;
+
+-- name: DisableUserTOTP :exec
+UPDATE users
+SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = $2
+WHERE id = $1;
+
+-- name: UseUserTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $2
+WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2);
+
+-- name: SetUserPassword :exec
+UPDATE users
+SET password = $2, updated_at = $3
+WHERE id = $1;
+
+-- name: TakeUserTOTPAttempt :execrows
+-- Counts a second factor check, unless the budget is used up. The count starts over after the lockout.
+UPDATE users
+SET totp_attempts = CASE WHEN totp_attempted_at IS NULL OR totp_attempted_at < sqlc.arg(lockout_start) THEN 1 ELSE totp_attempts + 1 END,
+    totp_attempted_at = sqlc.arg(attempted_at)
+WHERE id = sqlc.arg(id)
+    AND (totp_attempts < sqlc.arg(max_attempts) OR totp_attempted_at IS NULL OR totp_attempted_at < sqlc.arg(lockout_start));
+
+-- name: ResetUserTOTPAttempts :exec
+UPDATE users
+SET totp_attempts = 0, totp_attempted_at = NULL
+WHERE id = $1;
@@ -0,0 +1,19 @@
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities (id, created_at, updated_at, user_id, provider, subject, email)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: FindUserIdentityByProviderSubject :one
+SELECT * FROM user_identities WHERE provider = $1 AND subject = $2;
+
+-- name: FindUserIdentitiesByUserID :many
+SELECT * FROM user_identities WHERE user_id = $1 ORDER BY created_at;
+
+-- name: DeleteUserIdentityKeepingLogin :execrows
+-- Deletes the identity unless it is the last way to sign in, i.e. the user has no password and no other identity
+DELETE FROM user_identities ui
+WHERE ui.user_id = $1 AND ui.provider = $2
+  AND (
+    EXISTS (SELECT 1 FROM users u WHERE u.id = ui.user_id AND u.password IS NOT NULL)
+    OR EXISTS (SELECT 1 FROM user_identities o WHERE o.user_id = ui.user_id AND o.provider <> ui.provider)
+  );
@@ -14,9 +14,9 @@ import (
 )
 
 const createEpisode = `-- name: CreateEpisode :one
-INSERT INTO episodes (id, created_at, updated_at, feed_id, feed_guid, current_position, played)
-VALUES ($1, $2, $3, $4, $5, $6, $7)
-RETURNING id, created_at, updated_at, feed_id, feed_guid, current_position, played
+INSERT INTO episodes (id, created_at, updated_at, feed_id, feed_guid, title, description, url, duration, published_at, current_position, played)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+RETURNING id, created_at, updated_at, feed_id, feed_guid, current_position, played, title, description, url, duration, published_at
 `
 
 type CreateEpisodeParams struct {
@@ -25,6 +25,11 @@ type CreateEpisodeParams struct {
 	UpdatedAt       time.Time     `json:"updated_at"`
 	FeedID          uuid.UUID     `json:"feed_id"`
 	FeedGuid        string        `json:"feed_guid"`
+	Title           string        `json:"title"`
+	Description     string        `json:"description"`
+	Url             string        `json:"url"`
+	Duration        sql.NullInt32 `json:"duration"`
+	PublishedAt     sql.NullTime  `json:"published_at"`
 	CurrentPosition sql.NullInt32 `json:"current_position"`
 	Played          bool          `json:"played"`
 }
@@ -36,6 +41,11 @@ func (q *Queries) CreateEpisode(ctx context.Context, arg CreateEpisodeParams) (*
 		arg.UpdatedAt,
 		arg.FeedID,
 		arg.FeedGuid,
+		arg.Title,
+		arg.Description,
+		arg.Url,
+		arg.Duration,
+		arg.PublishedAt,
 		arg.CurrentPosition,
 		arg.Played,
 	)
@@ -48,6 +58,11 @@ func (q *Queries) CreateEpisode(ctx context.Context, arg CreateEpisodeParams) (*
 		&i.FeedGuid,
 		&i.CurrentPosition,
 		&i.Played,
+		&i.Title,
+		&i.Description,
+		&i.Url,
+		&i.Duration,
+		&i.PublishedAt,
 	)
 	return &i, err
 }
@@ -62,7 +77,7 @@ func (q *Queries) DeleteEpisode(ctx context.Context, id uuid.UUID) error {
 }
 
 const findAllEpisodes = `-- name: FindAllEpisodes :many
-SELECT id, created_at, updated_at, feed_id, feed_guid, current_position, played FROM episodes ORDER BY created_at DESC
+SELECT id, created_at, updated_at, feed_id, feed_guid, current_position, played, title, description, url, duration, published_at FROM episodes ORDER BY created_at DESC
 `
 
 func (q *Queries) FindAllEpisodes(ctx context.Context) ([]*Episode, error) {
@@ -82,6 +97,11 @@ func (q *Queries) FindAllEpisodes(ctx context.Context) ([]*Episode, error) {
 			&i.FeedGuid,
 			&i.CurrentPosition,
 			&i.Played,
+			&i.Title,
+			&i.Description,
+			&i.Url,
+			&i.Duration,
+			&i.PublishedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -97,7 +117,7 @@ func (q *Queries) FindAllEpisodes(ctx context.Context) ([]*Episode, error) {
 }
 
 const findEpisodeByID = `-- name: FindEpisodeByID :one
-SELECT id, created_at, updated_at, feed_id, feed_guid, current_position, played FROM episodes WHERE id = $1
+SELECT id, created_at, updated_at, feed_id, feed_guid, current_position, played, title, description, url, duration, published_at FROM episodes WHERE id = $1
 `
 
 func (q *Queries) FindEpisodeByID(ctx context.Context, id uuid.UUID) (*Episode, error) {
@@ -111,13 +131,117 @@ func (q *Queries) FindEpisodeByID(ctx context.Context, id uuid.UUID) (*Episode,
 		&i.FeedGuid,
 		&i.CurrentPosition,
 		&i.Played,
+		&i.Title,
+		&i.Description,
+		&i.Url,
+		&i.Duration,
+		&i.PublishedAt,
 	)
 	return &i, err
 }
 
+const findEpisodeByIDAndUserID = `-- name: FindEpisodeByIDAndUserID :one
+SELECT episodes.id, episodes.created_at, episodes.updated_at, episodes.feed_id, episodes.feed_guid, episodes.current_position, episodes.played, episodes.title, episodes.description, episodes.url, episodes.duration, episodes.published_at FROM episodes
+JOIN feeds ON feeds.id = episodes.feed_id
+WHERE episodes.id = $1 AND feeds.user_id = $2
+`
+
+type FindEpisodeByIDAndUserIDParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) FindEpisodeByIDAndUserID(ctx context.Context, arg FindEpisodeByIDAndUserIDParams) (*Episode, error) {
+	row := q.db.QueryRowContext(ctx, findEpisodeByIDAndUserID, arg.ID, arg.UserID)
+	var i Episode
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.FeedID,
+		&i.FeedGuid,
+		&i.CurrentPosition,
+		&i.Played,
+		&i.Title,
+		&i.Description,
+		&i.Url,
+		&i.Duration,
+		&i.PublishedAt,
+	)
+	return &i, err
+}
+
+const findEpisodesByFeedID = `-- name: FindEpisodesByFeedID :many
+SELECT id, created_at, updated_at, feed_id, feed_guid, current_position, played, title, description, url, duration, published_at FROM episodes WHERE feed_id = $1 ORDER BY published_at DESC NULLS LAST, created_at DESC
+`
+
+func (q *Queries) FindEpisodesByFeedID(ctx context.Context, feedID uuid.UUID) ([]*Episode, error) {
+	rows, err := q.db.QueryContext(ctx, findEpisodesByFeedID, feedID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []*Episode{}
+	for rows.Next() {
+		var i Episode
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.FeedID,
+			&i.FeedGuid,
+			&i.CurrentPosition,
+			&i.Played,
+			&i.Title,
+			&i.Description,
+			&i.Url,
+			&i.Duration,
+			&i.PublishedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const patchEpisodeProgress = `-- name: PatchEpisodeProgress :execrows
+UPDATE episodes
+SET updated_at = $1,
+    current_position = COALESCE($2, current_position),
+    played = COALESCE($3, played)
+WHERE id = $4 AND updated_at <= $1
+`
+
+type PatchEpisodeProgressParams struct {
+	UpdatedAt       time.Time     `json:"updated_at"`
+	CurrentPosition sql.NullInt32 `json:"current_position"`
+	Played          sql.NullBool  `json:"played"`
+	ID              uuid.UUID     `json:"id"`
+}
+
+func (q *Queries) PatchEpisodeProgress(ctx context.Context, arg PatchEpisodeProgressParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, patchEpisodeProgress,
+		arg.UpdatedAt,
+		arg.CurrentPosition,
+		arg.Played,
+		arg.ID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const updateEpisode = `-- name: UpdateEpisode :exec
 UPDATE episodes 
-SET updated_at = $2, feed_id = $3, feed_guid = $4, current_position = $5, played = $6
+SET updated_at = $2, feed_id = $3, feed_guid = $4, title = $5, description = $6, url = $7, duration = $8, published_at = $9, current_position = $10, played = $11
 WHERE id = $1
 `
 
@@ -126,6 +250,11 @@ type UpdateEpisodeParams struct {
 	UpdatedAt       time.Time     `json:"updated_at"`
 	FeedID          uuid.UUID     `json:"feed_id"`
 	FeedGuid        string        `json:"feed_guid"`
+	Title           string        `json:"title"`
+	Description     string        `json:"description"`
+	Url             string        `json:"url"`
+	Duration        sql.NullInt32 `json:"duration"`
+	PublishedAt     sql.NullTime  `json:"published_at"`
 	CurrentPosition sql.NullInt32 `json:"current_position"`
 	Played          bool          `json:"played"`
 }
@@ -136,8 +265,91 @@ func (q *Queries) UpdateEpisode(ctx context.Context, arg UpdateEpisodeParams) er
 		arg.UpdatedAt,
 		arg.FeedID,
 		arg.FeedGuid,
+		arg.Title,
+		arg.Description,
+		arg.Url,
+		arg.Duration,
+		arg.PublishedAt,
 		arg.CurrentPosition,
 		arg.Played,
 	)
 	return err
 }
+
+const updateEpisodeProgress = `-- name: UpdateEpisodeProgress :execrows
+UPDATE episodes
+SET updated_at = $2, current_position = $3, played = $4
+WHERE id = $1 AND updated_at <= $2
+`
+
+type UpdateEpisodeProgressParams struct {
+	ID              uuid.UUID     `json:"id"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+	CurrentPosition sql.NullInt32 `json:"current_position"`
+	Played          bool          `json:"played"`
+}
+
+func (q *Queries) UpdateEpisodeProgress(ctx context.Context, arg UpdateEpisodeProgressParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateEpisodeProgress,
+		arg.ID,
+		arg.UpdatedAt,
+		arg.CurrentPosition,
+		arg.Played,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const upsertEpisode = `-- name: UpsertEpisode :one
+INSERT INTO episodes (id, created_at, updated_at, feed_id, feed_guid, title, description, url, duration, published_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+ON CONFLICT (feed_id, feed_guid) DO UPDATE
+SET title = EXCLUDED.title, description = EXCLUDED.description, url = EXCLUDED.url, duration = EXCLUDED.duration, published_at = EXCLUDED.published_at
+RETURNING id, created_at, updated_at, feed_id, feed_guid, current_position, played, title, description, url, duration, published_at
+`
+
+type UpsertEpisodeParams struct {
+	ID          uuid.UUID     `json:"id"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+	FeedID      uuid.UUID     `json:"feed_id"`
+	FeedGuid    string        `json:"feed_guid"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Url         string        `json:"url"`
+	Duration    sql.NullInt32 `json:"duration"`
+	PublishedAt sql.NullTime  `json:"published_at"`
+}
+
+func (q *Queries) UpsertEpisode(ctx context.Context, arg UpsertEpisodeParams) (*Episode, error) {
+	row := q.db.QueryRowContext(ctx, upsertEpisode,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.FeedID,
+		arg.FeedGuid,
+		arg.Title,
+		arg.Description,
+		arg.Url,
+		arg.Duration,
+		arg.PublishedAt,
+	)
+	var i Episode
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.FeedID,
+		&i.FeedGuid,
+		&i.CurrentPosition,
+		&i.Played,
+		&i.Title,
+		&i.Description,
+		&i.Url,
+		&i.Duration,
+		&i.PublishedAt,
+	)
+	return &i, err
+}
@@ -14,19 +14,21 @@ import (
 )
 
 const createFeed = `-- name: CreateFeed :one
-INSERT INTO feeds (id, created_at, updated_at, user_id, title, url, synced_at)
-VALUES ($1, $2, $3, $4, $5, $6, $7)
-RETURNING id, created_at, updated_at, user_id, title, url, synced_at
+INSERT INTO feeds (id, created_at, updated_at, user_id, title, url, synced_at, sync_attempted_at, credentials)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id, created_at, updated_at, user_id, title, url, synced_at, etag, last_modified, credentials, sync_attempted_at
 `
 
 type CreateFeedParams struct {
-	ID        uuid.UUID    `json:"id"`
-	CreatedAt time.Time    `json:"created_at"`
-	UpdatedAt time.Time    `json:"updated_at"`
-	UserID    uuid.UUID    `json:"user_id"`
-	Title     string       `json:"title"`
-	Url       string       `json:"url"`
-	SyncedAt  sql.NullTime `json:"synced_at"`
+	ID              uuid.UUID    `json:"id"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+	UserID          uuid.UUID    `json:"user_id"`
+	Title           string       `json:"title"`
+	Url             string       `json:"url"`
+	SyncedAt        sql.NullTime `json:"synced_at"`
+	SyncAttemptedAt sql.NullTime `json:"sync_attempted_at"`
+	Credentials     []byte       `json:"credentials"`
 }
 
 func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (*Feed, error) {
@@ -38,6 +40,8 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (*Feed,
 		arg.Title,
 		arg.Url,
 		arg.SyncedAt,
+		arg.SyncAttemptedAt,
+		arg.Credentials,
 	)
 	var i Feed
 	err := row.Scan(
@@ -48,6 +52,10 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (*Feed,
 		&i.Title,
 		&i.Url,
 		&i.SyncedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.Credentials,
+		&i.SyncAttemptedAt,
 	)
 	return &i, err
 }
@@ -62,7 +70,7 @@ func (q *Queries) DeleteFeed(ctx context.Context, id uuid.UUID) error {
 }
 
 const findAllFeeds = `-- name: FindAllFeeds :many
-SELECT id, created_at, updated_at, user_id, title, url, synced_at FROM feeds ORDER BY created_at DESC
+SELECT id, created_at, updated_at, user_id, title, url, synced_at, etag, last_modified, credentials, sync_attempted_at FROM feeds ORDER BY created_at DESC
 `
 
 func (q *Queries) FindAllFeeds(ctx context.Context) ([]*Feed, error) {
@@ -82,6 +90,10 @@ func (q *Queries) FindAllFeeds(ctx context.Context) ([]*Feed, error) {
 			&i.Title,
 			&i.Url,
 			&i.SyncedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.Credentials,
+			&i.SyncAttemptedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -97,7 +109,7 @@ func (q *Queries) FindAllFeeds(ctx context.Context) ([]*Feed, error) {
 }
 
 const findFeedByID = `-- name: FindFeedByID :one
-SELECT id, created_at, updated_at, user_id, title, url, synced_at FROM feeds WHERE id = $1
+SELECT id, created_at, updated_at, user_id, title, url, synced_at, etag, last_modified, credentials, sync_attempted_at FROM feeds WHERE id = $1
 `
 
 func (q *Queries) FindFeedByID(ctx context.Context, id uuid.UUID) (*Feed, error) {
@@ -111,12 +123,16 @@ func (q *Queries) FindFeedByID(ctx context.Context, id uuid.UUID) (*Feed, error)
 		&i.Title,
 		&i.Url,
 		&i.SyncedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.Credentials,
+		&i.SyncAttemptedAt,
 	)
 	return &i, err
 }
 
 const findFeedByIDAndUserID = `-- name: FindFeedByIDAndUserID :one
-SELECT id, created_at, updated_at, user_id, title, url, synced_at FROM feeds WHERE id = $1 AND user_id = $2
+SELECT id, created_at, updated_at, user_id, title, url, synced_at, etag, last_modified, credentials, sync_attempted_at FROM feeds WHERE id = $1 AND user_id = $2
 `
 
 type FindFeedByIDAndUserIDParams struct {
@@ -135,12 +151,16 @@ func (q *Queries) FindFeedByIDAndUserID(ctx context.Context, arg FindFeedByIDAnd
 		&i.Title,
 		&i.Url,
 		&i.SyncedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.Credentials,
+		&i.SyncAttemptedAt,
 	)
 	return &i, err
 }
 
 const findFeedsByUserID = `-- name: FindFeedsByUserID :many
-SELECT id, created_at, updated_at, user_id, title, url, synced_at FROM feeds WHERE user_id = $1 ORDER BY created_at DESC
+SELECT id, created_at, updated_at, user_id, title, url, synced_at, etag, last_modified, credentials, sync_attempted_at FROM feeds WHERE user_id = $1 ORDER BY created_at DESC
 `
 
 func (q *Queries) FindFeedsByUserID(ctx context.Context, userID uuid.UUID) ([]*Feed, error) {
@@ -160,6 +180,10 @@ func (q *Queries) FindFeedsByUserID(ctx context.Context, userID uuid.UUID) ([]*F
 			&i.Title,
 			&i.Url,
 			&i.SyncedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.Credentials,
+			&i.SyncAttemptedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -174,19 +198,83 @@ func (q *Queries) FindFeedsByUserID(ctx context.Context, userID uuid.UUID) ([]*F
 	return items, nil
 }
 
+const findFeedsToSync = `-- name: FindFeedsToSync :many
+SELECT id, created_at, updated_at, user_id, title, url, synced_at, etag, last_modified, credentials, sync_attempted_at FROM feeds
+WHERE sync_attempted_at IS NULL OR sync_attempted_at < $1
+ORDER BY sync_attempted_at ASC NULLS FIRST, created_at ASC
+LIMIT $2
+`
+
+type FindFeedsToSyncParams struct {
+	SyncAttemptedAt sql.NullTime `json:"sync_attempted_at"`
+	Limit           int32        `json:"limit"`
+}
+
+func (q *Queries) FindFeedsToSync(ctx context.Context, arg FindFeedsToSyncParams) ([]*Feed, error) {
+	rows, err := q.db.QueryContext(ctx, findFeedsToSync, arg.SyncAttemptedAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []*Feed{}
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Title,
+			&i.Url,
+			&i.SyncedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.Credentials,
+			&i.SyncAttemptedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markFeedSyncAttempted = `-- name: MarkFeedSyncAttempted :exec
+UPDATE feeds SET sync_attempted_at = $2 WHERE id = $1
+`
+
+type MarkFeedSyncAttemptedParams struct {
+	ID              uuid.UUID    `json:"id"`
+	SyncAttemptedAt sql.NullTime `json:"sync_attempted_at"`
+}
+
+func (q *Queries) MarkFeedSyncAttempted(ctx context.Context, arg MarkFeedSyncAttemptedParams) error {
+	_, err := q.db.ExecContext(ctx, markFeedSyncAttempted, arg.ID, arg.SyncAttemptedAt)
+	return err
+}
+
 const updateFeed = `-- name: UpdateFeed :exec
 UPDATE feeds
-SET updated_at = $2, user_id = $3, title = $4, url = $5, synced_at = $6
+SET updated_at = $2, user_id = $3, title = $4, url = $5, synced_at = $6, etag = $7, last_modified = $8, credentials = $9
 WHERE id = $1
 `
 
 type UpdateFeedParams struct {
-	ID        uuid.UUID    `json:"id"`
-	UpdatedAt time.Time    `json:"updated_at"`
-	UserID    uuid.UUID    `json:"user_id"`
-	Title     string       `json:"title"`
-	Url       string       `json:"url"`
-	SyncedAt  sql.NullTime `json:"synced_at"`
+	ID           uuid.UUID    `json:"id"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+	UserID       uuid.UUID    `json:"user_id"`
+	Title        string       `json:"title"`
+	Url          string       `json:"url"`
+	SyncedAt     sql.NullTime `json:"synced_at"`
+	Etag         string       `json:"etag"`
+	LastModified string       `json:"last_modified"`
+	Credentials  []byte       `json:"credentials"`
 }
 
 func (q *Queries) UpdateFeed(ctx context.Context, arg UpdateFeedParams) error {
@@ -197,6 +285,36 @@ func (q *Queries) UpdateFeed(ctx context.Context, arg UpdateFeedParams) error {
 		arg.Title,
 		arg.Url,
 		arg.SyncedAt,
+		arg.Etag,
+		arg.LastModified,
+		arg.Credentials,
+	)
+	return err
+}
+
+const updateFeedSyncResult = `-- name: UpdateFeedSyncResult :exec
+UPDATE feeds
+SET updated_at = $2, title = $3, synced_at = $4, etag = $5, last_modified = $6
+WHERE id = $1
+`
+
+type UpdateFeedSyncResultParams struct {
+	ID           uuid.UUID    `json:"id"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+	Title        string       `json:"title"`
+	SyncedAt     sql.NullTime `json:"synced_at"`
+	Etag         string       `json:"etag"`
+	LastModified string       `json:"last_modified"`
+}
+
+func (q *Queries) UpdateFeedSyncResult(ctx context.Context, arg UpdateFeedSyncResultParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedSyncResult,
+		arg.ID,
+		arg.UpdatedAt,
+		arg.Title,
+		arg.SyncedAt,
+		arg.Etag,
+		arg.LastModified,
 	)
 	return err
 }
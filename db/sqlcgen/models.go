@@ -11,6 +11,29 @@ import (
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID         uuid.UUID    `json:"id"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+	UserID     uuid.UUID    `json:"user_id"`
+	Name       string       `json:"name"`
+	KeyHash    string       `json:"key_hash"`
+	KeyPrefix  string       `json:"key_prefix"`
+	Scopes     []string     `json:"scopes"`
+	ExpiresAt  sql.NullTime `json:"expires_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+}
+
+type EmailVerificationToken struct {
+	ID        uuid.UUID    `json:"id"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	UserID    uuid.UUID    `json:"user_id"`
+	TokenHash string       `json:"token_hash"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
+}
+
 type Episode struct {
 	ID              uuid.UUID     `json:"id"`
 	CreatedAt       time.Time     `json:"created_at"`
@@ -19,23 +42,89 @@ type Episode struct {
 	FeedGuid        string        `json:"feed_guid"`
 	CurrentPosition sql.NullInt32 `json:"current_position"`
 	Played          bool          `json:"played"`
+	Title           string        `json:"title"`
+	Description     string        `json:"description"`
+	Url             string        `json:"url"`
+	Duration        sql.NullInt32 `json:"duration"`
+	PublishedAt     sql.NullTime  `json:"published_at"`
 }
 
 type Feed struct {
+	ID              uuid.UUID    `json:"id"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+	UserID          uuid.UUID    `json:"user_id"`
+	Title           string       `json:"title"`
+	Url             string       `json:"url"`
+	SyncedAt        sql.NullTime `json:"synced_at"`
+	Etag            string       `json:"etag"`
+	LastModified    string       `json:"last_modified"`
+	Credentials     []byte       `json:"credentials"`
+	SyncAttemptedAt sql.NullTime `json:"sync_attempted_at"`
+}
+
+type PasswordResetToken struct {
+	ID        uuid.UUID    `json:"id"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	UserID    uuid.UUID    `json:"user_id"`
+	TokenHash string       `json:"token_hash"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
+}
+
+type RecoveryCode struct {
 	ID        uuid.UUID    `json:"id"`
 	CreatedAt time.Time    `json:"created_at"`
 	UpdatedAt time.Time    `json:"updated_at"`
 	UserID    uuid.UUID    `json:"user_id"`
-	Title     string       `json:"title"`
-	Url       string       `json:"url"`
-	SyncedAt  sql.NullTime `json:"synced_at"`
+	CodeHash  string       `json:"code_hash"`
+	UsedAt    sql.NullTime `json:"used_at"`
+}
+
+type RefreshToken struct {
+	ID              uuid.UUID    `json:"id"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+	UserID          uuid.UUID    `json:"user_id"`
+	FamilyID        uuid.UUID    `json:"family_id"`
+	TokenHash       string       `json:"token_hash"`
+	ExpiresAt       time.Time    `json:"expires_at"`
+	UsedAt          sql.NullTime `json:"used_at"`
+	RevokedAt       sql.NullTime `json:"revoked_at"`
+	AuthenticatedAt sql.NullTime `json:"authenticated_at"`
+}
+
+type RevokedToken struct {
+	Jti       string    `json:"jti"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 type User struct {
-	ID        uuid.UUID      `json:"id"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	Email     string         `json:"email"`
-	Password  sql.NullString `json:"password"`
-	GoogleID  sql.NullString `json:"google_id"`
+	ID              uuid.UUID      `json:"id"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	Email           string         `json:"email"`
+	Password        sql.NullString `json:"password"`
+	EmailVerifiedAt sql.NullTime   `json:"email_verified_at"`
+	TotpSecret      []byte         `json:"totp_secret"`
+	TotpEnabledAt   sql.NullTime   `json:"totp_enabled_at"`
+	TotpLastStep    sql.NullInt64  `json:"totp_last_step"`
+	TotpAttempts    int32          `json:"totp_attempts"`
+	TotpAttemptedAt sql.NullTime   `json:"totp_attempted_at"`
+}
+
+type UserIdentity struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+}
+
+type UserTokenRevocation struct {
+	UserID        uuid.UUID `json:"user_id"`
+	RevokedBefore time.Time `json:"revoked_before"`
 }
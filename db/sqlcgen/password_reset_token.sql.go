@@ -0,0 +1,104 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: password_reset_token.sql
+
+package sqlcgen
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createPasswordResetToken = `-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (id, created_at, updated_at, user_id, token_hash, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, created_at, updated_at, user_id, token_hash, expires_at, used_at
+`
+
+type CreatePasswordResetTokenParams struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	TokenHash string    `json:"token_hash"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (q *Queries) CreatePasswordResetToken(ctx context.Context, arg CreatePasswordResetTokenParams) (*PasswordResetToken, error) {
+	row := q.db.QueryRowContext(ctx, createPasswordResetToken,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.UserID,
+		arg.TokenHash,
+		arg.ExpiresAt,
+	)
+	var i PasswordResetToken
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.TokenHash,
+		&i.ExpiresAt,
+		&i.UsedAt,
+	)
+	return &i, err
+}
+
+const findPasswordResetTokenByHash = `-- name: FindPasswordResetTokenByHash :one
+SELECT id, created_at, updated_at, user_id, token_hash, expires_at, used_at FROM password_reset_tokens WHERE token_hash = $1
+`
+
+func (q *Queries) FindPasswordResetTokenByHash(ctx context.Context, tokenHash string) (*PasswordResetToken, error) {
+	row := q.db.QueryRowContext(ctx, findPasswordResetTokenByHash, tokenHash)
+	var i PasswordResetToken
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.TokenHash,
+		&i.ExpiresAt,
+		&i.UsedAt,
+	)
+	return &i, err
+}
+
+const invalidatePasswordResetTokensByUserID = `-- name: InvalidatePasswordResetTokensByUserID :exec
+UPDATE password_reset_tokens
+SET updated_at = $2, used_at = $2
+WHERE user_id = $1 AND used_at IS NULL
+`
+
+type InvalidatePasswordResetTokensByUserIDParams struct {
+	UserID    uuid.UUID `json:"user_id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (q *Queries) InvalidatePasswordResetTokensByUserID(ctx context.Context, arg InvalidatePasswordResetTokensByUserIDParams) error {
+	_, err := q.db.ExecContext(ctx, invalidatePasswordResetTokensByUserID, arg.UserID, arg.UpdatedAt)
+	return err
+}
+
+const markPasswordResetTokenUsed = `-- name: MarkPasswordResetTokenUsed :execrows
+UPDATE password_reset_tokens
+SET updated_at = $2, used_at = $2
+WHERE id = $1 AND used_at IS NULL
+`
+
+type MarkPasswordResetTokenUsedParams struct {
+	ID        uuid.UUID `json:"id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (q *Queries) MarkPasswordResetTokenUsed(ctx context.Context, arg MarkPasswordResetTokenUsedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markPasswordResetTokenUsed, arg.ID, arg.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
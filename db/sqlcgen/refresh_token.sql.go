@@ -0,0 +1,131 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: refresh_token.sql
+
+package sqlcgen
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createRefreshToken = `-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (id, created_at, updated_at, user_id, family_id, token_hash, expires_at, authenticated_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id, created_at, updated_at, user_id, family_id, token_hash, expires_at, used_at, revoked_at, authenticated_at
+`
+
+type CreateRefreshTokenParams struct {
+	ID              uuid.UUID    `json:"id"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+	UserID          uuid.UUID    `json:"user_id"`
+	FamilyID        uuid.UUID    `json:"family_id"`
+	TokenHash       string       `json:"token_hash"`
+	ExpiresAt       time.Time    `json:"expires_at"`
+	AuthenticatedAt sql.NullTime `json:"authenticated_at"`
+}
+
+func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (*RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, createRefreshToken,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.UserID,
+		arg.FamilyID,
+		arg.TokenHash,
+		arg.ExpiresAt,
+		arg.AuthenticatedAt,
+	)
+	var i RefreshToken
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.FamilyID,
+		&i.TokenHash,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.RevokedAt,
+		&i.AuthenticatedAt,
+	)
+	return &i, err
+}
+
+const findRefreshTokenByHash = `-- name: FindRefreshTokenByHash :one
+SELECT id, created_at, updated_at, user_id, family_id, token_hash, expires_at, used_at, revoked_at, authenticated_at FROM refresh_tokens WHERE token_hash = $1
+`
+
+func (q *Queries) FindRefreshTokenByHash(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, findRefreshTokenByHash, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.FamilyID,
+		&i.TokenHash,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.RevokedAt,
+		&i.AuthenticatedAt,
+	)
+	return &i, err
+}
+
+const markRefreshTokenUsed = `-- name: MarkRefreshTokenUsed :execrows
+UPDATE refresh_tokens
+SET updated_at = $2, used_at = $2
+WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL
+`
+
+type MarkRefreshTokenUsedParams struct {
+	ID        uuid.UUID `json:"id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (q *Queries) MarkRefreshTokenUsed(ctx context.Context, arg MarkRefreshTokenUsedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markRefreshTokenUsed, arg.ID, arg.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET updated_at = $2, revoked_at = $2
+WHERE family_id = $1 AND revoked_at IS NULL
+`
+
+type RevokeRefreshTokenFamilyParams struct {
+	FamilyID  uuid.UUID `json:"family_id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, arg RevokeRefreshTokenFamilyParams) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, arg.FamilyID, arg.UpdatedAt)
+	return err
+}
+
+const revokeRefreshTokensByUserID = `-- name: RevokeRefreshTokensByUserID :exec
+UPDATE refresh_tokens
+SET updated_at = $2, revoked_at = $2
+WHERE user_id = $1 AND revoked_at IS NULL
+`
+
+type RevokeRefreshTokensByUserIDParams struct {
+	UserID    uuid.UUID `json:"user_id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (q *Queries) RevokeRefreshTokensByUserID(ctx context.Context, arg RevokeRefreshTokensByUserIDParams) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokensByUserID, arg.UserID, arg.UpdatedAt)
+	return err
+}
@@ -14,17 +14,17 @@ import (
 )
 
 const createOAuthUser = `-- name: CreateOAuthUser :one
-INSERT INTO users (id, created_at, updated_at, email, google_id)
+INSERT INTO users (id, created_at, updated_at, email, email_verified_at)
 VALUES ($1, $2, $3, $4, $5)
-RETURNING id, created_at, updated_at, email, password, google_id
+RETURNING id, created_at, updated_at, email, password, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, totp_attempts, totp_attempted_at
 `
 
 type CreateOAuthUserParams struct {
-	ID        uuid.UUID      `json:"id"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	Email     string         `json:"email"`
-	GoogleID  sql.NullString `json:"google_id"`
+	ID              uuid.UUID    `json:"id"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+	Email           string       `json:"email"`
+	EmailVerifiedAt sql.NullTime `json:"email_verified_at"`
 }
 
 func (q *Queries) CreateOAuthUser(ctx context.Context, arg CreateOAuthUserParams) (*User, error) {
@@ -33,7 +33,7 @@ func (q *Queries) CreateOAuthUser(ctx context.Context, arg CreateOAuthUserParams
 		arg.CreatedAt,
 		arg.UpdatedAt,
 		arg.Email,
-		arg.GoogleID,
+		arg.EmailVerifiedAt,
 	)
 	var i User
 	err := row.Scan(
@@ -42,7 +42,12 @@ func (q *Queries) CreateOAuthUser(ctx context.Context, arg CreateOAuthUserParams
 		&i.UpdatedAt,
 		&i.Email,
 		&i.Password,
-		&i.GoogleID,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.TotpAttempts,
+		&i.TotpAttemptedAt,
 	)
 	return &i, err
 }
@@ -50,7 +55,7 @@ func (q *Queries) CreateOAuthUser(ctx context.Context, arg CreateOAuthUserParams
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, password)
 VALUES ($1, $2, $3, $4, $5)
-RETURNING id, created_at, updated_at, email, password, google_id
+RETURNING id, created_at, updated_at, email, password, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, totp_attempts, totp_attempted_at
 `
 
 type CreateUserParams struct {
@@ -76,7 +81,12 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (*User,
 		&i.UpdatedAt,
 		&i.Email,
 		&i.Password,
-		&i.GoogleID,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.TotpAttempts,
+		&i.TotpAttemptedAt,
 	)
 	return &i, err
 }
@@ -90,8 +100,40 @@ func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const disableUserTOTP = `-- name: DisableUserTOTP :exec
+UPDATE users
+SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = $2
+WHERE id = $1
+`
+
+type DisableUserTOTPParams struct {
+	ID        uuid.UUID `json:"id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (q *Queries) DisableUserTOTP(ctx context.Context, arg DisableUserTOTPParams) error {
+	_, err := q.db.ExecContext(ctx, disableUserTOTP, arg.ID, arg.UpdatedAt)
+	return err
+}
+
+const enableUserTOTP = `-- name: EnableUserTOTP :exec
+UPDATE users
+SET totp_enabled_at = $2, updated_at = $2
+WHERE id = $1 AND totp_secret IS NOT NULL
+`
+
+type EnableUserTOTPParams struct {
+	ID            uuid.UUID    `json:"id"`
+	TotpEnabledAt sql.NullTime `json:"totp_enabled_at"`
+}
+
+func (q *Queries) EnableUserTOTP(ctx context.Context, arg EnableUserTOTPParams) error {
+	_, err := q.db.ExecContext(ctx, enableUserTOTP, arg.ID, arg.TotpEnabledAt)
+	return err
+}
+
 const findAllUsers = `-- name: FindAllUsers :many
-SELECT id, created_at, updated_at, email, password, google_id FROM users ORDER BY created_at DESC
+SELECT id, created_at, updated_at, email, password, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, totp_attempts, totp_attempted_at FROM users ORDER BY created_at DESC
 `
 
 func (q *Queries) FindAllUsers(ctx context.Context) ([]*User, error) {
@@ -109,7 +151,12 @@ func (q *Queries) FindAllUsers(ctx context.Context) ([]*User, error) {
 			&i.UpdatedAt,
 			&i.Email,
 			&i.Password,
-			&i.GoogleID,
+			&i.EmailVerifiedAt,
+			&i.TotpSecret,
+			&i.TotpEnabledAt,
+			&i.TotpLastStep,
+			&i.TotpAttempts,
+			&i.TotpAttemptedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -125,7 +172,7 @@ func (q *Queries) FindAllUsers(ctx context.Context) ([]*User, error) {
 }
 
 const findUserByEmail = `-- name: FindUserByEmail :one
-SELECT id, created_at, updated_at, email, password, google_id FROM users WHERE email = $1
+SELECT id, created_at, updated_at, email, password, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, totp_attempts, totp_attempted_at FROM users WHERE email = $1
 `
 
 func (q *Queries) FindUserByEmail(ctx context.Context, email string) (*User, error) {
@@ -137,17 +184,22 @@ func (q *Queries) FindUserByEmail(ctx context.Context, email string) (*User, err
 		&i.UpdatedAt,
 		&i.Email,
 		&i.Password,
-		&i.GoogleID,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.TotpAttempts,
+		&i.TotpAttemptedAt,
 	)
 	return &i, err
 }
 
-const findUserByGoogleID = `-- name: FindUserByGoogleID :one
-SELECT id, created_at, updated_at, email, password, google_id FROM users WHERE google_id = $1
+const findUserByID = `-- name: FindUserByID :one
+SELECT id, created_at, updated_at, email, password, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, totp_attempts, totp_attempted_at FROM users WHERE id = $1
 `
 
-func (q *Queries) FindUserByGoogleID(ctx context.Context, googleID sql.NullString) (*User, error) {
-	row := q.db.QueryRowContext(ctx, findUserByGoogleID, googleID)
+func (q *Queries) FindUserByID(ctx context.Context, id uuid.UUID) (*User, error) {
+	row := q.db.QueryRowContext(ctx, findUserByID, id)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -155,27 +207,105 @@ func (q *Queries) FindUserByGoogleID(ctx context.Context, googleID sql.NullStrin
 		&i.UpdatedAt,
 		&i.Email,
 		&i.Password,
-		&i.GoogleID,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.TotpAttempts,
+		&i.TotpAttemptedAt,
 	)
 	return &i, err
 }
 
-const findUserByID = `-- name: FindUserByID :one
-SELECT id, created_at, updated_at, email, password, google_id FROM users WHERE id = $1
+const markUserEmailVerified = `-- name: MarkUserEmailVerified :exec
+UPDATE users
+SET email_verified_at = COALESCE(email_verified_at, $2), updated_at = $2
+WHERE id = $1
 `
 
-func (q *Queries) FindUserByID(ctx context.Context, id uuid.UUID) (*User, error) {
-	row := q.db.QueryRowContext(ctx, findUserByID, id)
-	var i User
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Email,
-		&i.Password,
-		&i.GoogleID,
+type MarkUserEmailVerifiedParams struct {
+	ID        uuid.UUID `json:"id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (q *Queries) MarkUserEmailVerified(ctx context.Context, arg MarkUserEmailVerifiedParams) error {
+	_, err := q.db.ExecContext(ctx, markUserEmailVerified, arg.ID, arg.UpdatedAt)
+	return err
+}
+
+const resetUserTOTPAttempts = `-- name: ResetUserTOTPAttempts :exec
+UPDATE users
+SET totp_attempts = 0, totp_attempted_at = NULL
+WHERE id = $1
+`
+
+func (q *Queries) ResetUserTOTPAttempts(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, resetUserTOTPAttempts, id)
+	return err
+}
+
+const setUserPassword = `-- name: SetUserPassword :exec
+UPDATE users
+SET password = $2, updated_at = $3
+WHERE id = $1
+`
+
+type SetUserPasswordParams struct {
+	ID        uuid.UUID      `json:"id"`
+	Password  sql.NullString `json:"password"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+func (q *Queries) SetUserPassword(ctx context.Context, arg SetUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, setUserPassword, arg.ID, arg.Password, arg.UpdatedAt)
+	return err
+}
+
+const setUserTOTPSecret = `-- name: SetUserTOTPSecret :exec
+UPDATE users
+SET totp_secret = $2, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = $3
+WHERE id = $1
+`
+
+type SetUserTOTPSecretParams struct {
+	ID         uuid.UUID `json:"id"`
+	TotpSecret []byte    `json:"totp_secret"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Starts a new enrollment, 2FA stays disabled until the first code is confirmed
+func (q *Queries) SetUserTOTPSecret(ctx context.Context, arg SetUserTOTPSecretParams) error {
+	_, err := q.db.ExecContext(ctx, setUserTOTPSecret, arg.ID, arg.TotpSecret, arg.UpdatedAt)
+	return err
+}
+
+const takeUserTOTPAttempt = `-- name: TakeUserTOTPAttempt :execrows
+UPDATE users
+SET totp_attempts = CASE WHEN totp_attempted_at IS NULL OR totp_attempted_at < $1 THEN 1 ELSE totp_attempts + 1 END,
+    totp_attempted_at = $2
+WHERE id = $3
+    AND (totp_attempts < $4 OR totp_attempted_at IS NULL OR totp_attempted_at < $1)
+`
+
+type TakeUserTOTPAttemptParams struct {
+	LockoutStart sql.NullTime `json:"lockout_start"`
+	AttemptedAt  sql.NullTime `json:"attempted_at"`
+	ID           uuid.UUID    `json:"id"`
+	MaxAttempts  int32        `json:"max_attempts"`
+}
+
+// Counts a second factor check, unless the budget is used up. The count starts over after the lockout.
+func (q *Queries) TakeUserTOTPAttempt(ctx context.Context, arg TakeUserTOTPAttemptParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, takeUserTOTPAttempt,
+		arg.LockoutStart,
+		arg.AttemptedAt,
+		arg.ID,
+		arg.MaxAttempts,
 	)
-	return &i, err
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const updateUser = `-- name: UpdateUser :exec
@@ -201,16 +331,21 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) error {
 	return err
 }
 
-const updateUserGoogleID = `-- name: UpdateUserGoogleID :exec
-UPDATE users SET google_id = $1, updated_at = NOW() WHERE id = $2
+const useUserTOTPStep = `-- name: UseUserTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $2
+WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)
 `
 
-type UpdateUserGoogleIDParams struct {
-	GoogleID sql.NullString `json:"google_id"`
-	ID       uuid.UUID      `json:"id"`
+type UseUserTOTPStepParams struct {
+	ID           uuid.UUID     `json:"id"`
+	TotpLastStep sql.NullInt64 `json:"totp_last_step"`
 }
 
-func (q *Queries) UpdateUserGoogleID(ctx context.Context, arg UpdateUserGoogleIDParams) error {
-	_, err := q.db.ExecContext(ctx, updateUserGoogleID, arg.GoogleID, arg.ID)
-	return err
+func (q *Queries) UseUserTOTPStep(ctx context.Context, arg UseUserTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useUserTOTPStep, arg.ID, arg.TotpLastStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
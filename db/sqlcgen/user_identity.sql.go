@@ -0,0 +1,134 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: user_identity.sql
+
+package sqlcgen
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createUserIdentity = `-- name: CreateUserIdentity :one
+INSERT INTO user_identities (id, created_at, updated_at, user_id, provider, subject, email)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, created_at, updated_at, user_id, provider, subject, email
+`
+
+type CreateUserIdentityParams struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+}
+
+func (q *Queries) CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) (*UserIdentity, error) {
+	row := q.db.QueryRowContext(ctx, createUserIdentity,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.UserID,
+		arg.Provider,
+		arg.Subject,
+		arg.Email,
+	)
+	var i UserIdentity
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Provider,
+		&i.Subject,
+		&i.Email,
+	)
+	return &i, err
+}
+
+const deleteUserIdentityKeepingLogin = `-- name: DeleteUserIdentityKeepingLogin :execrows
+DELETE FROM user_identities ui
+WHERE ui.user_id = $1 AND ui.provider = $2
+  AND (
+    EXISTS (SELECT 1 FROM users u WHERE u.id = ui.user_id AND u.password IS NOT NULL)
+    OR EXISTS (SELECT 1 FROM user_identities o WHERE o.user_id = ui.user_id AND o.provider <> ui.provider)
+  )
+`
+
+type DeleteUserIdentityKeepingLoginParams struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Provider string    `json:"provider"`
+}
+
+// Deletes the identity unless it is the last way to sign in, i.e. the user has no password and no other identity
+func (q *Queries) DeleteUserIdentityKeepingLogin(ctx context.Context, arg DeleteUserIdentityKeepingLoginParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUserIdentityKeepingLogin, arg.UserID, arg.Provider)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const findUserIdentitiesByUserID = `-- name: FindUserIdentitiesByUserID :many
+SELECT id, created_at, updated_at, user_id, provider, subject, email FROM user_identities WHERE user_id = $1 ORDER BY created_at
+`
+
+func (q *Queries) FindUserIdentitiesByUserID(ctx context.Context, userID uuid.UUID) ([]*UserIdentity, error) {
+	rows, err := q.db.QueryContext(ctx, findUserIdentitiesByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []*UserIdentity{}
+	for rows.Next() {
+		var i UserIdentity
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Provider,
+			&i.Subject,
+			&i.Email,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const findUserIdentityByProviderSubject = `-- name: FindUserIdentityByProviderSubject :one
+SELECT id, created_at, updated_at, user_id, provider, subject, email FROM user_identities WHERE provider = $1 AND subject = $2
+`
+
+type FindUserIdentityByProviderSubjectParams struct {
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
+}
+
+func (q *Queries) FindUserIdentityByProviderSubject(ctx context.Context, arg FindUserIdentityByProviderSubjectParams) (*UserIdentity, error) {
+	row := q.db.QueryRowContext(ctx, findUserIdentityByProviderSubject, arg.Provider, arg.Subject)
+	var i UserIdentity
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Provider,
+		&i.Subject,
+		&i.Email,
+	)
+	return &i, err
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"pcast-api/db/sqlcgen"
+)
+
+var tracer = otel.Tracer("pcast-api/db")
+
+// tracedDBTX starts a span for every query, named after the sqlc query
+type tracedDBTX struct {
+	db sqlcgen.DBTX
+}
+
+// Trace wraps a *sql.DB or *sql.Tx for the sqlc queries
+func Trace(db sqlcgen.DBTX) sqlcgen.DBTX {
+	return &tracedDBTX{db: db}
+}
+
+func (t *tracedDBTX) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuery(ctx, query)
+	result, err := t.db.ExecContext(ctx, query, args...)
+	endQuery(span, err)
+
+	return result, err
+}
+
+func (t *tracedDBTX) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := startQuery(ctx, query)
+	stmt, err := t.db.PrepareContext(ctx, query)
+	endQuery(span, err)
+
+	return stmt, err
+}
+
+// QueryContext ends the span when the query returns, reading the rows is not included
+func (t *tracedDBTX) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuery(ctx, query)
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	endQuery(span, err)
+
+	return rows, err
+}
+
+func (t *tracedDBTX) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuery(ctx, query)
+	row := t.db.QueryRowContext(ctx, query, args...)
+	endQuery(span, row.Err())
+
+	return row
+}
+
+func startQuery(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := queryName(query)
+
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.DBSystemNamePostgreSQL,
+		semconv.DBQuerySummary(name),
+		semconv.DBQueryText(query),
+	))
+}
+
+func endQuery(span trace.Span, err error) {
+	// No rows is an expected result, not a failure of the database
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// queryName returns the name of a sqlc query from its "-- name: FindUserByID :one" header
+func queryName(query string) string {
+	header, _, _ := strings.Cut(query, "\n")
+	if name, ok := strings.CutPrefix(header, "-- name: "); ok {
+		name, _, _ = strings.Cut(name, " ")
+		return name
+	}
+
+	return "query"
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// mockDBTX fails every statement with err
+type mockDBTX struct {
+	err error
+}
+
+func (m *mockDBTX) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, m.err
+}
+
+func (m *mockDBTX) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, m.err
+}
+
+func (m *mockDBTX) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, m.err
+}
+
+func (m *mockDBTX) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return &sql.Row{}
+}
+
+func newRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return recorder
+}
+
+func TestTrace(t *testing.T) {
+	recorder := newRecorder(t)
+	failure := errors.New("connection reset")
+
+	_, err := Trace(&mockDBTX{}).ExecContext(context.Background(), "-- name: DeleteUser :exec\nDELETE FROM users WHERE id = $1")
+	require.NoError(t, err)
+	_, err = Trace(&mockDBTX{err: failure}).QueryContext(context.Background(), "-- name: FindAllUsers :many\nSELECT * FROM users")
+	require.ErrorIs(t, err, failure)
+	_, err = Trace(&mockDBTX{err: sql.ErrNoRows}).ExecContext(context.Background(), "SELECT 1")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	assert.Equal(t, "DeleteUser", spans[0].Name())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, "FindAllUsers", spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	// Statements without a sqlc header get a generic name, no rows is no error
+	assert.Equal(t, "query", spans[2].Name())
+	assert.Equal(t, codes.Unset, spans[2].Status().Code)
+}
@@ -15,25 +15,145 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/auth/google": {
+        "/auth/providers": {
             "get": {
-                "description": "Redirects to Google OAuth consent screen",
+                "description": "Lists the OpenID Connect providers users can sign in with",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "auth"
                 ],
-                "summary": "Initiate Google OAuth",
+                "summary": "List OAuth providers",
                 "responses": {
-                    "302": {
-                        "description": "Redirect to Google",
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/oauth.ProviderPresenter"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/token": {
+            "post": {
+                "description": "Exchanges the login code an app received at its redirect_uri for an access token with a refresh token.\nIf two-factor authentication is enabled, the response only contains a challenge token for /user/login/2fa.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Redeem login code",
+                "parameters": [
+                    {
+                        "description": "TokenRequest data",
+                        "name": "token",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/oauth.TokenRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/oauth.LoginResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request"
+                    },
+                    "401": {
+                        "description": "Invalid or expired code, or wrong code verifier"
+                    }
+                }
+            }
+        },
+        "/auth/{provider}": {
+            "get": {
+                "description": "Redirects to the consent screen of the OpenID Connect provider. Apps pass an allow-listed redirect_uri,\ne.g. a custom scheme, with the S256 challenge of their own PKCE verifier. Their login ends with a redirect\nto redirect_uri with a login code, which they exchange for the tokens at /auth/token.\nWith intent=link nobody is signed in, the login ends with a link code for POST /user/identities.\nLinks also need the S256 challenge, the link code is bound to it.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Initiate OAuth login",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Provider name, e.g. google",
+                        "name": "provider",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "login (default) or link",
+                        "name": "intent",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Allow-listed URI the login returns to with ?code= and ?state=",
+                        "name": "redirect_uri",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "S256 PKCE challenge, required with redirect_uri or intent=link",
+                        "name": "code_challenge",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Must be S256, required with redirect_uri or intent=link",
+                        "name": "code_challenge_method",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "State of the app, returned with the login code",
+                        "name": "state",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "307": {
+                        "description": "Redirect to the provider",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -44,20 +164,27 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/google/callback": {
+        "/auth/{provider}/callback": {
             "get": {
-                "description": "Handles Google OAuth callback and returns JWT token",
+                "description": "Handles the callback of the OpenID Connect provider and returns an access token with a refresh token.\nIf two-factor authentication is enabled, the response only contains a challenge token for /user/login/2fa.\nA new identity with the email of an existing account is refused with 403, unless the provider has link_by_email enabled.\nLogins started with a redirect_uri are redirected there with ?code= and ?state=, or ?error= if the login failed.\nLogins with intent=link return a link code instead, as linkCode or as ?code= for the redirect_uri.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "auth"
                 ],
-                "summary": "Google OAuth callback",
+                "summary": "OAuth callback",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Authorization code from Google",
+                        "description": "Provider name, e.g. google",
+                        "name": "provider",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Authorization code from the provider",
                         "name": "code",
                         "in": "query",
                         "required": true
@@ -77,6 +204,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/oauth.LoginResponse"
                         }
                     },
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/oauth.LinkResponse"
+                        }
+                    },
+                    "302": {
+                        "description": "Redirect to the redirect_uri of the app",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
@@ -86,6 +225,33 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -94,21 +260,37 @@ const docTemplate = `{
                                 "type": "string"
                             }
                         }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
                     }
                 }
             }
         },
-        "/feeds": {
+        "/episodes/{id}": {
             "get": {
-                "description": "Retrieve all feeds from the store",
+                "description": "Retrieve the episode with the given episode ID",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "feeds"
+                    "episodes"
                 ],
-                "summary": "Get all feeds",
+                "summary": "Get an episode",
                 "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Episode ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
                     {
                         "type": "string",
                         "description": "User ID",
@@ -121,16 +303,16 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/feed.Presenter"
-                            }
+                            "$ref": "#/definitions/episode.Presenter"
                         }
+                    },
+                    "404": {
+                        "description": "Episode not found"
                     }
                 }
             },
-            "post": {
-                "description": "Create a new feed with the data provided in the request",
+            "patch": {
+                "description": "Update the playback state of the episode with the given episode ID",
                 "consumes": [
                     "application/json"
                 ],
@@ -138,17 +320,24 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "feeds"
+                    "episodes"
                 ],
-                "summary": "Create a new feed",
+                "summary": "Update an episode",
                 "parameters": [
                     {
-                        "description": "CreateRequest data",
-                        "name": "feed",
+                        "type": "string",
+                        "description": "Episode ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "UpdateRequest data",
+                        "name": "episode",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/feed.CreateRequest"
+                            "$ref": "#/definitions/episode.UpdateRequest"
                         }
                     },
                     {
@@ -160,30 +349,54 @@ const docTemplate = `{
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/feed.Presenter"
+                            "$ref": "#/definitions/episode.Presenter"
+                        }
+                    },
+                    "404": {
+                        "description": "Episode not found"
+                    },
+                    "409": {
+                        "description": "Newer progress already stored",
+                        "schema": {
+                            "$ref": "#/definitions/episode.Presenter"
                         }
                     }
                 }
             }
         },
-        "/feeds/{id}": {
-            "delete": {
-                "description": "Delete a feed with the given feed ID",
+        "/episodes/{id}/progress": {
+            "put": {
+                "description": "Store the playback position of the episode with the given episode ID.\nUpdates older than the stored state are rejected and the current server state is returned.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "feeds"
+                    "episodes"
                 ],
-                "summary": "Delete a feed",
+                "summary": "Sync the playback progress of an episode",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "ID",
+                        "description": "Episode ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     },
+                    {
+                        "description": "ProgressRequest data",
+                        "name": "progress",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/episode.ProgressRequest"
+                        }
+                    },
                     {
                         "type": "string",
                         "description": "User ID",
@@ -194,26 +407,34 @@ const docTemplate = `{
                 ],
                 "responses": {
                     "200": {
-                        "description": "Feed deleted successfully"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/episode.Presenter"
+                        }
+                    },
+                    "404": {
+                        "description": "Episode not found"
+                    },
+                    "409": {
+                        "description": "Newer progress already stored",
+                        "schema": {
+                            "$ref": "#/definitions/episode.Presenter"
+                        }
                     }
                 }
             }
         },
-        "/feeds/{id}/sync": {
-            "put": {
-                "description": "Sync a feed with the given feed ID",
+        "/feeds": {
+            "get": {
+                "description": "Retrieve all feeds from the store",
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
                     "feeds"
                 ],
-                "summary": "Sync a feed",
+                "summary": "Get all feeds",
                 "parameters": [
-                    {
-                        "type": "string",
-                        "description": "Feed ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
                     {
                         "type": "string",
                         "description": "User ID",
@@ -223,15 +444,19 @@ const docTemplate = `{
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "Feed synced successfully"
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/feed.Presenter"
+                            }
+                        }
                     }
                 }
-            }
-        },
-        "/user/login": {
+            },
             "post": {
-                "description": "Login user with the data provided in the request",
+                "description": "Create a new feed with the data provided in the request",
                 "consumes": [
                     "application/json"
                 ],
@@ -239,28 +464,1048 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "feeds"
                 ],
-                "summary": "Login user",
+                "summary": "Create a new feed",
                 "parameters": [
                     {
-                        "description": "LoginRequest data",
-                        "name": "user",
+                        "description": "CreateRequest data",
+                        "name": "feed",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/user.LoginRequest"
+                            "$ref": "#/definitions/feed.CreateRequest"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/user.LoginResponse"
+                            "$ref": "#/definitions/feed.Presenter"
                         }
-                    }
-                }
+                    },
+                    "400": {
+                        "description": "Invalid credentials"
+                    },
+                    "501": {
+                        "description": "Private feeds are not configured"
+                    }
+                }
+            }
+        },
+        "/feeds/export.opml": {
+            "get": {
+                "description": "Export all feeds of the user as an OPML 2.0 document",
+                "produces": [
+                    "text/xml"
+                ],
+                "tags": [
+                    "feeds"
+                ],
+                "summary": "Export feeds as OPML",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OPML document",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/feeds/import": {
+            "post": {
+                "description": "Subscribe to every feed of an OPML 1.0/2.0 document, including nested folders.\nFeeds the user is already subscribed to are skipped.",
+                "consumes": [
+                    "text/xml"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "feeds"
+                ],
+                "summary": "Import feeds from OPML",
+                "parameters": [
+                    {
+                        "description": "OPML document",
+                        "name": "opml",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/feed.ImportPresenter"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid OPML document"
+                    }
+                }
+            }
+        },
+        "/feeds/{id}": {
+            "delete": {
+                "description": "Delete a feed with the given feed ID",
+                "tags": [
+                    "feeds"
+                ],
+                "summary": "Delete a feed",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Feed deleted successfully"
+                    }
+                }
+            }
+        },
+        "/feeds/{id}/credentials": {
+            "put": {
+                "description": "Store HTTP Basic credentials or a bearer token used to download the feed.\nThe credentials are encrypted at rest and never returned.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "feeds"
+                ],
+                "summary": "Set the credentials of a private feed",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Feed ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "CredentialsRequest data",
+                        "name": "credentials",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/feed.CredentialsRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/feed.Presenter"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid credentials"
+                    },
+                    "404": {
+                        "description": "Feed not found"
+                    },
+                    "501": {
+                        "description": "Private feeds are not configured"
+                    }
+                }
+            },
+            "delete": {
+                "description": "Remove the stored credentials, the feed is downloaded without authentication afterwards",
+                "tags": [
+                    "feeds"
+                ],
+                "summary": "Remove the credentials of a feed",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Feed ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Credentials removed"
+                    },
+                    "404": {
+                        "description": "Feed not found"
+                    }
+                }
+            }
+        },
+        "/feeds/{id}/episodes": {
+            "get": {
+                "description": "Retrieve all episodes of the feed with the given feed ID",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "episodes"
+                ],
+                "summary": "Get all episodes of a feed",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Feed ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/episode.Presenter"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Feed not found"
+                    }
+                }
+            }
+        },
+        "/feeds/{id}/sync": {
+            "put": {
+                "description": "Download and parse the feed with the given feed ID and upsert its episodes",
+                "tags": [
+                    "feeds"
+                ],
+                "summary": "Sync a feed",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Feed ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Feed synced successfully"
+                    },
+                    "404": {
+                        "description": "Feed not found"
+                    },
+                    "500": {
+                        "description": "Feed credentials could not be decrypted"
+                    },
+                    "502": {
+                        "description": "Feed could not be fetched or parsed"
+                    }
+                }
+            }
+        },
+        "/user": {
+            "delete": {
+                "description": "Delete the user with all feeds, episodes, linked identities and API keys, and revoke all tokens.\nRequires the password or, without it, a login within the last 5 minutes.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Delete the account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "DeleteAccountRequest data",
+                        "name": "user",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/user.DeleteAccountRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Account deleted"
+                    },
+                    "401": {
+                        "description": "Invalid password"
+                    },
+                    "403": {
+                        "description": "Sign in again to delete the account"
+                    }
+                }
+            }
+        },
+        "/user/2fa": {
+            "get": {
+                "description": "Tell whether two-factor authentication is enabled and how many unused recovery codes are left",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Get two-factor authentication status",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.TwoFactorStatusPresenter"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/2fa/confirm": {
+            "post": {
+                "description": "Enable two-factor authentication with a code of the enrolled authenticator.\nReturns the recovery codes, they cannot be shown again.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Enable two-factor authentication",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "TwoFactorCodeRequest data",
+                        "name": "code",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.TwoFactorCodeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.RecoveryCodesPresenter"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid code"
+                    },
+                    "409": {
+                        "description": "Not enrolled or already enabled"
+                    }
+                }
+            }
+        },
+        "/user/2fa/disable": {
+            "post": {
+                "description": "Disable two-factor authentication with a TOTP or recovery code. All recovery codes are deleted.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Disable two-factor authentication",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "TwoFactorCodeRequest data",
+                        "name": "code",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.TwoFactorCodeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Two-factor authentication disabled"
+                    },
+                    "400": {
+                        "description": "Invalid code"
+                    },
+                    "409": {
+                        "description": "Two-factor authentication is not enabled"
+                    },
+                    "429": {
+                        "description": "Too many invalid codes"
+                    }
+                }
+            }
+        },
+        "/user/2fa/enroll": {
+            "post": {
+                "description": "Create a new TOTP secret. Two-factor authentication is enabled once a code is confirmed at /user/2fa/confirm.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Enroll an authenticator",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.TwoFactorEnrollmentPresenter"
+                        }
+                    },
+                    "409": {
+                        "description": "Two-factor authentication is already enabled"
+                    },
+                    "501": {
+                        "description": "Two-factor authentication is not configured"
+                    }
+                }
+            }
+        },
+        "/user/2fa/recovery-codes": {
+            "post": {
+                "description": "Replace all recovery codes after checking a TOTP or recovery code",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Regenerate recovery codes",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "TwoFactorCodeRequest data",
+                        "name": "code",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.TwoFactorCodeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.RecoveryCodesPresenter"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid code"
+                    },
+                    "409": {
+                        "description": "Two-factor authentication is not enabled"
+                    },
+                    "429": {
+                        "description": "Too many invalid codes"
+                    }
+                }
+            }
+        },
+        "/user/api-keys": {
+            "get": {
+                "description": "Lists the personal API keys of the user",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "List API keys",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/apikey.Presenter"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Creates a personal API key for scripts and integrations. It is sent as \"Authorization: Bearer \u003ckey\u003e\"\nand can only access the routes of its scopes. The key is only returned in this response.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Create an API key",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "CreateRequest data",
+                        "name": "key",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/apikey.CreateRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/apikey.CreatedPresenter"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/user/api-keys/{id}": {
+            "delete": {
+                "description": "Revokes the API key, requests with it are rejected immediately",
+                "tags": [
+                    "user"
+                ],
+                "summary": "Delete an API key",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "API key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "API key deleted"
+                    },
+                    "404": {
+                        "description": "API key not found"
+                    }
+                }
+            }
+        },
+        "/user/email/verify": {
+            "post": {
+                "description": "Confirm the email address with the token from the verification mail",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Verify email address",
+                "parameters": [
+                    {
+                        "description": "VerifyEmailRequest data",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.VerifyEmailRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Email verified"
+                    },
+                    "400": {
+                        "description": "Invalid, expired or used token"
+                    }
+                }
+            }
+        },
+        "/user/email/verify/resend": {
+            "post": {
+                "description": "Mail a new link to verify the email address. The response is the same whether or not the email belongs to an account.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Resend verification mail",
+                "parameters": [
+                    {
+                        "description": "ResendVerificationRequest data",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.ResendVerificationRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Verification mail sent if the account exists and is not verified"
+                    }
+                }
+            }
+        },
+        "/user/export": {
+            "get": {
+                "description": "Download all data stored about the user as ZIP archive. pcast-data.json holds the profile,\nlinked identities, feeds and episodes with their playback state, subscriptions.opml the feeds.\nPasswords, 2FA secrets and feed credentials are not exported.",
+                "produces": [
+                    "application/zip"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Export personal data",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "ZIP archive",
+                        "schema": {
+                            "type": "file"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/identities": {
+            "get": {
+                "description": "Lists the accounts at OpenID Connect providers the user can sign in with",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "List linked identities",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/oauth.IdentityPresenter"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Links the account of a login with intent=link to the user, independent of its email",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Link an identity",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "LinkIdentityRequest data",
+                        "name": "identity",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/oauth.LinkIdentityRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/oauth.IdentityPresenter"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/user/identities/{provider}": {
+            "delete": {
+                "description": "Removes the identity of the provider. The last identity of an account without password cannot be removed.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Unlink an identity",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Provider name, e.g. google",
+                        "name": "provider",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Unlinked"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/user/login": {
+            "post": {
+                "description": "Login user with the data provided in the request\nIf two-factor authentication is enabled, the response only contains a challenge token for /user/login/2fa.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Login user",
+                "parameters": [
+                    {
+                        "description": "LoginRequest data",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.LoginRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.LoginResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid email or password"
+                    },
+                    "403": {
+                        "description": "Email address not verified"
+                    }
+                }
+            }
+        },
+        "/user/login/2fa": {
+            "post": {
+                "description": "Exchange the challenge token of a password login and a TOTP or recovery code for an access token and refresh token.\nThe challenge token is valid for 5 minutes, every code is accepted once.\nAfter 5 invalid codes, all codes of the user are refused for 15 minutes.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Complete a two-factor login",
+                "parameters": [
+                    {
+                        "description": "TwoFactorLoginRequest data",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.TwoFactorLoginRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.LoginResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid or expired challenge token or invalid code"
+                    },
+                    "429": {
+                        "description": "Too many invalid codes"
+                    }
+                }
+            }
+        },
+        "/user/logout": {
+            "post": {
+                "description": "Revoke the access token of the request and, if given, the refresh token of the same login",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Logout user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "LogoutRequest data",
+                        "name": "logout",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/user.LogoutRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Logged out"
+                    },
+                    "400": {
+                        "description": "The access token has no ID and cannot be revoked, sign in again"
+                    }
+                }
+            }
+        },
+        "/user/logout/all": {
+            "post": {
+                "description": "Revoke all access and refresh tokens of the user",
+                "tags": [
+                    "user"
+                ],
+                "summary": "Logout all sessions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Logged out everywhere"
+                    }
+                }
             }
         },
         "/user/password": {
@@ -301,42 +1546,297 @@ const docTemplate = `{
                 }
             }
         },
-        "/user/register": {
-            "post": {
-                "description": "Register a new user with the data provided in the request",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "user"
-                ],
-                "summary": "Create a new user",
-                "parameters": [
-                    {
-                        "description": "RegisterRequest data",
-                        "name": "user",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/user.RegisterRequest"
-                        }
-                    }
-                ],
-                "responses": {
-                    "201": {
-                        "description": "Created",
-                        "schema": {
-                            "$ref": "#/definitions/user.Presenter"
-                        }
-                    }
+        "/user/password/forgot": {
+            "post": {
+                "description": "Mail a link to reset the password. The response is the same whether or not the email belongs to an account.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Request a password reset",
+                "parameters": [
+                    {
+                        "description": "ForgotPasswordRequest data",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.ForgotPasswordRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Reset mail sent if the account exists"
+                    }
+                }
+            }
+        },
+        "/user/password/reset": {
+            "post": {
+                "description": "Set a new password with the token from the reset mail. Logs out all sessions of the user.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Reset password",
+                "parameters": [
+                    {
+                        "description": "ResetPasswordRequest data",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.ResetPasswordRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Password changed"
+                    },
+                    "400": {
+                        "description": "Invalid, expired or used token"
+                    }
+                }
+            }
+        },
+        "/user/register": {
+            "post": {
+                "description": "Register a new user with the data provided in the request. A link to verify the email address is mailed to the user.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Create a new user",
+                "parameters": [
+                    {
+                        "description": "RegisterRequest data",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.RegisterRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/user.Presenter"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/token/refresh": {
+            "post": {
+                "description": "Exchange a refresh token for a new access token and refresh token. Every refresh token can be used once,\nreusing a rotated refresh token revokes all tokens of the login.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Refresh access token",
+                "parameters": [
+                    {
+                        "description": "RefreshTokenRequest data",
+                        "name": "token",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.RefreshTokenRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.LoginResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid, expired or reused refresh token"
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "apikey.CreateRequest": {
+            "type": "object",
+            "required": [
+                "name",
+                "scopes"
+            ],
+            "properties": {
+                "expiresAt": {
+                    "description": "ExpiresAt is empty for a key that does not expire",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 255
+                },
+                "scopes": {
+                    "description": "Scopes are any of feeds:read, feeds:write, episodes:read and episodes:write",
+                    "type": "array",
+                    "minItems": 1,
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "apikey.CreatedPresenter": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "lastUsedAt": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "description": "Prefix is the start of the key, so users can tell their keys apart",
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "apikey.Presenter": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "lastUsedAt": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "description": "Prefix is the start of the key, so users can tell their keys apart",
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "episode.Presenter": {
+            "type": "object",
+            "properties": {
+                "currentPosition": {
+                    "type": "integer"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "duration": {
+                    "type": "integer"
+                },
+                "feedId": {
+                    "type": "string"
+                },
+                "guid": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "played": {
+                    "type": "boolean"
+                },
+                "publishedAt": {
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "updatedAt": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "episode.ProgressRequest": {
+            "type": "object",
+            "required": [
+                "position",
+                "timestamp"
+            ],
+            "properties": {
+                "played": {
+                    "type": "boolean"
+                },
+                "position": {
+                    "type": "integer",
+                    "maximum": 2147483647,
+                    "minimum": 0
+                },
+                "timestamp": {
+                    "type": "string"
                 }
             }
-        }
-    },
-    "definitions": {
+        },
+        "episode.UpdateRequest": {
+            "type": "object",
+            "properties": {
+                "currentPosition": {
+                    "type": "integer",
+                    "maximum": 2147483647,
+                    "minimum": 0
+                },
+                "played": {
+                    "type": "boolean"
+                }
+            }
+        },
         "feed.CreateRequest": {
             "type": "object",
             "required": [
@@ -344,6 +1844,70 @@ const docTemplate = `{
                 "url"
             ],
             "properties": {
+                "credentials": {
+                    "description": "Credentials are only needed for private feeds",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/feed.CredentialsRequest"
+                        }
+                    ]
+                },
+                "title": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "feed.CredentialsRequest": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string"
+                },
+                "token": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "feed.ImportPresenter": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "type": "integer"
+                },
+                "duplicates": {
+                    "type": "integer"
+                },
+                "invalid": {
+                    "type": "integer"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/feed.ImportResultPresenter"
+                    }
+                }
+            }
+        },
+        "feed.ImportResultPresenter": {
+            "type": "object",
+            "properties": {
+                "feedId": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "created",
+                        "duplicate",
+                        "invalid"
+                    ]
+                },
                 "title": {
                     "type": "string"
                 },
@@ -358,6 +1922,10 @@ const docTemplate = `{
                 "id": {
                     "type": "string"
                 },
+                "private": {
+                    "description": "Private is set when credentials are stored, the credentials themselves are never returned",
+                    "type": "boolean"
+                },
                 "syncedAt": {
                     "type": "string"
                 },
@@ -369,11 +1937,112 @@ const docTemplate = `{
                 }
             }
         },
+        "oauth.IdentityPresenter": {
+            "type": "object",
+            "properties": {
+                "displayName": {
+                    "type": "string"
+                },
+                "email": {
+                    "description": "Email is the address reported by the provider when the identity was linked",
+                    "type": "string"
+                },
+                "linkedAt": {
+                    "type": "string"
+                },
+                "provider": {
+                    "type": "string"
+                }
+            }
+        },
+        "oauth.LinkIdentityRequest": {
+            "type": "object",
+            "required": [
+                "code",
+                "codeVerifier"
+            ],
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "codeVerifier": {
+                    "description": "CodeVerifier is the PKCE verifier of the code_challenge the link login was started with",
+                    "type": "string"
+                }
+            }
+        },
+        "oauth.LinkResponse": {
+            "type": "object",
+            "properties": {
+                "linkCode": {
+                    "type": "string"
+                }
+            }
+        },
         "oauth.LoginResponse": {
             "type": "object",
             "properties": {
+                "challengeToken": {
+                    "type": "string"
+                },
+                "expiresIn": {
+                    "description": "ExpiresIn is the lifetime of the access token in seconds",
+                    "type": "integer"
+                },
+                "refreshToken": {
+                    "type": "string"
+                },
                 "token": {
                     "type": "string"
+                },
+                "twoFactorRequired": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "oauth.ProviderPresenter": {
+            "type": "object",
+            "properties": {
+                "displayName": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "oauth.TokenRequest": {
+            "type": "object",
+            "required": [
+                "code",
+                "codeVerifier"
+            ],
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "codeVerifier": {
+                    "description": "CodeVerifier is the PKCE verifier of the code_challenge the app started the login with",
+                    "type": "string"
+                }
+            }
+        },
+        "user.DeleteAccountRequest": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string"
+                }
+            }
+        },
+        "user.ForgotPasswordRequest": {
+            "type": "object",
+            "required": [
+                "email"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string"
                 }
             }
         },
@@ -395,19 +2064,65 @@ const docTemplate = `{
         "user.LoginResponse": {
             "type": "object",
             "properties": {
+                "challengeToken": {
+                    "type": "string"
+                },
+                "expiresIn": {
+                    "description": "ExpiresIn is the lifetime of the access token in seconds",
+                    "type": "integer"
+                },
+                "refreshToken": {
+                    "type": "string"
+                },
                 "token": {
                     "type": "string"
+                },
+                "twoFactorRequired": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "user.LogoutRequest": {
+            "type": "object",
+            "properties": {
+                "refreshToken": {
+                    "type": "string"
                 }
             }
         },
         "user.Presenter": {
             "type": "object",
             "properties": {
+                "emailVerified": {
+                    "type": "boolean"
+                },
                 "id": {
                     "type": "string"
                 }
             }
         },
+        "user.RecoveryCodesPresenter": {
+            "type": "object",
+            "properties": {
+                "recoveryCodes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "user.RefreshTokenRequest": {
+            "type": "object",
+            "required": [
+                "refreshToken"
+            ],
+            "properties": {
+                "refreshToken": {
+                    "type": "string"
+                }
+            }
+        },
         "user.RegisterRequest": {
             "type": "object",
             "required": [
@@ -423,6 +2138,82 @@ const docTemplate = `{
                 }
             }
         },
+        "user.ResendVerificationRequest": {
+            "type": "object",
+            "required": [
+                "email"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string"
+                }
+            }
+        },
+        "user.ResetPasswordRequest": {
+            "type": "object",
+            "required": [
+                "password",
+                "token"
+            ],
+            "properties": {
+                "password": {
+                    "type": "string"
+                },
+                "token": {
+                    "type": "string"
+                }
+            }
+        },
+        "user.TwoFactorCodeRequest": {
+            "type": "object",
+            "required": [
+                "code"
+            ],
+            "properties": {
+                "code": {
+                    "type": "string"
+                }
+            }
+        },
+        "user.TwoFactorEnrollmentPresenter": {
+            "type": "object",
+            "properties": {
+                "secret": {
+                    "description": "Secret is the base32 encoded secret for manual entry",
+                    "type": "string"
+                },
+                "uri": {
+                    "description": "URI is the otpauth:// URI, usually shown as QR code",
+                    "type": "string"
+                }
+            }
+        },
+        "user.TwoFactorLoginRequest": {
+            "type": "object",
+            "required": [
+                "challengeToken",
+                "code"
+            ],
+            "properties": {
+                "challengeToken": {
+                    "type": "string"
+                },
+                "code": {
+                    "type": "string"
+                }
+            }
+        },
+        "user.TwoFactorStatusPresenter": {
+            "type": "object",
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "recoveryCodesRemaining": {
+                    "type": "integer"
+                }
+            }
+        },
         "user.UpdatePasswordRequest": {
             "type": "object",
             "required": [
@@ -437,6 +2228,17 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "user.VerifyEmailRequest": {
+            "type": "object",
+            "required": [
+                "token"
+            ],
+            "properties": {
+                "token": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
@@ -0,0 +1,175 @@
+package apikey_test
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/steinfletcher/apitest"
+	"github.com/steinfletcher/apitest-jsonpath"
+	"pcast-api/controller/apikey"
+	"pcast-api/controller/user"
+	testhelper "pcast-api/integration_test/testhelper"
+)
+
+func TestMain(m *testing.M) {
+	testhelper.Setup()
+
+	code := m.Run()
+
+	testhelper.Teardown()
+
+	os.Exit(code)
+}
+
+func newApp() *echo.Echo {
+	return testhelper.NewApp()
+}
+
+func unmarshal[M any](t *testing.T, result *apitest.Result) *M {
+	u, err := testhelper.UnmarshalResult[M](result.Response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func truncateTables() {
+	testhelper.TruncateAll()
+}
+
+func createUser(t *testing.T) string {
+	email := fmt.Sprintf("apikey-test-%s@example.com", uuid.New().String()[:8])
+	jsonBody := fmt.Sprintf(`{"email": "%s", "password": "test"}`, email)
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/register").
+		JSON(jsonBody).
+		Expect(t).
+		Status(http.StatusCreated).
+		End()
+
+	loginResult := apitest.New().
+		Handler(newApp()).
+		Post("/api/user/login").
+		JSON(jsonBody).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	return unmarshal[user.LoginResponse](t, &loginResult).Token
+}
+
+func createAPIKey(t *testing.T, token string, body string) *apikey.CreatedPresenter {
+	result := apitest.New().
+		Handler(newApp()).
+		Post("/api/user/api-keys").
+		Header("Authorization", "Bearer "+token).
+		JSON(body).
+		Expect(t).
+		Status(http.StatusCreated).
+		End()
+
+	return unmarshal[apikey.CreatedPresenter](t, &result)
+}
+
+func TestAPIKey_Scopes(t *testing.T) {
+	t.Cleanup(truncateTables)
+	token := createUser(t)
+	key := createAPIKey(t, token, `{"name": "cron", "scopes": ["feeds:read"]}`)
+
+	apitest.New().
+		Handler(newApp()).
+		Get("/api/feeds").
+		Header("Authorization", "Bearer "+key.Key).
+		Expect(t).
+		Assert(jsonpath.Len("$", 0)).
+		Status(http.StatusOK).
+		End()
+
+	// The key cannot write feeds
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/feeds").
+		Header("Authorization", "Bearer "+key.Key).
+		JSON(`{"url": "https://example.com","title":"Example"}`).
+		Expect(t).
+		Status(http.StatusForbidden).
+		End()
+
+	// Routes without scope do not accept API keys
+	apitest.New().
+		Handler(newApp()).
+		Get("/api/user/api-keys").
+		Header("Authorization", "Bearer "+key.Key).
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Get("/api/user/api-keys").
+		Header("Authorization", "Bearer "+token).
+		Expect(t).
+		Assert(jsonpath.Len("$", 1)).
+		Assert(jsonpath.Equal("$[0].name", "cron")).
+		Assert(jsonpath.Present("$[0].lastUsedAt")).
+		Assert(jsonpath.NotPresent("$[0].key")).
+		Status(http.StatusOK).
+		End()
+}
+
+func TestAPIKey_Delete(t *testing.T) {
+	t.Cleanup(truncateTables)
+	token := createUser(t)
+	key := createAPIKey(t, token, `{"name": "cron", "scopes": ["feeds:read", "feeds:write"]}`)
+
+	apitest.New().
+		Handler(newApp()).
+		Delete(fmt.Sprintf("/api/user/api-keys/%s", key.ID)).
+		Header("Authorization", "Bearer "+token).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Get("/api/feeds").
+		Header("Authorization", "Bearer "+key.Key).
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+}
+
+func TestAPIKey_Invalid(t *testing.T) {
+	t.Cleanup(truncateTables)
+	token := createUser(t)
+
+	for _, body := range []string{
+		`{"name": "cron", "scopes": ["user:write"]}`,
+		`{"name": "cron", "scopes": []}`,
+		`{"scopes": ["feeds:read"]}`,
+		`{"name": "cron", "scopes": ["feeds:read"], "expiresAt": "2000-01-01T00:00:00Z"}`,
+	} {
+		apitest.New().
+			Handler(newApp()).
+			Post("/api/user/api-keys").
+			Header("Authorization", "Bearer "+token).
+			JSON(body).
+			Expect(t).
+			Status(http.StatusBadRequest).
+			End()
+	}
+
+	apitest.New().
+		Handler(newApp()).
+		Get("/api/feeds").
+		Header("Authorization", "Bearer pcast_unknown").
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+}
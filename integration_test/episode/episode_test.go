@@ -0,0 +1,280 @@
+package episode_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/steinfletcher/apitest"
+	"github.com/steinfletcher/apitest-jsonpath"
+
+	"pcast-api/controller/episode"
+	"pcast-api/controller/feed"
+	"pcast-api/controller/user"
+	testhelper "pcast-api/integration_test/testhelper"
+)
+
+func TestMain(m *testing.M) {
+	testhelper.Setup()
+
+	code := m.Run()
+
+	testhelper.Teardown()
+
+	os.Exit(code)
+}
+
+func newApp() *echo.Echo {
+	return testhelper.NewApp()
+}
+
+func unmarshal[M any](t *testing.T, result *apitest.Result) *M {
+	u, err := testhelper.UnmarshalResult[M](result.Response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func truncateTables() {
+	testhelper.TruncateAll()
+}
+
+func createUser(t *testing.T) string {
+	email := fmt.Sprintf("episode-test-%s@example.com", uuid.New().String()[:8])
+	jsonBody := fmt.Sprintf(`{"email": "%s", "password": "test"}`, email)
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/register").
+		JSON(jsonBody).
+		Expect(t).
+		Status(http.StatusCreated).
+		End()
+
+	loginResult := apitest.New().
+		Handler(newApp()).
+		Post("/api/user/login").
+		JSON(jsonBody).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	return unmarshal[user.LoginResponse](t, &loginResult).Token
+}
+
+// createSyncedFeed creates a feed served from the podcast fixture and syncs it
+func createSyncedFeed(t *testing.T, token string) *feed.Presenter {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "../../fixtures/test/rss/podcast.xml")
+	}))
+	t.Cleanup(server.Close)
+
+	result := apitest.New().
+		Handler(newApp()).
+		Post("/api/feeds").
+		Header("Authorization", "Bearer "+token).
+		JSON(fmt.Sprintf(`{"url": "%s","title":"Example"}`, server.URL)).
+		Expect(t).
+		Status(http.StatusCreated).
+		End()
+
+	fd := unmarshal[feed.Presenter](t, &result)
+
+	apitest.New().
+		Handler(newApp()).
+		Put(fmt.Sprintf("/api/feeds/%s/sync", fd.ID)).
+		Header("Authorization", "Bearer "+token).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+
+	return fd
+}
+
+func getEpisodes(t *testing.T, token string, feedID uuid.UUID) []episode.Presenter {
+	result := apitest.New().
+		Handler(newApp()).
+		Get(fmt.Sprintf("/api/feeds/%s/episodes", feedID)).
+		Header("Authorization", "Bearer "+token).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	return *unmarshal[[]episode.Presenter](t, &result)
+}
+
+func TestGetEpisodes(t *testing.T) {
+	t.Cleanup(truncateTables)
+	token := createUser(t)
+	fd := createSyncedFeed(t, token)
+
+	apitest.New().
+		Handler(newApp()).
+		Get(fmt.Sprintf("/api/feeds/%s/episodes", fd.ID)).
+		Header("Authorization", "Bearer "+token).
+		Expect(t).
+		Assert(jsonpath.Len("$", 3)).
+		Assert(jsonpath.Equal("$[0].title", "Episode 3: Sync all the things")).
+		Assert(jsonpath.Equal("$[0].played", false)).
+		Status(http.StatusOK).
+		End()
+}
+
+func TestGetEpisodesOfForeignFeed(t *testing.T) {
+	t.Cleanup(truncateTables)
+	fd := createSyncedFeed(t, createUser(t))
+	otherToken := createUser(t)
+
+	apitest.New().
+		Handler(newApp()).
+		Get(fmt.Sprintf("/api/feeds/%s/episodes", fd.ID)).
+		Header("Authorization", "Bearer "+otherToken).
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+}
+
+func TestGetEpisode(t *testing.T) {
+	t.Cleanup(truncateTables)
+	token := createUser(t)
+	fd := createSyncedFeed(t, token)
+	episodes := getEpisodes(t, token, fd.ID)
+
+	apitest.New().
+		Handler(newApp()).
+		Get(fmt.Sprintf("/api/episodes/%s", episodes[0].ID)).
+		Header("Authorization", "Bearer "+token).
+		Expect(t).
+		Assert(jsonpath.Equal("$.guid", "tag:example.com,2024:episode-3")).
+		Assert(jsonpath.Equal("$.duration", float64(3723))).
+		Status(http.StatusOK).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Get(fmt.Sprintf("/api/episodes/%s", episodes[0].ID)).
+		Header("Authorization", "Bearer "+createUser(t)).
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+}
+
+func TestUpdateEpisode(t *testing.T) {
+	t.Cleanup(truncateTables)
+	token := createUser(t)
+	fd := createSyncedFeed(t, token)
+	episodes := getEpisodes(t, token, fd.ID)
+
+	apitest.New().
+		Handler(newApp()).
+		Patch(fmt.Sprintf("/api/episodes/%s", episodes[0].ID)).
+		Header("Authorization", "Bearer "+token).
+		JSON(`{"currentPosition": 120}`).
+		Expect(t).
+		Assert(jsonpath.Equal("$.currentPosition", float64(120))).
+		Assert(jsonpath.Equal("$.played", false)).
+		Status(http.StatusOK).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Patch(fmt.Sprintf("/api/episodes/%s", episodes[0].ID)).
+		Header("Authorization", "Bearer "+token).
+		JSON(`{"played": true}`).
+		Expect(t).
+		Assert(jsonpath.Equal("$.currentPosition", float64(120))).
+		Assert(jsonpath.Equal("$.played", true)).
+		Status(http.StatusOK).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Patch(fmt.Sprintf("/api/episodes/%s", episodes[0].ID)).
+		Header("Authorization", "Bearer "+token).
+		JSON(`{"currentPosition": -1}`).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+
+	// The position is stored as a 32 bit integer
+	apitest.New().
+		Handler(newApp()).
+		Patch(fmt.Sprintf("/api/episodes/%s", episodes[0].ID)).
+		Header("Authorization", "Bearer "+token).
+		JSON(`{"currentPosition": 2147483648}`).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestUpdateProgress(t *testing.T) {
+	t.Cleanup(truncateTables)
+	token := createUser(t)
+	fd := createSyncedFeed(t, token)
+	episodes := getEpisodes(t, token, fd.ID)
+	now := time.Now().UTC()
+
+	apitest.New().
+		Handler(newApp()).
+		Put(fmt.Sprintf("/api/episodes/%s/progress", episodes[0].ID)).
+		Header("Authorization", "Bearer "+token).
+		JSON(fmt.Sprintf(`{"position": 300, "played": false, "timestamp": "%s"}`, now.Format(time.RFC3339Nano))).
+		Expect(t).
+		Assert(jsonpath.Equal("$.currentPosition", float64(300))).
+		Status(http.StatusOK).
+		End()
+
+	// An update from a device with an older state is rejected with the current server state
+	apitest.New().
+		Handler(newApp()).
+		Put(fmt.Sprintf("/api/episodes/%s/progress", episodes[0].ID)).
+		Header("Authorization", "Bearer "+token).
+		JSON(fmt.Sprintf(`{"position": 100, "played": true, "timestamp": "%s"}`, now.Add(-time.Minute).Format(time.RFC3339Nano))).
+		Expect(t).
+		Assert(jsonpath.Equal("$.currentPosition", float64(300))).
+		Assert(jsonpath.Equal("$.played", false)).
+		Status(http.StatusConflict).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Put(fmt.Sprintf("/api/episodes/%s/progress", episodes[0].ID)).
+		Header("Authorization", "Bearer "+token).
+		JSON(fmt.Sprintf(`{"position": 600, "played": true, "timestamp": "%s"}`, now.Add(time.Second).Format(time.RFC3339Nano))).
+		Expect(t).
+		Assert(jsonpath.Equal("$.currentPosition", float64(600))).
+		Assert(jsonpath.Equal("$.played", true)).
+		Status(http.StatusOK).
+		End()
+}
+
+func TestUpdateProgressValidation(t *testing.T) {
+	t.Cleanup(truncateTables)
+	token := createUser(t)
+	fd := createSyncedFeed(t, token)
+	episodes := getEpisodes(t, token, fd.ID)
+
+	apitest.New().
+		Handler(newApp()).
+		Put(fmt.Sprintf("/api/episodes/%s/progress", episodes[0].ID)).
+		Header("Authorization", "Bearer "+token).
+		JSON(`{"position": 300, "played": false}`).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Put(fmt.Sprintf("/api/episodes/%s/progress", episodes[0].ID)).
+		Header("Authorization", "Bearer "+token).
+		JSON(fmt.Sprintf(`{"position": 2147483648, "played": false, "timestamp": "%s"}`, time.Now().UTC().Format(time.RFC3339Nano))).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+}
@@ -2,7 +2,9 @@ package feed_test
 
 import (
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
@@ -69,6 +71,17 @@ func createUser(t *testing.T) (uuid.UUID, string) {
 	return u.ID, lr.Token
 }
 
+// newFeedServer serves the given fixture file as an RSS feed
+func newFeedServer(t *testing.T, fixture string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		http.ServeFile(w, r, fixture)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
 func TestGetFeeds(t *testing.T) {
 	t.Cleanup(truncateTables)
 	_, token := createUser(t)
@@ -193,12 +206,13 @@ func TestDeleteFeed(t *testing.T) {
 func TestUpdateFeed(t *testing.T) {
 	t.Cleanup(truncateTables)
 	_, token := createUser(t)
+	server := newFeedServer(t, "../../fixtures/test/rss/podcast.xml")
 
 	result := apitest.New().
 		Handler(newApp()).
 		Post("/api/feeds").
 		Header("Authorization", "Bearer "+token).
-		JSON(`{"url": "https://example.com","title":"Example"}`).
+		JSON(fmt.Sprintf(`{"url": "%s","title":"Example"}`, server.URL)).
 		Expect(t).
 		Assert(jsonpath.Equal("$.syncedAt", nil)).
 		Status(http.StatusCreated).
@@ -220,6 +234,240 @@ func TestUpdateFeed(t *testing.T) {
 		Header("Authorization", "Bearer "+token).
 		Expect(t).
 		Assert(jsonpath.NotEqual("$[0].syncedAt", nil)).
+		Assert(jsonpath.Equal("$[0].title", "The PCast Show")).
+		Status(http.StatusOK).
+		End()
+}
+
+func TestSyncFeedInvalidFeed(t *testing.T) {
+	t.Cleanup(truncateTables)
+	_, token := createUser(t)
+	server := newFeedServer(t, "../../fixtures/test/rss/invalid.xml")
+
+	result := apitest.New().
+		Handler(newApp()).
+		Post("/api/feeds").
+		Header("Authorization", "Bearer "+token).
+		JSON(fmt.Sprintf(`{"url": "%s","title":"Example"}`, server.URL)).
+		Expect(t).
+		Status(http.StatusCreated).
+		End()
+
+	fd := unmarshal[feed.Presenter](t, &result)
+
+	apitest.New().
+		Handler(newApp()).
+		Put(fmt.Sprintf("/api/feeds/%s/sync", fd.ID)).
+		Header("Authorization", "Bearer "+token).
+		Expect(t).
+		Status(http.StatusBadGateway).
+		End()
+}
+
+func TestPrivateFeedCredentials(t *testing.T) {
+	t.Cleanup(truncateTables)
+	_, token := createUser(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "alice" || password != "hunter2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.ServeFile(w, r, "../../fixtures/test/rss/podcast.xml")
+	}))
+	t.Cleanup(server.Close)
+
+	result := apitest.New().
+		Handler(newApp()).
+		Post("/api/feeds").
+		Header("Authorization", "Bearer "+token).
+		JSON(fmt.Sprintf(`{"url": "%s","title":"Private","credentials":{"username":"alice","password":"hunter2"}}`, server.URL)).
+		Expect(t).
+		Assert(jsonpath.Equal("$.private", true)).
+		Assert(jsonpath.NotPresent("$.credentials")).
+		Status(http.StatusCreated).
+		End()
+
+	fd := unmarshal[feed.Presenter](t, &result)
+
+	apitest.New().
+		Handler(newApp()).
+		Put(fmt.Sprintf("/api/feeds/%s/sync", fd.ID)).
+		Header("Authorization", "Bearer "+token).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Delete(fmt.Sprintf("/api/feeds/%s/credentials", fd.ID)).
+		Header("Authorization", "Bearer "+token).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Put(fmt.Sprintf("/api/feeds/%s/sync", fd.ID)).
+		Header("Authorization", "Bearer "+token).
+		Expect(t).
+		Status(http.StatusBadGateway).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Put(fmt.Sprintf("/api/feeds/%s/credentials", fd.ID)).
+		Header("Authorization", "Bearer "+token).
+		JSON(`{"username":"alice","password":"hunter2"}`).
+		Expect(t).
+		Assert(jsonpath.Equal("$.private", true)).
+		Status(http.StatusOK).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Put(fmt.Sprintf("/api/feeds/%s/sync", fd.ID)).
+		Header("Authorization", "Bearer "+token).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+}
+
+func TestUpdateCredentialsInvalid(t *testing.T) {
+	t.Cleanup(truncateTables)
+	_, token := createUser(t)
+
+	result := apitest.New().
+		Handler(newApp()).
+		Post("/api/feeds").
+		Header("Authorization", "Bearer "+token).
+		JSON(`{"url": "https://example.com","title":"Example"}`).
+		Expect(t).
+		Assert(jsonpath.Equal("$.private", false)).
+		Status(http.StatusCreated).
+		End()
+
+	fd := unmarshal[feed.Presenter](t, &result)
+
+	apitest.New().
+		Handler(newApp()).
+		Put(fmt.Sprintf("/api/feeds/%s/credentials", fd.ID)).
+		Header("Authorization", "Bearer "+token).
+		JSON(`{"username":"alice","token":"s3cr3t"}`).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Put(fmt.Sprintf("/api/feeds/%s/credentials", uuid.Must(uuid.NewV7()))).
+		Header("Authorization", "Bearer "+token).
+		JSON(`{"token":"s3cr3t"}`).
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+}
+
+func TestImportFeeds(t *testing.T) {
+	t.Cleanup(truncateTables)
+	_, token := createUser(t)
+
+	opml, err := os.ReadFile("../../fixtures/test/opml/subscriptions.opml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/feeds/import").
+		Header("Authorization", "Bearer "+token).
+		ContentType("text/x-opml").
+		Body(string(opml)).
+		Expect(t).
+		Assert(jsonpath.Equal("$.created", float64(3))).
+		Assert(jsonpath.Equal("$.duplicates", float64(1))).
+		Assert(jsonpath.Equal("$.invalid", float64(3))).
+		Assert(jsonpath.Len("$.results", 7)).
+		Status(http.StatusOK).
+		End()
+
+	// Importing the same document again only reports duplicates
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/feeds/import").
+		Header("Authorization", "Bearer "+token).
+		ContentType("text/x-opml").
+		Body(string(opml)).
+		Expect(t).
+		Assert(jsonpath.Equal("$.created", float64(0))).
+		Assert(jsonpath.Equal("$.duplicates", float64(4))).
+		Status(http.StatusOK).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Get("/api/feeds").
+		Header("Authorization", "Bearer "+token).
+		Expect(t).
+		Assert(jsonpath.Len("$", 3)).
+		Status(http.StatusOK).
+		End()
+}
+
+func TestImportFeedsInvalidDocument(t *testing.T) {
+	t.Cleanup(truncateTables)
+	_, token := createUser(t)
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/feeds/import").
+		Header("Authorization", "Bearer "+token).
+		ContentType("text/x-opml").
+		Body("not opml").
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestExportFeeds(t *testing.T) {
+	t.Cleanup(truncateTables)
+	_, token := createUser(t)
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/feeds").
+		Header("Authorization", "Bearer "+token).
+		JSON(`{"url": "https://example.com/feed.rss","title":"Example"}`).
+		Expect(t).
+		Status(http.StatusCreated).
+		End()
+
+	result := apitest.New().
+		Handler(newApp()).
+		Get("/api/feeds/export.opml").
+		Header("Authorization", "Bearer "+token).
+		Expect(t).
+		Header("Content-Type", "text/x-opml; charset=UTF-8").
+		Status(http.StatusOK).
+		End()
+
+	opml, err := io.ReadAll(result.Response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Round-trip the export into the account of another user
+	_, otherToken := createUser(t)
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/feeds/import").
+		Header("Authorization", "Bearer "+otherToken).
+		ContentType("text/x-opml").
+		Body(string(opml)).
+		Expect(t).
+		Assert(jsonpath.Equal("$.created", float64(1))).
+		Assert(jsonpath.Equal("$.results[0].url", "https://example.com/feed.rss")).
+		Assert(jsonpath.Equal("$.results[0].title", "Example")).
 		Status(http.StatusOK).
 		End()
 }
@@ -0,0 +1,90 @@
+package health_test
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/steinfletcher/apitest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pcast-api/controller"
+	"pcast-api/controller/health"
+	testhelper "pcast-api/integration_test/testhelper"
+	healthService "pcast-api/service/health"
+)
+
+func TestMain(m *testing.M) {
+	testhelper.Setup()
+
+	code := m.Run()
+
+	testhelper.Teardown()
+
+	os.Exit(code)
+}
+
+func unmarshal[M any](t *testing.T, result *apitest.Result) *M {
+	u, err := testhelper.UnmarshalResult[M](result.Response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func newApp(t *testing.T) (*echo.Echo, *healthService.Service) {
+	app := testhelper.NewApp()
+	service, err := controller.NewHealthHandler(testhelper.DB, app)
+	require.NoError(t, err)
+
+	return app, service
+}
+
+func TestLiveness(t *testing.T) {
+	app, _ := newApp(t)
+
+	result := apitest.New().
+		Handler(app).
+		Get("/healthz").
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	assert.Equal(t, health.StatusOK, unmarshal[health.Presenter](t, &result).Status)
+}
+
+func TestReadiness(t *testing.T) {
+	// The test database is migrated with goose before the tests
+	app, service := newApp(t)
+
+	result := apitest.New().
+		Handler(app).
+		Get("/readyz").
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	p := unmarshal[health.Presenter](t, &result)
+	assert.Equal(t, health.StatusOK, p.Status)
+	assert.Equal(t, map[string]string{"database": health.StatusOK, "migrations": health.StatusOK}, p.Checks)
+
+	// Once the shutdown started the load balancer stops sending requests, liveness is unaffected
+	service.Drain()
+
+	result = apitest.New().
+		Handler(app).
+		Get("/readyz").
+		Expect(t).
+		Status(http.StatusServiceUnavailable).
+		End()
+	assert.Equal(t, health.StatusDraining, unmarshal[health.Presenter](t, &result).Status)
+
+	apitest.New().
+		Handler(app).
+		Get("/healthz").
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+}
@@ -0,0 +1,166 @@
+package jwks_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/steinfletcher/apitest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pcast-api/config"
+	"pcast-api/controller/jwks"
+	"pcast-api/controller/user"
+	testhelper "pcast-api/integration_test/testhelper"
+)
+
+func TestMain(m *testing.M) {
+	testhelper.Setup()
+
+	code := m.Run()
+
+	testhelper.Teardown()
+
+	os.Exit(code)
+}
+
+func unmarshal[M any](t *testing.T, result *apitest.Result) *M {
+	u, err := testhelper.UnmarshalResult[M](result.Response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func truncateTables() {
+	testhelper.TruncateAll()
+}
+
+// writeSigningKey stores a new Ed25519 private key as PEM file
+func writeSigningKey(t *testing.T, id string) config.SigningKey {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	data, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), id+".pem")
+	require.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: data}), 0o600))
+
+	return config.SigningKey{ID: id, File: file}
+}
+
+func newAppWithSigningKeys(keys ...config.SigningKey) *echo.Echo {
+	cfg := testhelper.TestConfig()
+	cfg.Auth.SigningKeys = keys
+
+	return testhelper.NewAppWithConfig(cfg)
+}
+
+func login(t *testing.T, app *echo.Echo) string {
+	email := fmt.Sprintf("jwks-test-%s@example.com", uuid.New().String()[:8])
+	jsonBody := fmt.Sprintf(`{"email": "%s", "password": "test"}`, email)
+
+	apitest.New().
+		Handler(app).
+		Post("/api/user/register").
+		JSON(jsonBody).
+		Expect(t).
+		Status(http.StatusCreated).
+		End()
+
+	loginResult := apitest.New().
+		Handler(app).
+		Post("/api/user/login").
+		JSON(jsonBody).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	return unmarshal[user.LoginResponse](t, &loginResult).Token
+}
+
+func getKeys(t *testing.T, app *echo.Echo) *jwks.Presenter {
+	result := apitest.New().
+		Handler(app).
+		Get("/.well-known/jwks.json").
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	return unmarshal[jwks.Presenter](t, &result)
+}
+
+func TestJWKS_Secret(t *testing.T) {
+	// Tokens signed with the jwt_secret cannot be verified by others, nothing is published
+	keys := getKeys(t, testhelper.NewApp())
+	assert.Empty(t, keys.Keys)
+}
+
+func TestJWKS_SigningKeys(t *testing.T) {
+	t.Cleanup(truncateTables)
+	current := writeSigningKey(t, "current")
+	previous := writeSigningKey(t, "previous")
+
+	// Tokens of the previous key stay valid during the rotation
+	oldToken := login(t, newAppWithSigningKeys(previous))
+	app := newAppWithSigningKeys(current, previous)
+	token := login(t, app)
+
+	keys := getKeys(t, app)
+	require.Len(t, keys.Keys, 2)
+	assert.Equal(t, "current", keys.Keys[0].ID)
+	assert.Equal(t, "previous", keys.Keys[1].ID)
+
+	// A token is verified with the published key of its kid
+	parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		for _, key := range keys.Keys {
+			if key.ID == token.Header["kid"] {
+				return ed25519.PublicKey(decode(t, key.X)), nil
+			}
+		}
+		return nil, fmt.Errorf("unknown key %v", token.Header["kid"])
+	}, jwt.WithValidMethods([]string{"EdDSA"}))
+	require.NoError(t, err)
+	assert.Equal(t, "current", parsed.Header["kid"])
+	assert.Equal(t, "OKP", keys.Keys[0].KeyType)
+	assert.Equal(t, "Ed25519", keys.Keys[0].Curve)
+
+	for _, accessToken := range []string{token, oldToken} {
+		apitest.New().
+			Handler(app).
+			Get("/api/user/2fa").
+			Header("Authorization", "Bearer "+accessToken).
+			Expect(t).
+			Status(http.StatusOK).
+			End()
+	}
+
+	// Once the previous key is removed its tokens are rejected, as are tokens of the jwt_secret
+	secretToken := login(t, testhelper.NewApp())
+	for _, accessToken := range []string{oldToken, secretToken} {
+		apitest.New().
+			Handler(newAppWithSigningKeys(current)).
+			Get("/api/user/2fa").
+			Header("Authorization", "Bearer "+accessToken).
+			Expect(t).
+			Status(http.StatusUnauthorized).
+			End()
+	}
+}
+
+func decode(t *testing.T, value string) []byte {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	require.NoError(t, err)
+	return decoded
+}
@@ -3,8 +3,13 @@ package testhelper
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 
@@ -16,42 +21,94 @@ import (
 
 var DB *sql.DB
 
+// MailDir receives the mails sent by the app under test
+var MailDir = filepath.Join(os.TempDir(), "pcast-test-mails")
+
 // TestDSN is the connection string for the test database
 const TestDSN = "host=localhost port=5432 user=pcast password=pcast dbname=pcast_test sslmode=disable"
 
 // Test configuration constants
 const (
-	TestJWTSecret        = "testsecret"
-	TestJWTExpirationMin = 10
+	TestJWTSecret            = "testsecret-testsecret-testsecret-1"
+	TestJWTExpirationMin     = 10
+	TestPasswordResetURL     = "http://localhost:3000/reset-password"
+	TestEmailVerificationURL = "http://localhost:3000/verify-email"
+	// TestFeedCredentialsKey is the base64 encoded key "0123456789abcdef0123456789abcdef"
+	TestFeedCredentialsKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
 )
 
 func Setup() {
 	DB = db.NewTestDB(TestDSN)
 
 	DB.Exec("TRUNCATE TABLE users CASCADE")
-	DB.Exec("TRUNCATE TABLE feeds")
-	DB.Exec("TRUNCATE TABLE episodes")
+	DB.Exec("TRUNCATE TABLE revoked_tokens")
+	DB.Exec("TRUNCATE TABLE user_token_revocations")
 
 	RunMigrations()
 }
 
 func Teardown() {
 	DB.Exec("TRUNCATE TABLE users CASCADE")
-	DB.Exec("TRUNCATE TABLE feeds")
-	DB.Exec("TRUNCATE TABLE episodes")
+	DB.Exec("TRUNCATE TABLE revoked_tokens")
+	DB.Exec("TRUNCATE TABLE user_token_revocations")
 	DB.Close()
 }
 
 func RunMigrations() {
 	_, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS users (
+			id UUID PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			email VARCHAR(255) UNIQUE NOT NULL,
+			password VARCHAR(255),
+			email_verified_at TIMESTAMP,
+			totp_secret BYTEA,
+			totp_enabled_at TIMESTAMP,
+			totp_last_step BIGINT,
+			totp_attempts INT NOT NULL DEFAULT 0,
+			totp_attempted_at TIMESTAMP
+		)
+	`)
+	if err != nil {
+		log.Panicf("CRITICAL: failed to create users table: %v", err)
+	}
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_users_email ON users(email)`)
+
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS feeds (
+			id UUID PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			title TEXT NOT NULL,
+			url VARCHAR(1000) NOT NULL,
+			synced_at TIMESTAMP,
+			sync_attempted_at TIMESTAMP,
+			etag VARCHAR(500) NOT NULL DEFAULT '',
+			last_modified VARCHAR(100) NOT NULL DEFAULT '',
+			credentials BYTEA
+		)
+	`)
+	if err != nil {
+		log.Printf("Warning: feeds table creation: %v\n", err)
+	}
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_feeds_user_id ON feeds(user_id)`)
+
+	_, err = DB.Exec(`
 		CREATE TABLE IF NOT EXISTS episodes (
 			id UUID PRIMARY KEY,
 			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
 			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
-			feed_id UUID NOT NULL,
-			feed_guid VARCHAR(255) NOT NULL,
+			feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+			feed_guid TEXT NOT NULL,
 			current_position INTEGER,
-			played BOOLEAN NOT NULL DEFAULT FALSE
+			played BOOLEAN NOT NULL DEFAULT FALSE,
+			title TEXT NOT NULL DEFAULT '',
+			description TEXT NOT NULL DEFAULT '',
+			url TEXT NOT NULL DEFAULT '',
+			duration INTEGER,
+			published_at TIMESTAMP
 		)
 	`)
 	if err != nil {
@@ -59,54 +116,156 @@ func RunMigrations() {
 	}
 	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_episodes_feed_id ON episodes(feed_id)`)
 	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_episodes_feed_guid ON episodes(feed_guid)`)
+	DB.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_episodes_feed_id_feed_guid ON episodes(feed_id, feed_guid)`)
 
 	_, err = DB.Exec(`
-		CREATE TABLE IF NOT EXISTS feeds (
+		CREATE TABLE IF NOT EXISTS refresh_tokens (
 			id UUID PRIMARY KEY,
 			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
 			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
-			user_id UUID NOT NULL,
-			title VARCHAR(500) NOT NULL,
-			url VARCHAR(1000) NOT NULL,
-			synced_at TIMESTAMP
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			family_id UUID NOT NULL,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP,
+			revoked_at TIMESTAMP,
+			authenticated_at TIMESTAMP
 		)
 	`)
 	if err != nil {
-		log.Printf("Warning: feeds table creation: %v\n", err)
+		log.Printf("Warning: refresh_tokens table creation: %v\n", err)
 	}
-	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_feeds_user_id ON feeds(user_id)`)
 
 	_, err = DB.Exec(`
-		CREATE TABLE IF NOT EXISTS users (
+		CREATE TABLE IF NOT EXISTS password_reset_tokens (
 			id UUID PRIMARY KEY,
 			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
 			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
-			email VARCHAR(255) UNIQUE NOT NULL,
-			password VARCHAR(255),
-			google_id VARCHAR(255) UNIQUE
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP
 		)
 	`)
 	if err != nil {
-		log.Panicf("CRITICAL: failed to create users table: %v", err)
+		log.Printf("Warning: password_reset_tokens table creation: %v\n", err)
 	}
-	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_users_email ON users(email)`)
-	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_users_google_id ON users(google_id)`)
+
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS email_verification_tokens (
+			id UUID PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP
+		)
+	`)
+	if err != nil {
+		log.Printf("Warning: email_verification_tokens table creation: %v\n", err)
+	}
+
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS recovery_codes (
+			id UUID PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			code_hash VARCHAR(64) NOT NULL,
+			used_at TIMESTAMP
+		)
+	`)
+	if err != nil {
+		log.Printf("Warning: recovery_codes table creation: %v\n", err)
+	}
+	DB.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_recovery_codes_user_id_code_hash ON recovery_codes(user_id, code_hash)`)
+
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS user_identities (
+			id UUID PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			provider VARCHAR(64) NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			email VARCHAR(255) NOT NULL
+		)
+	`)
+	if err != nil {
+		log.Printf("Warning: user_identities table creation: %v\n", err)
+	}
+	DB.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_user_identities_provider_subject ON user_identities(provider, subject)`)
+	DB.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_user_identities_user_id_provider ON user_identities(user_id, provider)`)
+
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id UUID PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(255) NOT NULL,
+			key_hash VARCHAR(64) UNIQUE NOT NULL,
+			key_prefix VARCHAR(16) NOT NULL,
+			scopes TEXT[] NOT NULL,
+			expires_at TIMESTAMP,
+			last_used_at TIMESTAMP
+		)
+	`)
+	if err != nil {
+		log.Printf("Warning: api_keys table creation: %v\n", err)
+	}
+
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS revoked_tokens (
+			jti VARCHAR(64) PRIMARY KEY,
+			expires_at TIMESTAMP NOT NULL
+		)
+	`)
+	DB.Exec(`
+		CREATE TABLE IF NOT EXISTS user_token_revocations (
+			user_id UUID PRIMARY KEY,
+			revoked_before TIMESTAMP NOT NULL
+		)
+	`)
 }
 
 func NewApp() *echo.Echo {
+	return NewAppWithConfig(TestConfig())
+}
+
+// NewAppWithConfig creates the app with a modified TestConfig
+func NewAppWithConfig(cfg *config.Config) *echo.Echo {
 	r := router.NewTestRouter()
-	apiGroup := r.Group("/api")
 
-	cfg := &config.Config{
+	if err := controller.NewController(cfg, DB, r); err != nil {
+		log.Panicf("failed to initialize controllers: %v", err)
+	}
+
+	return r
+}
+
+// TestConfig returns the configuration of the app under test
+func TestConfig() *config.Config {
+	return &config.Config{
 		Auth: config.Auth{
 			JwtSecret:        TestJWTSecret,
 			JwtExpirationMin: TestJWTExpirationMin,
+			// config.New applies the defaults, which are skipped here
+			RefreshExpirationDays:            config.DefaultRefreshExpirationDays,
+			PasswordResetExpirationMin:       config.DefaultPasswordResetExpirationMin,
+			EmailVerificationExpirationHours: config.DefaultEmailVerificationExpirationHours,
+			FeedCredentialsKey:               TestFeedCredentialsKey,
+			PasswordResetURL:                 TestPasswordResetURL,
+			EmailVerificationURL:             TestEmailVerificationURL,
+		},
+		// The feeds are served by httptest servers on the loopback interface
+		Sync: config.Sync{AllowPrivateAddresses: true},
+		Mail: config.Mail{
+			Driver:    config.MailDriverFile,
+			Directory: MailDir,
 		},
 	}
-
-	controller.NewController(cfg, DB, apiGroup)
-
-	return r
 }
 
 func Unmarshal[T any](bytes []byte) (*T, error) {
@@ -126,8 +285,46 @@ func UnmarshalResult[T any](result io.Reader) (*T, error) {
 	return Unmarshal[T](bytes)
 }
 
+// LastMail returns the latest mail sent to the recipient
+func LastMail(to string) (string, error) {
+	entries, err := os.ReadDir(MailDir)
+	if err != nil {
+		return "", err
+	}
+
+	// Files are named by UUIDv7, the newest one comes last
+	for i := len(entries) - 1; i >= 0; i-- {
+		content, err := os.ReadFile(filepath.Join(MailDir, entries[i].Name()))
+		if err != nil {
+			return "", err
+		}
+		if strings.Contains(string(content), "\r\nTo: "+to+"\r\n") {
+			return string(content), nil
+		}
+	}
+
+	return "", fmt.Errorf("no mail to %s", to)
+}
+
+// WaitForMail returns the latest mail to the recipient other than previous. Password reset and resent
+// verification mails are sent in the background, so it waits a few seconds for the mail to arrive.
+func WaitForMail(to, previous string) (string, error) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mail, err := LastMail(to)
+		if err == nil && mail != previous {
+			return mail, nil
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("no new mail to %s", to)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func TruncateAll() {
 	DB.Exec("TRUNCATE TABLE users CASCADE")
-	DB.Exec("TRUNCATE TABLE feeds")
-	DB.Exec("TRUNCATE TABLE episodes")
+	DB.Exec("TRUNCATE TABLE revoked_tokens")
+	DB.Exec("TRUNCATE TABLE user_token_revocations")
+	os.RemoveAll(MailDir)
 }
@@ -1,17 +1,28 @@
 package user
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/base32"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/steinfletcher/apitest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"pcast-api/controller/user"
 	testhelper "pcast-api/integration_test/testhelper"
+	"pcast-api/service/auth"
+	exportService "pcast-api/service/export"
 )
 
 func TestMain(m *testing.M) {
@@ -87,3 +98,611 @@ func TestUpdatePassword(t *testing.T) {
 		Status(http.StatusOK).
 		End()
 }
+
+func TestRefreshToken(t *testing.T) {
+	t.Cleanup(truncateTable)
+	email := fmt.Sprintf("user-refresh-%s@example.com", uuid.New().String()[:8])
+	jsonBody := fmt.Sprintf(`{"email": "%s", "password": "test"}`, email)
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/register").
+		JSON(jsonBody).
+		Expect(t).
+		Status(http.StatusCreated).
+		End()
+
+	loginResult := apitest.New().
+		Handler(newApp()).
+		Post("/api/user/login").
+		JSON(jsonBody).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	lr := unmarshal[user.LoginResponse](t, &loginResult)
+	assert.NotEmpty(t, lr.RefreshToken)
+
+	refreshResult := apitest.New().
+		Handler(newApp()).
+		Post("/api/user/token/refresh").
+		JSON(fmt.Sprintf(`{"refreshToken": "%s"}`, lr.RefreshToken)).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	rr := unmarshal[user.LoginResponse](t, &refreshResult)
+	assert.NotEmpty(t, rr.Token)
+	assert.NotEqual(t, lr.RefreshToken, rr.RefreshToken)
+
+	apitest.New().
+		Handler(newApp()).
+		Put("/api/user/password").
+		Header("Authorization", "Bearer "+rr.Token).
+		JSON(`{"oldPassword": "test", "newPassword": "test2"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	// Reusing the rotated token revokes the rotated one as well
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/token/refresh").
+		JSON(fmt.Sprintf(`{"refreshToken": "%s"}`, lr.RefreshToken)).
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/token/refresh").
+		JSON(fmt.Sprintf(`{"refreshToken": "%s"}`, rr.RefreshToken)).
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+}
+
+func registerAndLogin(t *testing.T, email string) *user.LoginResponse {
+	jsonBody := fmt.Sprintf(`{"email": "%s", "password": "test"}`, email)
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/register").
+		JSON(jsonBody).
+		Expect(t).
+		Status(http.StatusCreated).
+		End()
+
+	return login(t, email)
+}
+
+func login(t *testing.T, email string) *user.LoginResponse {
+	loginResult := apitest.New().
+		Handler(newApp()).
+		Post("/api/user/login").
+		JSON(fmt.Sprintf(`{"email": "%s", "password": "test"}`, email)).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	return unmarshal[user.LoginResponse](t, &loginResult)
+}
+
+func TestLogout(t *testing.T) {
+	t.Cleanup(truncateTable)
+	email := fmt.Sprintf("user-logout-%s@example.com", uuid.New().String()[:8])
+	lr := registerAndLogin(t, email)
+	other := login(t, email)
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/logout").
+		Header("Authorization", "Bearer "+lr.Token).
+		JSON(fmt.Sprintf(`{"refreshToken": "%s"}`, lr.RefreshToken)).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Get("/api/feeds").
+		Header("Authorization", "Bearer "+lr.Token).
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/token/refresh").
+		JSON(fmt.Sprintf(`{"refreshToken": "%s"}`, lr.RefreshToken)).
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+
+	// Other sessions stay signed in
+	apitest.New().
+		Handler(newApp()).
+		Get("/api/feeds").
+		Header("Authorization", "Bearer "+other.Token).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+}
+
+func TestLogoutAll(t *testing.T) {
+	t.Cleanup(truncateTable)
+	email := fmt.Sprintf("user-logout-all-%s@example.com", uuid.New().String()[:8])
+	lr := registerAndLogin(t, email)
+	other := login(t, email)
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/logout/all").
+		Header("Authorization", "Bearer "+lr.Token).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+
+	for _, session := range []*user.LoginResponse{lr, other} {
+		apitest.New().
+			Handler(newApp()).
+			Get("/api/feeds").
+			Header("Authorization", "Bearer "+session.Token).
+			Expect(t).
+			Status(http.StatusUnauthorized).
+			End()
+
+		apitest.New().
+			Handler(newApp()).
+			Post("/api/user/token/refresh").
+			JSON(fmt.Sprintf(`{"refreshToken": "%s"}`, session.RefreshToken)).
+			Expect(t).
+			Status(http.StatusUnauthorized).
+			End()
+	}
+
+	// Signing in again after logging out everywhere works
+	fresh := login(t, email)
+	apitest.New().
+		Handler(newApp()).
+		Get("/api/feeds").
+		Header("Authorization", "Bearer "+fresh.Token).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+}
+
+func TestDeleteAccount(t *testing.T) {
+	t.Cleanup(truncateTable)
+	email := fmt.Sprintf("user-delete-%s@example.com", uuid.New().String()[:8])
+	lr := registerAndLogin(t, email)
+
+	var userID uuid.UUID
+	require.NoError(t, testhelper.DB.QueryRow("SELECT id FROM users WHERE email = $1", email).Scan(&userID))
+	feedID := uuid.Must(uuid.NewV7())
+	_, err := testhelper.DB.Exec("INSERT INTO feeds (id, user_id, title, url) VALUES ($1, $2, 'Feed', 'https://example.com/feed.xml')", feedID, userID)
+	require.NoError(t, err)
+	_, err = testhelper.DB.Exec("INSERT INTO episodes (id, feed_id, feed_guid) VALUES ($1, $2, 'guid')", uuid.Must(uuid.NewV7()), feedID)
+	require.NoError(t, err)
+
+	apitest.New().
+		Handler(newApp()).
+		Delete("/api/user").
+		Header("Authorization", "Bearer "+lr.Token).
+		JSON(`{"password": "wrong"}`).
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+
+	// Without the password the login must be recent
+	staleToken, err := auth.CreateJWTToken(userID, auth.NewHMACKeys(testhelper.TestJWTSecret), 10, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	apitest.New().
+		Handler(newApp()).
+		Delete("/api/user").
+		Header("Authorization", "Bearer "+staleToken).
+		Expect(t).
+		Status(http.StatusForbidden).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Delete("/api/user").
+		Header("Authorization", "Bearer "+lr.Token).
+		JSON(`{"password": "test"}`).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+
+	var count int
+	require.NoError(t, testhelper.DB.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM users WHERE id = $1) +
+		(SELECT COUNT(*) FROM feeds WHERE user_id = $1) +
+		(SELECT COUNT(*) FROM episodes WHERE feed_id = $2) +
+		(SELECT COUNT(*) FROM refresh_tokens WHERE user_id = $1)`, userID, feedID).Scan(&count))
+	assert.Zero(t, count)
+
+	// Tokens of the deleted account are revoked
+	apitest.New().
+		Handler(newApp()).
+		Get("/api/feeds").
+		Header("Authorization", "Bearer "+lr.Token).
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/token/refresh").
+		JSON(fmt.Sprintf(`{"refreshToken": "%s"}`, lr.RefreshToken)).
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+}
+
+func TestDeleteAccount_RecentLogin(t *testing.T) {
+	t.Cleanup(truncateTable)
+	email := fmt.Sprintf("user-delete-recent-%s@example.com", uuid.New().String()[:8])
+	lr := registerAndLogin(t, email)
+
+	// Right after signing in no password is needed
+	apitest.New().
+		Handler(newApp()).
+		Delete("/api/user").
+		Header("Authorization", "Bearer "+lr.Token).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/login").
+		JSON(fmt.Sprintf(`{"email": "%s", "password": "test"}`, email)).
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+}
+
+// mailTokenPattern finds the token in the link of a reset or verification mail
+var mailTokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+func TestExportData(t *testing.T) {
+	t.Cleanup(truncateTable)
+	email := fmt.Sprintf("user-export-%s@example.com", uuid.New().String()[:8])
+	lr := registerAndLogin(t, email)
+
+	var userID uuid.UUID
+	require.NoError(t, testhelper.DB.QueryRow("SELECT id FROM users WHERE email = $1", email).Scan(&userID))
+	feedID := uuid.Must(uuid.NewV7())
+	_, err := testhelper.DB.Exec("INSERT INTO feeds (id, user_id, title, url) VALUES ($1, $2, 'Feed', 'https://example.com/feed.xml')", feedID, userID)
+	require.NoError(t, err)
+	_, err = testhelper.DB.Exec("INSERT INTO episodes (id, feed_id, feed_guid, current_position, played) VALUES ($1, $2, 'guid', 42, TRUE)", uuid.Must(uuid.NewV7()), feedID)
+	require.NoError(t, err)
+
+	result := apitest.New().
+		Handler(newApp()).
+		Get("/api/user/export").
+		Header("Authorization", "Bearer "+lr.Token).
+		Expect(t).
+		Status(http.StatusOK).
+		Header("Content-Type", "application/zip").
+		End()
+
+	body, err := io.ReadAll(result.Response.Body)
+	require.NoError(t, err)
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+	require.Len(t, archive.File, 2)
+	assert.Equal(t, exportService.DataFile, archive.File[0].Name)
+	assert.Equal(t, exportService.OPMLFile, archive.File[1].Name)
+
+	file, err := archive.File[0].Open()
+	require.NoError(t, err)
+	defer file.Close()
+	var data exportService.Data
+	require.NoError(t, json.NewDecoder(file).Decode(&data))
+	assert.Equal(t, email, data.Profile.Email)
+	assert.True(t, data.Profile.HasPassword)
+	require.Len(t, data.Feeds, 1)
+	require.Len(t, data.Feeds[0].Episodes, 1)
+	assert.Equal(t, 42, *data.Feeds[0].Episodes[0].CurrentPosition)
+	assert.True(t, data.Feeds[0].Episodes[0].Played)
+
+	apitest.New().
+		Handler(newApp()).
+		Get("/api/user/export").
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+}
+
+func TestPasswordReset(t *testing.T) {
+	t.Cleanup(truncateTable)
+	email := fmt.Sprintf("user-reset-%s@example.com", uuid.New().String()[:8])
+	lr := registerAndLogin(t, email)
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/password/forgot").
+		JSON(fmt.Sprintf(`{"email": "%s"}`, email)).
+		Expect(t).
+		Status(http.StatusAccepted).
+		End()
+
+	mail, err := testhelper.WaitForMail(email, "")
+	require.NoError(t, err)
+	match := mailTokenPattern.FindStringSubmatch(mail)
+	require.Len(t, match, 2)
+	token := match[1]
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/password/reset").
+		JSON(fmt.Sprintf(`{"token": "%s", "password": "newpassword"}`, token)).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+
+	// Existing sessions are logged out
+	apitest.New().
+		Handler(newApp()).
+		Get("/api/feeds").
+		Header("Authorization", "Bearer "+lr.Token).
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/login").
+		JSON(fmt.Sprintf(`{"email": "%s", "password": "test"}`, email)).
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/login").
+		JSON(fmt.Sprintf(`{"email": "%s", "password": "newpassword"}`, email)).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	// The token can only be used once
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/password/reset").
+		JSON(fmt.Sprintf(`{"token": "%s", "password": "otherpassword"}`, token)).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestForgotPassword_UnknownEmail(t *testing.T) {
+	email := fmt.Sprintf("user-unknown-%s@example.com", uuid.New().String()[:8])
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/password/forgot").
+		JSON(fmt.Sprintf(`{"email": "%s"}`, email)).
+		Expect(t).
+		Status(http.StatusAccepted).
+		End()
+
+	_, err := testhelper.LastMail(email)
+	assert.Error(t, err)
+}
+
+func TestResetPassword_InvalidToken(t *testing.T) {
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/password/reset").
+		JSON(`{"token": "invalid", "password": "newpassword"}`).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestEmailVerification(t *testing.T) {
+	t.Cleanup(truncateTable)
+	cfg := testhelper.TestConfig()
+	cfg.Auth.RequireEmailVerification = true
+	app := testhelper.NewAppWithConfig(cfg)
+
+	email := fmt.Sprintf("user-verify-%s@example.com", uuid.New().String()[:8])
+	jsonBody := fmt.Sprintf(`{"email": "%s", "password": "test"}`, email)
+
+	registerResult := apitest.New().
+		Handler(app).
+		Post("/api/user/register").
+		JSON(jsonBody).
+		Expect(t).
+		Status(http.StatusCreated).
+		End()
+
+	presenter := unmarshal[user.Presenter](t, &registerResult)
+	assert.False(t, presenter.EmailVerified)
+
+	apitest.New().
+		Handler(app).
+		Post("/api/user/login").
+		JSON(jsonBody).
+		Expect(t).
+		Status(http.StatusForbidden).
+		End()
+
+	mail, err := testhelper.LastMail(email)
+	require.NoError(t, err)
+	assert.Contains(t, mail, testhelper.TestEmailVerificationURL)
+	match := mailTokenPattern.FindStringSubmatch(mail)
+	require.Len(t, match, 2)
+
+	apitest.New().
+		Handler(app).
+		Post("/api/user/email/verify").
+		JSON(fmt.Sprintf(`{"token": "%s"}`, match[1])).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+
+	apitest.New().
+		Handler(app).
+		Post("/api/user/login").
+		JSON(jsonBody).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	// The token can only be used once
+	apitest.New().
+		Handler(app).
+		Post("/api/user/email/verify").
+		JSON(fmt.Sprintf(`{"token": "%s"}`, match[1])).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestResendVerification(t *testing.T) {
+	t.Cleanup(truncateTable)
+	email := fmt.Sprintf("user-resend-%s@example.com", uuid.New().String()[:8])
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/register").
+		JSON(fmt.Sprintf(`{"email": "%s", "password": "test"}`, email)).
+		Expect(t).
+		Status(http.StatusCreated).
+		End()
+
+	first, err := testhelper.LastMail(email)
+	require.NoError(t, err)
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/email/verify/resend").
+		JSON(fmt.Sprintf(`{"email": "%s"}`, email)).
+		Expect(t).
+		Status(http.StatusAccepted).
+		End()
+
+	second, err := testhelper.WaitForMail(email, first)
+	require.NoError(t, err)
+	assert.NotEqual(t, mailTokenPattern.FindString(first), mailTokenPattern.FindString(second))
+
+	// Both links stay valid until used
+	for _, mail := range []string{first, second} {
+		apitest.New().
+			Handler(newApp()).
+			Post("/api/user/email/verify").
+			JSON(fmt.Sprintf(`{"token": "%s"}`, mailTokenPattern.FindStringSubmatch(mail)[1])).
+			Expect(t).
+			Status(http.StatusNoContent).
+			End()
+	}
+}
+
+func TestTwoFactor(t *testing.T) {
+	t.Cleanup(truncateTable)
+	email := fmt.Sprintf("user-2fa-%s@example.com", uuid.New().String()[:8])
+	lr := registerAndLogin(t, email)
+
+	enrollResult := apitest.New().
+		Handler(newApp()).
+		Post("/api/user/2fa/enroll").
+		Header("Authorization", "Bearer "+lr.Token).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	enrollment := unmarshal[user.TwoFactorEnrollmentPresenter](t, &enrollResult)
+	assert.Contains(t, enrollment.URI, "otpauth://totp/")
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/2fa/confirm").
+		Header("Authorization", "Bearer "+lr.Token).
+		JSON(`{"code": "not-a-code"}`).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+
+	confirmResult := apitest.New().
+		Handler(newApp()).
+		Post("/api/user/2fa/confirm").
+		Header("Authorization", "Bearer "+lr.Token).
+		JSON(fmt.Sprintf(`{"code": "%s"}`, auth.TOTPCode(secret, time.Now()))).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	codes := unmarshal[user.RecoveryCodesPresenter](t, &confirmResult)
+	require.Len(t, codes.RecoveryCodes, 10)
+
+	// The password alone only yields a challenge
+	challengeResult := login(t, email)
+	assert.True(t, challengeResult.TwoFactorRequired)
+	assert.Empty(t, challengeResult.Token)
+	require.NotEmpty(t, challengeResult.ChallengeToken)
+
+	// The challenge is no access token
+	apitest.New().
+		Handler(newApp()).
+		Get("/api/feeds").
+		Header("Authorization", "Bearer "+challengeResult.ChallengeToken).
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+
+	// The code used for confirmation cannot be replayed, the next one is accepted
+	loginResult := apitest.New().
+		Handler(newApp()).
+		Post("/api/user/login/2fa").
+		JSON(fmt.Sprintf(`{"challengeToken": "%s", "code": "%s"}`, challengeResult.ChallengeToken, auth.TOTPCode(secret, time.Now().Add(30*time.Second)))).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	tokens := unmarshal[user.LoginResponse](t, &loginResult)
+	assert.NotEmpty(t, tokens.Token)
+
+	// Recovery codes work once
+	for _, status := range []int{http.StatusOK, http.StatusUnauthorized} {
+		apitest.New().
+			Handler(newApp()).
+			Post("/api/user/login/2fa").
+			JSON(fmt.Sprintf(`{"challengeToken": "%s", "code": "%s"}`, challengeResult.ChallengeToken, codes.RecoveryCodes[0])).
+			Expect(t).
+			Status(status).
+			End()
+	}
+
+	apitest.New().
+		Handler(newApp()).
+		Get("/api/user/2fa").
+		Header("Authorization", "Bearer "+tokens.Token).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"enabled": true, "recoveryCodesRemaining": 9}`).
+		End()
+
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/2fa/disable").
+		Header("Authorization", "Bearer "+tokens.Token).
+		JSON(fmt.Sprintf(`{"code": "%s"}`, codes.RecoveryCodes[1])).
+		Expect(t).
+		Status(http.StatusNoContent).
+		End()
+
+	assert.NotEmpty(t, login(t, email).Token)
+}
+
+func TestLoginTwoFactor_InvalidChallenge(t *testing.T) {
+	apitest.New().
+		Handler(newApp()).
+		Post("/api/user/login/2fa").
+		JSON(`{"challengeToken": "invalid", "code": "123456"}`).
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+}
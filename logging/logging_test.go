@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pcast-api/config"
+)
+
+// lines decodes the JSON lines of the logger
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var result []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		result = append(result, entry)
+	}
+	return result
+}
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&config.Server{LogLevel: "info", LogFormat: config.LogFormatJSON}, &buf)
+	userID := uuid.New()
+
+	ctx := WithUserID(WithRequestID(context.Background(), "req-1"), userID)
+	logger.InfoContext(ctx, "store error", "error", "timeout")
+	logger.DebugContext(ctx, "not logged")
+	logger.Info("without request")
+
+	entries := lines(t, &buf)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "store error", entries[0]["msg"])
+	assert.Equal(t, "req-1", entries[0]["request_id"])
+	assert.Equal(t, userID.String(), entries[0]["user_id"])
+	assert.Equal(t, "timeout", entries[0]["error"])
+	assert.NotContains(t, entries[1], "request_id")
+	assert.NotContains(t, entries[1], "user_id")
+}
+
+func TestNew_Text(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&config.Server{LogLevel: "DEBUG", LogFormat: config.LogFormatText}, &buf)
+
+	logger.With("feed_id", 1).DebugContext(WithRequestID(context.Background(), "req-1"), "synced")
+
+	assert.Contains(t, buf.String(), "level=DEBUG msg=synced feed_id=1 request_id=req-1")
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(RequestIDMiddleware())
+	e.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, RequestID(c.Request().Context()))
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NotEmpty(t, rec.Body.String())
+	assert.Equal(t, rec.Body.String(), rec.Header().Get(echo.HeaderXRequestID))
+
+	// The ID of a proxy is kept
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderXRequestID, "proxy-id")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, "proxy-id", rec.Body.String())
+	assert.Equal(t, "proxy-id", rec.Header().Get(echo.HeaderXRequestID))
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&config.Server{LogFormat: config.LogFormatJSON}, &buf)
+	userID := uuid.New()
+
+	e := echo.New()
+	e.Use(RequestIDMiddleware())
+	e.Use(AccessLogMiddleware(logger))
+	e.GET("/api/feeds/:id", func(c echo.Context) error {
+		// Like the auth middleware, which runs after the access log
+		c.SetRequest(c.Request().WithContext(WithUserID(c.Request().Context(), userID)))
+		logger.ErrorContext(c.Request().Context(), "store error", "error", "timeout")
+		return errors.New("store error")
+	})
+	e.GET("/api/feeds", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/feeds/1", nil)
+	req.Header.Set(echo.HeaderXRequestID, "req-1")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/feeds", nil))
+
+	entries := lines(t, &buf)
+	require.Len(t, entries, 3)
+
+	// Every line of the request carries its request and user ID
+	for _, entry := range entries[:2] {
+		assert.Equal(t, "req-1", entry["request_id"])
+		assert.Equal(t, userID.String(), entry["user_id"])
+	}
+	assert.Equal(t, slog.LevelError.String(), entries[1]["level"])
+	assert.Equal(t, "request", entries[1]["msg"])
+	assert.Equal(t, "/api/feeds/:id", entries[1]["route"])
+	assert.Equal(t, "/api/feeds/1", entries[1]["uri"])
+	assert.EqualValues(t, http.StatusInternalServerError, entries[1]["status"])
+	assert.Equal(t, "store error", entries[1]["error"])
+
+	assert.Equal(t, slog.LevelInfo.String(), entries[2]["level"])
+	assert.EqualValues(t, http.StatusOK, entries[2]["status"])
+	assert.NotEmpty(t, entries[2]["request_id"])
+	assert.NotContains(t, entries[2], "user_id")
+}
@@ -1,17 +1,26 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/labstack/echo/v4"
 	echoSwagger "github.com/swaggo/echo-swagger"
 
 	"pcast-api/config"
 	"pcast-api/controller"
 	"pcast-api/db"
 	_ "pcast-api/docs"
+	"pcast-api/logging"
+	"pcast-api/metrics"
 	"pcast-api/router"
+	"pcast-api/server"
+	"pcast-api/tracing"
 )
 
 const usage = `Usage:
@@ -32,21 +41,86 @@ func main() {
 
 	c, err := config.New(cfgFile)
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		fatal("Failed to load config", err)
 	}
 
-	r := router.New(c)
-	apiGroup := r.Group("/api")
+	logger := logging.New(&c.Server, os.Stdout)
+	slog.SetDefault(logger)
+
+	tracer, err := tracing.New(context.Background(), &c.Tracing)
+	if err != nil {
+		fatal("Failed to initialize tracing", err)
+	}
+
+	r := router.New(c, logger)
+	// The start is logged below, so the output stays parseable
+	r.HideBanner = true
+	r.HidePort = true
 
 	// Initialize database connection (all stores now use sqlc)
 	d, err := db.New(c)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("Failed to connect to database", err)
 	}
 
-	controller.NewController(c, d, apiGroup)
+	if err := controller.NewController(c, d, r); err != nil {
+		fatal("Failed to initialize controllers", err)
+	}
 
 	r.GET("/swagger/*", echoSwagger.WrapHandler)
 
-	r.Logger.Fatal(r.Start(c.Server.GetAddress()))
+	health, err := controller.NewHealthHandler(d, r)
+	if err != nil {
+		fatal("Failed to initialize health checks", err)
+	}
+
+	drainDelay, err := c.Server.GetDrainDelay()
+	if err != nil {
+		fatal("Failed to parse drain delay", err)
+	}
+	shutdownTimeout, err := c.Server.GetShutdownTimeout()
+	if err != nil {
+		fatal("Failed to parse shutdown timeout", err)
+	}
+
+	// On SIGTERM /readyz fails, then the workers stop, in-flight requests are drained and the database pool is closed last
+	srv := server.New(r, drainDelay, shutdownTimeout)
+	srv.AddDrainHook(health.Drain)
+	if c.Sync.Enabled {
+		scheduler, err := controller.NewFeedScheduler(c, d)
+		if err != nil {
+			fatal("Failed to create feed scheduler", err)
+		}
+		srv.AddWorker(scheduler.Run)
+	}
+	// Spans of the drained requests are exported before the database is closed
+	srv.AddCloser(tracer)
+	srv.AddCloser(d)
+
+	if err := metrics.RegisterDB(d, c.Database.Database); err != nil {
+		fatal("Failed to register database metrics", err)
+	}
+	if c.Server.AdminPort == 0 {
+		r.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+	} else {
+		admin := echo.New()
+		admin.HideBanner = true
+		admin.HidePort = true
+		admin.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+		srv.AddWorker(server.AdminWorker(admin, c.Server.GetAdminAddress()))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	slog.Info("Starting server", "address", c.Server.GetAddress(), "admin_port", c.Server.AdminPort)
+	if err := srv.Run(ctx, c.Server.GetAddress()); err != nil {
+		fatal("Server failed", err)
+	}
+}
+
+// fatal logs err and exits, the deferred calls are not run
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
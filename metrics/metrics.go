@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "pcast"
+
+// Login methods
+const (
+	LoginPassword  = "password"
+	LoginTwoFactor = "2fa"
+	LoginOAuth     = "oauth"
+)
+
+// Outcomes of a feed sync
+const (
+	SyncUpdated     = "updated"
+	SyncNotModified = "not_modified"
+	SyncFailed      = "failed"
+)
+
+// unmatchedRoute labels requests without a route, so unknown URIs do not create new series
+const unmatchedRoute = "unmatched"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts by method and result.",
+	}, []string{"method", "result"})
+
+	feedSyncs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "feed_syncs_total",
+		Help:      "Feed syncs by outcome.",
+	}, []string{"outcome"})
+
+	feedSyncDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "feed_sync_duration_seconds",
+		Help:      "Duration of feed syncs including the download by outcome.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"outcome"})
+)
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RegisterDB exposes the connection pool stats of db
+func RegisterDB(db *sql.DB, name string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Middleware counts the requests and observes their latency. The route is the path echo matched,
+// like /api/feeds/:id, and not the requested URI.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			route := c.Path()
+			if route == "" || route == "/*" {
+				route = unmatchedRoute
+			}
+
+			labels := prometheus.Labels{
+				"method": c.Request().Method,
+				"route":  route,
+				"status": strconv.Itoa(status(c, err)),
+			}
+			httpRequests.With(labels).Inc()
+			httpRequestDuration.With(labels).Observe(time.Since(start).Seconds())
+
+			return err
+		}
+	}
+}
+
+// status returns the status the response will have. Errors are only written by the error handler after the middleware.
+func status(c echo.Context, err error) int {
+	if err == nil || c.Response().Committed {
+		return c.Response().Status
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+	return http.StatusInternalServerError
+}
+
+// ObserveLogin counts a login attempt, it failed if err is set
+func ObserveLogin(method string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	logins.WithLabelValues(method, result).Inc()
+}
+
+// ObserveFeedSync records a sync that started at start, it failed if err is set
+func ObserveFeedSync(start time.Time, outcome string, err error) {
+	if err != nil {
+		outcome = SyncFailed
+	}
+
+	feedSyncs.WithLabelValues(outcome).Inc()
+	feedSyncDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(e *echo.Echo, method string, target string) {
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, target, nil))
+}
+
+func TestMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(Middleware())
+	g := e.Group("/api")
+	g.GET("/feeds/:id", func(c echo.Context) error {
+		if c.Param("id") == "missing" {
+			return echo.ErrNotFound
+		}
+		return c.NoContent(http.StatusOK)
+	})
+	g.POST("/feeds", func(c echo.Context) error {
+		return errors.New("store error")
+	})
+
+	serve(e, http.MethodGet, "/api/feeds/1")
+	serve(e, http.MethodGet, "/api/feeds/2")
+	serve(e, http.MethodGet, "/api/feeds/missing")
+	serve(e, http.MethodPost, "/api/feeds")
+	serve(e, http.MethodGet, "/unknown/path")
+
+	// The route is labelled with the path pattern, not the URI
+	assert.Equal(t, 2.0, testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/api/feeds/:id", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/api/feeds/:id", "404")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequests.WithLabelValues("POST", "/api/feeds", "500")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequests.WithLabelValues("GET", unmatchedRoute, "404")))
+	assert.Equal(t, 4, testutil.CollectAndCount(httpRequestDuration))
+}
+
+func TestObserveLogin(t *testing.T) {
+	ObserveLogin(LoginPassword, nil)
+	ObserveLogin(LoginPassword, errors.New("invalid password"))
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(logins.WithLabelValues(LoginPassword, "success")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(logins.WithLabelValues(LoginPassword, "failure")))
+}
+
+func TestObserveFeedSync(t *testing.T) {
+	ObserveFeedSync(time.Now(), SyncNotModified, nil)
+	ObserveFeedSync(time.Now(), SyncUpdated, errors.New("timeout"))
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(feedSyncs.WithLabelValues(SyncNotModified)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(feedSyncs.WithLabelValues(SyncFailed)))
+	assert.Zero(t, testutil.ToFloat64(feedSyncs.WithLabelValues(SyncUpdated)))
+}
+
+func TestHandler(t *testing.T) {
+	ObserveLogin(LoginOAuth, nil)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `pcast_logins_total{method="oauth",result="success"} 1`)
+}
@@ -1,9 +1,17 @@
 package auth
 
 import (
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+
+	"pcast-api/logging"
 )
 
 // UserContextKey is the context key for storing user ID
@@ -11,18 +19,46 @@ type UserContextKey string
 
 const (
 	UserIDKey UserContextKey = "user_id"
+	ClaimsKey UserContextKey = "token_claims"
+	APIKeyKey UserContextKey = "api_key"
 )
 
-// JWTMiddleware extracts user ID from JWT token and stores it in context
-type JWTMiddleware struct {
-	secret []byte
+// TokenClaims are the claims of the access token of the request
+type TokenClaims struct {
+	UserID uuid.UUID
+	// ID is the jti claim, empty for tokens issued before tokens could be revoked
+	ID        string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	// AuthenticatedAt is the auth_time claim, the time the user signed in. Zero for tokens without it.
+	AuthenticatedAt time.Time
 }
 
-func NewJWTMiddleware(secret []byte) *JWTMiddleware {
-	return &JWTMiddleware{secret: secret}
+// APIKeyClaims are the user and scopes of the API key of the request
+type APIKeyClaims struct {
+	UserID uuid.UUID
+	Scopes []string
+}
+
+// JWTMiddleware reads the user ID and scopes of the token validated by the echo-jwt middleware,
+// which verifies the signature with the keys of the token service
+type JWTMiddleware struct{}
+
+func NewJWTMiddleware() *JWTMiddleware {
+	return &JWTMiddleware{}
 }
 
 func (m *JWTMiddleware) ExtractUserID(c echo.Context) (*uuid.UUID, error) {
+	claims, err := m.ExtractClaims(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &claims.UserID, nil
+}
+
+// ExtractClaims reads the claims of the token validated by the echo-jwt middleware
+func (m *JWTMiddleware) ExtractClaims(c echo.Context) (*TokenClaims, error) {
 	token, ok := c.Get("user").(*jwt.Token)
 	if !ok {
 		return nil, echo.ErrUnauthorized
@@ -43,11 +79,33 @@ func (m *JWTMiddleware) ExtractUserID(c echo.Context) (*uuid.UUID, error) {
 		return nil, echo.ErrBadRequest
 	}
 
-	return &userID, nil
+	result := &TokenClaims{UserID: userID}
+	result.ID, _ = claims["jti"].(string)
+
+	// Read iat directly, jwt.NumericDate truncates it to seconds
+	if iat, ok := claims["iat"].(float64); ok {
+		result.IssuedAt = time.UnixMilli(int64(math.Round(iat * 1000)))
+	}
+
+	if authTime, ok := claims["auth_time"].(float64); ok {
+		result.AuthenticatedAt = time.Unix(int64(authTime), 0)
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil {
+		return nil, echo.ErrUnauthorized
+	}
+	if exp != nil {
+		result.ExpiresAt = exp.Time
+	}
+
+	return result, nil
 }
 
+// SetUserID stores the user of the request, the logs of the request carry the user ID from now on
 func (m *JWTMiddleware) SetUserID(c echo.Context, userID uuid.UUID) {
 	c.Set(string(UserIDKey), userID)
+	c.SetRequest(c.Request().WithContext(logging.WithUserID(c.Request().Context(), userID)))
 }
 
 func (m *JWTMiddleware) GetUserID(c echo.Context) (*uuid.UUID, error) {
@@ -58,3 +116,49 @@ func (m *JWTMiddleware) GetUserID(c echo.Context) (*uuid.UUID, error) {
 
 	return &userID, nil
 }
+
+func (m *JWTMiddleware) SetClaims(c echo.Context, claims *TokenClaims) {
+	c.Set(string(ClaimsKey), claims)
+}
+
+func (m *JWTMiddleware) GetClaims(c echo.Context) (*TokenClaims, error) {
+	claims, ok := c.Get(string(ClaimsKey)).(*TokenClaims)
+	if !ok {
+		return nil, echo.ErrUnauthorized
+	}
+
+	return claims, nil
+}
+
+// SetAPIKey stores the API key of the request. The user ID is only set by RequireScope,
+// so routes without a scope do not accept API keys.
+func (m *JWTMiddleware) SetAPIKey(c echo.Context, claims *APIKeyClaims) {
+	c.Set(string(APIKeyKey), claims)
+}
+
+// RequireScope lets API keys with the scope access the route. Access tokens are not scoped and always pass.
+func (m *JWTMiddleware) RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, ok := c.Get(string(APIKeyKey)).(*APIKeyClaims)
+			if !ok {
+				return next(c)
+			}
+			if !slices.Contains(claims.Scopes, scope) {
+				return echo.NewHTTPError(http.StatusForbidden, "API key lacks scope "+scope)
+			}
+
+			m.SetUserID(c, claims.UserID)
+			return next(c)
+		}
+	}
+}
+
+// BearerToken returns the token of the Authorization header, empty if there is none
+func BearerToken(c echo.Context) string {
+	token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return token
+}
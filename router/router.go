@@ -1,29 +1,25 @@
 package router
 
 import (
+	"log/slog"
+
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
-	"github.com/labstack/gommon/log"
+
 	"pcast-api/config"
+	"pcast-api/logging"
+	"pcast-api/metrics"
 	"pcast-api/router/validator"
-	"strings"
+	"pcast-api/tracing"
 )
 
-var logLevels = map[string]log.Lvl{
-	"debug": log.DEBUG,
-	"info":  log.INFO,
-	"warn":  log.WARN,
-	"error": log.ERROR,
-}
-
-func New(c *config.Config) *echo.Echo {
+func New(c *config.Config, logger *slog.Logger) *echo.Echo {
 	e := echo.New()
+	e.Use(logging.RequestIDMiddleware())
+	e.Use(tracing.Middleware(c.Tracing.ServiceName))
+	e.Use(metrics.Middleware())
 
 	if c.Server.Logging {
-		ll := getLogLevel(c.Server.LogLevel)
-
-		e.Logger.SetLevel(ll)
-		e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{Format: c.Server.LogFormat}))
+		e.Use(logging.AccessLogMiddleware(logger))
 	}
 
 	e.Validator = validator.New()
@@ -31,15 +27,6 @@ func New(c *config.Config) *echo.Echo {
 	return e
 }
 
-func getLogLevel(s string) log.Lvl {
-	ll, ok := logLevels[strings.ToLower(s)]
-	if !ok {
-		return log.INFO
-	}
-
-	return ll
-}
-
 func NewTestRouter() *echo.Echo {
 	e := echo.New()
 	e.Validator = validator.New()
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Worker runs in the background until ctx is canceled
+type Worker func(ctx context.Context)
+
+// Server runs the HTTP server together with the background workers and shuts both down gracefully
+type Server struct {
+	echo            *echo.Echo
+	drainDelay      time.Duration
+	shutdownTimeout time.Duration
+	drainHooks      []func()
+	workers         []Worker
+	closers         []io.Closer
+}
+
+func New(e *echo.Echo, drainDelay time.Duration, shutdownTimeout time.Duration) *Server {
+	return &Server{echo: e, drainDelay: drainDelay, shutdownTimeout: shutdownTimeout}
+}
+
+// AddDrainHook adds a function called as soon as the shutdown starts, e.g. to fail the readiness probe
+func (s *Server) AddDrainHook(hook func()) {
+	s.drainHooks = append(s.drainHooks, hook)
+}
+
+// AddWorker adds a worker started by Run
+func (s *Server) AddWorker(worker Worker) {
+	s.workers = append(s.workers, worker)
+}
+
+// AddCloser adds a resource like the database pool that is closed once requests and workers are done.
+// Closers are closed in the order they were added.
+func (s *Server) AddCloser(closer io.Closer) {
+	s.closers = append(s.closers, closer)
+}
+
+// Run serves requests on address until ctx is canceled, e.g. by SIGTERM, or the server fails.
+// The shutdown then happens in order:
+//  1. the drain hooks are called and requests are still served for the drain delay, so the load balancer
+//     notices the failing readiness probe
+//  2. the workers are canceled and new connections are refused
+//  3. in-flight requests and workers get the shutdown timeout to finish, afterwards connections are closed
+//  4. the closers are closed
+func (s *Server) Run(ctx context.Context, address string) error {
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var workers sync.WaitGroup
+	for _, worker := range s.workers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			worker(workerCtx)
+		}()
+	}
+
+	started := make(chan error, 1)
+	go func() {
+		started <- s.echo.Start(address)
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		s.drain()
+	case err = <-started:
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	stopWorkers()
+	if shutdownErr := s.echo.Shutdown(shutdownCtx); shutdownErr != nil {
+		// Requests still running after the timeout are aborted
+		s.echo.Close()
+		err = errors.Join(err, shutdownErr)
+	}
+	if waitErr := wait(shutdownCtx, &workers); waitErr != nil {
+		err = errors.Join(err, waitErr)
+	}
+
+	for _, closer := range s.closers {
+		if closeErr := closer.Close(); closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
+	}
+
+	return err
+}
+
+// drain calls the drain hooks and keeps serving requests for the drain delay
+func (s *Server) drain() {
+	for _, hook := range s.drainHooks {
+		hook()
+	}
+
+	time.Sleep(s.drainDelay)
+}
+
+// AdminWorker serves e on a separate address, e.g. the metrics on an admin port, until ctx is canceled
+func AdminWorker(e *echo.Echo, address string) Worker {
+	return func(ctx context.Context) {
+		go func() {
+			if err := e.Start(address); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("admin server failed", "address", address, "error", err)
+			}
+		}()
+
+		<-ctx.Done()
+		e.Close()
+	}
+}
+
+// wait waits for the workers until ctx is done
+func wait(ctx context.Context, workers *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// events records the steps of a shutdown in order
+type events struct {
+	mu   sync.Mutex
+	list []string
+}
+
+func (e *events) add(event string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.list = append(e.list, event)
+}
+
+func (e *events) get() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.list...)
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+// newEcho serves a handler that blocks until release is closed
+func newEcho(t *testing.T, entered chan<- struct{}, release <-chan struct{}, events *events) (*echo.Echo, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.Listener = listener
+	e.GET("/slow", func(c echo.Context) error {
+		entered <- struct{}{}
+		<-release
+		events.add("request")
+		return c.NoContent(http.StatusOK)
+	})
+
+	return e, "http://" + listener.Addr().String()
+}
+
+func get(url string) (int, error) {
+	res, err := http.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	return res.StatusCode, nil
+}
+
+func TestServer_Run(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	events := &events{}
+	e, url := newEcho(t, entered, release, events)
+
+	srv := New(e, 0, 5*time.Second)
+	srv.AddWorker(func(ctx context.Context) {
+		<-ctx.Done()
+		events.add("worker")
+	})
+	srv.AddCloser(closerFunc(func() error {
+		events.add("redis")
+		return nil
+	}))
+	srv.AddCloser(closerFunc(func() error {
+		events.add("db")
+		return nil
+	}))
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- srv.Run(ctx, "")
+	}()
+
+	status := make(chan int)
+	go func() {
+		code, _ := get(url + "/slow")
+		status <- code
+	}()
+	<-entered
+
+	// SIGTERM
+	stop()
+
+	// New connections are refused while the in-flight request is drained
+	assert.Eventually(t, func() bool {
+		_, err := get(url + "/other")
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+	assert.NotContains(t, events.get(), "request")
+	assert.NotContains(t, events.get(), "db")
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-status)
+	require.NoError(t, <-done)
+
+	// The workers and requests are done before the resources are closed, in order
+	got := events.get()
+	require.Len(t, got, 4)
+	assert.ElementsMatch(t, []string{"worker", "request"}, got[:2])
+	assert.Equal(t, []string{"redis", "db"}, got[2:])
+}
+
+func TestServer_Run_DrainDelay(t *testing.T) {
+	events := &events{}
+	e, url := newEcho(t, make(chan struct{}), make(chan struct{}), events)
+	var draining atomic.Bool
+	e.GET("/readyz", func(c echo.Context) error {
+		if draining.Load() {
+			return c.NoContent(http.StatusServiceUnavailable)
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	srv := New(e, 200*time.Millisecond, time.Second)
+	srv.AddDrainHook(func() {
+		draining.Store(true)
+	})
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- srv.Run(ctx, "")
+	}()
+
+	require.Eventually(t, func() bool {
+		code, err := get(url + "/readyz")
+		return err == nil && code == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+	stop()
+
+	// Requests are still served during the drain delay, the readiness probe fails
+	code, err := get(url + "/readyz")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	require.NoError(t, <-done)
+	_, err = get(url + "/readyz")
+	assert.Error(t, err)
+}
+
+func TestServer_Run_Timeout(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	events := &events{}
+	e, url := newEcho(t, entered, release, events)
+
+	srv := New(e, 0, 50*time.Millisecond)
+	srv.AddCloser(closerFunc(func() error {
+		events.add("db")
+		return nil
+	}))
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- srv.Run(ctx, "")
+	}()
+
+	failed := make(chan error)
+	go func() {
+		_, err := get(url + "/slow")
+		failed <- err
+	}()
+	<-entered
+	stop()
+
+	// The request is aborted after the timeout, the resources are closed anyway
+	assert.ErrorIs(t, <-done, context.DeadlineExceeded)
+	assert.Error(t, <-failed)
+	assert.Equal(t, []string{"db"}, events.get())
+}
+
+func TestAdminWorker(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	admin := echo.New()
+	admin.HideBanner = true
+	admin.HidePort = true
+	admin.Listener = listener
+	admin.GET("/metrics", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	url := "http://" + listener.Addr().String() + "/metrics"
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		AdminWorker(admin, "")(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		code, err := get(url)
+		return err == nil && code == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+
+	stop()
+	<-done
+	_, err = get(url)
+	assert.Error(t, err)
+}
+
+func TestServer_Run_StartError(t *testing.T) {
+	events := &events{}
+	srv := New(echo.New(), 0, time.Second)
+	srv.AddWorker(func(ctx context.Context) {
+		<-ctx.Done()
+		events.add("worker")
+	})
+	srv.AddCloser(closerFunc(func() error {
+		events.add("db")
+		return nil
+	}))
+
+	err := srv.Run(context.Background(), "invalid address")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"worker", "db"}, events.get())
+}
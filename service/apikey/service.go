@@ -0,0 +1,149 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+
+	"pcast-api/service/auth"
+	modelInterface "pcast-api/service/model_interface"
+	store "pcast-api/store/apikey"
+)
+
+var tracer = otel.Tracer("pcast-api/service/apikey")
+
+// Scopes of API keys. Access tokens are not scoped, they grant everything.
+const (
+	ScopeFeedsRead     = "feeds:read"
+	ScopeFeedsWrite    = "feeds:write"
+	ScopeEpisodesRead  = "episodes:read"
+	ScopeEpisodesWrite = "episodes:write"
+)
+
+// Scopes are all scopes an API key can have
+var Scopes = []string{ScopeFeedsRead, ScopeFeedsWrite, ScopeEpisodesRead, ScopeEpisodesWrite}
+
+// KeyPrefix starts every API key, it tells API keys and access tokens apart
+const KeyPrefix = "pcast_"
+
+// displayPrefixLength is the length of the start of a key that is stored in clear to recognize it
+const displayPrefixLength = len(KeyPrefix) + 6
+
+// lastUsedInterval limits the writes of the last use, a busy script would update it on every request
+const lastUsedInterval = time.Minute
+
+var (
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	ErrInvalidAPIKey  = errors.New("invalid or expired API key")
+	ErrInvalidScope   = errors.New("unknown API key scope")
+	ErrNoScopes       = errors.New("API key needs at least one scope")
+	ErrExpiryInPast   = errors.New("API key expiry is in the past")
+)
+
+type Service struct {
+	store modelInterface.APIKey
+}
+
+func NewService(store modelInterface.APIKey) *Service {
+	return &Service{store: store}
+}
+
+// IsAPIKey reports whether a bearer token is an API key rather than an access token
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, KeyPrefix)
+}
+
+// Create creates a key with the scopes, expiresAt is nil for a key that does not expire.
+// The key is only returned here, the store only knows its hash.
+func (s *Service) Create(ctx context.Context, userID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (*store.APIKey, string, error) {
+	ctx, span := tracer.Start(ctx, "apikey.Create")
+	defer span.End()
+
+	if len(scopes) == 0 {
+		return nil, "", ErrNoScopes
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return nil, "", ErrInvalidScope
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", ErrExpiryInPast
+	}
+
+	token, err := auth.GenerateToken()
+	if err != nil {
+		return nil, "", err
+	}
+	key := KeyPrefix + token
+
+	sorted := slices.Clone(scopes)
+	slices.Sort(sorted)
+
+	apiKey := &store.APIKey{
+		UserID:    userID,
+		Name:      name,
+		KeyHash:   auth.HashToken(key),
+		KeyPrefix: key[:displayPrefixLength],
+		Scopes:    slices.Compact(sorted),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.store.Create(ctx, apiKey); err != nil {
+		return nil, "", err
+	}
+
+	return apiKey, key, nil
+}
+
+// List returns the keys of the user
+func (s *Service) List(ctx context.Context, userID uuid.UUID) ([]store.APIKey, error) {
+	ctx, span := tracer.Start(ctx, "apikey.List")
+	defer span.End()
+
+	return s.store.FindByUserID(ctx, userID)
+}
+
+// Delete revokes a key of the user
+func (s *Service) Delete(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "apikey.Delete")
+	defer span.End()
+
+	deleted, err := s.store.Delete(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate returns the stored key of an API key and records its use
+func (s *Service) Authenticate(ctx context.Context, key string) (*store.APIKey, error) {
+	ctx, span := tracer.Start(ctx, "apikey.Authenticate")
+	defer span.End()
+
+	if !IsAPIKey(key) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	apiKey, err := s.store.FindByHash(ctx, auth.HashToken(key))
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if apiKey.ExpiresAt != nil && !apiKey.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if apiKey.LastUsedAt == nil || time.Since(*apiKey.LastUsedAt) > lastUsedInterval {
+		// The last use is informational, failing to record it must not fail the request
+		_ = s.store.MarkUsed(ctx, apiKey)
+	}
+
+	return apiKey, nil
+}
@@ -0,0 +1,187 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pcast-api/service/auth"
+	store "pcast-api/store/apikey"
+)
+
+// mockAPIKeyStore keeps API keys in memory
+type mockAPIKeyStore struct {
+	keys      []*store.APIKey
+	createErr error
+	markErr   error
+	marked    int
+}
+
+func (m *mockAPIKeyStore) Create(ctx context.Context, key *store.APIKey) error {
+	if m.createErr != nil {
+		return m.createErr
+	}
+	key.ID = uuid.Must(uuid.NewV7())
+	m.keys = append(m.keys, key)
+	return nil
+}
+
+func (m *mockAPIKeyStore) FindByHash(ctx context.Context, keyHash string) (*store.APIKey, error) {
+	for _, key := range m.keys {
+		if key.KeyHash == keyHash {
+			return key, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (m *mockAPIKeyStore) FindByUserID(ctx context.Context, userID uuid.UUID) ([]store.APIKey, error) {
+	var keys []store.APIKey
+	for _, key := range m.keys {
+		if key.UserID == userID {
+			keys = append(keys, *key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *mockAPIKeyStore) MarkUsed(ctx context.Context, key *store.APIKey) error {
+	m.marked++
+	if m.markErr != nil {
+		return m.markErr
+	}
+	now := time.Now()
+	key.LastUsedAt = &now
+	return nil
+}
+
+func (m *mockAPIKeyStore) Delete(ctx context.Context, userID uuid.UUID, id uuid.UUID) (bool, error) {
+	for i, key := range m.keys {
+		if key.ID == id && key.UserID == userID {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestService_Create(t *testing.T) {
+	keys := &mockAPIKeyStore{}
+	service := NewService(keys)
+	userID := uuid.Must(uuid.NewV7())
+
+	apiKey, key, err := service.Create(context.Background(), userID, "cron", []string{ScopeFeedsWrite, ScopeFeedsRead, ScopeFeedsRead}, nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, KeyPrefix))
+	assert.True(t, IsAPIKey(key))
+	assert.Equal(t, userID, apiKey.UserID)
+	assert.Equal(t, "cron", apiKey.Name)
+	assert.Equal(t, []string{ScopeFeedsRead, ScopeFeedsWrite}, apiKey.Scopes)
+	assert.Nil(t, apiKey.ExpiresAt)
+	// Only the hash and a short prefix of the key are stored
+	assert.Equal(t, auth.HashToken(key), apiKey.KeyHash)
+	assert.Equal(t, key[:12], apiKey.KeyPrefix)
+	assert.NotContains(t, apiKey.KeyHash, key)
+
+	_, other, err := service.Create(context.Background(), userID, "cron", []string{ScopeFeedsRead}, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+}
+
+func TestService_Create_Invalid(t *testing.T) {
+	service := NewService(&mockAPIKeyStore{})
+	userID := uuid.Must(uuid.NewV7())
+	past := time.Now().Add(-time.Hour)
+
+	_, _, err := service.Create(context.Background(), userID, "cron", nil, nil)
+	assert.Equal(t, ErrNoScopes, err)
+
+	_, _, err = service.Create(context.Background(), userID, "cron", []string{ScopeFeedsRead, "user:write"}, nil)
+	assert.Equal(t, ErrInvalidScope, err)
+
+	_, _, err = service.Create(context.Background(), userID, "cron", []string{ScopeFeedsRead}, &past)
+	assert.Equal(t, ErrExpiryInPast, err)
+}
+
+func TestService_Authenticate(t *testing.T) {
+	keys := &mockAPIKeyStore{}
+	service := NewService(keys)
+	userID := uuid.Must(uuid.NewV7())
+	_, key, err := service.Create(context.Background(), userID, "cron", []string{ScopeFeedsRead}, nil)
+	require.NoError(t, err)
+
+	apiKey, err := service.Authenticate(context.Background(), key)
+	assert.NoError(t, err)
+	require.NotNil(t, apiKey)
+	assert.Equal(t, userID, apiKey.UserID)
+	assert.NotNil(t, apiKey.LastUsedAt)
+	assert.Equal(t, 1, keys.marked)
+
+	// The last use is written at most once a minute
+	_, err = service.Authenticate(context.Background(), key)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, keys.marked)
+
+	for _, invalid := range []string{"", "pcast_unknown", key[len(KeyPrefix):], "eyJhbGciOiJIUzI1NiJ9.e30.sig"} {
+		_, err = service.Authenticate(context.Background(), invalid)
+		assert.Equal(t, ErrInvalidAPIKey, err)
+	}
+}
+
+func TestService_Authenticate_Expired(t *testing.T) {
+	keys := &mockAPIKeyStore{}
+	service := NewService(keys)
+	expiresAt := time.Now().Add(time.Hour)
+	apiKey, key, err := service.Create(context.Background(), uuid.Must(uuid.NewV7()), "cron", []string{ScopeFeedsRead}, &expiresAt)
+	require.NoError(t, err)
+
+	_, err = service.Authenticate(context.Background(), key)
+	assert.NoError(t, err)
+
+	expired := time.Now().Add(-time.Second)
+	apiKey.ExpiresAt = &expired
+	_, err = service.Authenticate(context.Background(), key)
+	assert.Equal(t, ErrInvalidAPIKey, err)
+}
+
+func TestService_Authenticate_MarkUsedFails(t *testing.T) {
+	keys := &mockAPIKeyStore{markErr: errors.New("database error")}
+	service := NewService(keys)
+	_, key, err := service.Create(context.Background(), uuid.Must(uuid.NewV7()), "cron", []string{ScopeFeedsRead}, nil)
+	require.NoError(t, err)
+
+	_, err = service.Authenticate(context.Background(), key)
+	assert.NoError(t, err)
+}
+
+func TestService_ListAndDelete(t *testing.T) {
+	keys := &mockAPIKeyStore{}
+	service := NewService(keys)
+	userID := uuid.Must(uuid.NewV7())
+	apiKey, _, err := service.Create(context.Background(), userID, "cron", []string{ScopeFeedsRead}, nil)
+	require.NoError(t, err)
+	_, _, err = service.Create(context.Background(), uuid.Must(uuid.NewV7()), "other", []string{ScopeFeedsRead}, nil)
+	require.NoError(t, err)
+
+	list, err := service.List(context.Background(), userID)
+	assert.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, apiKey.ID, list[0].ID)
+
+	// Keys of other users are not found
+	err = service.Delete(context.Background(), uuid.Must(uuid.NewV7()), apiKey.ID)
+	assert.Equal(t, ErrAPIKeyNotFound, err)
+
+	err = service.Delete(context.Background(), userID, apiKey.ID)
+	assert.NoError(t, err)
+
+	list, err = service.List(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// challengeExpiration is the time a user has to enter the second factor after the password
+const challengeExpiration = 5 * time.Minute
+
+// challengeAudience marks challenge tokens, so they cannot be confused with other tokens signed by this service
+const challengeAudience = "pcast-2fa-challenge"
+
+var ErrInvalidChallenge = errors.New("invalid two-factor challenge token")
+
+// IssueChallenge creates a short-lived token proving that the user passed the password check of a login.
+// It is signed with a key derived from the JWT secret, so it is rejected as access token.
+func (s *TokenService) IssueChallenge(userID uuid.UUID) (string, error) {
+	now := time.Now()
+	claims := &jwt.RegisteredClaims{
+		Subject:   userID.String(),
+		Audience:  jwt.ClaimStrings{challengeAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(challengeExpiration)),
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.derivedKey(challengeAudience))
+}
+
+// VerifyChallenge returns the user a challenge token was issued for
+func (s *TokenService) VerifyChallenge(challenge string) (uuid.UUID, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(challenge, claims, func(token *jwt.Token) (interface{}, error) {
+		return s.derivedKey(challengeAudience), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(challengeAudience), jwt.WithExpirationRequired())
+	if err != nil {
+		return uuid.Nil, ErrInvalidChallenge
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, ErrInvalidChallenge
+	}
+
+	return userID, nil
+}
+
+// derivedKey returns the signing key of tokens with the given audience, derived from the JWT secret
+func (s *TokenService) derivedKey(audience string) []byte {
+	key := sha256.Sum256([]byte(audience + ":" + s.keys.secret))
+	return key[:]
+}
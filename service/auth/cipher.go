@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+)
+
+var ErrDecryptFailed = errors.New("failed to decrypt secret")
+
+// Purposes of the secrets encrypted with the configured key. Each purpose uses its own derived key,
+// so a secret encrypted for one purpose cannot be decrypted for another.
+const (
+	PurposeFeedCredentials = "pcast feed credentials"
+	PurposeTOTPSecret      = "pcast totp secret"
+)
+
+// Cipher encrypts secrets at rest with AES-GCM. The random nonce is prepended to the ciphertext.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher creates a Cipher for purpose from a 16, 24 or 32 byte AES key. The AES key of the
+// Cipher is derived from key and purpose with HKDF-SHA256 and has the same length as key.
+func NewCipher(key []byte, purpose string) (*Cipher, error) {
+	// Rejects invalid key lengths before deriving
+	if _, err := aes.NewCipher(key); err != nil {
+		return nil, err
+	}
+
+	derived, err := hkdf.Key(sha256.New, key, nil, purpose, len(key))
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cipher{aead: aead}, nil
+}
+
+// Encrypt seals the plaintext with a fresh random nonce. The ciphertext is bound to owner, e.g. the ID
+// of the row it is stored in, so it cannot be decrypted once copied to another row.
+func (c *Cipher) Encrypt(plaintext []byte, owner []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return c.aead.Seal(nonce, nonce, plaintext, owner), nil
+}
+
+// Decrypt opens a ciphertext created by Encrypt for the same owner. Returns ErrDecryptFailed if it was
+// tampered with, encrypted with a different key or purpose or for a different owner.
+func (c *Cipher) Decrypt(ciphertext []byte, owner []byte) ([]byte, error) {
+	nonceSize := c.aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, ErrDecryptFailed
+	}
+
+	plaintext, err := c.aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], owner)
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+
+	return plaintext, nil
+}
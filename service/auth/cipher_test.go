@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCipher_EncryptDecrypt(t *testing.T) {
+	c, err := NewCipher(bytes.Repeat([]byte{1}, 32), PurposeFeedCredentials)
+	require.NoError(t, err)
+
+	ciphertext, err := c.Encrypt([]byte("secret"), []byte("owner"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(ciphertext), "secret")
+
+	// A fresh nonce is used for every encryption
+	other, err := c.Encrypt([]byte("secret"), []byte("owner"))
+	require.NoError(t, err)
+	assert.NotEqual(t, ciphertext, other)
+
+	plaintext, err := c.Decrypt(ciphertext, []byte("owner"))
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(plaintext))
+}
+
+func TestCipher_DecryptWrongKey(t *testing.T) {
+	c, err := NewCipher(bytes.Repeat([]byte{1}, 32), PurposeFeedCredentials)
+	require.NoError(t, err)
+	other, err := NewCipher(bytes.Repeat([]byte{2}, 32), PurposeFeedCredentials)
+	require.NoError(t, err)
+
+	ciphertext, err := c.Encrypt([]byte("secret"), []byte("owner"))
+	require.NoError(t, err)
+
+	_, err = other.Decrypt(ciphertext, []byte("owner"))
+	assert.ErrorIs(t, err, ErrDecryptFailed)
+}
+
+func TestCipher_DecryptTampered(t *testing.T) {
+	c, err := NewCipher(bytes.Repeat([]byte{1}, 32), PurposeFeedCredentials)
+	require.NoError(t, err)
+
+	ciphertext, err := c.Encrypt([]byte("secret"), []byte("owner"))
+	require.NoError(t, err)
+	ciphertext[len(ciphertext)-1] ^= 0xff
+
+	_, err = c.Decrypt(ciphertext, []byte("owner"))
+	assert.ErrorIs(t, err, ErrDecryptFailed)
+
+	_, err = c.Decrypt([]byte("short"), []byte("owner"))
+	assert.ErrorIs(t, err, ErrDecryptFailed)
+}
+
+func TestCipher_DecryptOtherOwner(t *testing.T) {
+	c, err := NewCipher(bytes.Repeat([]byte{1}, 32), PurposeFeedCredentials)
+	require.NoError(t, err)
+
+	ciphertext, err := c.Encrypt([]byte("secret"), []byte("feed 1"))
+	require.NoError(t, err)
+
+	// A ciphertext copied to another row does not decrypt
+	_, err = c.Decrypt(ciphertext, []byte("feed 2"))
+	assert.ErrorIs(t, err, ErrDecryptFailed)
+}
+
+func TestCipher_DecryptOtherPurpose(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	feeds, err := NewCipher(key, PurposeFeedCredentials)
+	require.NoError(t, err)
+	totp, err := NewCipher(key, PurposeTOTPSecret)
+	require.NoError(t, err)
+
+	ciphertext, err := feeds.Encrypt([]byte("secret"), []byte("owner"))
+	require.NoError(t, err)
+
+	_, err = totp.Decrypt(ciphertext, []byte("owner"))
+	assert.ErrorIs(t, err, ErrDecryptFailed)
+}
+
+func TestNewCipher_InvalidKey(t *testing.T) {
+	_, err := NewCipher([]byte("too short"), PurposeFeedCredentials)
+	assert.Error(t, err)
+}
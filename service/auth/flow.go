@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// flowExpiration is the time a user has for the consent screen of a provider
+const flowExpiration = 10 * time.Minute
+
+// flowAudience marks the state of OAuth logins, so it cannot be confused with other tokens signed by this service
+const flowAudience = "pcast-oauth-flow"
+
+var ErrInvalidFlow = errors.New("invalid OAuth flow state")
+
+type flowClaims struct {
+	jwt.RegisteredClaims
+	Flow json.RawMessage `json:"flow"`
+}
+
+// SealFlow signs the state of an OAuth login, which the browser keeps until the callback.
+// The state carries the PKCE verifier and where the login returns to, so the client must not be able to change it.
+func (s *TokenService) SealFlow(flow any) (string, error) {
+	data, err := json.Marshal(flow)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := &flowClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{flowAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(flowExpiration)),
+		},
+		Flow: data,
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.derivedKey(flowAudience))
+}
+
+// OpenFlow verifies the state of SealFlow and decodes it into flow
+func (s *TokenService) OpenFlow(sealed string, flow any) error {
+	claims := &flowClaims{}
+	_, err := jwt.ParseWithClaims(sealed, claims, func(token *jwt.Token) (interface{}, error) {
+		return s.derivedKey(flowAudience), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(flowAudience), jwt.WithExpirationRequired())
+	if err != nil || len(claims.Flow) == 0 {
+		return ErrInvalidFlow
+	}
+
+	if err := json.Unmarshal(claims.Flow, flow); err != nil {
+		return ErrInvalidFlow
+	}
+	return nil
+}
@@ -7,19 +7,36 @@ import (
 	"github.com/google/uuid"
 )
 
-// CreateJWTToken creates a signed JWT token for the given user ID
-func CreateJWTToken(userID uuid.UUID, secret string, expirationMin int) (string, error) {
-	claims := &jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expirationMin) * time.Minute)),
-		Subject:   userID.String(),
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+// accessClaims are the registered claims with the issued at time in millisecond precision.
+// RFC 7519 allows fractional NumericDate values, jwt.NumericDate would truncate it to seconds
+// and a token issued right after "log out all sessions" could not be told apart from older ones.
+type accessClaims struct {
+	jwt.RegisteredClaims
+	IssuedAt float64 `json:"iat"`
+	// AuthTime is the time the user signed in, it stays the same when the token is refreshed
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+}
 
-	tokenString, err := token.SignedString([]byte(secret))
+// CreateJWTToken creates a signed JWT token for the given user ID. Every token gets a unique ID (jti) to revoke it.
+// authenticatedAt is the time of the login, it is left out if zero.
+func CreateJWTToken(userID uuid.UUID, keys *Keys, expirationMin int, authenticatedAt time.Time) (string, error) {
+	id, err := uuid.NewV7()
 	if err != nil {
 		return "", err
 	}
 
-	return tokenString, nil
+	now := time.Now()
+	claims := &accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(expirationMin) * time.Minute)),
+			Subject:   userID.String(),
+			ID:        id.String(),
+		},
+		IssuedAt: float64(now.UnixMilli()) / 1000,
+	}
+	if !authenticatedAt.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(authenticatedAt)
+	}
+
+	return keys.Sign(claims)
 }
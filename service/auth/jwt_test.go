@@ -14,7 +14,7 @@ func TestCreateJWTToken(t *testing.T) {
 	secret := "testsecret"
 	expirationMin := 60
 
-	tokenString, err := CreateJWTToken(userID, secret, expirationMin)
+	tokenString, err := CreateJWTToken(userID, NewHMACKeys(secret), expirationMin, time.Time{})
 	assert.NoError(t, err)
 	assert.NotEmpty(t, tokenString)
 
@@ -43,7 +43,7 @@ func TestCreateJWTToken_DifferentExpiration(t *testing.T) {
 	testCases := []int{1, 10, 120, 1440}
 
 	for _, expirationMin := range testCases {
-		tokenString, err := CreateJWTToken(userID, secret, expirationMin)
+		tokenString, err := CreateJWTToken(userID, NewHMACKeys(secret), expirationMin, time.Time{})
 		assert.NoError(t, err)
 		assert.NotEmpty(t, tokenString)
 
@@ -63,7 +63,7 @@ func TestCreateJWTToken_SigningMethod(t *testing.T) {
 	userID := uuid.Must(uuid.NewV7())
 	secret := "testsecret"
 
-	tokenString, err := CreateJWTToken(userID, secret, 60)
+	tokenString, err := CreateJWTToken(userID, NewHMACKeys(secret), 60, time.Time{})
 	assert.NoError(t, err)
 
 	// Parse without validation to check the signing method
@@ -71,3 +71,27 @@ func TestCreateJWTToken_SigningMethod(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, jwt.SigningMethodHS256.Alg(), token.Method.Alg())
 }
+
+func TestCreateJWTToken_IDAndIssuedAt(t *testing.T) {
+	userID := uuid.Must(uuid.NewV7())
+
+	first, err := CreateJWTToken(userID, NewHMACKeys("testsecret"), 60, time.Time{})
+	assert.NoError(t, err)
+	second, err := CreateJWTToken(userID, NewHMACKeys("testsecret"), 60, time.Time{})
+	assert.NoError(t, err)
+
+	parse := func(tokenString string) jwt.MapClaims {
+		token, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+		assert.NoError(t, err)
+		return token.Claims.(jwt.MapClaims)
+	}
+
+	firstClaims, secondClaims := parse(first), parse(second)
+	assert.NotEmpty(t, firstClaims["jti"])
+	assert.NotEqual(t, firstClaims["jti"], secondClaims["jti"])
+
+	// The issued at time keeps its milliseconds
+	iat, ok := firstClaims["iat"].(float64)
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now(), time.UnixMilli(int64(iat*1000)), 2*time.Second)
+}
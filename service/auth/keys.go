@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSAKeyBits is the minimum size of RSA signing keys
+const minRSAKeyBits = 2048
+
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// Keys sign and verify the tokens issued by pcast. Access tokens are signed with the first signing key
+// or, if there is none, with the JWT secret (HS256). Short-lived internal tokens like 2FA challenges are
+// always signed with keys derived from the secret.
+type Keys struct {
+	secret  string
+	signing *SigningKey
+	// keys are all signing keys in configured order, byID indexes them by kid
+	keys []*SigningKey
+	byID map[string]*SigningKey
+}
+
+// SigningKey is an RSA (RS256) or Ed25519 (EdDSA) key identified by its kid.
+// A key only used for verification may lack the private key.
+type SigningKey struct {
+	ID      string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// PublicKey is a key to verify access tokens with, as published in the JWKS
+type PublicKey struct {
+	ID        string
+	Algorithm string
+	Key       crypto.PublicKey
+}
+
+// NewHMACKeys signs access tokens with the secret
+func NewHMACKeys(secret string) *Keys {
+	return &Keys{secret: secret}
+}
+
+// NewKeys signs access tokens with the first signing key, all of them verify access tokens.
+// Without signing keys it is the same as NewHMACKeys.
+func NewKeys(secret string, signingKeys ...*SigningKey) (*Keys, error) {
+	keys := NewHMACKeys(secret)
+	if len(signingKeys) == 0 {
+		return keys, nil
+	}
+
+	if signingKeys[0].private == nil {
+		return nil, fmt.Errorf("signing key '%s' has no private key", signingKeys[0].ID)
+	}
+
+	keys.signing = signingKeys[0]
+	keys.keys = signingKeys
+	keys.byID = make(map[string]*SigningKey, len(signingKeys))
+	for _, key := range signingKeys {
+		if _, ok := keys.byID[key.ID]; ok {
+			return nil, fmt.Errorf("signing key '%s' is configured twice", key.ID)
+		}
+		keys.byID[key.ID] = key
+	}
+
+	return keys, nil
+}
+
+// LoadSigningKey reads a PEM encoded key from a file, see ParseSigningKey
+func LoadSigningKey(id string, file string) (*SigningKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("signing key '%s' cannot be read: %w", id, err)
+	}
+
+	return ParseSigningKey(id, data)
+}
+
+// ParseSigningKey parses a PEM encoded PKCS#8 or PKCS#1 private key, or a PKIX public key for keys
+// only used for verification
+func ParseSigningKey(id string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key '%s' is not PEM encoded", id)
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unexpected PEM block '%s'", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("signing key '%s' is invalid: %w", id, err)
+	}
+
+	return NewSigningKey(id, key)
+}
+
+// NewSigningKey wraps an *rsa.PrivateKey, ed25519.PrivateKey, *rsa.PublicKey or ed25519.PublicKey
+func NewSigningKey(id string, key any) (*SigningKey, error) {
+	signingKey := &SigningKey{ID: id}
+	if signer, ok := key.(crypto.Signer); ok {
+		signingKey.private = signer
+		key = signer.Public()
+	}
+
+	switch public := key.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("signing key '%s' has %d bits, at least %d are required", id, public.N.BitLen(), minRSAKeyBits)
+		}
+		signingKey.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		signingKey.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("signing key '%s' is no RSA or Ed25519 key", id)
+	}
+	signingKey.public = key
+
+	return signingKey, nil
+}
+
+// Sign signs the claims of an access token. Tokens of signing keys carry the kid header.
+func (k *Keys) Sign(claims jwt.Claims) (string, error) {
+	if k.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(k.secret))
+	}
+
+	token := jwt.NewWithClaims(k.signing.method, claims)
+	token.Header["kid"] = k.signing.ID
+
+	return token.SignedString(k.signing.private)
+}
+
+// Keyfunc returns the key to verify an access token with. Once signing keys are configured,
+// tokens signed with the secret are rejected and clients renew them with their refresh token.
+func (k *Keys) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if k.signing == nil {
+		if token.Method.Alg() != jwt.SigningMethodHS256.Alg() {
+			return nil, ErrUnknownSigningKey
+		}
+		return []byte(k.secret), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.byID[kid]
+	// The algorithm must match the key, otherwise a public key could be used as HMAC secret
+	if !ok || token.Method.Alg() != key.method.Alg() {
+		return nil, ErrUnknownSigningKey
+	}
+
+	return key.public, nil
+}
+
+// PublicKeys returns the keys access tokens are verified with. It is empty if they are signed with the secret.
+func (k *Keys) PublicKeys() []PublicKey {
+	keys := make([]PublicKey, len(k.keys))
+	for i, key := range k.keys {
+		keys[i] = PublicKey{ID: key.ID, Algorithm: key.method.Alg(), Key: key.public}
+	}
+
+	return keys
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newEd25519Key(t *testing.T, id string) (*SigningKey, ed25519.PublicKey) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	key, err := NewSigningKey(id, private)
+	require.NoError(t, err)
+
+	return key, public
+}
+
+func parseAccessToken(tokenString string, keys *Keys) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, keys.Keyfunc)
+}
+
+func TestKeys_Ed25519(t *testing.T) {
+	key, public := newEd25519Key(t, "2026-01")
+	keys, err := NewKeys("testsecret", key)
+	require.NoError(t, err)
+
+	tokenString, err := CreateJWTToken(uuid.Must(uuid.NewV7()), keys, 10, time.Time{})
+	require.NoError(t, err)
+
+	token, err := parseAccessToken(tokenString, keys)
+	require.NoError(t, err)
+	assert.Equal(t, jwt.SigningMethodEdDSA.Alg(), token.Method.Alg())
+	assert.Equal(t, "2026-01", token.Header["kid"])
+
+	// Other services verify with the public key only
+	_, err = jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return public, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []PublicKey{{ID: "2026-01", Algorithm: "EdDSA", Key: public}}, keys.PublicKeys())
+}
+
+func TestKeys_RSA(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+	key, err := ParseSigningKey("rsa", data)
+	require.NoError(t, err)
+	keys, err := NewKeys("testsecret", key)
+	require.NoError(t, err)
+
+	tokenString, err := CreateJWTToken(uuid.Must(uuid.NewV7()), keys, 10, time.Time{})
+	require.NoError(t, err)
+
+	token, err := parseAccessToken(tokenString, keys)
+	require.NoError(t, err)
+	assert.Equal(t, jwt.SigningMethodRS256.Alg(), token.Method.Alg())
+	assert.Equal(t, &private.PublicKey, keys.PublicKeys()[0].Key)
+}
+
+func TestKeys_Rotation(t *testing.T) {
+	current, _ := newEd25519Key(t, "current")
+	previous, previousPublic := newEd25519Key(t, "previous")
+
+	oldKeys, err := NewKeys("testsecret", previous)
+	require.NoError(t, err)
+	oldToken, err := CreateJWTToken(uuid.Must(uuid.NewV7()), oldKeys, 10, time.Time{})
+	require.NoError(t, err)
+
+	// The previous key may be kept as public key only
+	data, err := x509.MarshalPKIXPublicKey(previousPublic)
+	require.NoError(t, err)
+	previousVerifier, err := ParseSigningKey("previous", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: data}))
+	require.NoError(t, err)
+
+	keys, err := NewKeys("testsecret", current, previousVerifier)
+	require.NoError(t, err)
+
+	_, err = parseAccessToken(oldToken, keys)
+	assert.NoError(t, err)
+
+	newToken, err := CreateJWTToken(uuid.Must(uuid.NewV7()), keys, 10, time.Time{})
+	require.NoError(t, err)
+	token, err := parseAccessToken(newToken, keys)
+	require.NoError(t, err)
+	assert.Equal(t, "current", token.Header["kid"])
+
+	publicKeys := keys.PublicKeys()
+	require.Len(t, publicKeys, 2)
+	assert.Equal(t, "current", publicKeys[0].ID)
+	assert.Equal(t, "previous", publicKeys[1].ID)
+
+	// Once the previous key is removed its tokens are rejected
+	keys, err = NewKeys("testsecret", current)
+	require.NoError(t, err)
+	_, err = parseAccessToken(oldToken, keys)
+	assert.ErrorIs(t, err, ErrUnknownSigningKey)
+}
+
+func TestKeys_RejectsSecretTokens(t *testing.T) {
+	key, _ := newEd25519Key(t, "2026-01")
+	keys, err := NewKeys("testsecret", key)
+	require.NoError(t, err)
+
+	// Tokens signed with the secret are no longer accepted once signing keys are configured
+	tokenString, err := CreateJWTToken(uuid.Must(uuid.NewV7()), NewHMACKeys("testsecret"), 10, time.Time{})
+	require.NoError(t, err)
+	_, err = parseAccessToken(tokenString, keys)
+	assert.ErrorIs(t, err, ErrUnknownSigningKey)
+
+	// Not even with the kid of a signing key
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: uuid.NewString()})
+	token.Header["kid"] = "2026-01"
+	tokenString, err = token.SignedString([]byte("testsecret"))
+	require.NoError(t, err)
+	_, err = parseAccessToken(tokenString, keys)
+	assert.ErrorIs(t, err, ErrUnknownSigningKey)
+
+	// And the secret does not verify tokens of signing keys
+	tokenString, err = CreateJWTToken(uuid.Must(uuid.NewV7()), keys, 10, time.Time{})
+	require.NoError(t, err)
+	_, err = parseAccessToken(tokenString, NewHMACKeys("testsecret"))
+	assert.ErrorIs(t, err, ErrUnknownSigningKey)
+	assert.Empty(t, NewHMACKeys("testsecret").PublicKeys())
+}
+
+func TestNewKeys_Invalid(t *testing.T) {
+	key, public := newEd25519Key(t, "2026-01")
+
+	verifier, err := NewSigningKey("verifier", public)
+	require.NoError(t, err)
+	_, err = NewKeys("testsecret", verifier, key)
+	assert.ErrorContains(t, err, "no private key")
+
+	_, err = NewKeys("testsecret", key, key)
+	assert.ErrorContains(t, err, "configured twice")
+}
+
+func TestParseSigningKey_Invalid(t *testing.T) {
+	_, err := ParseSigningKey("key", []byte("not pem"))
+	assert.ErrorContains(t, err, "not PEM encoded")
+
+	_, err = ParseSigningKey("key", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("x")}))
+	assert.ErrorContains(t, err, "unexpected PEM block")
+
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	_, err = NewSigningKey("small", small)
+	assert.ErrorContains(t, err, "at least 2048")
+
+	_, err = NewSigningKey("hmac", []byte("secret"))
+	assert.ErrorContains(t, err, "no RSA or Ed25519 key")
+
+	_, err = LoadSigningKey("missing", "nonexistent.pem")
+	assert.ErrorContains(t, err, "cannot be read")
+}
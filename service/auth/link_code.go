@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// linkCodeExpiration is the time a signed in client has to link the identity of a link code
+const linkCodeExpiration = 5 * time.Minute
+
+// linkCodeAudience marks link codes, so they cannot be confused with other tokens signed by this service
+const linkCodeAudience = "pcast-link-code"
+
+var ErrInvalidLinkCode = errors.New("invalid link code")
+
+// LinkCode is an account at a provider that the holder of the code signed in to
+type LinkCode struct {
+	Provider string
+	Subject  string
+	Email    string
+	// EmailVerified tells whether the provider verified Email
+	EmailVerified bool
+}
+
+type linkCodeClaims struct {
+	jwt.RegisteredClaims
+	Provider      string `json:"provider"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+	// CodeChallenge is the S256 PKCE challenge of the app, only the holder of the verifier can redeem the code
+	CodeChallenge string `json:"code_challenge"`
+}
+
+// IssueLinkCode creates a short-lived code proving a login at a provider without signing in anyone.
+// A signed in client redeems it to link the identity to its user, so the code never grants access
+// to an account. It is bound to the PKCE challenge of the app, so an intercepted code cannot be
+// linked to the account of someone else.
+func (s *TokenService) IssueLinkCode(link *LinkCode, codeChallenge string) (string, error) {
+	now := time.Now()
+	claims := &linkCodeClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   link.Subject,
+			Audience:  jwt.ClaimStrings{linkCodeAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(linkCodeExpiration)),
+		},
+		Provider:      link.Provider,
+		Email:         link.Email,
+		EmailVerified: link.EmailVerified,
+		CodeChallenge: codeChallenge,
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.derivedKey(linkCodeAudience))
+}
+
+// RedeemLinkCode returns the identity of a link code if the verifier matches its challenge
+func (s *TokenService) RedeemLinkCode(code string, verifier string) (*LinkCode, error) {
+	claims := &linkCodeClaims{}
+	_, err := jwt.ParseWithClaims(code, claims, func(token *jwt.Token) (interface{}, error) {
+		return s.derivedKey(linkCodeAudience), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(linkCodeAudience), jwt.WithExpirationRequired())
+	if err != nil || claims.Subject == "" || claims.Provider == "" {
+		return nil, ErrInvalidLinkCode
+	}
+
+	if claims.CodeChallenge == "" || !verifyCodeChallenge(claims.CodeChallenge, verifier) {
+		return nil, ErrInvalidLinkCode
+	}
+
+	return &LinkCode{Provider: claims.Provider, Subject: claims.Subject, Email: claims.Email, EmailVerified: claims.EmailVerified}, nil
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+// loginCodeExpiration is the time an app has to redeem the code of a login that returned to its redirect URI
+const loginCodeExpiration = time.Minute
+
+// loginCodeAudience marks login codes, so they cannot be confused with other tokens signed by this service
+const loginCodeAudience = "pcast-login-code"
+
+var ErrInvalidLoginCode = errors.New("invalid login code")
+
+type loginCodeClaims struct {
+	jwt.RegisteredClaims
+	// CodeChallenge is the S256 PKCE challenge of the app, only the holder of the verifier can redeem the code
+	CodeChallenge string `json:"code_challenge"`
+}
+
+// IssueLoginCode creates a short-lived code that an app exchanges for the tokens of the user.
+// The code passes through the browser and the custom scheme of the app, so it is bound to the
+// PKCE challenge of the app and useless to anyone intercepting the redirect.
+func (s *TokenService) IssueLoginCode(userID uuid.UUID, codeChallenge string) (string, error) {
+	now := time.Now()
+	claims := &loginCodeClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{loginCodeAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(loginCodeExpiration)),
+		},
+		CodeChallenge: codeChallenge,
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.derivedKey(loginCodeAudience))
+}
+
+// RedeemLoginCode returns the user a login code was issued for if the verifier matches its challenge
+func (s *TokenService) RedeemLoginCode(code string, verifier string) (uuid.UUID, error) {
+	claims := &loginCodeClaims{}
+	_, err := jwt.ParseWithClaims(code, claims, func(token *jwt.Token) (interface{}, error) {
+		return s.derivedKey(loginCodeAudience), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(loginCodeAudience), jwt.WithExpirationRequired())
+	if err != nil {
+		return uuid.Nil, ErrInvalidLoginCode
+	}
+
+	if claims.CodeChallenge == "" || !verifyCodeChallenge(claims.CodeChallenge, verifier) {
+		return uuid.Nil, ErrInvalidLoginCode
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, ErrInvalidLoginCode
+	}
+
+	return userID, nil
+}
+
+// verifyCodeChallenge reports whether the PKCE verifier belongs to the S256 challenge
+func verifyCodeChallenge(challenge string, verifier string) bool {
+	return subtle.ConstantTimeCompare([]byte(oauth2.S256ChallengeFromVerifier(verifier)), []byte(challenge)) == 1
+}
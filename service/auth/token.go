@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+
+	"pcast-api/config"
+	modelInterface "pcast-api/service/model_interface"
+	store "pcast-api/store/token"
+)
+
+var tracer = otel.Tracer("pcast-api/service/auth")
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used")
+	// ErrTokenNotRevocable is returned for access tokens without jti, issued before tokens could be revoked
+	ErrTokenNotRevocable = errors.New("access token has no ID and cannot be revoked")
+)
+
+// TokenPair is a short-lived access token together with the refresh token to renew it
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	// ExpiresIn is the lifetime of the access token in seconds
+	ExpiresIn int
+}
+
+// TokenService issues, rotates and revokes access and refresh tokens
+type TokenService struct {
+	store             modelInterface.RefreshToken
+	revocations       modelInterface.Revocation
+	keys              *Keys
+	jwtExpirationMin  int
+	refreshExpiration time.Duration
+}
+
+// NewTokenService creates a TokenService. Lifetimes that are not positive, e.g. of a config not created
+// by config.New, fall back to the defaults, since the tokens would be expired when issued.
+func NewTokenService(store modelInterface.RefreshToken, revocations modelInterface.Revocation, keys *Keys, jwtExpirationMin int, refreshExpirationDays int) *TokenService {
+	if jwtExpirationMin <= 0 {
+		jwtExpirationMin = config.DefaultJWTExpirationMin
+	}
+	if refreshExpirationDays <= 0 {
+		refreshExpirationDays = config.DefaultRefreshExpirationDays
+	}
+
+	return &TokenService{
+		store:             store,
+		revocations:       revocations,
+		keys:              keys,
+		jwtExpirationMin:  jwtExpirationMin,
+		refreshExpiration: time.Duration(refreshExpirationDays) * 24 * time.Hour,
+	}
+}
+
+// Issue creates a token pair for a new login, starting a new refresh token family
+func (s *TokenService) Issue(ctx context.Context, userID uuid.UUID) (*TokenPair, error) {
+	ctx, span := tracer.Start(ctx, "auth.Issue")
+	defer span.End()
+
+	familyID, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issue(ctx, userID, familyID, time.Now())
+}
+
+// Refresh exchanges a refresh token for a new token pair. Every refresh token can be used once.
+// Presenting a token that was already rotated revokes its whole family, since either the client
+// or an attacker holds a stolen copy.
+func (s *TokenService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	ctx, span := tracer.Start(ctx, "auth.Refresh")
+	defer span.End()
+
+	current, err := s.store.FindByHash(ctx, HashToken(refreshToken))
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if current.RevokedAt != nil || time.Now().After(current.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if current.UsedAt != nil {
+		return nil, s.revokeReused(ctx, current)
+	}
+
+	marked, err := s.store.MarkUsed(ctx, current)
+	if err != nil {
+		return nil, err
+	}
+	if !marked {
+		// Lost a race against a concurrent refresh with the same token
+		return nil, s.revokeReused(ctx, current)
+	}
+
+	var authenticatedAt time.Time
+	if current.AuthenticatedAt != nil {
+		authenticatedAt = *current.AuthenticatedAt
+	}
+
+	return s.issue(ctx, current.UserID, current.FamilyID, authenticatedAt)
+}
+
+// Revoke logs out a single session. The access token is revoked until it expires and, if given,
+// all refresh tokens of the same login. Unknown refresh tokens are ignored. Returns ErrTokenNotRevocable
+// without revoking anything if the access token has no jti.
+func (s *TokenService) Revoke(ctx context.Context, userID uuid.UUID, jti string, expiresAt time.Time, refreshToken string) error {
+	ctx, span := tracer.Start(ctx, "auth.Revoke")
+	defer span.End()
+
+	if jti == "" {
+		return ErrTokenNotRevocable
+	}
+	if err := s.revocations.RevokeToken(ctx, jti, expiresAt); err != nil {
+		return err
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	token, err := s.store.FindByHash(ctx, HashToken(refreshToken))
+	if err != nil || token.UserID != userID {
+		return nil
+	}
+
+	return s.store.RevokeFamily(ctx, token.FamilyID)
+}
+
+// RevokeAll logs out all sessions of the user by revoking every access token issued until now and all refresh tokens
+func (s *TokenService) RevokeAll(ctx context.Context, userID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "auth.RevokeAll")
+	defer span.End()
+
+	if err := s.revocations.RevokeUserTokens(ctx, userID, time.Now()); err != nil {
+		return err
+	}
+
+	return s.store.RevokeByUserID(ctx, userID)
+}
+
+// IsRevoked reports whether an access token was revoked by Revoke or RevokeAll
+func (s *TokenService) IsRevoked(ctx context.Context, userID uuid.UUID, jti string, issuedAt time.Time) (bool, error) {
+	ctx, span := tracer.Start(ctx, "auth.IsRevoked")
+	defer span.End()
+
+	return s.revocations.IsRevoked(ctx, jti, userID, issuedAt)
+}
+
+func (s *TokenService) revokeReused(ctx context.Context, token *store.RefreshToken) error {
+	if err := s.store.RevokeFamily(ctx, token.FamilyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// issue creates a token pair of the family. authenticatedAt is the time of the login, zero if unknown.
+func (s *TokenService) issue(ctx context.Context, userID uuid.UUID, familyID uuid.UUID, authenticatedAt time.Time) (*TokenPair, error) {
+	accessToken, err := CreateJWTToken(userID, s.keys, s.jwtExpirationMin, authenticatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	token := &store.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(s.refreshExpiration),
+	}
+	if !authenticatedAt.IsZero() {
+		token.AuthenticatedAt = &authenticatedAt
+	}
+
+	err = s.store.Create(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    s.jwtExpirationMin * 60,
+	}, nil
+}
+
+// GenerateToken returns 32 random bytes, base64url encoded. Used for all opaque single use tokens.
+func GenerateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex encoded SHA-256 of a token. The tokens are random, so no salt is needed.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
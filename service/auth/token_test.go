@@ -0,0 +1,458 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"pcast-api/config"
+	store "pcast-api/store/token"
+)
+
+// mockRefreshTokenStore keeps refresh tokens in memory
+type mockRefreshTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]*store.RefreshToken
+}
+
+func newMockRefreshTokenStore() *mockRefreshTokenStore {
+	return &mockRefreshTokenStore{tokens: map[string]*store.RefreshToken{}}
+}
+
+func (m *mockRefreshTokenStore) Create(ctx context.Context, token *store.RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := token.BeforeCreate(); err != nil {
+		return err
+	}
+	t := *token
+	m.tokens[token.TokenHash] = &t
+	return nil
+}
+
+func (m *mockRefreshTokenStore) FindByHash(ctx context.Context, tokenHash string) (*store.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tokens[tokenHash]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	found := *t
+	return &found, nil
+}
+
+func (m *mockRefreshTokenStore) MarkUsed(ctx context.Context, token *store.RefreshToken) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.tokens[token.TokenHash]
+	if t.UsedAt != nil || t.RevokedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	t.UsedAt = &now
+	return true, nil
+}
+
+func (m *mockRefreshTokenStore) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for _, t := range m.tokens {
+		if t.FamilyID == familyID && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *mockRefreshTokenStore) RevokeByUserID(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for _, t := range m.tokens {
+		if t.UserID == userID && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+// mockRevocationStore keeps revoked access tokens in memory
+type mockRevocationStore struct {
+	tokens map[string]time.Time
+	users  map[uuid.UUID]time.Time
+}
+
+func newMockRevocationStore() *mockRevocationStore {
+	return &mockRevocationStore{tokens: map[string]time.Time{}, users: map[uuid.UUID]time.Time{}}
+}
+
+func (m *mockRevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	m.tokens[jti] = expiresAt
+	return nil
+}
+
+func (m *mockRevocationStore) RevokeUserTokens(ctx context.Context, userID uuid.UUID, issuedBefore time.Time) error {
+	m.users[userID] = issuedBefore
+	return nil
+}
+
+func (m *mockRevocationStore) IsRevoked(ctx context.Context, jti string, userID uuid.UUID, issuedAt time.Time) (bool, error) {
+	if _, ok := m.tokens[jti]; ok {
+		return true, nil
+	}
+	revokedBefore, ok := m.users[userID]
+	return ok && !issuedAt.After(revokedBefore), nil
+}
+
+func TestTokenService_Issue(t *testing.T) {
+	tokens := newMockRefreshTokenStore()
+	service := NewTokenService(tokens, newMockRevocationStore(), NewHMACKeys("testsecret"), 10, 30)
+	userID := uuid.Must(uuid.NewV7())
+
+	pair, err := service.Issue(context.Background(), userID)
+	require.NoError(t, err)
+	assert.NotEmpty(t, pair.AccessToken)
+	assert.NotEmpty(t, pair.RefreshToken)
+	assert.Equal(t, 600, pair.ExpiresIn)
+
+	// Only the hash of the refresh token is stored
+	stored, err := tokens.FindByHash(context.Background(), HashToken(pair.RefreshToken))
+	require.NoError(t, err)
+	assert.NotEqual(t, pair.RefreshToken, stored.TokenHash)
+	assert.Equal(t, userID, stored.UserID)
+	assert.WithinDuration(t, time.Now().Add(30*24*time.Hour), stored.ExpiresAt, time.Second)
+}
+
+func TestTokenService_Issue_DefaultLifetimes(t *testing.T) {
+	tokens := newMockRefreshTokenStore()
+	service := NewTokenService(tokens, newMockRevocationStore(), NewHMACKeys("testsecret"), 0, -1)
+
+	pair, err := service.Issue(context.Background(), uuid.Must(uuid.NewV7()))
+	require.NoError(t, err)
+	assert.Equal(t, config.DefaultJWTExpirationMin*60, pair.ExpiresIn)
+
+	// The refresh token is not expired when issued
+	refreshed, err := service.Refresh(context.Background(), pair.RefreshToken)
+	require.NoError(t, err)
+	stored, err := tokens.FindByHash(context.Background(), HashToken(refreshed.RefreshToken))
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(config.DefaultRefreshExpirationDays*24*time.Hour), stored.ExpiresAt, time.Second)
+}
+
+func TestTokenService_AuthTime(t *testing.T) {
+	tokens := newMockRefreshTokenStore()
+	service := NewTokenService(tokens, newMockRevocationStore(), NewHMACKeys("testsecret"), 10, 30)
+
+	authTime := func(accessToken string) float64 {
+		token, _, err := jwt.NewParser().ParseUnverified(accessToken, jwt.MapClaims{})
+		require.NoError(t, err)
+		authTime, ok := token.Claims.(jwt.MapClaims)["auth_time"].(float64)
+		require.True(t, ok)
+		return authTime
+	}
+
+	first, err := service.Issue(context.Background(), uuid.Must(uuid.NewV7()))
+	require.NoError(t, err)
+	assert.InDelta(t, float64(time.Now().Unix()), authTime(first.AccessToken), 1)
+
+	// A refresh is no login, the time of the login is kept
+	stored, err := tokens.FindByHash(context.Background(), HashToken(first.RefreshToken))
+	require.NoError(t, err)
+	loginTime := time.Now().Add(-time.Hour)
+	tokens.tokens[stored.TokenHash].AuthenticatedAt = &loginTime
+
+	second, err := service.Refresh(context.Background(), first.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, float64(loginTime.Unix()), authTime(second.AccessToken))
+
+	// Tokens issued before the login time was stored have none
+	stored, err = tokens.FindByHash(context.Background(), HashToken(second.RefreshToken))
+	require.NoError(t, err)
+	tokens.tokens[stored.TokenHash].AuthenticatedAt = nil
+
+	third, err := service.Refresh(context.Background(), second.RefreshToken)
+	require.NoError(t, err)
+	token, _, err := jwt.NewParser().ParseUnverified(third.AccessToken, jwt.MapClaims{})
+	require.NoError(t, err)
+	assert.NotContains(t, token.Claims.(jwt.MapClaims), "auth_time")
+}
+
+func TestTokenService_Refresh(t *testing.T) {
+	tokens := newMockRefreshTokenStore()
+	service := NewTokenService(tokens, newMockRevocationStore(), NewHMACKeys("testsecret"), 10, 30)
+
+	first, err := service.Issue(context.Background(), uuid.Must(uuid.NewV7()))
+	require.NoError(t, err)
+
+	second, err := service.Refresh(context.Background(), first.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	// The rotated token belongs to the same family
+	firstStored, _ := tokens.FindByHash(context.Background(), HashToken(first.RefreshToken))
+	secondStored, _ := tokens.FindByHash(context.Background(), HashToken(second.RefreshToken))
+	assert.Equal(t, firstStored.FamilyID, secondStored.FamilyID)
+	assert.NotNil(t, firstStored.UsedAt)
+
+	third, err := service.Refresh(context.Background(), second.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEmpty(t, third.AccessToken)
+}
+
+func TestTokenService_Refresh_ReuseRevokesFamily(t *testing.T) {
+	tokens := newMockRefreshTokenStore()
+	service := NewTokenService(tokens, newMockRevocationStore(), NewHMACKeys("testsecret"), 10, 30)
+
+	first, err := service.Issue(context.Background(), uuid.Must(uuid.NewV7()))
+	require.NoError(t, err)
+	second, err := service.Refresh(context.Background(), first.RefreshToken)
+	require.NoError(t, err)
+
+	// Another login of the same user is not affected
+	other, err := service.Issue(context.Background(), uuid.Must(uuid.NewV7()))
+	require.NoError(t, err)
+
+	_, err = service.Refresh(context.Background(), first.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+	_, err = service.Refresh(context.Background(), second.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	_, err = service.Refresh(context.Background(), other.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestTokenService_Refresh_Invalid(t *testing.T) {
+	service := NewTokenService(newMockRefreshTokenStore(), newMockRevocationStore(), NewHMACKeys("testsecret"), 10, 30)
+
+	_, err := service.Refresh(context.Background(), "unknown")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestTokenService_Refresh_Expired(t *testing.T) {
+	tokens := newMockRefreshTokenStore()
+	service := NewTokenService(tokens, newMockRevocationStore(), NewHMACKeys("testsecret"), 10, 30)
+
+	pair, err := service.Issue(context.Background(), uuid.Must(uuid.NewV7()))
+	require.NoError(t, err)
+	tokens.tokens[HashToken(pair.RefreshToken)].ExpiresAt = time.Now().Add(-time.Minute)
+
+	_, err = service.Refresh(context.Background(), pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestTokenService_Revoke(t *testing.T) {
+	tokens := newMockRefreshTokenStore()
+	service := NewTokenService(tokens, newMockRevocationStore(), NewHMACKeys("testsecret"), 10, 30)
+	userID := uuid.Must(uuid.NewV7())
+
+	pair, err := service.Issue(context.Background(), userID)
+	require.NoError(t, err)
+
+	jti := uuid.NewString()
+	err = service.Revoke(context.Background(), userID, jti, time.Now().Add(time.Minute), pair.RefreshToken)
+	require.NoError(t, err)
+
+	revoked, err := service.IsRevoked(context.Background(), userID, jti, time.Now())
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = service.IsRevoked(context.Background(), userID, uuid.NewString(), time.Now())
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	_, err = service.Refresh(context.Background(), pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestTokenService_Revoke_WithoutID(t *testing.T) {
+	tokens := newMockRefreshTokenStore()
+	service := NewTokenService(tokens, newMockRevocationStore(), NewHMACKeys("testsecret"), 10, 30)
+	userID := uuid.Must(uuid.NewV7())
+
+	pair, err := service.Issue(context.Background(), userID)
+	require.NoError(t, err)
+
+	// An access token without jti cannot be revoked, the logout must not pretend it succeeded
+	err = service.Revoke(context.Background(), userID, "", time.Now().Add(time.Minute), pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrTokenNotRevocable)
+}
+
+func TestTokenService_Revoke_ForeignRefreshToken(t *testing.T) {
+	tokens := newMockRefreshTokenStore()
+	service := NewTokenService(tokens, newMockRevocationStore(), NewHMACKeys("testsecret"), 10, 30)
+
+	pair, err := service.Issue(context.Background(), uuid.Must(uuid.NewV7()))
+	require.NoError(t, err)
+
+	// A user cannot revoke the refresh tokens of another user
+	err = service.Revoke(context.Background(), uuid.Must(uuid.NewV7()), uuid.NewString(), time.Now().Add(time.Minute), pair.RefreshToken)
+	require.NoError(t, err)
+
+	_, err = service.Refresh(context.Background(), pair.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestTokenService_RevokeAll(t *testing.T) {
+	tokens := newMockRefreshTokenStore()
+	service := NewTokenService(tokens, newMockRevocationStore(), NewHMACKeys("testsecret"), 10, 30)
+	userID := uuid.Must(uuid.NewV7())
+
+	first, err := service.Issue(context.Background(), userID)
+	require.NoError(t, err)
+	second, err := service.Issue(context.Background(), userID)
+	require.NoError(t, err)
+	issuedAt := time.Now()
+
+	require.NoError(t, service.RevokeAll(context.Background(), userID))
+
+	revoked, err := service.IsRevoked(context.Background(), userID, uuid.NewString(), issuedAt)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	// Tokens issued afterwards are valid
+	revoked, err = service.IsRevoked(context.Background(), userID, uuid.NewString(), time.Now().Add(time.Millisecond))
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	for _, pair := range []*TokenPair{first, second} {
+		_, err = service.Refresh(context.Background(), pair.RefreshToken)
+		assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	}
+}
+
+func TestTokenService_Challenge(t *testing.T) {
+	tokens := NewTokenService(newMockRefreshTokenStore(), nil, NewHMACKeys("testsecret"), 10, 30)
+	userID := uuid.Must(uuid.NewV7())
+
+	challenge, err := tokens.IssueChallenge(userID)
+	require.NoError(t, err)
+
+	verified, err := tokens.VerifyChallenge(challenge)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, verified)
+
+	// A challenge is no access token
+	_, err = jwt.Parse(challenge, func(token *jwt.Token) (interface{}, error) {
+		return []byte("testsecret"), nil
+	})
+	assert.Error(t, err)
+}
+
+func TestTokenService_Challenge_Invalid(t *testing.T) {
+	tokens := NewTokenService(newMockRefreshTokenStore(), nil, NewHMACKeys("testsecret"), 10, 30)
+
+	// An access token is no challenge
+	accessToken, err := CreateJWTToken(uuid.Must(uuid.NewV7()), NewHMACKeys("testsecret"), 10, time.Time{})
+	require.NoError(t, err)
+	_, err = tokens.VerifyChallenge(accessToken)
+	assert.ErrorIs(t, err, ErrInvalidChallenge)
+
+	// Challenges of another secret are rejected
+	other := NewTokenService(newMockRefreshTokenStore(), nil, NewHMACKeys("othersecret"), 10, 30)
+	challenge, err := other.IssueChallenge(uuid.Must(uuid.NewV7()))
+	require.NoError(t, err)
+	_, err = tokens.VerifyChallenge(challenge)
+	assert.ErrorIs(t, err, ErrInvalidChallenge)
+
+	_, err = tokens.VerifyChallenge("invalid")
+	assert.ErrorIs(t, err, ErrInvalidChallenge)
+}
+
+func TestTokenService_LoginCode(t *testing.T) {
+	tokens := NewTokenService(newMockRefreshTokenStore(), nil, NewHMACKeys("testsecret"), 10, 30)
+	userID := uuid.Must(uuid.NewV7())
+	verifier := oauth2.GenerateVerifier()
+
+	code, err := tokens.IssueLoginCode(userID, oauth2.S256ChallengeFromVerifier(verifier))
+	require.NoError(t, err)
+
+	redeemed, err := tokens.RedeemLoginCode(code, verifier)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, redeemed)
+
+	// Without the verifier of the app the code is worthless
+	_, err = tokens.RedeemLoginCode(code, oauth2.GenerateVerifier())
+	assert.ErrorIs(t, err, ErrInvalidLoginCode)
+
+	// A login code is no challenge and a challenge is no login code
+	_, err = tokens.VerifyChallenge(code)
+	assert.ErrorIs(t, err, ErrInvalidChallenge)
+	challenge, err := tokens.IssueChallenge(userID)
+	require.NoError(t, err)
+	_, err = tokens.RedeemLoginCode(challenge, verifier)
+	assert.ErrorIs(t, err, ErrInvalidLoginCode)
+
+	_, err = tokens.RedeemLoginCode("invalid", verifier)
+	assert.ErrorIs(t, err, ErrInvalidLoginCode)
+}
+
+func TestTokenService_LinkCode(t *testing.T) {
+	tokens := NewTokenService(newMockRefreshTokenStore(), nil, NewHMACKeys("testsecret"), 10, 30)
+	link := &LinkCode{Provider: "keycloak", Subject: "subject-123", Email: "foo@example.com"}
+
+	// A code without challenge could be redeemed by anyone who intercepts it
+	code, err := tokens.IssueLinkCode(link, "")
+	require.NoError(t, err)
+	_, err = tokens.RedeemLinkCode(code, "")
+	assert.ErrorIs(t, err, ErrInvalidLinkCode)
+
+	verifier := oauth2.GenerateVerifier()
+	code, err = tokens.IssueLinkCode(link, oauth2.S256ChallengeFromVerifier(verifier))
+	require.NoError(t, err)
+	redeemed, err := tokens.RedeemLinkCode(code, verifier)
+	assert.NoError(t, err)
+	assert.Equal(t, link, redeemed)
+
+	_, err = tokens.RedeemLinkCode(code, oauth2.GenerateVerifier())
+	assert.ErrorIs(t, err, ErrInvalidLinkCode)
+
+	// A login code is no link code
+	loginCode, err := tokens.IssueLoginCode(uuid.Must(uuid.NewV7()), oauth2.S256ChallengeFromVerifier(verifier))
+	require.NoError(t, err)
+	_, err = tokens.RedeemLinkCode(loginCode, verifier)
+	assert.ErrorIs(t, err, ErrInvalidLinkCode)
+	_, err = tokens.RedeemLoginCode(code, verifier)
+	assert.ErrorIs(t, err, ErrInvalidLoginCode)
+}
+
+func TestTokenService_Flow(t *testing.T) {
+	tokens := NewTokenService(newMockRefreshTokenStore(), nil, NewHMACKeys("testsecret"), 10, 30)
+	type flow struct {
+		Verifier    string `json:"verifier"`
+		RedirectURI string `json:"redirectUri"`
+	}
+
+	sealed, err := tokens.SealFlow(&flow{Verifier: "verifier", RedirectURI: "pcast://login"})
+	require.NoError(t, err)
+
+	opened := &flow{}
+	require.NoError(t, tokens.OpenFlow(sealed, opened))
+	assert.Equal(t, &flow{Verifier: "verifier", RedirectURI: "pcast://login"}, opened)
+
+	// The client cannot change the state, e.g. the redirect URI or the verifier
+	parts := strings.Split(sealed, ".")
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(payload), "pcast://login", "evil://login", 1)))
+	assert.ErrorIs(t, tokens.OpenFlow(strings.Join(parts, "."), &flow{}), ErrInvalidFlow)
+
+	// Other tokens of the service are no flow state
+	challenge, err := tokens.IssueChallenge(uuid.Must(uuid.NewV7()))
+	require.NoError(t, err)
+	assert.ErrorIs(t, tokens.OpenFlow(challenge, &flow{}), ErrInvalidFlow)
+
+	other := NewTokenService(newMockRefreshTokenStore(), nil, NewHMACKeys("othersecret"), 10, 30)
+	assert.ErrorIs(t, other.OpenFlow(sealed, &flow{}), ErrInvalidFlow)
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test vectors of RFC 6238 appendix B for SHA1, truncated to 6 digits
+var rfcSecret = []byte("12345678901234567890")
+
+func TestTOTPCode_RFC6238(t *testing.T) {
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unix, code := range cases {
+		assert.Equal(t, code, totpCode(rfcSecret, unix/30), "time %d", unix)
+	}
+}
+
+func TestTOTPCode(t *testing.T) {
+	assert.Equal(t, "050471", TOTPCode(rfcSecret, time.Unix(1111111111, 0)))
+}
+
+func TestValidateTOTP(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+
+	step, ok := ValidateTOTP(rfcSecret, "050471", at)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1111111111/30), step)
+
+	// Codes of the previous and next period are accepted
+	_, ok = ValidateTOTP(rfcSecret, "050471", at.Add(30*time.Second))
+	assert.True(t, ok)
+	_, ok = ValidateTOTP(rfcSecret, "050471", at.Add(-30*time.Second))
+	assert.True(t, ok)
+
+	_, ok = ValidateTOTP(rfcSecret, "050471", at.Add(90*time.Second))
+	assert.False(t, ok)
+}
+
+func TestValidateTOTP_Invalid(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+
+	for _, code := range []string{"", "12345", "1234567", "000000", "05047a"} {
+		_, ok := ValidateTOTP(rfcSecret, code, at)
+		assert.False(t, ok, code)
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	first, err := GenerateTOTPSecret()
+	require.NoError(t, err)
+	second, err := GenerateTOTPSecret()
+	require.NoError(t, err)
+
+	assert.Len(t, first, 20)
+	assert.NotEqual(t, first, second)
+	assert.Len(t, EncodeTOTPSecret(first), 32)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(TOTPURI("pcast", "foo@bar.com", rfcSecret))
+	require.NoError(t, err)
+
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/pcast:foo@bar.com", uri.Path)
+	assert.Equal(t, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", uri.Query().Get("secret"))
+	assert.Equal(t, "pcast", uri.Query().Get("issuer"))
+	assert.Equal(t, "6", uri.Query().Get("digits"))
+	assert.Equal(t, "30", uri.Query().Get("period"))
+}
@@ -0,0 +1,123 @@
+package episode
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+
+	modelInterface "pcast-api/service/model_interface"
+	store "pcast-api/store/episode"
+)
+
+var tracer = otel.Tracer("pcast-api/service/episode")
+
+var (
+	ErrEpisodeNotFound = errors.New("episode not found")
+	ErrFeedNotFound    = errors.New("feed not found")
+	ErrStaleProgress   = errors.New("progress update is older than the stored state")
+)
+
+type Service struct {
+	store     modelInterface.Episode
+	feedStore modelInterface.Feed
+}
+
+func NewService(store modelInterface.Episode, feedStore modelInterface.Feed) *Service {
+	return &Service{store: store, feedStore: feedStore}
+}
+
+// GetEpisodesByFeedID returns the episodes of a feed owned by the given user
+func (s *Service) GetEpisodesByFeedID(ctx context.Context, userID uuid.UUID, feedID uuid.UUID) ([]store.Episode, error) {
+	ctx, span := tracer.Start(ctx, "episode.GetEpisodesByFeedID")
+	defer span.End()
+
+	if _, err := s.feedStore.FindByIDAndUserID(ctx, feedID, userID); err != nil {
+		return nil, ErrFeedNotFound
+	}
+
+	return s.store.FindByFeedID(ctx, feedID)
+}
+
+// GetEpisode returns an episode of a feed owned by the given user
+func (s *Service) GetEpisode(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*store.Episode, error) {
+	ctx, span := tracer.Start(ctx, "episode.GetEpisode")
+	defer span.End()
+
+	e, err := s.store.FindByIDAndUserID(ctx, id, userID)
+	if err != nil {
+		return nil, ErrEpisodeNotFound
+	}
+	return e, nil
+}
+
+// UpdateEpisode updates the playback state of an episode. Nil values are left unchanged.
+// The update is written with the current server time and, like UpdateProgress, returns ErrStaleProgress
+// together with the current state if a newer state is already stored.
+func (s *Service) UpdateEpisode(ctx context.Context, userID uuid.UUID, id uuid.UUID, currentPosition *int, played *bool) (*store.Episode, error) {
+	ctx, span := tracer.Start(ctx, "episode.UpdateEpisode")
+	defer span.End()
+
+	if _, err := s.GetEpisode(ctx, userID, id); err != nil {
+		return nil, err
+	}
+
+	// updated_at is stored without time zone, use the same local wall clock as the stores do
+	now := time.Now().In(time.Local).Truncate(time.Microsecond)
+	updated, err := s.store.PatchProgress(ctx, id, currentPosition, played, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reload, the fields left unchanged may have been updated concurrently
+	e, err := s.GetEpisode(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return e, ErrStaleProgress
+	}
+	return e, nil
+}
+
+// UpdateProgress stores the playback position of an episode using last-writer-wins on the client timestamp.
+// Timestamps in the future are capped to the current server time. If a newer state is already stored,
+// ErrStaleProgress is returned together with the current server state.
+func (s *Service) UpdateProgress(ctx context.Context, userID uuid.UUID, id uuid.UUID, position int, played bool, timestamp time.Time) (*store.Episode, error) {
+	ctx, span := tracer.Start(ctx, "episode.UpdateProgress")
+	defer span.End()
+
+	current, err := s.GetEpisode(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if timestamp.After(now) {
+		timestamp = now
+	}
+
+	e := *current
+	e.CurrentPosition = &position
+	e.Played = played
+	// updated_at is stored without time zone, use the same local wall clock as the stores do
+	e.UpdatedAt = timestamp.In(time.Local).Truncate(time.Microsecond)
+
+	updated, err := s.store.UpdateProgress(ctx, &e)
+	if err != nil {
+		return nil, err
+	}
+
+	if !updated {
+		// Reload, the stored state may have changed since it was read above
+		current, err = s.GetEpisode(ctx, userID, id)
+		if err != nil {
+			return nil, err
+		}
+		return current, ErrStaleProgress
+	}
+
+	return &e, nil
+}
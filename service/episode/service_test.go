@@ -0,0 +1,231 @@
+package episode
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	store "pcast-api/store/episode"
+	feedStore "pcast-api/store/feed"
+)
+
+type mockStore struct {
+	episode         *store.Episode
+	episodes        []store.Episode
+	progressUpdated bool
+	err             error
+}
+
+func (m *mockStore) FindByID(ctx context.Context, id uuid.UUID) (*store.Episode, error) {
+	return m.episode, m.err
+}
+
+func (m *mockStore) FindByFeedID(ctx context.Context, feedID uuid.UUID) ([]store.Episode, error) {
+	return m.episodes, m.err
+}
+
+func (m *mockStore) FindByIDAndUserID(ctx context.Context, id, userID uuid.UUID) (*store.Episode, error) {
+	return m.episode, m.err
+}
+
+func (m *mockStore) Create(ctx context.Context, episode *store.Episode) error {
+	return m.err
+}
+
+func (m *mockStore) Upsert(ctx context.Context, episode *store.Episode) error {
+	return m.err
+}
+
+func (m *mockStore) Update(ctx context.Context, episode *store.Episode) error {
+	return m.err
+}
+
+func (m *mockStore) UpdateProgress(ctx context.Context, episode *store.Episode) (bool, error) {
+	return m.progressUpdated, m.err
+}
+
+func (m *mockStore) PatchProgress(ctx context.Context, id uuid.UUID, currentPosition *int, played *bool, updatedAt time.Time) (bool, error) {
+	if m.err != nil || !m.progressUpdated {
+		return false, m.err
+	}
+	if currentPosition != nil {
+		m.episode.CurrentPosition = currentPosition
+	}
+	if played != nil {
+		m.episode.Played = *played
+	}
+	m.episode.UpdatedAt = updatedAt
+	return true, nil
+}
+
+func (m *mockStore) Delete(ctx context.Context, episode *store.Episode) error {
+	return m.err
+}
+
+type mockFeedStore struct {
+	feed *feedStore.Feed
+	err  error
+}
+
+func (m *mockFeedStore) FindAll(ctx context.Context) ([]feedStore.Feed, error) {
+	return nil, m.err
+}
+
+func (m *mockFeedStore) FindByID(ctx context.Context, id uuid.UUID) (*feedStore.Feed, error) {
+	return m.feed, m.err
+}
+
+func (m *mockFeedStore) FindByUserID(ctx context.Context, userID uuid.UUID) ([]feedStore.Feed, error) {
+	return nil, m.err
+}
+
+func (m *mockFeedStore) FindByIDAndUserID(ctx context.Context, id, userID uuid.UUID) (*feedStore.Feed, error) {
+	return m.feed, m.err
+}
+
+func (m *mockFeedStore) FindStale(ctx context.Context, attemptedBefore time.Time, limit int) ([]feedStore.Feed, error) {
+	return nil, m.err
+}
+
+func (m *mockFeedStore) MarkSyncAttempted(ctx context.Context, feed *feedStore.Feed, at time.Time) error {
+	return m.err
+}
+
+func (m *mockFeedStore) Create(ctx context.Context, feed *feedStore.Feed) error {
+	return m.err
+}
+
+func (m *mockFeedStore) Update(ctx context.Context, feed *feedStore.Feed) error {
+	return m.err
+}
+
+func (m *mockFeedStore) UpdateSyncResult(ctx context.Context, feed *feedStore.Feed) error {
+	return m.err
+}
+
+func (m *mockFeedStore) Delete(ctx context.Context, feed *feedStore.Feed) error {
+	return m.err
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestService_GetEpisodesByFeedID(t *testing.T) {
+	episodes := []store.Episode{{FeedGUID: "guid-1"}, {FeedGUID: "guid-2"}}
+	service := NewService(&mockStore{episodes: episodes}, &mockFeedStore{feed: &feedStore.Feed{}})
+
+	result, err := service.GetEpisodesByFeedID(context.Background(), uuid.Must(uuid.NewV7()), uuid.Must(uuid.NewV7()))
+	assert.NoError(t, err)
+	assert.Equal(t, episodes, result)
+}
+
+func TestService_GetEpisodesByFeedID_FeedNotFound(t *testing.T) {
+	service := NewService(&mockStore{}, &mockFeedStore{err: errors.New("not found")})
+
+	result, err := service.GetEpisodesByFeedID(context.Background(), uuid.Must(uuid.NewV7()), uuid.Must(uuid.NewV7()))
+	assert.Equal(t, ErrFeedNotFound, err)
+	assert.Nil(t, result)
+}
+
+func TestService_GetEpisode(t *testing.T) {
+	episode := &store.Episode{FeedGUID: "guid-1"}
+	service := NewService(&mockStore{episode: episode}, &mockFeedStore{})
+
+	result, err := service.GetEpisode(context.Background(), uuid.Must(uuid.NewV7()), episode.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, episode, result)
+}
+
+func TestService_GetEpisode_NotFound(t *testing.T) {
+	service := NewService(&mockStore{err: errors.New("not found")}, &mockFeedStore{})
+
+	result, err := service.GetEpisode(context.Background(), uuid.Must(uuid.NewV7()), uuid.Must(uuid.NewV7()))
+	assert.Equal(t, ErrEpisodeNotFound, err)
+	assert.Nil(t, result)
+}
+
+func TestService_UpdateEpisode(t *testing.T) {
+	episode := &store.Episode{FeedGUID: "guid-1", CurrentPosition: intPtr(10)}
+	service := NewService(&mockStore{episode: episode, progressUpdated: true}, &mockFeedStore{})
+
+	result, err := service.UpdateEpisode(context.Background(), uuid.Must(uuid.NewV7()), episode.ID, intPtr(120), boolPtr(true))
+	assert.NoError(t, err)
+	assert.Equal(t, 120, *result.CurrentPosition)
+	assert.True(t, result.Played)
+}
+
+func TestService_UpdateEpisode_Partial(t *testing.T) {
+	episode := &store.Episode{FeedGUID: "guid-1", CurrentPosition: intPtr(10)}
+	service := NewService(&mockStore{episode: episode, progressUpdated: true}, &mockFeedStore{})
+
+	result, err := service.UpdateEpisode(context.Background(), uuid.Must(uuid.NewV7()), episode.ID, nil, boolPtr(true))
+	assert.NoError(t, err)
+	assert.Equal(t, 10, *result.CurrentPosition)
+	assert.True(t, result.Played)
+}
+
+func TestService_UpdateEpisode_Stale(t *testing.T) {
+	episode := &store.Episode{FeedGUID: "guid-1", CurrentPosition: intPtr(10)}
+	service := NewService(&mockStore{episode: episode}, &mockFeedStore{})
+
+	result, err := service.UpdateEpisode(context.Background(), uuid.Must(uuid.NewV7()), episode.ID, intPtr(120), nil)
+	assert.ErrorIs(t, err, ErrStaleProgress)
+	assert.Equal(t, 10, *result.CurrentPosition)
+}
+
+func TestService_UpdateEpisode_NotFound(t *testing.T) {
+	service := NewService(&mockStore{err: errors.New("not found")}, &mockFeedStore{})
+
+	result, err := service.UpdateEpisode(context.Background(), uuid.Must(uuid.NewV7()), uuid.Must(uuid.NewV7()), intPtr(1), nil)
+	assert.Equal(t, ErrEpisodeNotFound, err)
+	assert.Nil(t, result)
+}
+
+func TestService_UpdateProgress(t *testing.T) {
+	episode := &store.Episode{FeedGUID: "guid-1"}
+	service := NewService(&mockStore{episode: episode, progressUpdated: true}, &mockFeedStore{})
+
+	timestamp := time.Now().Add(-time.Minute)
+	result, err := service.UpdateProgress(context.Background(), uuid.Must(uuid.NewV7()), episode.ID, 300, true, timestamp)
+	assert.NoError(t, err)
+	assert.Equal(t, 300, *result.CurrentPosition)
+	assert.True(t, result.Played)
+	assert.WithinDuration(t, timestamp, result.UpdatedAt, time.Microsecond)
+}
+
+func TestService_UpdateProgress_FutureTimestamp(t *testing.T) {
+	episode := &store.Episode{FeedGUID: "guid-1"}
+	service := NewService(&mockStore{episode: episode, progressUpdated: true}, &mockFeedStore{})
+
+	result, err := service.UpdateProgress(context.Background(), uuid.Must(uuid.NewV7()), episode.ID, 300, false, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), result.UpdatedAt, time.Second)
+}
+
+func TestService_UpdateProgress_Stale(t *testing.T) {
+	episode := &store.Episode{FeedGUID: "guid-1", CurrentPosition: intPtr(600)}
+	service := NewService(&mockStore{episode: episode, progressUpdated: false}, &mockFeedStore{})
+
+	result, err := service.UpdateProgress(context.Background(), uuid.Must(uuid.NewV7()), episode.ID, 300, false, time.Now().Add(-time.Hour))
+	assert.Equal(t, ErrStaleProgress, err)
+	if assert.NotNil(t, result) {
+		assert.Equal(t, 600, *result.CurrentPosition)
+	}
+}
+
+func TestService_UpdateProgress_NotFound(t *testing.T) {
+	service := NewService(&mockStore{err: errors.New("not found")}, &mockFeedStore{})
+
+	result, err := service.UpdateProgress(context.Background(), uuid.Must(uuid.NewV7()), uuid.Must(uuid.NewV7()), 300, false, time.Now())
+	assert.Equal(t, ErrEpisodeNotFound, err)
+	assert.Nil(t, result)
+}
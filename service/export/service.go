@@ -0,0 +1,259 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+
+	feedService "pcast-api/service/feed"
+	modelInterface "pcast-api/service/model_interface"
+	episodeStore "pcast-api/store/episode"
+	feedStore "pcast-api/store/feed"
+	identityStore "pcast-api/store/identity"
+	userStore "pcast-api/store/user"
+)
+
+var tracer = otel.Tracer("pcast-api/service/export")
+
+// Names of the files in the archive
+const (
+	DataFile = "pcast-data.json"
+	OPMLFile = "subscriptions.opml"
+)
+
+// Service exports the personal data of a user as ZIP archive
+type Service struct {
+	users      modelInterface.User
+	identities modelInterface.Identity
+	feeds      modelInterface.Feed
+	episodes   modelInterface.Episode
+}
+
+func NewService(users modelInterface.User, identities modelInterface.Identity, feeds modelInterface.Feed, episodes modelInterface.Episode) *Service {
+	return &Service{users: users, identities: identities, feeds: feeds, episodes: episodes}
+}
+
+// Export is the data of a user ready to be written. Episodes are only loaded while writing, one feed at a time,
+// so the memory use does not grow with the size of the library.
+type Export struct {
+	service    *Service
+	createdAt  time.Time
+	user       *userStore.User
+	identities []identityStore.Identity
+	feeds      []feedStore.Feed
+}
+
+// NewExport loads the profile, identities and feeds of the user. Errors surface here, before anything is written.
+func (s *Service) NewExport(ctx context.Context, userID uuid.UUID) (*Export, error) {
+	ctx, span := tracer.Start(ctx, "export.NewExport")
+	defer span.End()
+
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := s.identities.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	feeds, err := s.feeds.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Export{service: s, createdAt: time.Now(), user: user, identities: identities, feeds: feeds}, nil
+}
+
+// Write streams the archive with the JSON data and the OPML subscriptions to w
+func (e *Export) Write(ctx context.Context, w io.Writer) error {
+	ctx, span := tracer.Start(ctx, "export.Write")
+	defer span.End()
+
+	archive := zip.NewWriter(w)
+
+	data, err := archive.CreateHeader(&zip.FileHeader{Name: DataFile, Method: zip.Deflate, Modified: e.createdAt})
+	if err != nil {
+		return err
+	}
+	if err := e.writeData(ctx, data); err != nil {
+		return err
+	}
+
+	opml, err := archive.CreateHeader(&zip.FileHeader{Name: OPMLFile, Method: zip.Deflate, Modified: e.createdAt})
+	if err != nil {
+		return err
+	}
+	if err := feedService.WriteOPML(opml, e.feeds, e.createdAt); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// writeData writes the Data document. The envelope is written field by field, so the feeds can be
+// streamed one by one, each with its episodes.
+func (e *Export) writeData(ctx context.Context, w io.Writer) error {
+	if _, err := io.WriteString(w, "{\n"); err != nil {
+		return err
+	}
+	fields := []struct {
+		name  string
+		value any
+	}{
+		{"exportedAt", e.createdAt},
+		{"profile", newProfile(e.user)},
+		{"identities", newIdentities(e.identities)},
+	}
+	for _, field := range fields {
+		if err := writeJSON(w, `  "`+field.name+`": `, field.value, "  "); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, ",\n"); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.WriteString(w, `  "feeds": [`); err != nil {
+		return err
+	}
+	for i := range e.feeds {
+		episodes, err := e.service.episodes.FindByFeedID(ctx, e.feeds[i].ID)
+		if err != nil {
+			return err
+		}
+
+		separator := ",\n    "
+		if i == 0 {
+			separator = "\n    "
+		}
+		if err := writeJSON(w, separator, newFeed(&e.feeds[i], episodes), "    "); err != nil {
+			return err
+		}
+	}
+
+	closing := "\n  ]\n}\n"
+	if len(e.feeds) == 0 {
+		closing = "]\n}\n"
+	}
+	_, err := io.WriteString(w, closing)
+	return err
+}
+
+// writeJSON writes prefix followed by the indented JSON of value
+func writeJSON(w io.Writer, prefix string, value any, indent string) error {
+	data, err := json.MarshalIndent(value, indent, "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, prefix); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Data is the JSON document of the export
+type Data struct {
+	ExportedAt time.Time  `json:"exportedAt"`
+	Profile    Profile    `json:"profile"`
+	Identities []Identity `json:"identities"`
+	// writeData writes the fields one by one, new fields must be added there as well
+	Feeds []Feed `json:"feeds"`
+}
+
+// Profile is the account of the user. Secrets like the password hash or the TOTP secret are left out.
+type Profile struct {
+	ID               uuid.UUID  `json:"id"`
+	Email            string     `json:"email"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	EmailVerifiedAt  *time.Time `json:"emailVerifiedAt"`
+	HasPassword      bool       `json:"hasPassword"`
+	TwoFactorEnabled bool       `json:"twoFactorEnabled"`
+}
+
+// Identity is an account of an OpenID Connect provider linked to the user
+type Identity struct {
+	Provider string    `json:"provider"`
+	Subject  string    `json:"subject"`
+	Email    string    `json:"email"`
+	LinkedAt time.Time `json:"linkedAt"`
+}
+
+// Feed is a subscription with its episodes. The credentials of private feeds are left out.
+type Feed struct {
+	ID        uuid.UUID  `json:"id"`
+	Title     string     `json:"title"`
+	URL       string     `json:"url"`
+	Private   bool       `json:"private"`
+	CreatedAt time.Time  `json:"createdAt"`
+	SyncedAt  *time.Time `json:"syncedAt"`
+	Episodes  []Episode  `json:"episodes"`
+}
+
+// Episode is an episode of a feed with the playback state of the user
+type Episode struct {
+	ID              uuid.UUID  `json:"id"`
+	GUID            string     `json:"guid"`
+	Title           string     `json:"title"`
+	URL             string     `json:"url"`
+	PublishedAt     *time.Time `json:"publishedAt"`
+	Duration        *int       `json:"duration"`
+	CurrentPosition *int       `json:"currentPosition"`
+	Played          bool       `json:"played"`
+}
+
+func newProfile(user *userStore.User) Profile {
+	return Profile{
+		ID:               user.ID,
+		Email:            user.Email,
+		CreatedAt:        user.CreatedAt,
+		EmailVerifiedAt:  user.EmailVerifiedAt,
+		HasPassword:      user.Password != nil,
+		TwoFactorEnabled: user.TOTPEnabledAt != nil,
+	}
+}
+
+func newIdentities(identities []identityStore.Identity) []Identity {
+	result := make([]Identity, len(identities))
+	for i, identity := range identities {
+		result[i] = Identity{
+			Provider: identity.Provider,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+			LinkedAt: identity.CreatedAt,
+		}
+	}
+	return result
+}
+
+func newFeed(feed *feedStore.Feed, episodes []episodeStore.Episode) Feed {
+	result := Feed{
+		ID:        feed.ID,
+		Title:     feed.Title,
+		URL:       feed.URL,
+		Private:   feed.Credentials != nil,
+		CreatedAt: feed.CreatedAt,
+		SyncedAt:  feed.SyncedAt,
+		Episodes:  make([]Episode, len(episodes)),
+	}
+	for i, episode := range episodes {
+		result.Episodes[i] = Episode{
+			ID:              episode.ID,
+			GUID:            episode.FeedGUID,
+			Title:           episode.Title,
+			URL:             episode.URL,
+			PublishedAt:     episode.PublishedAt,
+			Duration:        episode.Duration,
+			CurrentPosition: episode.CurrentPosition,
+			Played:          episode.Played,
+		}
+	}
+	return result
+}
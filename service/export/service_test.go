@@ -0,0 +1,295 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	episodeStore "pcast-api/store/episode"
+	feedStore "pcast-api/store/feed"
+	identityStore "pcast-api/store/identity"
+	userStore "pcast-api/store/user"
+)
+
+type mockUserStore struct {
+	user *userStore.User
+	err  error
+}
+
+func (m *mockUserStore) FindAll(ctx context.Context) ([]userStore.User, error) {
+	return nil, nil
+}
+
+func (m *mockUserStore) Create(ctx context.Context, user *userStore.User) error {
+	return nil
+}
+
+func (m *mockUserStore) FindByID(ctx context.Context, id uuid.UUID) (*userStore.User, error) {
+	return m.user, m.err
+}
+
+func (m *mockUserStore) FindByEmail(ctx context.Context, email string) (*userStore.User, error) {
+	return m.user, m.err
+}
+
+func (m *mockUserStore) Delete(ctx context.Context, user *userStore.User) error {
+	return nil
+}
+
+func (m *mockUserStore) Update(ctx context.Context, user *userStore.User) error {
+	return nil
+}
+
+func (m *mockUserStore) CreateOAuthUser(ctx context.Context, user *userStore.User) error {
+	return nil
+}
+
+func (m *mockUserStore) MarkEmailVerified(ctx context.Context, user *userStore.User) error {
+	return nil
+}
+
+func (m *mockUserStore) SetTOTPSecret(ctx context.Context, user *userStore.User, secret []byte) error {
+	return nil
+}
+
+func (m *mockUserStore) EnableTOTP(ctx context.Context, user *userStore.User) error {
+	return nil
+}
+
+func (m *mockUserStore) DisableTOTP(ctx context.Context, user *userStore.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UseTOTPStep(ctx context.Context, user *userStore.User, step int64) (bool, error) {
+	return false, nil
+}
+
+func (m *mockUserStore) TakeTOTPAttempt(ctx context.Context, user *userStore.User, maxAttempts int, lockout time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (m *mockUserStore) ResetTOTPAttempts(ctx context.Context, user *userStore.User) error {
+	return nil
+}
+
+type mockIdentityStore struct {
+	identities []identityStore.Identity
+}
+
+func (m *mockIdentityStore) Create(ctx context.Context, identity *identityStore.Identity) error {
+	return nil
+}
+
+func (m *mockIdentityStore) FindByProviderSubject(ctx context.Context, provider string, subject string) (*identityStore.Identity, error) {
+	return nil, nil
+}
+
+func (m *mockIdentityStore) FindByUserID(ctx context.Context, userID uuid.UUID) ([]identityStore.Identity, error) {
+	return m.identities, nil
+}
+
+func (m *mockIdentityStore) DeleteKeepingLogin(ctx context.Context, userID uuid.UUID, provider string) (bool, error) {
+	return false, nil
+}
+
+type mockFeedStore struct {
+	feeds []feedStore.Feed
+}
+
+func (m *mockFeedStore) FindAll(ctx context.Context) ([]feedStore.Feed, error) {
+	return m.feeds, nil
+}
+
+func (m *mockFeedStore) Create(ctx context.Context, feed *feedStore.Feed) error {
+	return nil
+}
+
+func (m *mockFeedStore) FindByID(ctx context.Context, id uuid.UUID) (*feedStore.Feed, error) {
+	return nil, nil
+}
+
+func (m *mockFeedStore) Delete(ctx context.Context, feed *feedStore.Feed) error {
+	return nil
+}
+
+func (m *mockFeedStore) Update(ctx context.Context, feed *feedStore.Feed) error {
+	return nil
+}
+
+func (m *mockFeedStore) UpdateSyncResult(ctx context.Context, feed *feedStore.Feed) error {
+	return nil
+}
+
+func (m *mockFeedStore) FindByUserID(ctx context.Context, userID uuid.UUID) ([]feedStore.Feed, error) {
+	return m.feeds, nil
+}
+
+func (m *mockFeedStore) FindByIDAndUserID(ctx context.Context, id, userID uuid.UUID) (*feedStore.Feed, error) {
+	return nil, nil
+}
+
+func (m *mockFeedStore) FindStale(ctx context.Context, attemptedBefore time.Time, limit int) ([]feedStore.Feed, error) {
+	return nil, nil
+}
+
+func (m *mockFeedStore) MarkSyncAttempted(ctx context.Context, feed *feedStore.Feed, at time.Time) error {
+	return nil
+}
+
+// mockEpisodeStore returns the episodes by feed and records the feeds episodes were loaded for
+type mockEpisodeStore struct {
+	episodes map[uuid.UUID][]episodeStore.Episode
+	loaded   []uuid.UUID
+}
+
+func (m *mockEpisodeStore) FindByID(ctx context.Context, id uuid.UUID) (*episodeStore.Episode, error) {
+	return nil, nil
+}
+
+func (m *mockEpisodeStore) FindByFeedID(ctx context.Context, feedID uuid.UUID) ([]episodeStore.Episode, error) {
+	m.loaded = append(m.loaded, feedID)
+	return m.episodes[feedID], nil
+}
+
+func (m *mockEpisodeStore) FindByIDAndUserID(ctx context.Context, id, userID uuid.UUID) (*episodeStore.Episode, error) {
+	return nil, nil
+}
+
+func (m *mockEpisodeStore) Create(ctx context.Context, episode *episodeStore.Episode) error {
+	return nil
+}
+
+func (m *mockEpisodeStore) Upsert(ctx context.Context, episode *episodeStore.Episode) error {
+	return nil
+}
+
+func (m *mockEpisodeStore) Update(ctx context.Context, episode *episodeStore.Episode) error {
+	return nil
+}
+
+func (m *mockEpisodeStore) UpdateProgress(ctx context.Context, episode *episodeStore.Episode) (bool, error) {
+	return false, nil
+}
+
+func (m *mockEpisodeStore) PatchProgress(ctx context.Context, id uuid.UUID, currentPosition *int, played *bool, updatedAt time.Time) (bool, error) {
+	return false, nil
+}
+
+func (m *mockEpisodeStore) Delete(ctx context.Context, episode *episodeStore.Episode) error {
+	return nil
+}
+
+// readArchive returns the files of a ZIP archive by name
+func readArchive(t *testing.T, data []byte) map[string][]byte {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	files := map[string][]byte{}
+	for _, file := range reader.File {
+		r, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		files[file.Name] = content
+	}
+	return files
+}
+
+func TestService_Export(t *testing.T) {
+	password := "hash"
+	user := &userStore.User{ID: uuid.Must(uuid.NewV7()), Email: "foo@bar.com", Password: &password, TOTPSecret: []byte("secret")}
+	feeds := []feedStore.Feed{
+		{ID: uuid.Must(uuid.NewV7()), UserID: user.ID, Title: "Public", URL: "https://example.com/public.xml"},
+		{ID: uuid.Must(uuid.NewV7()), UserID: user.ID, Title: "Private", URL: "https://example.com/private.xml", Credentials: []byte("encrypted")},
+	}
+	position := 42
+	episodes := &mockEpisodeStore{episodes: map[uuid.UUID][]episodeStore.Episode{
+		feeds[0].ID: {
+			{ID: uuid.Must(uuid.NewV7()), FeedID: feeds[0].ID, FeedGUID: "guid-1", Title: "First", CurrentPosition: &position},
+			{ID: uuid.Must(uuid.NewV7()), FeedID: feeds[0].ID, FeedGUID: "guid-2", Title: "Second", Played: true},
+		},
+	}}
+	identities := &mockIdentityStore{identities: []identityStore.Identity{{UserID: user.ID, Provider: "keycloak", Subject: "subject-1", Email: "foo@bar.com"}}}
+	service := NewService(&mockUserStore{user: user}, identities, &mockFeedStore{feeds: feeds}, episodes)
+
+	export, err := service.NewExport(context.Background(), user.ID)
+	require.NoError(t, err)
+	// Episodes are loaded while writing
+	assert.Empty(t, episodes.loaded)
+
+	var buf bytes.Buffer
+	require.NoError(t, export.Write(context.Background(), &buf))
+	assert.Equal(t, []uuid.UUID{feeds[0].ID, feeds[1].ID}, episodes.loaded)
+
+	files := readArchive(t, buf.Bytes())
+	require.Contains(t, files, DataFile)
+	require.Contains(t, files, OPMLFile)
+
+	var data Data
+	require.NoError(t, json.Unmarshal(files[DataFile], &data))
+	// The streamed document is the same as the marshaled Data
+	expected, err := json.Marshal(&Data{
+		ExportedAt: data.ExportedAt,
+		Profile:    newProfile(user),
+		Identities: newIdentities(identities.identities),
+		Feeds:      []Feed{newFeed(&feeds[0], episodes.episodes[feeds[0].ID]), newFeed(&feeds[1], nil)},
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, string(expected), string(files[DataFile]))
+	assert.Equal(t, user.ID, data.Profile.ID)
+	assert.True(t, data.Profile.HasPassword)
+	assert.False(t, data.Profile.TwoFactorEnabled)
+	require.Len(t, data.Identities, 1)
+	assert.Equal(t, "keycloak", data.Identities[0].Provider)
+
+	require.Len(t, data.Feeds, 2)
+	assert.False(t, data.Feeds[0].Private)
+	assert.True(t, data.Feeds[1].Private)
+	require.Len(t, data.Feeds[0].Episodes, 2)
+	assert.Equal(t, &position, data.Feeds[0].Episodes[0].CurrentPosition)
+	assert.True(t, data.Feeds[0].Episodes[1].Played)
+	assert.Empty(t, data.Feeds[1].Episodes)
+
+	// Secrets stay out of the export
+	for _, secret := range []string{"hash", "secret", "encrypted", "ZW5jcnlwdGVk"} {
+		assert.NotContains(t, string(files[DataFile]), secret)
+	}
+
+	assert.Contains(t, string(files[OPMLFile]), `xmlUrl="https://example.com/public.xml"`)
+	assert.Contains(t, string(files[OPMLFile]), `xmlUrl="https://example.com/private.xml"`)
+}
+
+func TestService_Export_NoFeeds(t *testing.T) {
+	user := &userStore.User{ID: uuid.Must(uuid.NewV7()), Email: "foo@bar.com"}
+	service := NewService(&mockUserStore{user: user}, &mockIdentityStore{}, &mockFeedStore{}, &mockEpisodeStore{})
+
+	export, err := service.NewExport(context.Background(), user.ID)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, export.Write(context.Background(), &buf))
+
+	files := readArchive(t, buf.Bytes())
+	var data Data
+	require.NoError(t, json.Unmarshal(files[DataFile], &data))
+	assert.NotNil(t, data.Feeds)
+	assert.Empty(t, data.Feeds)
+	assert.NotNil(t, data.Identities)
+	assert.False(t, data.Profile.HasPassword)
+}
+
+func TestService_Export_UserNotFound(t *testing.T) {
+	service := NewService(&mockUserStore{err: assert.AnError}, &mockIdentityStore{}, &mockFeedStore{}, &mockEpisodeStore{})
+
+	_, err := service.NewExport(context.Background(), uuid.Must(uuid.NewV7()))
+	assert.ErrorIs(t, err, assert.AnError)
+}
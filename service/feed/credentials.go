@@ -0,0 +1,100 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+
+	store "pcast-api/store/feed"
+)
+
+var (
+	ErrFeedNotFound           = errors.New("feed not found")
+	ErrCredentialsUnsupported = errors.New("no feed credentials key is configured")
+	ErrInvalidCredentials     = errors.New("credentials need either a username or a token")
+)
+
+// SetCredentials encrypts the credentials onto the feed without storing it. Nil credentials make the feed public.
+// The credentials are bound to the ID of the feed, a new feed gets its ID here.
+func (s *Service) SetCredentials(feed *store.Feed, credentials *store.Credentials) error {
+	if credentials == nil {
+		feed.Credentials = nil
+		return nil
+	}
+
+	hasBasic := credentials.Username != ""
+	hasToken := credentials.Token != ""
+	if hasBasic == hasToken || (!hasBasic && credentials.Password != "") {
+		return ErrInvalidCredentials
+	}
+
+	if s.cipher == nil {
+		return ErrCredentialsUnsupported
+	}
+
+	if err := feed.BeforeCreate(); err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+
+	ciphertext, err := s.cipher.Encrypt(plaintext, feed.ID[:])
+	if err != nil {
+		return err
+	}
+
+	feed.Credentials = ciphertext
+	return nil
+}
+
+// UpdateCredentials replaces the credentials of a feed owned by the user. Nil credentials remove them.
+func (s *Service) UpdateCredentials(ctx context.Context, userID uuid.UUID, id uuid.UUID, credentials *store.Credentials) (*store.Feed, error) {
+	ctx, span := tracer.Start(ctx, "feed.UpdateCredentials")
+	defer span.End()
+
+	feed, err := s.store.FindByIDAndUserID(ctx, id, userID)
+	if err != nil {
+		return nil, ErrFeedNotFound
+	}
+
+	if err := s.SetCredentials(feed, credentials); err != nil {
+		return nil, err
+	}
+
+	// Validators of a response fetched with other credentials do not apply anymore
+	feed.ETag = ""
+	feed.LastModified = ""
+
+	if err := s.store.Update(ctx, feed); err != nil {
+		return nil, err
+	}
+
+	return feed, nil
+}
+
+// credentials decrypts the credentials of the feed. Returns nil for public feeds.
+func (s *Service) credentials(feed *store.Feed) (*store.Credentials, error) {
+	if feed.Credentials == nil {
+		return nil, nil
+	}
+	if s.cipher == nil {
+		return nil, ErrCredentialsUnsupported
+	}
+
+	plaintext, err := s.cipher.Decrypt(feed.Credentials, feed.ID[:])
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials store.Credentials
+	if err := json.Unmarshal(plaintext, &credentials); err != nil {
+		return nil, err
+	}
+
+	return &credentials, nil
+}
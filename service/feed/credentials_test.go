@@ -0,0 +1,156 @@
+package feed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pcast-api/service/auth"
+	store "pcast-api/store/feed"
+)
+
+func newCipher(t *testing.T) *auth.Cipher {
+	cipher, err := auth.NewCipher(bytes.Repeat([]byte{7}, 32), auth.PurposeFeedCredentials)
+	require.NoError(t, err)
+	return cipher
+}
+
+// newPrivateFeedServer serves the podcast fixture only to requests with the given Authorization header
+func newPrivateFeedServer(t *testing.T, authorization string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != authorization {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.ServeFile(w, r, "../../fixtures/test/rss/podcast.xml")
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestService_SetCredentials(t *testing.T) {
+	service := NewService(&mockStore{}, &mockEpisodeStore{}, NewFetcher(http.DefaultClient), newCipher(t))
+	feed := &store.Feed{}
+
+	err := service.SetCredentials(feed, &store.Credentials{Username: "alice", Password: "hunter2"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, feed.Credentials)
+	assert.NotContains(t, string(feed.Credentials), "hunter2")
+
+	credentials, err := service.credentials(feed)
+	assert.NoError(t, err)
+	assert.Equal(t, &store.Credentials{Username: "alice", Password: "hunter2"}, credentials)
+
+	err = service.SetCredentials(feed, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, feed.Credentials)
+}
+
+func TestService_SetCredentials_BoundToFeed(t *testing.T) {
+	server := newPrivateFeedServer(t, "Bearer s3cr3t")
+	service := NewService(&mockStore{}, &mockEpisodeStore{}, NewFetcher(server.Client()), newCipher(t))
+	feed := &store.Feed{URL: server.URL}
+
+	require.NoError(t, service.SetCredentials(feed, &store.Credentials{Token: "s3cr3t"}))
+	assert.NotEqual(t, uuid.Nil, feed.ID)
+
+	// Credentials copied to another feed in the database do not decrypt
+	other := &store.Feed{ID: uuid.Must(uuid.NewV7()), URL: server.URL, Credentials: feed.Credentials}
+	_, err := service.credentials(other)
+	assert.ErrorIs(t, err, auth.ErrDecryptFailed)
+}
+
+func TestService_SetCredentials_Invalid(t *testing.T) {
+	service := NewService(&mockStore{}, &mockEpisodeStore{}, NewFetcher(http.DefaultClient), newCipher(t))
+
+	for _, credentials := range []*store.Credentials{
+		{},
+		{Password: "hunter2"},
+		{Username: "alice", Token: "token"},
+		{Password: "hunter2", Token: "token"},
+	} {
+		err := service.SetCredentials(&store.Feed{}, credentials)
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+}
+
+func TestService_SetCredentials_Unsupported(t *testing.T) {
+	service := newService(&mockStore{})
+
+	err := service.SetCredentials(&store.Feed{}, &store.Credentials{Token: "token"})
+	assert.ErrorIs(t, err, ErrCredentialsUnsupported)
+}
+
+func TestService_UpdateCredentials(t *testing.T) {
+	feed := &store.Feed{ID: uuid.Must(uuid.NewV7()), ETag: `"v1"`, LastModified: "Wed, 03 Jan 2024 10:00:00 GMT"}
+	service := NewService(&mockStore{feed: feed}, &mockEpisodeStore{}, NewFetcher(http.DefaultClient), newCipher(t))
+
+	result, err := service.UpdateCredentials(context.Background(), uuid.Must(uuid.NewV7()), feed.ID, &store.Credentials{Token: "token"})
+	assert.NoError(t, err)
+	assert.NotNil(t, result.Credentials)
+	assert.Empty(t, result.ETag)
+	assert.Empty(t, result.LastModified)
+}
+
+func TestService_UpdateCredentials_NotFound(t *testing.T) {
+	service := NewService(&mockStore{err: errors.New("not found")}, &mockEpisodeStore{}, NewFetcher(http.DefaultClient), newCipher(t))
+
+	_, err := service.UpdateCredentials(context.Background(), uuid.Must(uuid.NewV7()), uuid.Must(uuid.NewV7()), nil)
+	assert.ErrorIs(t, err, ErrFeedNotFound)
+}
+
+func TestService_SyncFeed_BasicAuth(t *testing.T) {
+	server := newPrivateFeedServer(t, "Basic YWxpY2U6aHVudGVyMg==")
+	feed := &store.Feed{ID: uuid.Must(uuid.NewV7()), URL: server.URL}
+	episodes := &mockEpisodeStore{}
+	service := NewService(&mockStore{feed: feed}, episodes, NewFetcher(server.Client()), newCipher(t))
+	require.NoError(t, service.SetCredentials(feed, &store.Credentials{Username: "alice", Password: "hunter2"}))
+
+	err := service.SyncFeed(context.Background(), uuid.Must(uuid.NewV7()), feed.ID)
+	assert.NoError(t, err)
+	assert.Len(t, episodes.episodes, 3)
+}
+
+func TestService_SyncFeed_BearerToken(t *testing.T) {
+	server := newPrivateFeedServer(t, "Bearer s3cr3t")
+	feed := &store.Feed{ID: uuid.Must(uuid.NewV7()), URL: server.URL}
+	episodes := &mockEpisodeStore{}
+	service := NewService(&mockStore{feed: feed}, episodes, NewFetcher(server.Client()), newCipher(t))
+	require.NoError(t, service.SetCredentials(feed, &store.Credentials{Token: "s3cr3t"}))
+
+	err := service.SyncFeed(context.Background(), uuid.Must(uuid.NewV7()), feed.ID)
+	assert.NoError(t, err)
+	assert.Len(t, episodes.episodes, 3)
+}
+
+func TestService_SyncFeed_MissingCredentials(t *testing.T) {
+	server := newPrivateFeedServer(t, "Bearer s3cr3t")
+	feed := &store.Feed{ID: uuid.Must(uuid.NewV7()), URL: server.URL}
+	service := NewService(&mockStore{feed: feed}, &mockEpisodeStore{}, NewFetcher(server.Client()), newCipher(t))
+
+	err := service.SyncFeed(context.Background(), uuid.Must(uuid.NewV7()), feed.ID)
+	assert.ErrorIs(t, err, ErrFetchFailed)
+}
+
+func TestService_SyncFeed_WrongKey(t *testing.T) {
+	server := newPrivateFeedServer(t, "Bearer s3cr3t")
+	feed := &store.Feed{ID: uuid.Must(uuid.NewV7()), URL: server.URL}
+	service := NewService(&mockStore{feed: feed}, &mockEpisodeStore{}, NewFetcher(server.Client()), newCipher(t))
+	require.NoError(t, service.SetCredentials(feed, &store.Credentials{Token: "s3cr3t"}))
+
+	other, err := auth.NewCipher(bytes.Repeat([]byte{8}, 32), auth.PurposeFeedCredentials)
+	require.NoError(t, err)
+	service.cipher = other
+
+	err = service.SyncFeed(context.Background(), uuid.Must(uuid.NewV7()), feed.ID)
+	assert.ErrorIs(t, err, auth.ErrDecryptFailed)
+	assert.Nil(t, feed.SyncedAt)
+}
@@ -0,0 +1,151 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+
+	store "pcast-api/store/feed"
+)
+
+// maxFeedSize limits the size of a downloaded feed document
+const maxFeedSize = 50 << 20
+
+const userAgent = "pcast-api"
+
+var (
+	ErrFetchFailed    = errors.New("failed to fetch feed")
+	ErrInvalidFeed    = errors.New("invalid RSS feed")
+	ErrPrivateAddress = errors.New("feed address is not public")
+)
+
+// reservedPrefixes are not covered by netip.Addr.IsPrivate but are not reachable on the internet either
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+// Fetcher downloads and parses RSS feeds
+type Fetcher struct {
+	client *http.Client
+}
+
+func NewFetcher(client *http.Client) *Fetcher {
+	return &Fetcher{client: client}
+}
+
+// NewTransport returns the transport to download feeds with. Unless allowPrivate is set, it refuses to connect
+// to loopback, private and link-local addresses like the cloud metadata service, so the feed URL of a user
+// cannot reach internal services. The check runs on the resolved address, which also covers redirects and DNS rebinding.
+func NewTransport(allowPrivate bool) *http.Transport {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = denyPrivateAddress
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+func denyPrivateAddress(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !isPublic(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, addrPort.Addr())
+	}
+	return nil
+}
+
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchResult is a downloaded feed together with the cache validators of the response
+type fetchResult struct {
+	doc          *rss
+	etag         string
+	lastModified string
+	// notModified is set when the server answered 304, doc is nil in that case
+	notModified bool
+}
+
+// Fetch downloads the feed and parses it as RSS 2.0, authenticating with the credentials of private feeds.
+// The request is made conditional on the validators stored on the feed, so an unchanged feed is not downloaded again.
+func (f *Fetcher) Fetch(ctx context.Context, feed *store.Feed, credentials *store.Credentials) (*fetchResult, error) {
+	ctx, span := tracer.Start(ctx, "feed.Fetch")
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feed.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFetchFailed, err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/rss+xml, application/xml;q=0.9, */*;q=0.8")
+	if credentials != nil {
+		// The client drops the Authorization header on redirects to other hosts
+		if credentials.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+credentials.Token)
+		} else {
+			req.SetBasicAuth(credentials.Username, credentials.Password)
+		}
+	}
+	if feed.ETag != "" {
+		req.Header.Set("If-None-Match", feed.ETag)
+	}
+	if feed.LastModified != "" {
+		req.Header.Set("If-Modified-Since", feed.LastModified)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFetchFailed, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		// A 304 may carry updated validators, keep the stored ones otherwise
+		result := &fetchResult{etag: feed.ETag, lastModified: feed.LastModified, notModified: true}
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			result.etag = etag
+		}
+		if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+			result.lastModified = lastModified
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("%w: unexpected status %d", ErrFetchFailed, resp.StatusCode)
+	}
+
+	doc, err := parseRSS(io.LimitReader(resp.Body, maxFeedSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return &fetchResult{
+		doc:          doc,
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
@@ -0,0 +1,59 @@
+package feed
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	store "pcast-api/store/feed"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.0.0.1", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.addr, func(t *testing.T) {
+			assert.Equal(t, test.public, isPublic(netip.MustParseAddr(test.addr)))
+		})
+	}
+}
+
+func TestFetcher_Fetch_PrivateAddress(t *testing.T) {
+	server := newFeedServer(t, "../../fixtures/test/rss/podcast.xml")
+	fetcher := NewFetcher(&http.Client{Transport: NewTransport(false)})
+
+	_, err := fetcher.Fetch(context.Background(), &store.Feed{URL: server.URL}, nil)
+	assert.ErrorIs(t, err, ErrFetchFailed)
+	assert.ErrorIs(t, err, ErrPrivateAddress)
+}
+
+func TestFetcher_Fetch_AllowPrivateAddress(t *testing.T) {
+	server := newFeedServer(t, "../../fixtures/test/rss/podcast.xml")
+	fetcher := NewFetcher(&http.Client{Transport: NewTransport(true)})
+
+	result, err := fetcher.Fetch(context.Background(), &store.Feed{URL: server.URL}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, result.doc.Channel.Items, 3)
+}
@@ -0,0 +1,216 @@
+package feed
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/html/charset"
+
+	store "pcast-api/store/feed"
+)
+
+// maxOPMLSize limits the size of an imported OPML document
+const maxOPMLSize = 10 << 20
+
+const opmlTitle = "PCast subscriptions"
+
+var ErrInvalidOPML = errors.New("invalid OPML document")
+
+// ImportStatus describes the outcome of importing a single outline
+type ImportStatus string
+
+const (
+	ImportStatusCreated   ImportStatus = "created"
+	ImportStatusDuplicate ImportStatus = "duplicate"
+	ImportStatusInvalid   ImportStatus = "invalid"
+)
+
+// ImportResult is the outcome of importing a single OPML outline
+type ImportResult struct {
+	Title  string
+	URL    string
+	Status ImportStatus
+	FeedID *uuid.UUID
+}
+
+// opml represents an OPML 1.0 or 2.0 document
+type opml struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    opmlHead `xml:"head"`
+	Body    opmlBody `xml:"body"`
+}
+
+type opmlHead struct {
+	Title       string `xml:"title,omitempty"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+type opmlBody struct {
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// opmlOutline is either a subscription (it has an xmlUrl) or a folder of nested outlines
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	Created  string        `xml:"created,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// parseOPML decodes an OPML document, converting non UTF-8 encodings on the fly
+func parseOPML(r io.Reader) (*opml, error) {
+	decoder := xml.NewDecoder(io.LimitReader(r, maxOPMLSize))
+	decoder.CharsetReader = charset.NewReaderLabel
+	decoder.Strict = false
+
+	var doc opml
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOPML, err)
+	}
+
+	return &doc, nil
+}
+
+// subscriptions flattens nested folders into the list of outlines that are not folders
+func (o *opml) subscriptions() []opmlOutline {
+	var result []opmlOutline
+
+	var walk func(outlines []opmlOutline)
+	walk = func(outlines []opmlOutline) {
+		for _, outline := range outlines {
+			if outline.XMLURL == "" && len(outline.Outlines) > 0 {
+				walk(outline.Outlines)
+				continue
+			}
+			result = append(result, outline)
+		}
+	}
+	walk(o.Body.Outlines)
+
+	return result
+}
+
+// title returns the display title of the outline, falling back to its text and feed URL
+func (o *opmlOutline) title() string {
+	for _, candidate := range []string{o.Title, o.Text, o.XMLURL} {
+		if candidate = strings.TrimSpace(candidate); candidate != "" {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// ImportOPML subscribes the user to every feed of the OPML document, including feeds in nested folders.
+// URLs the user is already subscribed to are skipped. Returns one result per subscription outline.
+func (s *Service) ImportOPML(ctx context.Context, userID uuid.UUID, r io.Reader) ([]ImportResult, error) {
+	ctx, span := tracer.Start(ctx, "feed.ImportOPML")
+	defer span.End()
+
+	doc, err := parseOPML(r)
+	if err != nil {
+		return nil, err
+	}
+
+	feeds, err := s.store.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(feeds))
+	for _, feed := range feeds {
+		known[feed.URL] = true
+	}
+
+	outlines := doc.subscriptions()
+	results := make([]ImportResult, 0, len(outlines))
+	for _, outline := range outlines {
+		result := ImportResult{Title: outline.title(), URL: strings.TrimSpace(outline.XMLURL)}
+
+		switch {
+		case !isValidFeedURL(result.URL):
+			result.Status = ImportStatusInvalid
+		case known[result.URL]:
+			result.Status = ImportStatusDuplicate
+		default:
+			feed := &store.Feed{UserID: userID, URL: result.URL, Title: result.Title}
+			if err := s.CreateFeed(ctx, feed); err != nil {
+				return nil, err
+			}
+
+			known[result.URL] = true
+			result.Status = ImportStatusCreated
+			result.FeedID = &feed.ID
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// isValidFeedURL reports whether s is an absolute http(s) URL
+func isValidFeedURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// ExportOPML writes all feeds of the user as an OPML 2.0 document
+func (s *Service) ExportOPML(ctx context.Context, userID uuid.UUID, w io.Writer) error {
+	ctx, span := tracer.Start(ctx, "feed.ExportOPML")
+	defer span.End()
+
+	feeds, err := s.GetFeedsByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return WriteOPML(w, feeds, time.Now())
+}
+
+// WriteOPML writes the feeds as an OPML 2.0 document created at the given time
+func WriteOPML(w io.Writer, feeds []store.Feed, createdAt time.Time) error {
+	doc := opml{
+		Version: "2.0",
+		Head: opmlHead{
+			Title:       opmlTitle,
+			DateCreated: createdAt.Format(time.RFC1123Z),
+		},
+	}
+
+	for _, feed := range feeds {
+		doc.Body.Outlines = append(doc.Body.Outlines, opmlOutline{
+			Text:    feed.Title,
+			Title:   feed.Title,
+			Type:    "rss",
+			XMLURL:  feed.URL,
+			Created: feed.CreatedAt.Format(time.RFC1123Z),
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
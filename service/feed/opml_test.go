@@ -0,0 +1,124 @@
+package feed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	store "pcast-api/store/feed"
+)
+
+func openOPMLFixture(t *testing.T) *os.File {
+	f, err := os.Open("../../fixtures/test/opml/subscriptions.opml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+
+	return f
+}
+
+func TestService_ImportOPML(t *testing.T) {
+	s := &mockStore{feeds: []store.Feed{{URL: "https://example.com/gotime.rss", Title: "Go Time"}}}
+	service := newService(s)
+
+	results, err := service.ImportOPML(context.Background(), uuid.Must(uuid.NewV7()), openOPMLFixture(t))
+	assert.NoError(t, err)
+
+	expected := []struct {
+		title  string
+		url    string
+		status ImportStatus
+	}{
+		{"The PCast Show", "https://example.com/pcast.rss", ImportStatusCreated},
+		{"Go Time", "https://example.com/gotime.rss", ImportStatusDuplicate},
+		{"Kotlin Weekly", "https://example.com/kotlin.rss", ImportStatusCreated},
+		{"The PCast Show (again)", "https://example.com/pcast.rss", ImportStatusDuplicate},
+		{"Broken", "not a url", ImportStatusInvalid},
+		{"FTP", "ftp://example.com/feed.rss", ImportStatusInvalid},
+		{"Just a note", "", ImportStatusInvalid},
+	}
+
+	if !assert.Len(t, results, len(expected)) {
+		t.FailNow()
+	}
+	for i, e := range expected {
+		assert.Equal(t, e.title, results[i].Title)
+		assert.Equal(t, e.url, results[i].URL)
+		assert.Equal(t, e.status, results[i].Status)
+		assert.Equal(t, e.status == ImportStatusCreated, results[i].FeedID != nil)
+	}
+}
+
+func TestService_ImportOPML_InvalidDocument(t *testing.T) {
+	service := newService(&mockStore{})
+
+	results, err := service.ImportOPML(context.Background(), uuid.Must(uuid.NewV7()), strings.NewReader("<html></html>"))
+	assert.ErrorIs(t, err, ErrInvalidOPML)
+	assert.Nil(t, results)
+}
+
+func TestService_ImportOPML_StoreError(t *testing.T) {
+	service := newService(&mockStore{err: errors.New("database error")})
+
+	results, err := service.ImportOPML(context.Background(), uuid.Must(uuid.NewV7()), openOPMLFixture(t))
+	assert.Error(t, err)
+	assert.Nil(t, results)
+}
+
+func TestService_ExportOPML(t *testing.T) {
+	createdAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	feeds := []store.Feed{
+		{URL: "https://example.com/pcast.rss", Title: "The PCast Show", CreatedAt: createdAt},
+		{URL: "https://example.com/feed.rss?a=1&b=2", Title: "Ampersands & <Brackets>", CreatedAt: createdAt},
+	}
+	service := newService(&mockStore{feeds: feeds})
+
+	var buf bytes.Buffer
+	err := service.ExportOPML(context.Background(), uuid.Must(uuid.NewV7()), &buf)
+	assert.NoError(t, err)
+
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, `<?xml version="1.0" encoding="UTF-8"?>`))
+	assert.Contains(t, out, `<opml version="2.0">`)
+	assert.Contains(t, out, `<dateCreated>`)
+	assert.Contains(t, out, `xmlUrl="https://example.com/feed.rss?a=1&amp;b=2"`)
+	assert.Contains(t, out, `created="Mon, 01 Jan 2024 10:00:00 +0000"`)
+
+	// The export must round-trip through the importer
+	importer := newService(&mockStore{})
+	results, err := importer.ImportOPML(context.Background(), uuid.Must(uuid.NewV7()), &buf)
+	assert.NoError(t, err)
+	if assert.Len(t, results, 2) {
+		for i, feed := range feeds {
+			assert.Equal(t, ImportStatusCreated, results[i].Status)
+			assert.Equal(t, feed.URL, results[i].URL)
+			assert.Equal(t, feed.Title, results[i].Title)
+		}
+	}
+}
+
+func TestService_ExportOPML_Empty(t *testing.T) {
+	service := newService(&mockStore{feeds: []store.Feed{}})
+
+	var buf bytes.Buffer
+	err := service.ExportOPML(context.Background(), uuid.Must(uuid.NewV7()), &buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), `<body></body>`)
+}
+
+func TestService_ExportOPML_StoreError(t *testing.T) {
+	service := newService(&mockStore{err: errors.New("database error")})
+
+	var buf bytes.Buffer
+	err := service.ExportOPML(context.Background(), uuid.Must(uuid.NewV7()), &buf)
+	assert.Error(t, err)
+	assert.Empty(t, buf.String())
+}
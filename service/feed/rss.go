@@ -0,0 +1,158 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/html/charset"
+
+	episodeStore "pcast-api/store/episode"
+)
+
+const itunesNamespace = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+
+// pubDateLayouts lists the date formats found in the wild for RSS pubDate elements
+var pubDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	time.RFC3339,
+}
+
+// rss represents an RSS 2.0 document
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// rssChannel represents the channel of an RSS 2.0 document.
+// Namespaced fields must be declared before their plain counterparts,
+// otherwise encoding/xml matches e.g. <itunes:title> against the plain title field.
+type rssChannel struct {
+	ItunesTitle string    `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd title"`
+	Title       string    `xml:"title"`
+	Items       []rssItem `xml:"item"`
+}
+
+// rssItem represents a single episode of an RSS 2.0 document
+type rssItem struct {
+	ItunesTitle    string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd title"`
+	ItunesSummary  string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd summary"`
+	ItunesDuration string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	Title          string       `xml:"title"`
+	Description    string       `xml:"description"`
+	GUID           string       `xml:"guid"`
+	Link           string       `xml:"link"`
+	PubDate        string       `xml:"pubDate"`
+	Enclosure      rssEnclosure `xml:"enclosure"`
+}
+
+type rssEnclosure struct {
+	URL  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// parseRSS decodes an RSS 2.0 document, converting non UTF-8 encodings on the fly
+func parseRSS(r io.Reader) (*rss, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charset.NewReaderLabel
+	decoder.Strict = false
+
+	var doc rss
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFeed, err)
+	}
+
+	return &doc, nil
+}
+
+// title returns the channel title, preferring the plain RSS title
+func (c *rssChannel) title() string {
+	if title := strings.TrimSpace(c.Title); title != "" {
+		return title
+	}
+	return strings.TrimSpace(c.ItunesTitle)
+}
+
+// guid returns the identifier of the item. Items without a guid fall back to
+// the enclosure URL and then the link, as most podcast players do.
+func (i *rssItem) guid() string {
+	for _, candidate := range []string{i.GUID, i.Enclosure.URL, i.Link} {
+		if candidate = strings.TrimSpace(candidate); candidate != "" {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// toEpisode converts the item into an episode of the given feed
+func (i *rssItem) toEpisode(feedID uuid.UUID) *episodeStore.Episode {
+	title := strings.TrimSpace(i.Title)
+	if title == "" {
+		title = strings.TrimSpace(i.ItunesTitle)
+	}
+
+	description := strings.TrimSpace(i.Description)
+	if description == "" {
+		description = strings.TrimSpace(i.ItunesSummary)
+	}
+
+	return &episodeStore.Episode{
+		FeedID:      feedID,
+		FeedGUID:    i.guid(),
+		Title:       title,
+		Description: description,
+		URL:         strings.TrimSpace(i.Enclosure.URL),
+		Duration:    parseDuration(i.ItunesDuration),
+		PublishedAt: parsePubDate(i.PubDate),
+	}
+}
+
+// parseDuration parses an itunes:duration value given either in seconds or as [HH:]MM:SS
+func parseDuration(s string) *int {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return nil
+	}
+
+	seconds := 0
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil
+		}
+		seconds = seconds*60 + n
+	}
+
+	return &seconds
+}
+
+// parsePubDate parses an RSS pubDate, returning nil if the format is unknown
+func parsePubDate(s string) *time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+
+	for _, layout := range pubDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			t = t.UTC()
+			return &t
+		}
+	}
+
+	return nil
+}
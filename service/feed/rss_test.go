@@ -0,0 +1,81 @@
+package feed
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDuration(t *testing.T) {
+	testCases := map[string]*int{
+		"1800":     intPtr(1800),
+		"45:30":    intPtr(2730),
+		"01:02:03": intPtr(3723),
+		" 90 ":     intPtr(90),
+		"":         nil,
+		"1:2:3:4":  nil,
+		"abc":      nil,
+		"-10":      nil,
+	}
+
+	for input, expected := range testCases {
+		assert.Equal(t, expected, parseDuration(input), "input %q", input)
+	}
+}
+
+func TestParsePubDate(t *testing.T) {
+	expected := time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC)
+
+	for _, input := range []string{
+		"Wed, 03 Jan 2024 10:00:00 +0000",
+		"Wed, 3 Jan 2024 10:00:00 +0000",
+		"Wed, 03 Jan 2024 11:00:00 +0100",
+		"Wed, 03 Jan 2024 10:00:00 GMT",
+		"2024-01-03T10:00:00Z",
+	} {
+		result := parsePubDate(input)
+		if assert.NotNil(t, result, "input %q", input) {
+			assert.True(t, expected.Equal(*result), "input %q", input)
+		}
+	}
+
+	assert.Nil(t, parsePubDate(""))
+	assert.Nil(t, parsePubDate("yesterday"))
+}
+
+func TestParseRSS_Latin1(t *testing.T) {
+	doc := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n" +
+		"<rss version=\"2.0\"><channel><title>Caf\xe9</title></channel></rss>"
+
+	result, err := parseRSS(strings.NewReader(doc))
+	assert.NoError(t, err)
+	assert.Equal(t, "Café", result.Channel.title())
+}
+
+func TestParseRSS_LongValues(t *testing.T) {
+	title := strings.Repeat("t", 2000)
+	url := "https://cdn.example.com/episode.mp3?" + strings.Repeat("utm_source=x&amp;", 100)
+	doc := `<rss version="2.0"><channel><item><title>` + title + `</title>` +
+		`<enclosure url="` + url + `" type="audio/mpeg"/></item></channel></rss>`
+
+	result, err := parseRSS(strings.NewReader(doc))
+	assert.NoError(t, err)
+
+	// Values are not truncated, the columns are unbounded
+	episode := result.Channel.Items[0].toEpisode(uuid.New())
+	assert.Equal(t, title, episode.Title)
+	assert.Len(t, episode.URL, len("https://cdn.example.com/episode.mp3?")+100*len("utm_source=x&"))
+	assert.Equal(t, episode.URL, episode.FeedGUID)
+}
+
+func TestParseRSS_NotRSS(t *testing.T) {
+	_, err := parseRSS(strings.NewReader(`<feed xmlns="http://www.w3.org/2005/Atom"></feed>`))
+	assert.ErrorIs(t, err, ErrInvalidFeed)
+}
+
+func intPtr(i int) *int {
+	return &i
+}
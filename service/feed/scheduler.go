@@ -0,0 +1,83 @@
+package feed
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"pcast-api/logging"
+	store "pcast-api/store/feed"
+)
+
+// Scheduler periodically refreshes the least recently synced feeds with a bounded worker pool
+type Scheduler struct {
+	service   *Service
+	interval  time.Duration
+	workers   int
+	batchSize int
+}
+
+func NewScheduler(service *Service, interval time.Duration, workers int, batchSize int) *Scheduler {
+	return &Scheduler{service: service, interval: interval, workers: workers, batchSize: batchSize}
+}
+
+// Run refreshes stale feeds immediately and then once per interval until ctx is canceled.
+// It returns once all workers have finished.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh syncs one batch of feeds whose sync was not attempted within the interval
+func (s *Scheduler) refresh(ctx context.Context) {
+	ctx, span := tracer.Start(ctx, "feed.refresh")
+	defer span.End()
+
+	feeds, err := s.service.store.FindStale(ctx, time.Now().Add(-s.interval), s.batchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.ErrorContext(ctx, "feed scheduler: failed to find stale feeds", "error", err)
+		}
+		return
+	}
+
+	jobs := make(chan store.Feed)
+	var wg sync.WaitGroup
+
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for feed := range jobs {
+				// The feed is synced on behalf of its owner, the logs carry the user ID like those of a request
+				feedCtx := logging.WithUserID(ctx, feed.UserID)
+				if err := s.service.syncFeed(feedCtx, &feed); err != nil && ctx.Err() == nil {
+					slog.ErrorContext(feedCtx, "feed scheduler: failed to sync feed", "feed_id", feed.ID, "error", err)
+				}
+			}
+		}()
+	}
+
+enqueue:
+	for _, feed := range feeds {
+		select {
+		case jobs <- feed:
+		case <-ctx.Done():
+			break enqueue
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,196 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	store "pcast-api/store/feed"
+)
+
+func TestScheduler_Refresh(t *testing.T) {
+	server := newFeedServer(t, "../../fixtures/test/rss/podcast.xml")
+	feeds := []store.Feed{
+		{ID: uuid.Must(uuid.NewV7()), URL: server.URL},
+		{ID: uuid.Must(uuid.NewV7()), URL: server.URL},
+	}
+	episodes := &mockEpisodeStore{}
+	service := NewService(&mockStore{feeds: feeds}, episodes, NewFetcher(server.Client()), nil)
+	scheduler := NewScheduler(service, time.Minute, 2, 10)
+
+	scheduler.refresh(context.Background())
+
+	assert.Len(t, episodes.episodes, 6)
+	for _, feed := range feeds {
+		count := 0
+		for _, episode := range episodes.episodes {
+			if episode.FeedID == feed.ID {
+				count++
+			}
+		}
+		assert.Equal(t, 3, count)
+	}
+}
+
+// queueStore keeps the feeds in memory and returns the stale ones like the database, least recently attempted first
+type queueStore struct {
+	mockStore
+	mu    sync.Mutex
+	feeds []*store.Feed
+}
+
+func (m *queueStore) FindStale(ctx context.Context, attemptedBefore time.Time, limit int) ([]store.Feed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var stale []store.Feed
+	for _, feed := range m.feeds {
+		if feed.SyncAttemptedAt == nil || feed.SyncAttemptedAt.Before(attemptedBefore) {
+			stale = append(stale, *feed)
+		}
+	}
+	sort.SliceStable(stale, func(i, j int) bool {
+		a, b := stale[i].SyncAttemptedAt, stale[j].SyncAttemptedAt
+		return b != nil && (a == nil || a.Before(*b))
+	})
+	if len(stale) > limit {
+		stale = stale[:limit]
+	}
+	return stale, nil
+}
+
+func (m *queueStore) MarkSyncAttempted(ctx context.Context, feed *store.Feed, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	feed.SyncAttemptedAt = &at
+	m.find(feed.ID).SyncAttemptedAt = &at
+	return nil
+}
+
+func (m *queueStore) Update(ctx context.Context, feed *store.Feed) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	*m.find(feed.ID) = *feed
+	return nil
+}
+
+func (m *queueStore) UpdateSyncResult(ctx context.Context, feed *store.Feed) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.find(feed.ID)
+	stored.Title = feed.Title
+	stored.SyncedAt = feed.SyncedAt
+	stored.ETag = feed.ETag
+	stored.LastModified = feed.LastModified
+	return nil
+}
+
+func (m *queueStore) find(id uuid.UUID) *store.Feed {
+	for _, feed := range m.feeds {
+		if feed.ID == id {
+			return feed
+		}
+	}
+	return nil
+}
+
+func TestScheduler_Refresh_BrokenFeedsDoNotStarveOthers(t *testing.T) {
+	broken := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(broken.Close)
+	healthy := newFeedServer(t, "../../fixtures/test/rss/podcast.xml")
+
+	// The healthy feed was synced before, the broken ones never were
+	lastSync := time.Now().Add(-2 * time.Hour)
+	healthyFeed := &store.Feed{ID: uuid.Must(uuid.NewV7()), URL: healthy.URL, SyncedAt: &lastSync, SyncAttemptedAt: &lastSync}
+	feeds := &queueStore{feeds: []*store.Feed{healthyFeed}}
+	for i := 0; i < 3; i++ {
+		feeds.feeds = append(feeds.feeds, &store.Feed{ID: uuid.Must(uuid.NewV7()), URL: broken.URL})
+	}
+
+	episodes := &mockEpisodeStore{}
+	service := NewService(feeds, episodes, NewFetcher(broken.Client()), nil)
+	// More broken feeds than fit into a batch
+	scheduler := NewScheduler(service, time.Minute, 2, 2)
+
+	start := time.Now()
+	scheduler.refresh(context.Background())
+	scheduler.refresh(context.Background())
+
+	assert.Len(t, episodes.episodes, 3)
+	if assert.NotNil(t, healthyFeed.SyncedAt) {
+		assert.False(t, healthyFeed.SyncedAt.Before(start))
+	}
+	for _, feed := range feeds.feeds[1:] {
+		assert.NotNil(t, feed.SyncAttemptedAt)
+		assert.Nil(t, feed.SyncedAt)
+	}
+}
+
+func TestScheduler_Refresh_KeepsCredentialsChangedDuringFetch(t *testing.T) {
+	feed := &store.Feed{ID: uuid.Must(uuid.NewV7())}
+	feeds := &queueStore{feeds: []*store.Feed{feed}}
+
+	// The user removes the credentials while the feed is being fetched
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		feeds.mu.Lock()
+		feed.Credentials = nil
+		feeds.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/rss+xml")
+		http.ServeFile(w, r, "../../fixtures/test/rss/podcast.xml")
+	}))
+	t.Cleanup(server.Close)
+	feed.URL = server.URL
+
+	service := NewService(feeds, &mockEpisodeStore{}, NewFetcher(server.Client()), newCipher(t))
+	require.NoError(t, service.SetCredentials(feed, &store.Credentials{Username: "alice", Password: "hunter2"}))
+	scheduler := NewScheduler(service, time.Minute, 1, 10)
+
+	scheduler.refresh(context.Background())
+
+	assert.NotNil(t, feed.SyncedAt)
+	assert.NotEmpty(t, feed.Title)
+	assert.Nil(t, feed.Credentials)
+}
+
+func TestScheduler_Refresh_StoreError(t *testing.T) {
+	episodes := &mockEpisodeStore{}
+	service := NewService(&mockStore{err: errors.New("database error")}, episodes, NewFetcher(http.DefaultClient), nil)
+	scheduler := NewScheduler(service, time.Minute, 2, 10)
+
+	scheduler.refresh(context.Background())
+
+	assert.Empty(t, episodes.episodes)
+}
+
+func TestScheduler_Run_StopsOnCancel(t *testing.T) {
+	service := NewService(&mockStore{}, &mockEpisodeStore{}, NewFetcher(http.DefaultClient), nil)
+	scheduler := NewScheduler(service, time.Hour, 2, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		scheduler.Run(ctx)
+		close(done)
+	}()
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("scheduler did not stop after the context was canceled")
+	}
+}
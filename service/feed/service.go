@@ -3,32 +3,53 @@ package feed
 import (
 	"context"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"pcast-api/metrics"
+	"pcast-api/service/auth"
 	modelInterface "pcast-api/service/model_interface"
 	store "pcast-api/store/feed"
 	"time"
 )
 
+var tracer = otel.Tracer("pcast-api/service/feed")
+
 type Service struct {
-	store modelInterface.Feed
+	store        modelInterface.Feed
+	episodeStore modelInterface.Episode
+	fetcher      *Fetcher
+	// cipher encrypts the credentials of private feeds, nil if no key is configured
+	cipher *auth.Cipher
 }
 
-func NewService(store modelInterface.Feed) *Service {
-	return &Service{store: store}
+func NewService(store modelInterface.Feed, episodeStore modelInterface.Episode, fetcher *Fetcher, cipher *auth.Cipher) *Service {
+	return &Service{store: store, episodeStore: episodeStore, fetcher: fetcher, cipher: cipher}
 }
 
 func (s *Service) GetFeed(ctx context.Context, id uuid.UUID) (*store.Feed, error) {
+	ctx, span := tracer.Start(ctx, "feed.GetFeed")
+	defer span.End()
+
 	return s.store.FindByID(ctx, id)
 }
 
 func (s *Service) GetFeedsByUserID(ctx context.Context, userID uuid.UUID) ([]store.Feed, error) {
+	ctx, span := tracer.Start(ctx, "feed.GetFeedsByUserID")
+	defer span.End()
+
 	return s.store.FindByUserID(ctx, userID)
 }
 
 func (s *Service) CreateFeed(ctx context.Context, feed *store.Feed) error {
+	ctx, span := tracer.Start(ctx, "feed.CreateFeed")
+	defer span.End()
+
 	return s.store.Create(ctx, feed)
 }
 
 func (s *Service) DeleteFeed(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "feed.DeleteFeed")
+	defer span.End()
+
 	feed, err := s.store.FindByIDAndUserID(ctx, id, userID)
 	if err != nil {
 		return err
@@ -38,13 +59,67 @@ func (s *Service) DeleteFeed(ctx context.Context, userID uuid.UUID, id uuid.UUID
 }
 
 func (s *Service) SyncFeed(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "feed.SyncFeed")
+	defer span.End()
+
 	feed, err := s.store.FindByIDAndUserID(ctx, id, userID)
 	if err != nil {
 		return err
 	}
 
+	return s.syncFeed(ctx, feed)
+}
+
+// syncFeed downloads the feed, updates its title and upserts one episode per item.
+// A feed that did not change since the last sync only has its SyncedAt advanced.
+// SyncAttemptedAt is advanced whether the sync succeeds or not.
+func (s *Service) syncFeed(ctx context.Context, feed *store.Feed) (err error) {
+	ctx, span := tracer.Start(ctx, "feed.syncFeed")
+	defer span.End()
+
+	start := time.Now()
+	outcome := metrics.SyncUpdated
+	defer func() { metrics.ObserveFeedSync(start, outcome, err) }()
+
+	// Failed syncs count as attempts too, so the scheduler moves on to the other feeds
+	if err := s.store.MarkSyncAttempted(ctx, feed, start); err != nil {
+		return err
+	}
+
+	credentials, err := s.credentials(feed)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.fetcher.Fetch(ctx, feed, credentials)
+	if err != nil {
+		return err
+	}
+
+	if result.notModified {
+		outcome = metrics.SyncNotModified
+	} else {
+		if title := result.doc.Channel.title(); title != "" {
+			feed.Title = title
+		}
+
+		for _, item := range result.doc.Channel.Items {
+			episode := item.toEpisode(feed.ID)
+			if episode.FeedGUID == "" {
+				continue
+			}
+
+			if err := s.episodeStore.Upsert(ctx, episode); err != nil {
+				return err
+			}
+		}
+	}
+
 	now := time.Now()
 	feed.SyncedAt = &now
+	feed.ETag = result.etag
+	feed.LastModified = result.lastModified
 
-	return s.store.Update(ctx, feed)
+	// the fetch can take a while, only write back what it changed
+	return s.store.UpdateSyncResult(ctx, feed)
 }
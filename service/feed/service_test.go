@@ -3,12 +3,16 @@ package feed
 import (
 	"context"
 	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 
+	episodeStore "pcast-api/store/episode"
 	store "pcast-api/store/feed"
 )
 
@@ -34,6 +38,15 @@ func (m *mockStore) FindByIDAndUserID(ctx context.Context, id, userID uuid.UUID)
 	return m.feed, m.err
 }
 
+func (m *mockStore) FindStale(ctx context.Context, attemptedBefore time.Time, limit int) ([]store.Feed, error) {
+	return m.feeds, m.err
+}
+
+func (m *mockStore) MarkSyncAttempted(ctx context.Context, feed *store.Feed, at time.Time) error {
+	feed.SyncAttemptedAt = &at
+	return m.err
+}
+
 func (m *mockStore) Create(ctx context.Context, feed *store.Feed) error {
 	return m.err
 }
@@ -42,14 +55,81 @@ func (m *mockStore) Update(ctx context.Context, feed *store.Feed) error {
 	return m.err
 }
 
+func (m *mockStore) UpdateSyncResult(ctx context.Context, feed *store.Feed) error {
+	return m.err
+}
+
 func (m *mockStore) Delete(ctx context.Context, feed *store.Feed) error {
 	return m.err
 }
 
+type mockEpisodeStore struct {
+	mu       sync.Mutex
+	episodes []*episodeStore.Episode
+	err      error
+}
+
+func (m *mockEpisodeStore) FindByID(ctx context.Context, id uuid.UUID) (*episodeStore.Episode, error) {
+	return nil, m.err
+}
+
+func (m *mockEpisodeStore) FindByFeedID(ctx context.Context, feedID uuid.UUID) ([]episodeStore.Episode, error) {
+	return nil, m.err
+}
+
+func (m *mockEpisodeStore) FindByIDAndUserID(ctx context.Context, id, userID uuid.UUID) (*episodeStore.Episode, error) {
+	return nil, m.err
+}
+
+func (m *mockEpisodeStore) Create(ctx context.Context, episode *episodeStore.Episode) error {
+	return m.err
+}
+
+func (m *mockEpisodeStore) Upsert(ctx context.Context, episode *episodeStore.Episode) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.episodes = append(m.episodes, episode)
+	return nil
+}
+
+func (m *mockEpisodeStore) Update(ctx context.Context, episode *episodeStore.Episode) error {
+	return m.err
+}
+
+func (m *mockEpisodeStore) UpdateProgress(ctx context.Context, episode *episodeStore.Episode) (bool, error) {
+	return true, m.err
+}
+
+func (m *mockEpisodeStore) PatchProgress(ctx context.Context, id uuid.UUID, currentPosition *int, played *bool, updatedAt time.Time) (bool, error) {
+	return true, m.err
+}
+
+func (m *mockEpisodeStore) Delete(ctx context.Context, episode *episodeStore.Episode) error {
+	return m.err
+}
+
+// newFeedServer serves the given fixture file as an RSS feed
+func newFeedServer(t *testing.T, fixture string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		http.ServeFile(w, r, fixture)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newService(s *mockStore) *Service {
+	return NewService(s, &mockEpisodeStore{}, NewFetcher(http.DefaultClient), nil)
+}
+
 func TestService_GetFeed(t *testing.T) {
 	feed := &store.Feed{URL: "https://example.com", Title: "Example"}
 	s := &mockStore{feed: feed}
-	service := NewService(s)
+	service := newService(s)
 
 	result, err := service.GetFeed(context.Background(), feed.ID)
 	assert.NoError(t, err)
@@ -58,7 +138,7 @@ func TestService_GetFeed(t *testing.T) {
 
 func TestService_GetFeed_Error(t *testing.T) {
 	s := &mockStore{err: errors.New("not found")}
-	service := NewService(s)
+	service := newService(s)
 
 	result, err := service.GetFeed(context.Background(), uuid.Must(uuid.NewV7()))
 	assert.Error(t, err)
@@ -68,7 +148,7 @@ func TestService_GetFeed_Error(t *testing.T) {
 func TestService_GetFeedsByUserID(t *testing.T) {
 	feeds := []store.Feed{{URL: "https://example.com", Title: "Example"}}
 	s := &mockStore{feeds: feeds}
-	service := NewService(s)
+	service := newService(s)
 
 	result, err := service.GetFeedsByUserID(context.Background(), uuid.Must(uuid.NewV7()))
 	assert.NoError(t, err)
@@ -77,7 +157,7 @@ func TestService_GetFeedsByUserID(t *testing.T) {
 
 func TestService_GetFeedsByUserID_Error(t *testing.T) {
 	s := &mockStore{err: errors.New("database error")}
-	service := NewService(s)
+	service := newService(s)
 
 	result, err := service.GetFeedsByUserID(context.Background(), uuid.Must(uuid.NewV7()))
 	assert.Error(t, err)
@@ -86,7 +166,7 @@ func TestService_GetFeedsByUserID_Error(t *testing.T) {
 
 func TestService_CreateFeed(t *testing.T) {
 	s := &mockStore{}
-	service := NewService(s)
+	service := newService(s)
 
 	feed := &store.Feed{URL: "https://example.com", Title: "Example"}
 	err := service.CreateFeed(context.Background(), feed)
@@ -95,7 +175,7 @@ func TestService_CreateFeed(t *testing.T) {
 
 func TestService_CreateFeed_Error(t *testing.T) {
 	s := &mockStore{err: errors.New("create error")}
-	service := NewService(s)
+	service := newService(s)
 
 	feed := &store.Feed{URL: "https://example.com", Title: "Example"}
 	err := service.CreateFeed(context.Background(), feed)
@@ -105,7 +185,7 @@ func TestService_CreateFeed_Error(t *testing.T) {
 func TestService_DeleteFeed(t *testing.T) {
 	feed := &store.Feed{URL: "https://example.com", Title: "Example"}
 	s := &mockStore{feed: feed}
-	service := NewService(s)
+	service := newService(s)
 
 	err := service.DeleteFeed(context.Background(), uuid.Must(uuid.NewV7()), feed.ID)
 	assert.NoError(t, err)
@@ -113,27 +193,134 @@ func TestService_DeleteFeed(t *testing.T) {
 
 func TestService_DeleteFeed_NotFound(t *testing.T) {
 	s := &mockStore{err: errors.New("not found")}
-	service := NewService(s)
+	service := newService(s)
 
 	err := service.DeleteFeed(context.Background(), uuid.Must(uuid.NewV7()), uuid.Must(uuid.NewV7()))
 	assert.Error(t, err)
 }
 
 func TestService_SyncFeed(t *testing.T) {
-	feed := &store.Feed{URL: "https://example.com", Title: "Example"}
+	server := newFeedServer(t, "../../fixtures/test/rss/podcast.xml")
+	feed := &store.Feed{ID: uuid.Must(uuid.NewV7()), URL: server.URL, Title: "Example"}
 	s := &mockStore{feed: feed}
-	service := NewService(s)
+	episodes := &mockEpisodeStore{}
+	service := NewService(s, episodes, NewFetcher(server.Client()), nil)
 
 	err := service.SyncFeed(context.Background(), uuid.Must(uuid.NewV7()), feed.ID)
 	assert.NoError(t, err)
 	assert.NotNil(t, feed.SyncedAt)
 	assert.WithinDuration(t, time.Now(), *feed.SyncedAt, time.Second)
+	assert.Equal(t, "The PCast Show", feed.Title)
+
+	if !assert.Len(t, episodes.episodes, 3) {
+		t.FailNow()
+	}
+
+	first := episodes.episodes[0]
+	assert.Equal(t, feed.ID, first.FeedID)
+	assert.Equal(t, "tag:example.com,2024:episode-3", first.FeedGUID)
+	assert.Equal(t, "Episode 3: Sync all the things", first.Title)
+	assert.Equal(t, "We finally sync feeds.", first.Description)
+	assert.Equal(t, "https://example.com/episode-3.mp3", first.URL)
+	assert.Equal(t, 3723, *first.Duration)
+	assert.Equal(t, time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC), *first.PublishedAt)
+
+	// Items without a guid are keyed on their enclosure URL
+	second := episodes.episodes[1]
+	assert.Equal(t, "https://example.com/episode-2.mp3", second.FeedGUID)
+	assert.Equal(t, "Why private feeds keep losing progress.", second.Description)
+	assert.Equal(t, 2730, *second.Duration)
+
+	third := episodes.episodes[2]
+	assert.Equal(t, "<p>The very <b>first</b> episode.</p>", third.Description)
+	assert.Equal(t, 1800, *third.Duration)
+	assert.Equal(t, time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC), *third.PublishedAt)
+}
+
+func TestService_SyncFeed_StoresValidators(t *testing.T) {
+	server := newFeedServer(t, "../../fixtures/test/rss/podcast.xml")
+	feed := &store.Feed{ID: uuid.Must(uuid.NewV7()), URL: server.URL, Title: "Example"}
+	s := &mockStore{feed: feed}
+	service := NewService(s, &mockEpisodeStore{}, NewFetcher(server.Client()), nil)
+
+	err := service.SyncFeed(context.Background(), uuid.Must(uuid.NewV7()), feed.ID)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, feed.LastModified)
+
+	_, err = http.ParseTime(feed.LastModified)
+	assert.NoError(t, err)
+}
+
+func TestService_SyncFeed_NotModified(t *testing.T) {
+	var ifNoneMatch, ifModifiedSince string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifNoneMatch = r.Header.Get("If-None-Match")
+		ifModifiedSince = r.Header.Get("If-Modified-Since")
+		w.Header().Set("ETag", `"v2"`)
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer server.Close()
+
+	lastModified := "Wed, 03 Jan 2024 10:00:00 GMT"
+	feed := &store.Feed{ID: uuid.Must(uuid.NewV7()), URL: server.URL, Title: "Example", ETag: `"v1"`, LastModified: lastModified}
+	s := &mockStore{feed: feed}
+	episodes := &mockEpisodeStore{}
+	service := NewService(s, episodes, NewFetcher(server.Client()), nil)
+
+	err := service.SyncFeed(context.Background(), uuid.Must(uuid.NewV7()), feed.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, `"v1"`, ifNoneMatch)
+	assert.Equal(t, lastModified, ifModifiedSince)
+
+	// A 304 is a successful sync without touching title or episodes
+	assert.NotNil(t, feed.SyncedAt)
+	assert.WithinDuration(t, time.Now(), *feed.SyncedAt, time.Second)
+	assert.Equal(t, "Example", feed.Title)
+	assert.Empty(t, episodes.episodes)
+	assert.Equal(t, `"v2"`, feed.ETag)
+	assert.Equal(t, lastModified, feed.LastModified)
 }
 
 func TestService_SyncFeed_NotFound(t *testing.T) {
 	s := &mockStore{err: errors.New("not found")}
-	service := NewService(s)
+	service := newService(s)
 
 	err := service.SyncFeed(context.Background(), uuid.Must(uuid.NewV7()), uuid.Must(uuid.NewV7()))
 	assert.Error(t, err)
 }
+
+func TestService_SyncFeed_InvalidFeed(t *testing.T) {
+	server := newFeedServer(t, "../../fixtures/test/rss/invalid.xml")
+	feed := &store.Feed{URL: server.URL, Title: "Example"}
+	s := &mockStore{feed: feed}
+	service := NewService(s, &mockEpisodeStore{}, NewFetcher(server.Client()), nil)
+
+	err := service.SyncFeed(context.Background(), uuid.Must(uuid.NewV7()), feed.ID)
+	assert.ErrorIs(t, err, ErrInvalidFeed)
+	assert.Nil(t, feed.SyncedAt)
+	assert.Equal(t, "Example", feed.Title)
+}
+
+func TestService_SyncFeed_FetchFailed(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	feed := &store.Feed{URL: server.URL, Title: "Example"}
+	s := &mockStore{feed: feed}
+	service := NewService(s, &mockEpisodeStore{}, NewFetcher(server.Client()), nil)
+
+	err := service.SyncFeed(context.Background(), uuid.Must(uuid.NewV7()), feed.ID)
+	assert.ErrorIs(t, err, ErrFetchFailed)
+	assert.Nil(t, feed.SyncedAt)
+}
+
+func TestService_SyncFeed_EpisodeStoreError(t *testing.T) {
+	server := newFeedServer(t, "../../fixtures/test/rss/podcast.xml")
+	feed := &store.Feed{URL: server.URL, Title: "Example"}
+	s := &mockStore{feed: feed}
+	service := NewService(s, &mockEpisodeStore{err: errors.New("database error")}, NewFetcher(server.Client()), nil)
+
+	err := service.SyncFeed(context.Background(), uuid.Must(uuid.NewV7()), feed.ID)
+	assert.Error(t, err)
+	assert.Nil(t, feed.SyncedAt)
+}
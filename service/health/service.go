@@ -0,0 +1,109 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// checkTimeout bounds a readiness check, the load balancer probes again shortly after
+const checkTimeout = 2 * time.Second
+
+var ErrMigrationMismatch = errors.New("database migration version does not match")
+
+// Check is a dependency the server needs to handle requests
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Result is the outcome of a check, Err is nil if the dependency is available
+type Result struct {
+	Name string
+	Err  error
+}
+
+// Status is the readiness of the server. While draining the checks are skipped.
+type Status struct {
+	Draining bool
+	Results  []Result
+}
+
+// Ready reports whether the server should receive requests
+func (s *Status) Ready() bool {
+	if s.Draining {
+		return false
+	}
+	for _, result := range s.Results {
+		if result.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Service reports whether the server is ready. It stops being ready once the server is draining.
+type Service struct {
+	checks   []Check
+	draining atomic.Bool
+}
+
+func NewService(checks ...Check) *Service {
+	return &Service{checks: checks}
+}
+
+// Drain marks the server as shutting down, so the load balancer stops sending requests
+func (s *Service) Drain() {
+	s.draining.Store(true)
+}
+
+// Ready runs all checks concurrently. The results are in the order of the checks.
+func (s *Service) Ready(ctx context.Context) *Status {
+	if s.draining.Load() {
+		return &Status{Draining: true}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	results := make([]Result, len(s.checks))
+	var wg sync.WaitGroup
+	for i, check := range s.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = Result{Name: check.Name, Err: check.Run(ctx)}
+		}()
+	}
+	wg.Wait()
+
+	return &Status{Results: results}
+}
+
+// Pinger is a connection pool like *sql.DB
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// DatabaseCheck checks that the database is reachable
+func DatabaseCheck(db Pinger) Check {
+	return Check{Name: "database", Run: db.PingContext}
+}
+
+// MigrationCheck checks that the database is migrated to the version the binary expects.
+// A database behind or ahead of the binary fails the check.
+func MigrationCheck(version func(ctx context.Context) (int64, error), expected int64) Check {
+	return Check{Name: "migrations", Run: func(ctx context.Context) error {
+		current, err := version(ctx)
+		if err != nil {
+			return err
+		}
+		if current != expected {
+			return fmt.Errorf("%w: database is at %d, expected %d", ErrMigrationMismatch, current, expected)
+		}
+		return nil
+	}}
+}
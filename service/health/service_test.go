@@ -0,0 +1,75 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockPinger struct {
+	err error
+}
+
+func (m *mockPinger) PingContext(ctx context.Context) error {
+	return m.err
+}
+
+func version(v int64, err error) func(ctx context.Context) (int64, error) {
+	return func(ctx context.Context) (int64, error) {
+		return v, err
+	}
+}
+
+func TestService_Ready(t *testing.T) {
+	service := NewService(DatabaseCheck(&mockPinger{}), MigrationCheck(version(15, nil), 15))
+
+	status := service.Ready(context.Background())
+	assert.True(t, status.Ready())
+	assert.False(t, status.Draining)
+	assert.Equal(t, []Result{{Name: "database"}, {Name: "migrations"}}, status.Results)
+}
+
+func TestService_Ready_Failing(t *testing.T) {
+	pingErr := errors.New("connection refused")
+
+	tests := []struct {
+		name     string
+		checks   []Check
+		failing  string
+		expected error
+	}{
+		{"database unreachable", []Check{DatabaseCheck(&mockPinger{err: pingErr})}, "database", pingErr},
+		{"database behind", []Check{MigrationCheck(version(14, nil), 15)}, "migrations", ErrMigrationMismatch},
+		{"database ahead", []Check{MigrationCheck(version(16, nil), 15)}, "migrations", ErrMigrationMismatch},
+		{"version unknown", []Check{MigrationCheck(version(0, pingErr), 15)}, "migrations", pingErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := NewService(tt.checks...).Ready(context.Background())
+			assert.False(t, status.Ready())
+			require.Len(t, status.Results, 1)
+			assert.Equal(t, tt.failing, status.Results[0].Name)
+			assert.ErrorIs(t, status.Results[0].Err, tt.expected)
+		})
+	}
+}
+
+func TestService_Drain(t *testing.T) {
+	checked := false
+	service := NewService(Check{Name: "database", Run: func(ctx context.Context) error {
+		checked = true
+		return nil
+	}})
+
+	service.Drain()
+
+	status := service.Ready(context.Background())
+	assert.False(t, status.Ready())
+	assert.True(t, status.Draining)
+	assert.Empty(t, status.Results)
+	assert.False(t, checked)
+}
@@ -0,0 +1,35 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileMailer stores every mail as .eml file in a directory, so it can be opened with a mail client
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir string, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return err
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+
+	// UUIDv7 names sort by the time the mail was sent
+	path := filepath.Join(m.dir, id.String()+".eml")
+	return os.WriteFile(path, format(m.from, msg, time.Now()), 0o600)
+}
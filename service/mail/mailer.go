@@ -0,0 +1,46 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+)
+
+// Message is a plain text mail to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers mails. Implementations send them via SMTP or just record them for local development.
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// format renders the message as RFC 5322 mail with CRLF line endings
+func format(from string, msg *Message, date time.Time) []byte {
+	var b strings.Builder
+
+	writeHeader(&b, "From", from)
+	writeHeader(&b, "To", msg.To)
+	writeHeader(&b, "Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	writeHeader(&b, "Date", date.Format(time.RFC1123Z))
+	writeHeader(&b, "MIME-Version", "1.0")
+	writeHeader(&b, "Content-Type", "text/plain; charset=utf-8")
+	writeHeader(&b, "Content-Transfer-Encoding", "8bit")
+	b.WriteString("\r\n")
+
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return []byte(b.String())
+}
+
+// writeHeader writes a header line, dropping line breaks so values cannot inject further headers
+func writeHeader(b *strings.Builder, name, value string) {
+	value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+	fmt.Fprintf(b, "%s: %s\r\n", name, value)
+}
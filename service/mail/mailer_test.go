@@ -0,0 +1,75 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	date := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	msg := &Message{To: "foo@bar.com", Subject: "Reset your password", Body: "Hello\nWorld"}
+
+	result := string(format("pcast <noreply@pcast.local>", msg, date))
+
+	assert.Equal(t, "From: pcast <noreply@pcast.local>\r\n"+
+		"To: foo@bar.com\r\n"+
+		"Subject: Reset your password\r\n"+
+		"Date: Tue, 02 Jan 2024 03:04:05 +0000\r\n"+
+		"MIME-Version: 1.0\r\n"+
+		"Content-Type: text/plain; charset=utf-8\r\n"+
+		"Content-Transfer-Encoding: 8bit\r\n"+
+		"\r\n"+
+		"Hello\r\nWorld", result)
+}
+
+func TestFormat_HeaderInjection(t *testing.T) {
+	msg := &Message{To: "foo@bar.com\r\nBcc: evil@example.com", Subject: "Hi", Body: ""}
+
+	result := string(format("noreply@pcast.local", msg, time.Now()))
+
+	assert.Contains(t, result, "To: foo@bar.comBcc: evil@example.com\r\n")
+	assert.NotContains(t, result, "\r\nBcc:")
+}
+
+func TestFormat_EncodesSubject(t *testing.T) {
+	msg := &Message{To: "foo@bar.com", Subject: "Passwort zurücksetzen", Body: ""}
+
+	result := string(format("noreply@pcast.local", msg, time.Now()))
+
+	assert.Contains(t, result, "Subject: =?utf-8?q?Passwort_zur=C3=BCcksetzen?=\r\n")
+}
+
+func TestLogMailer_Send(t *testing.T) {
+	var buf bytes.Buffer
+	mailer := NewLogMailer(&buf, "noreply@pcast.local")
+
+	err := mailer.Send(context.Background(), &Message{To: "foo@bar.com", Subject: "Hi", Body: "token: abc"})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "To: foo@bar.com\r\n")
+	assert.Contains(t, buf.String(), "token: abc")
+}
+
+func TestFileMailer_Send(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mails")
+	mailer := NewFileMailer(dir, "noreply@pcast.local")
+
+	require.NoError(t, mailer.Send(context.Background(), &Message{To: "foo@bar.com", Subject: "First", Body: "1"}))
+	require.NoError(t, mailer.Send(context.Background(), &Message{To: "foo@bar.com", Subject: "Second", Body: "2"}))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.True(t, strings.HasSuffix(entries[0].Name(), ".eml"))
+
+	content, err := os.ReadFile(filepath.Join(dir, entries[1].Name()))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "Subject: Second\r\n")
+}
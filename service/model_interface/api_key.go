@@ -0,0 +1,17 @@
+package model_interface
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"pcast-api/store/apikey"
+)
+
+type APIKey interface {
+	Create(ctx context.Context, key *apikey.APIKey) error
+	FindByHash(ctx context.Context, keyHash string) (*apikey.APIKey, error)
+	FindByUserID(ctx context.Context, userID uuid.UUID) ([]apikey.APIKey, error)
+	MarkUsed(ctx context.Context, key *apikey.APIKey) error
+	Delete(ctx context.Context, userID uuid.UUID, id uuid.UUID) (bool, error)
+}
@@ -0,0 +1,13 @@
+package model_interface
+
+import (
+	"context"
+
+	"pcast-api/store/emailverification"
+)
+
+type EmailVerification interface {
+	Create(ctx context.Context, token *emailverification.EmailVerificationToken) error
+	FindByHash(ctx context.Context, tokenHash string) (*emailverification.EmailVerificationToken, error)
+	MarkUsed(ctx context.Context, token *emailverification.EmailVerificationToken) (bool, error)
+}
@@ -0,0 +1,20 @@
+package model_interface
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"pcast-api/store/episode"
+	"time"
+)
+
+type Episode interface {
+	FindByID(ctx context.Context, id uuid.UUID) (*episode.Episode, error)
+	FindByFeedID(ctx context.Context, feedID uuid.UUID) ([]episode.Episode, error)
+	FindByIDAndUserID(ctx context.Context, id, userID uuid.UUID) (*episode.Episode, error)
+	Create(ctx context.Context, episode *episode.Episode) error
+	Upsert(ctx context.Context, episode *episode.Episode) error
+	Update(ctx context.Context, episode *episode.Episode) error
+	UpdateProgress(ctx context.Context, episode *episode.Episode) (bool, error)
+	PatchProgress(ctx context.Context, id uuid.UUID, currentPosition *int, played *bool, updatedAt time.Time) (bool, error)
+	Delete(ctx context.Context, episode *episode.Episode) error
+}
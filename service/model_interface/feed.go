@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/google/uuid"
 	"pcast-api/store/feed"
+	"time"
 )
 
 type Feed interface {
@@ -12,6 +13,9 @@ type Feed interface {
 	FindByID(ctx context.Context, id uuid.UUID) (*feed.Feed, error)
 	Delete(ctx context.Context, feed *feed.Feed) error
 	Update(ctx context.Context, feed *feed.Feed) error
+	UpdateSyncResult(ctx context.Context, feed *feed.Feed) error
 	FindByUserID(ctx context.Context, userID uuid.UUID) ([]feed.Feed, error)
 	FindByIDAndUserID(ctx context.Context, id, userID uuid.UUID) (*feed.Feed, error)
+	FindStale(ctx context.Context, attemptedBefore time.Time, limit int) ([]feed.Feed, error)
+	MarkSyncAttempted(ctx context.Context, feed *feed.Feed, at time.Time) error
 }
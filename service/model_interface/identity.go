@@ -0,0 +1,16 @@
+package model_interface
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"pcast-api/store/identity"
+)
+
+type Identity interface {
+	Create(ctx context.Context, identity *identity.Identity) error
+	FindByProviderSubject(ctx context.Context, provider string, subject string) (*identity.Identity, error)
+	FindByUserID(ctx context.Context, userID uuid.UUID) ([]identity.Identity, error)
+	DeleteKeepingLogin(ctx context.Context, userID uuid.UUID, provider string) (bool, error)
+}
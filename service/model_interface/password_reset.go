@@ -0,0 +1,13 @@
+package model_interface
+
+import (
+	"context"
+
+	"pcast-api/store/passwordreset"
+)
+
+type PasswordReset interface {
+	Create(ctx context.Context, token *passwordreset.PasswordResetToken) error
+	FindByHash(ctx context.Context, tokenHash string) (*passwordreset.PasswordResetToken, error)
+	Redeem(ctx context.Context, token *passwordreset.PasswordResetToken, passwordHash string) (bool, error)
+}
@@ -0,0 +1,14 @@
+package model_interface
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type RecoveryCode interface {
+	Replace(ctx context.Context, userID uuid.UUID, codeHashes []string) error
+	Use(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error)
+	CountUnused(ctx context.Context, userID uuid.UUID) (int, error)
+	DeleteByUserID(ctx context.Context, userID uuid.UUID) error
+}
@@ -0,0 +1,17 @@
+package model_interface
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"pcast-api/store/token"
+)
+
+type RefreshToken interface {
+	Create(ctx context.Context, token *token.RefreshToken) error
+	FindByHash(ctx context.Context, tokenHash string) (*token.RefreshToken, error)
+	MarkUsed(ctx context.Context, token *token.RefreshToken) (bool, error)
+	RevokeFamily(ctx context.Context, familyID uuid.UUID) error
+	RevokeByUserID(ctx context.Context, userID uuid.UUID) error
+}
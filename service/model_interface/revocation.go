@@ -0,0 +1,15 @@
+package model_interface
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Revocation stores revoked access tokens. Implemented for Postgres and Redis.
+type Revocation interface {
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	RevokeUserTokens(ctx context.Context, userID uuid.UUID, issuedBefore time.Time) error
+	IsRevoked(ctx context.Context, jti string, userID uuid.UUID, issuedAt time.Time) (bool, error)
+}
@@ -2,6 +2,8 @@ package model_interface
 
 import (
 	"context"
+	"time"
+
 	"github.com/google/uuid"
 	"pcast-api/store/user"
 )
@@ -11,9 +13,14 @@ type User interface {
 	Create(ctx context.Context, user *user.User) error
 	FindByID(ctx context.Context, id uuid.UUID) (*user.User, error)
 	FindByEmail(ctx context.Context, email string) (*user.User, error)
-	FindByGoogleID(ctx context.Context, googleID string) (*user.User, error)
 	Delete(ctx context.Context, user *user.User) error
 	Update(ctx context.Context, user *user.User) error
-	UpdateGoogleID(ctx context.Context, userID uuid.UUID, googleID string) error
 	CreateOAuthUser(ctx context.Context, user *user.User) error
+	MarkEmailVerified(ctx context.Context, user *user.User) error
+	SetTOTPSecret(ctx context.Context, user *user.User, secret []byte) error
+	EnableTOTP(ctx context.Context, user *user.User) error
+	DisableTOTP(ctx context.Context, user *user.User) error
+	UseTOTPStep(ctx context.Context, user *user.User, step int64) (bool, error)
+	TakeTOTPAttempt(ctx context.Context, user *user.User, maxAttempts int, lockout time.Duration) (bool, error)
+	ResetTOTPAttempts(ctx context.Context, user *user.User) error
 }
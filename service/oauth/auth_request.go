@@ -0,0 +1,88 @@
+package oauth
+
+import (
+	"net"
+	"net/url"
+
+	"golang.org/x/oauth2"
+
+	"pcast-api/service/auth"
+)
+
+// AuthRequest is a login in progress at a provider. The client keeps it between the redirect
+// to the provider and the callback, the provider only ever sees the state, nonce and S256 challenge.
+type AuthRequest struct {
+	// State is compared with the state of the callback against CSRF
+	State string `json:"state"`
+	// Verifier is the PKCE code verifier for the exchange of the authorization code
+	Verifier string `json:"verifier"`
+	// Nonce must be returned in the ID token, so a token of another login cannot be replayed
+	Nonce string `json:"nonce"`
+	// RedirectURI is the allow-listed page or app scheme the login returns to, empty to answer with JSON
+	RedirectURI string `json:"redirectUri,omitempty"`
+	// CodeChallenge is the S256 PKCE challenge of the app, the login or link code is bound to it
+	CodeChallenge string `json:"codeChallenge,omitempty"`
+	// Link marks a login that proves the ownership of an identity for a signed in user, it ends with a link code
+	Link bool `json:"link,omitempty"`
+}
+
+// NewAuthRequest starts a login. A login with a redirect URI ends with a login code for that URI,
+// which requires the URI to be allow-listed and the app to send the S256 challenge of its own verifier.
+// A login to link an identity always needs the challenge, the link code is bound to it.
+func (s *Service) NewAuthRequest(redirectURI string, codeChallenge string, link bool) (*AuthRequest, error) {
+	if redirectURI != "" && !redirectURIAllowed(s.redirectURIs, redirectURI) {
+		return nil, ErrRedirectURINotAllowed
+	}
+	// base64url of a SHA-256 hash without padding
+	if (redirectURI != "" || link) && len(codeChallenge) != 43 {
+		return nil, ErrInvalidCodeChallenge
+	}
+
+	state, err := auth.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := auth.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthRequest{
+		State:         state,
+		Verifier:      oauth2.GenerateVerifier(),
+		Nonce:         nonce,
+		RedirectURI:   redirectURI,
+		CodeChallenge: codeChallenge,
+		Link:          link,
+	}, nil
+}
+
+// redirectURIAllowed reports whether uri is one of the allowed URIs. Loopback URIs of native apps
+// match with any port, the port is picked by the operating system at runtime (RFC 8252, section 7.3).
+func redirectURIAllowed(allowed []string, uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" || u.Fragment != "" {
+		return false
+	}
+
+	for _, a := range allowed {
+		if a == uri {
+			return true
+		}
+
+		au, err := url.Parse(a)
+		if err != nil || !isLoopback(au) || !isLoopback(u) {
+			continue
+		}
+		if au.Hostname() == u.Hostname() && au.Path == u.Path && au.RawQuery == u.RawQuery {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isLoopback(u *url.URL) bool {
+	ip := net.ParseIP(u.Hostname())
+	return u.Scheme == "http" && u.User == nil && ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,139 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"pcast-api/config"
+)
+
+// OAuthProvider abstracts OAuth2 operations for testability, it is implemented by *oauth2.Config
+type OAuthProvider interface {
+	AuthCodeURL(state string, opts ...oauth2.AuthCodeOption) string
+	Exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error)
+}
+
+// Claims are the verified details of the account at the provider
+type Claims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// Provider is an OpenID Connect provider. The issuer is discovered on first use, so an unreachable
+// provider does not keep the API from starting. A failed discovery is retried on the next login.
+type Provider struct {
+	Name        string
+	DisplayName string
+	// LinkByEmail allows signing in to an existing account with the email of a new identity
+	LinkByEmail bool
+
+	config config.OAuthProvider
+	client *http.Client
+
+	mu       sync.Mutex
+	oidc     *oidc.Provider
+	oauth    OAuthProvider
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewProvider creates a provider that talks to the issuer with the given HTTP client
+func NewProvider(cfg config.OAuthProvider, client *http.Client) *Provider {
+	return &Provider{
+		Name:        cfg.Name,
+		DisplayName: cfg.DisplayName,
+		LinkByEmail: cfg.LinkByEmail,
+		config:      cfg,
+		client:      client,
+	}
+}
+
+// AuthCodeURL returns the URL of the consent screen of the provider. It carries the S256 challenge
+// of the PKCE verifier and the nonce of the request.
+func (p *Provider) AuthCodeURL(ctx context.Context, req *AuthRequest) (string, error) {
+	if err := p.discover(ctx); err != nil {
+		return "", err
+	}
+
+	return p.oauth.AuthCodeURL(req.State, oauth2.S256ChallengeOption(req.Verifier), oidc.Nonce(req.Nonce)), nil
+}
+
+// Authenticate exchanges the authorization code with the PKCE verifier of the request and verifies
+// the ID token of the response, including its nonce. The email is taken from the userinfo endpoint
+// if the ID token does not contain it.
+func (p *Provider) Authenticate(ctx context.Context, code string, req *AuthRequest) (*Claims, error) {
+	ctx, span := tracer.Start(ctx, "oauth.Authenticate")
+	defer span.End()
+
+	if err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx = oidc.ClientContext(ctx, p.client)
+
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(req.Verifier))
+	if err != nil {
+		return nil, ErrFailedExchange
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, ErrInvalidIDToken
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	// A token issued for another login must not be replayed into this one
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(req.Nonce)) != 1 {
+		return nil, ErrInvalidIDToken
+	}
+
+	var claims Claims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	if claims.Email == "" {
+		userInfo, err := p.oidc.UserInfo(ctx, oauth2.StaticTokenSource(token))
+		if err != nil || userInfo.Subject != claims.Subject {
+			return nil, ErrFailedUserInfo
+		}
+		claims.Email = userInfo.Email
+		claims.EmailVerified = userInfo.EmailVerified
+	}
+
+	return &claims, nil
+}
+
+// discover fetches the discovery document of the issuer, once it succeeded the result is kept
+func (p *Provider) discover(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oidc != nil {
+		return nil
+	}
+
+	discovered, err := oidc.NewProvider(oidc.ClientContext(ctx, p.client), p.config.Issuer)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrProviderUnavailable, p.Name, err)
+	}
+
+	p.oidc = discovered
+	p.oauth = &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		RedirectURL:  p.config.RedirectURL,
+		Scopes:       p.config.Scopes,
+		Endpoint:     discovered.Endpoint(),
+	}
+	p.verifier = discovered.Verifier(&oidc.Config{ClientID: p.config.ClientID})
+	return nil
+}
@@ -2,193 +2,362 @@ package oauth
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"io"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
+	"go.opentelemetry.io/otel"
 
 	"pcast-api/config"
+	"pcast-api/metrics"
 	"pcast-api/service/auth"
 	modelInterface "pcast-api/service/model_interface"
+	userService "pcast-api/service/user"
+	identityStore "pcast-api/store/identity"
 	store "pcast-api/store/user"
 )
 
+var tracer = otel.Tracer("pcast-api/service/oauth")
+
 var (
-	ErrFailedExchange      = errors.New("failed to exchange authorization code")
-	ErrFailedUserInfo      = errors.New("failed to fetch user info from Google")
-	ErrUnverifiedEmail     = errors.New("email not verified by Google")
-	ErrGoogleNotConfigured = errors.New("Google OAuth is not configured")
+	ErrFailedExchange        = errors.New("failed to exchange authorization code")
+	ErrInvalidIDToken        = errors.New("invalid ID token")
+	ErrFailedUserInfo        = errors.New("failed to fetch user info from the provider")
+	ErrUnverifiedEmail       = errors.New("email not verified by the provider")
+	ErrUnknownProvider       = errors.New("unknown OAuth provider")
+	ErrProviderUnavailable   = errors.New("OAuth provider is unavailable")
+	ErrRedirectURINotAllowed = errors.New("redirect URI is not allowed")
+	ErrInvalidCodeChallenge  = errors.New("redirect URI and link require an S256 code challenge")
+	ErrIdentityNotFound      = errors.New("no identity of this provider is linked")
+	ErrIdentityLinked        = errors.New("identity is linked to another account")
+	ErrProviderLinked        = errors.New("another identity of this provider is already linked")
+	ErrLastLoginMethod       = errors.New("identity is the last way to sign in, set a password first")
+	ErrUnverifiedAccount     = errors.New("account with this email is not verified, sign in and link the identity")
+	ErrAccountExists         = errors.New("account with this email exists, sign in and link the identity")
 )
 
-// GoogleUserInfo represents the user info returned by Google's userinfo API
-type GoogleUserInfo struct {
-	ID            string `json:"id"`
-	Email         string `json:"email"`
-	VerifiedEmail bool   `json:"verified_email"`
-	Name          string `json:"name"`
-	Picture       string `json:"picture"`
+// CallbackResult is the outcome of a login at a provider. A login with a redirect URI only gets
+// a LoginCode for the app, which exchanges it for the LoginResult at ExchangeLoginCode.
+// A login to link an identity only gets a LinkCode for LinkIdentity.
+type CallbackResult struct {
+	Login       *userService.LoginResult
+	LoginCode   string
+	LinkCode    string
+	RedirectURI string
 }
 
-// OAuthProvider abstracts OAuth2 operations for testability
-type OAuthProvider interface {
-	AuthCodeURL(state string, opts ...oauth2.AuthCodeOption) string
-	Exchange(ctx context.Context, code string) (*oauth2.Token, error)
-	Client(ctx context.Context, token *oauth2.Token) *http.Client
+type Service struct {
+	userStore    modelInterface.User
+	identities   modelInterface.Identity
+	providers    []*Provider
+	tokens       *auth.TokenService
+	redirectURIs []string
 }
 
-// oauth2ConfigAdapter adapts oauth2.Config to OAuthProvider interface
-type oauth2ConfigAdapter struct {
-	config *oauth2.Config
+// NewService creates the providers of the [[oauth.providers]] config, they use client for all requests to the issuers
+func NewService(cfg *config.Config, userStore modelInterface.User, identities modelInterface.Identity, tokens *auth.TokenService, client *http.Client) *Service {
+	providers := make([]*Provider, len(cfg.OAuth.Providers))
+	for i, providerConfig := range cfg.OAuth.Providers {
+		providers[i] = NewProvider(providerConfig, client)
+	}
+
+	service := NewServiceWithProviders(userStore, identities, tokens, providers...)
+	service.redirectURIs = cfg.OAuth.RedirectURIs
+	return service
 }
 
-func (a *oauth2ConfigAdapter) AuthCodeURL(state string, opts ...oauth2.AuthCodeOption) string {
-	return a.config.AuthCodeURL(state, opts...)
+// NewServiceWithProviders creates a service with custom providers (for testing)
+func NewServiceWithProviders(userStore modelInterface.User, identities modelInterface.Identity, tokens *auth.TokenService, providers ...*Provider) *Service {
+	return &Service{
+		userStore:  userStore,
+		identities: identities,
+		providers:  providers,
+		tokens:     tokens,
+	}
 }
 
-func (a *oauth2ConfigAdapter) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
-	return a.config.Exchange(ctx, code)
+// Providers returns the configured providers in config order
+func (s *Service) Providers() []*Provider {
+	return s.providers
 }
 
-func (a *oauth2ConfigAdapter) Client(ctx context.Context, token *oauth2.Token) *http.Client {
-	return a.config.Client(ctx, token)
+// GetAuthURL returns the URL to redirect the user to the consent screen of the provider
+func (s *Service) GetAuthURL(ctx context.Context, provider string, req *AuthRequest) (string, error) {
+	ctx, span := tracer.Start(ctx, "oauth.GetAuthURL")
+	defer span.End()
+
+	p, err := s.provider(provider)
+	if err != nil {
+		return "", err
+	}
+
+	return p.AuthCodeURL(ctx, req)
 }
 
-type Service struct {
-	userStore        modelInterface.User
-	googleProvider   OAuthProvider
-	jwtSecret        string
-	jwtExpirationMin int
-}
-
-func NewService(cfg *config.Config, userStore modelInterface.User) *Service {
-	var googleProvider OAuthProvider
-	if cfg.Auth.GoogleClientID != "" && cfg.Auth.GoogleClientSecret != "" {
-		googleProvider = &oauth2ConfigAdapter{
-			config: &oauth2.Config{
-				ClientID:     cfg.Auth.GoogleClientID,
-				ClientSecret: cfg.Auth.GoogleClientSecret,
-				RedirectURL:  cfg.Auth.GoogleRedirectURL,
-				Scopes:       []string{"openid", "email", "profile"},
-				Endpoint:     google.Endpoint,
-			},
+// HandleCallback exchanges the authorization code of the request, verifies the ID token and signs in
+// the user of the identity. Unknown identities get a new account or, if the provider allows linking by email,
+// are linked to the verified account with the same email. If the user enabled 2FA, the result is a challenge like for a password login.
+func (s *Service) HandleCallback(ctx context.Context, provider string, code string, req *AuthRequest) (_ *CallbackResult, err error) {
+	ctx, span := tracer.Start(ctx, "oauth.HandleCallback")
+	defer span.End()
+
+	// Linking an identity is no login
+	defer func() {
+		if !req.Link {
+			metrics.ObserveLogin(metrics.LoginOAuth, err)
 		}
+	}()
+
+	p, err := s.provider(provider)
+	if err != nil {
+		return nil, err
+	}
+	// The request comes back from the client, the allow-list may also have changed in the meantime
+	if req.RedirectURI != "" && !redirectURIAllowed(s.redirectURIs, req.RedirectURI) {
+		return nil, ErrRedirectURINotAllowed
+	}
+	// A link code without challenge could be linked to any account by whoever intercepts it
+	if req.Link && req.CodeChallenge == "" {
+		return nil, ErrInvalidCodeChallenge
 	}
 
-	return &Service{
-		userStore:        userStore,
-		googleProvider:   googleProvider,
-		jwtSecret:        cfg.Auth.JwtSecret,
-		jwtExpirationMin: cfg.Auth.JwtExpirationMin,
+	claims, err := p.Authenticate(ctx, code, req)
+	if err != nil {
+		return nil, err
 	}
-}
 
-// NewServiceWithProvider creates a service with a custom OAuth provider (for testing)
-func NewServiceWithProvider(userStore modelInterface.User, provider OAuthProvider, jwtSecret string, jwtExpirationMin int) *Service {
-	return &Service{
-		userStore:        userStore,
-		googleProvider:   provider,
-		jwtSecret:        jwtSecret,
-		jwtExpirationMin: jwtExpirationMin,
+	if req.Link {
+		link := &auth.LinkCode{Provider: p.Name, Subject: claims.Subject, Email: claims.Email, EmailVerified: claims.EmailVerified}
+		linkCode, err := s.tokens.IssueLinkCode(link, req.CodeChallenge)
+		if err != nil {
+			return nil, err
+		}
+		return &CallbackResult{LinkCode: linkCode, RedirectURI: req.RedirectURI}, nil
+	}
+
+	user, err := s.findOrCreateUser(ctx, p, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.RedirectURI != "" {
+		loginCode, err := s.tokens.IssueLoginCode(user.ID, req.CodeChallenge)
+		if err != nil {
+			return nil, err
+		}
+		return &CallbackResult{LoginCode: loginCode, RedirectURI: req.RedirectURI}, nil
+	}
+
+	result, err := s.login(ctx, user)
+	if err != nil {
+		return nil, err
 	}
+	return &CallbackResult{Login: result}, nil
 }
 
-// GetGoogleAuthURL returns the URL to redirect user to Google's OAuth consent screen
-func (s *Service) GetGoogleAuthURL(state string) (string, error) {
-	if s.googleProvider == nil {
-		return "", ErrGoogleNotConfigured
+// ExchangeLoginCode signs in the user of a login code, the verifier must match the challenge the app
+// started the login with. If the user enabled 2FA, the result is a challenge like for a password login.
+func (s *Service) ExchangeLoginCode(ctx context.Context, code string, verifier string) (*userService.LoginResult, error) {
+	ctx, span := tracer.Start(ctx, "oauth.ExchangeLoginCode")
+	defer span.End()
+
+	userID, err := s.tokens.RedeemLoginCode(code, verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userStore.FindByID(ctx, userID)
+	if err != nil {
+		return nil, auth.ErrInvalidLoginCode
 	}
-	return s.googleProvider.AuthCodeURL(state, oauth2.AccessTypeOffline), nil
+
+	return s.login(ctx, user)
 }
 
-// HandleGoogleCallback exchanges the authorization code for tokens,
-// fetches user info, and creates or links the user account
-func (s *Service) HandleGoogleCallback(ctx context.Context, code string) (string, error) {
-	if s.googleProvider == nil {
-		return "", ErrGoogleNotConfigured
+// Identities returns the identities linked to the user
+func (s *Service) Identities(ctx context.Context, userID uuid.UUID) ([]identityStore.Identity, error) {
+	ctx, span := tracer.Start(ctx, "oauth.Identities")
+	defer span.End()
+
+	return s.identities.FindByUserID(ctx, userID)
+}
+
+// LinkIdentity links the identity of a link code to the user. Unlike the automatic linking of a login,
+// the email of the identity does not matter, the user proved to own both accounts. If the provider
+// verified the email of the account, the email of the user counts as verified.
+func (s *Service) LinkIdentity(ctx context.Context, userID uuid.UUID, code string, verifier string) (*identityStore.Identity, error) {
+	ctx, span := tracer.Start(ctx, "oauth.LinkIdentity")
+	defer span.End()
+
+	link, err := s.tokens.RedeemLinkCode(code, verifier)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.provider(link.Provider); err != nil {
+		return nil, err
+	}
+
+	if existing, err := s.identities.FindByProviderSubject(ctx, link.Provider, link.Subject); err == nil && existing != nil {
+		if existing.UserID != userID {
+			return nil, ErrIdentityLinked
+		}
+		return existing, nil
 	}
 
-	// Exchange authorization code for access token
-	token, err := s.googleProvider.Exchange(ctx, code)
+	identities, err := s.identities.FindByUserID(ctx, userID)
 	if err != nil {
-		return "", ErrFailedExchange
+		return nil, err
+	}
+	for _, identity := range identities {
+		if identity.Provider == link.Provider {
+			return nil, ErrProviderLinked
+		}
 	}
 
-	// Fetch user info from Google
-	userInfo, err := s.fetchGoogleUserInfo(ctx, token)
+	user, err := s.userStore.FindByID(ctx, userID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	// Ensure the email is verified
-	if !userInfo.VerifiedEmail {
-		return "", ErrUnverifiedEmail
+	identity := &identityStore.Identity{
+		UserID:   userID,
+		Provider: link.Provider,
+		Subject:  link.Subject,
+		Email:    link.Email,
+	}
+	if err := s.identities.Create(ctx, identity); err != nil {
+		return nil, err
 	}
 
-	// Try to find existing user by Google ID
-	user, err := s.userStore.FindByGoogleID(ctx, userInfo.ID)
-	if err == nil && user != nil {
-		// User exists with this Google ID, create JWT and return
-		return auth.CreateJWTToken(user.ID, s.jwtSecret, s.jwtExpirationMin)
+	if err := s.markEmailVerified(ctx, user, link.Email, link.EmailVerified); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// UnlinkIdentity removes the identity of the provider from the user. The last identity of a user
+// without password is kept, the account could not be signed in to anymore.
+func (s *Service) UnlinkIdentity(ctx context.Context, userID uuid.UUID, provider string) error {
+	ctx, span := tracer.Start(ctx, "oauth.UnlinkIdentity")
+	defer span.End()
+
+	identities, err := s.identities.FindByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	linked := false
+	for _, identity := range identities {
+		if identity.Provider == provider {
+			linked = true
+		}
+	}
+	if !linked {
+		return ErrIdentityNotFound
+	}
+
+	deleted, err := s.identities.DeleteKeepingLogin(ctx, userID, provider)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrLastLoginMethod
+	}
+	return nil
+}
+
+// findOrCreateUser returns the user of the identity, linking or creating an account for new identities
+func (s *Service) findOrCreateUser(ctx context.Context, p *Provider, claims *Claims) (*store.User, error) {
+	// Try to find the user by the linked identity
+	identity, err := s.identities.FindByProviderSubject(ctx, p.Name, claims.Subject)
+	if err == nil && identity != nil {
+		return s.userStore.FindByID(ctx, identity.UserID)
+	}
+
+	// Linking or creating an account relies on the provider having verified the address
+	if !claims.EmailVerified {
+		return nil, ErrUnverifiedEmail
 	}
 
 	// Try to find existing user by email (for account linking)
-	user, err = s.userStore.FindByEmail(ctx, userInfo.Email)
+	user, err := s.userStore.FindByEmail(ctx, claims.Email)
 	if err == nil && user != nil {
-		// User exists with this email, link Google account
-		if err := s.userStore.UpdateGoogleID(ctx, user.ID, userInfo.ID); err != nil {
-			return "", err
+		if !p.LinkByEmail {
+			return nil, ErrAccountExists
+		}
+		// Anyone could have registered the address with a password of their own and would keep access
+		// to the account, its owner has to sign in and link the identity instead
+		if user.EmailVerifiedAt == nil {
+			return nil, ErrUnverifiedAccount
+		}
+		if err := s.identities.Create(ctx, newIdentity(user.ID, p.Name, claims)); err != nil {
+			return nil, err
+		}
+		if err := s.markEmailVerified(ctx, user, claims.Email, claims.EmailVerified); err != nil {
+			return nil, err
 		}
-		return auth.CreateJWTToken(user.ID, s.jwtSecret, s.jwtExpirationMin)
+		return user, nil
 	}
 
-	// Create new OAuth user
+	// Create new OAuth user, the address is verified by the provider
+	now := time.Now()
 	newUser := &store.User{
-		Email:    userInfo.Email,
-		GoogleID: &userInfo.ID,
+		Email:           claims.Email,
+		EmailVerifiedAt: &now,
 	}
 
 	if err := s.userStore.CreateOAuthUser(ctx, newUser); err != nil {
-		return "", err
+		return nil, err
+	}
+	if err := s.identities.Create(ctx, newIdentity(newUser.ID, p.Name, claims)); err != nil {
+		// Don't leave an account behind that nobody can sign in to
+		_ = s.userStore.Delete(ctx, newUser)
+		return nil, err
 	}
 
-	return auth.CreateJWTToken(newUser.ID, s.jwtSecret, s.jwtExpirationMin)
+	return newUser, nil
 }
 
-// fetchGoogleUserInfo fetches user info from Google's userinfo API
-func (s *Service) fetchGoogleUserInfo(ctx context.Context, token *oauth2.Token) (*GoogleUserInfo, error) {
-	client := s.googleProvider.Client(ctx, token)
-	resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
-	if err != nil {
-		return nil, ErrFailedUserInfo
+// markEmailVerified verifies the email of the user with a linked identity, if the provider verified the same address
+func (s *Service) markEmailVerified(ctx context.Context, user *store.User, email string, verified bool) error {
+	if !verified || email != user.Email || user.EmailVerifiedAt != nil {
+		return nil
 	}
-	defer resp.Body.Close()
+	return s.userStore.MarkEmailVerified(ctx, user)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, ErrFailedUserInfo
+// login issues the tokens of the user or, with 2FA enabled, a challenge for the second factor
+func (s *Service) login(ctx context.Context, user *store.User) (*userService.LoginResult, error) {
+	if user.TOTPEnabledAt != nil {
+		challenge, err := s.tokens.IssueChallenge(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &userService.LoginResult{ChallengeToken: challenge}, nil
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	tokens, err := s.tokens.Issue(ctx, user.ID)
 	if err != nil {
-		return nil, ErrFailedUserInfo
+		return nil, err
 	}
+	return &userService.LoginResult{Tokens: tokens}, nil
+}
 
-	var userInfo GoogleUserInfo
-	if err := json.Unmarshal(body, &userInfo); err != nil {
-		return nil, ErrFailedUserInfo
+func (s *Service) provider(name string) (*Provider, error) {
+	for _, p := range s.providers {
+		if p.Name == name {
+			return p, nil
+		}
 	}
-
-	return &userInfo, nil
+	return nil, ErrUnknownProvider
 }
 
-// GenerateState generates a random state string for CSRF protection
-func GenerateState() (string, error) {
-	id, err := uuid.NewV7()
-	if err != nil {
-		return "", err
+func newIdentity(userID uuid.UUID, provider string, claims *Claims) *identityStore.Identity {
+	return &identityStore.Identity{
+		UserID:   userID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
 	}
-	return id.String(), nil
 }
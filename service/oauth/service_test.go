@@ -2,16 +2,29 @@ package oauth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/oauth2"
 
+	"pcast-api/config"
+	"pcast-api/service/auth"
+	identityStore "pcast-api/store/identity"
+	tokenStore "pcast-api/store/token"
 	store "pcast-api/store/user"
 )
 
@@ -20,14 +33,43 @@ func strPtr(s string) *string {
 	return &s
 }
 
+// mockRefreshTokenStore implements modelInterface.RefreshToken for testing
+type mockRefreshTokenStore struct{}
+
+func (m *mockRefreshTokenStore) Create(ctx context.Context, token *tokenStore.RefreshToken) error {
+	return nil
+}
+
+func (m *mockRefreshTokenStore) FindByHash(ctx context.Context, tokenHash string) (*tokenStore.RefreshToken, error) {
+	return nil, errors.New("not found")
+}
+
+func (m *mockRefreshTokenStore) MarkUsed(ctx context.Context, token *tokenStore.RefreshToken) (bool, error) {
+	return true, nil
+}
+
+func (m *mockRefreshTokenStore) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	return nil
+}
+
+func (m *mockRefreshTokenStore) RevokeByUserID(ctx context.Context, userID uuid.UUID) error {
+	return nil
+}
+
+func newTokenService() *auth.TokenService {
+	return auth.NewTokenService(&mockRefreshTokenStore{}, nil, auth.NewHMACKeys("secret"), 60, 30)
+}
+
 // mockUserStore implements modelInterface.User for testing
 type mockUserStore struct {
-	user              *store.User
-	users             []store.User
-	findByGoogleIDErr error
-	findByEmailErr    error
-	createErr         error
-	updateErr         error
+	user           *store.User
+	users          []store.User
+	findByEmailErr error
+	createErr      error
+	created        *store.User
+	deleted        *store.User
+	updateErr      error
+	verified       bool
 }
 
 func (m *mockUserStore) FindAll(ctx context.Context) ([]store.User, error) {
@@ -45,13 +87,6 @@ func (m *mockUserStore) FindByEmail(ctx context.Context, email string) (*store.U
 	return m.user, nil
 }
 
-func (m *mockUserStore) FindByGoogleID(ctx context.Context, googleID string) (*store.User, error) {
-	if m.findByGoogleIDErr != nil {
-		return nil, m.findByGoogleIDErr
-	}
-	return m.user, nil
-}
-
 func (m *mockUserStore) Create(ctx context.Context, user *store.User) error {
 	return m.createErr
 }
@@ -64,6 +99,7 @@ func (m *mockUserStore) CreateOAuthUser(ctx context.Context, user *store.User) e
 	if user.ID == uuid.Nil {
 		user.ID = uuid.Must(uuid.NewV7())
 	}
+	m.created = user
 	return nil
 }
 
@@ -71,295 +107,760 @@ func (m *mockUserStore) Update(ctx context.Context, user *store.User) error {
 	return m.updateErr
 }
 
-func (m *mockUserStore) UpdateGoogleID(ctx context.Context, userID uuid.UUID, googleID string) error {
+func (m *mockUserStore) Delete(ctx context.Context, user *store.User) error {
+	m.deleted = user
+	return nil
+}
+
+func (m *mockUserStore) MarkEmailVerified(ctx context.Context, user *store.User) error {
+	m.verified = true
+	return m.updateErr
+}
+
+func (m *mockUserStore) SetTOTPSecret(ctx context.Context, user *store.User, secret []byte) error {
 	return m.updateErr
 }
 
-func (m *mockUserStore) Delete(ctx context.Context, user *store.User) error {
+func (m *mockUserStore) EnableTOTP(ctx context.Context, user *store.User) error {
+	return m.updateErr
+}
+
+func (m *mockUserStore) DisableTOTP(ctx context.Context, user *store.User) error {
+	return m.updateErr
+}
+
+func (m *mockUserStore) UseTOTPStep(ctx context.Context, user *store.User, step int64) (bool, error) {
+	return true, m.updateErr
+}
+
+func (m *mockUserStore) TakeTOTPAttempt(ctx context.Context, user *store.User, maxAttempts int, lockout time.Duration) (bool, error) {
+	return true, m.updateErr
+}
+
+func (m *mockUserStore) ResetTOTPAttempts(ctx context.Context, user *store.User) error {
+	return m.updateErr
+}
+
+// mockIdentityStore implements modelInterface.Identity for testing
+type mockIdentityStore struct {
+	identities []identityStore.Identity
+	createErr  error
+	// password tells DeleteKeepingLogin that the users have a password
+	password bool
+}
+
+func (m *mockIdentityStore) Create(ctx context.Context, identity *identityStore.Identity) error {
+	if m.createErr != nil {
+		return m.createErr
+	}
+	m.identities = append(m.identities, *identity)
 	return nil
 }
 
-// mockOAuthProvider implements OAuthProvider for testing
-type mockOAuthProvider struct {
-	authCodeURL  string
-	token        *oauth2.Token
-	exchangeErr  error
-	httpClient   *http.Client
+func (m *mockIdentityStore) FindByProviderSubject(ctx context.Context, provider string, subject string) (*identityStore.Identity, error) {
+	for _, identity := range m.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, errors.New("not found")
 }
 
-func (m *mockOAuthProvider) AuthCodeURL(state string, opts ...oauth2.AuthCodeOption) string {
-	return m.authCodeURL
+func (m *mockIdentityStore) FindByUserID(ctx context.Context, userID uuid.UUID) ([]identityStore.Identity, error) {
+	var identities []identityStore.Identity
+	for _, identity := range m.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
 }
 
-func (m *mockOAuthProvider) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
-	if m.exchangeErr != nil {
-		return nil, m.exchangeErr
+func (m *mockIdentityStore) DeleteKeepingLogin(ctx context.Context, userID uuid.UUID, provider string) (bool, error) {
+	identities, _ := m.FindByUserID(ctx, userID)
+	if !m.password && len(identities) < 2 {
+		return false, nil
+	}
+
+	for i, identity := range m.identities {
+		if identity.UserID == userID && identity.Provider == provider {
+			m.identities = append(m.identities[:i], m.identities[i+1:]...)
+			return true, nil
+		}
 	}
-	return m.token, nil
+	return false, nil
 }
 
-func (m *mockOAuthProvider) Client(ctx context.Context, token *oauth2.Token) *http.Client {
-	return m.httpClient
+// fakeIssuer is a local OpenID Connect provider. The token endpoint accepts the code "valid-code"
+// and returns an ID token with the claims of the test.
+type fakeIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// claims are added to the ID token, they override the defaults
+	claims   jwt.MapClaims
+	userInfo map[string]any
+	// codeChallenge is the PKCE challenge of the last authorization, the token endpoint checks the verifier against it
+	codeChallenge string
 }
 
-func TestGenerateState(t *testing.T) {
-	state, err := GenerateState()
-	assert.NoError(t, err)
-	assert.NotEmpty(t, state)
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
 
-	// Should be a valid UUID
-	_, err = uuid.Parse(state)
-	assert.NoError(t, err)
+	f := &fakeIssuer{
+		key: key,
+		claims: jwt.MapClaims{
+			"sub":            "subject-123",
+			"email":          "test@example.com",
+			"email_verified": true,
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                f.server.URL,
+			"authorization_endpoint":                f.server.URL + "/auth",
+			"token_endpoint":                        f.server.URL + "/token",
+			"jwks_uri":                              f.server.URL + "/keys",
+			"userinfo_endpoint":                     f.server.URL + "/userinfo",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("code") != "valid-code" ||
+			oauth2.S256ChallengeFromVerifier(r.PostForm.Get("code_verifier")) != f.codeChallenge {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant"}`))
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     f.idToken(t),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if f.userInfo == nil || r.Header.Get("Authorization") != "Bearer access-token" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(f.userInfo)
+	})
+
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+
+	return f
 }
 
-func TestService_GetGoogleAuthURL_Success(t *testing.T) {
-	provider := &mockOAuthProvider{
-		authCodeURL: "https://accounts.google.com/o/oauth2/auth?client_id=test",
+func (f *fakeIssuer) idToken(t *testing.T) string {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": f.server.URL,
+		"aud": "client-id",
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
 	}
-	service := NewServiceWithProvider(nil, provider, "secret", 60)
+	for name, value := range f.claims {
+		claims[name] = value
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(f.key)
+	require.NoError(t, err)
+	return signed
+}
+
+func (f *fakeIssuer) provider() *Provider {
+	return NewProvider(config.OAuthProvider{
+		Name:         "fake",
+		DisplayName:  "Fake",
+		Issuer:       f.server.URL,
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://localhost/api/auth/fake/callback",
+		Scopes:       config.DefaultOAuthScopes,
+	}, f.server.Client())
+}
 
-	url, err := service.GetGoogleAuthURL("test-state")
+// authorize starts a login at the issuer like the consent screen would, the ID token gets the nonce of the request
+func (f *fakeIssuer) authorize(t *testing.T, service *Service) *AuthRequest {
+	req, err := service.NewAuthRequest("", "", false)
+	require.NoError(t, err)
+
+	authURL, err := service.GetAuthURL(context.Background(), "fake", req)
+	require.NoError(t, err)
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+
+	f.codeChallenge = parsed.Query().Get("code_challenge")
+	f.claims["nonce"] = parsed.Query().Get("nonce")
+	return req
+}
+
+func newService(t *testing.T, userStore *mockUserStore, identities *mockIdentityStore) (*Service, *fakeIssuer) {
+	issuer := newFakeIssuer(t)
+	return NewServiceWithProviders(userStore, identities, newTokenService(), issuer.provider()), issuer
+}
+
+func TestNewService_Providers(t *testing.T) {
+	cfg := &config.Config{OAuth: config.OAuth{Providers: []config.OAuthProvider{
+		{Name: "google", DisplayName: "Google", Issuer: config.GoogleIssuer, ClientID: "id"},
+		{Name: "keycloak", DisplayName: "Keycloak", Issuer: "http://localhost:8180/realms/pcast", ClientID: "id"},
+	}}}
+
+	// Creating the service does not contact the providers
+	service := NewService(cfg, nil, nil, newTokenService(), http.DefaultClient)
+
+	providers := service.Providers()
+	require.Len(t, providers, 2)
+	assert.Equal(t, "google", providers[0].Name)
+	assert.Equal(t, "Keycloak", providers[1].DisplayName)
+}
+
+func TestService_GetAuthURL_Success(t *testing.T) {
+	service, issuer := newService(t, &mockUserStore{}, &mockIdentityStore{})
+
+	req, err := service.NewAuthRequest("", "", false)
+	require.NoError(t, err)
+
+	authURL, err := service.GetAuthURL(context.Background(), "fake", req)
 	assert.NoError(t, err)
-	assert.Equal(t, "https://accounts.google.com/o/oauth2/auth?client_id=test", url)
+	assert.True(t, strings.HasPrefix(authURL, issuer.server.URL+"/auth?"))
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+	query := parsed.Query()
+	assert.Equal(t, "client-id", query.Get("client_id"))
+	assert.Equal(t, req.State, query.Get("state"))
+	assert.Equal(t, req.Nonce, query.Get("nonce"))
+	assert.Equal(t, "openid email profile", query.Get("scope"))
+	// Only the challenge leaves the server, the verifier is sent with the code exchange
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, oauth2.S256ChallengeFromVerifier(req.Verifier), query.Get("code_challenge"))
+	assert.NotContains(t, authURL, req.Verifier)
 }
 
-func TestService_GetGoogleAuthURL_NotConfigured(t *testing.T) {
-	service := NewServiceWithProvider(nil, nil, "secret", 60)
+func TestService_GetAuthURL_UnknownProvider(t *testing.T) {
+	service, _ := newService(t, &mockUserStore{}, &mockIdentityStore{})
 
-	url, err := service.GetGoogleAuthURL("test-state")
-	assert.Error(t, err)
-	assert.Equal(t, ErrGoogleNotConfigured, err)
-	assert.Empty(t, url)
+	authURL, err := service.GetAuthURL(context.Background(), "unknown", &AuthRequest{State: "test-state"})
+	assert.Equal(t, ErrUnknownProvider, err)
+	assert.Empty(t, authURL)
 }
 
-func TestService_HandleGoogleCallback_NotConfigured(t *testing.T) {
-	service := NewServiceWithProvider(nil, nil, "secret", 60)
+func TestService_GetAuthURL_ProviderUnavailable(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	provider := issuer.provider()
+	issuer.server.Close()
+	service := NewServiceWithProviders(&mockUserStore{}, &mockIdentityStore{}, newTokenService(), provider)
 
-	token, err := service.HandleGoogleCallback(context.Background(), "code")
-	assert.Error(t, err)
-	assert.Equal(t, ErrGoogleNotConfigured, err)
-	assert.Empty(t, token)
+	authURL, err := service.GetAuthURL(context.Background(), "fake", &AuthRequest{State: "test-state"})
+	assert.ErrorIs(t, err, ErrProviderUnavailable)
+	assert.Empty(t, authURL)
 }
 
-func TestService_HandleGoogleCallback_ExchangeFails(t *testing.T) {
-	provider := &mockOAuthProvider{
-		exchangeErr: errors.New("exchange failed"),
-	}
-	service := NewServiceWithProvider(nil, provider, "secret", 60)
+func TestService_HandleCallback_UnknownProvider(t *testing.T) {
+	service, issuer := newService(t, &mockUserStore{}, &mockIdentityStore{})
 
-	token, err := service.HandleGoogleCallback(context.Background(), "invalid-code")
-	assert.Error(t, err)
+	result, err := service.HandleCallback(context.Background(), "unknown", "valid-code", issuer.authorize(t, service))
+	assert.Equal(t, ErrUnknownProvider, err)
+	assert.Nil(t, result)
+}
+
+func TestService_HandleCallback_ExchangeFails(t *testing.T) {
+	service, issuer := newService(t, &mockUserStore{}, &mockIdentityStore{})
+
+	result, err := service.HandleCallback(context.Background(), "fake", "invalid-code", issuer.authorize(t, service))
 	assert.Equal(t, ErrFailedExchange, err)
-	assert.Empty(t, token)
+	assert.Nil(t, result)
 }
 
-func TestService_HandleGoogleCallback_ExistingGoogleUser(t *testing.T) {
-	userID := uuid.Must(uuid.NewV7())
-	existingUser := &store.User{
-		ID:       userID,
-		Email:    "test@example.com",
-		GoogleID: strPtr("google123"),
+func TestService_HandleCallback_InvalidIDToken(t *testing.T) {
+	for name, claims := range map[string]jwt.MapClaims{
+		"audience": {"aud": "other-client"},
+		"issuer":   {"iss": "https://evil.example.com"},
+		"expired":  {"exp": time.Now().Add(-time.Hour).Unix()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			service, issuer := newService(t, &mockUserStore{}, &mockIdentityStore{})
+			for claim, value := range claims {
+				issuer.claims[claim] = value
+			}
+
+			result, err := service.HandleCallback(context.Background(), "fake", "valid-code", issuer.authorize(t, service))
+			assert.Equal(t, ErrInvalidIDToken, err)
+			assert.Nil(t, result)
+		})
 	}
+}
 
-	userStore := &mockUserStore{
-		user: existingUser,
-	}
+func TestService_HandleCallback_ExistingIdentity(t *testing.T) {
+	userID := uuid.Must(uuid.NewV7())
+	userStore := &mockUserStore{user: &store.User{ID: userID, Email: "test@example.com"}}
+	identities := &mockIdentityStore{identities: []identityStore.Identity{
+		{UserID: userID, Provider: "fake", Subject: "subject-123", Email: "test@example.com"},
+	}}
+	service, issuer := newService(t, userStore, identities)
+	// The identity is known, the email at the provider does not matter anymore
+	issuer.claims["email_verified"] = false
+
+	result, err := service.HandleCallback(context.Background(), "fake", "valid-code", issuer.authorize(t, service))
+	assert.NoError(t, err)
+	require.NotNil(t, result)
+	assert.NotNil(t, result.Login.Tokens)
+	assert.Empty(t, result.Login.ChallengeToken)
+	assert.Nil(t, userStore.created)
+	assert.Len(t, identities.identities, 1)
+}
 
-	// Create a test server that returns Google user info
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		userInfo := GoogleUserInfo{
-			ID:            "google123",
-			Email:         "test@example.com",
-			VerifiedEmail: true,
-			Name:          "Test User",
-		}
-		json.NewEncoder(w).Encode(userInfo)
-	}))
-	defer server.Close()
+func TestService_HandleCallback_TwoFactor(t *testing.T) {
+	userID := uuid.Must(uuid.NewV7())
+	enabledAt := time.Now()
+	userStore := &mockUserStore{user: &store.User{ID: userID, Email: "test@example.com", TOTPEnabledAt: &enabledAt}}
+	identities := &mockIdentityStore{identities: []identityStore.Identity{
+		{UserID: userID, Provider: "fake", Subject: "subject-123", Email: "test@example.com"},
+	}}
+	tokens := newTokenService()
+	issuer := newFakeIssuer(t)
+	service := NewServiceWithProviders(userStore, identities, tokens, issuer.provider())
+
+	result, err := service.HandleCallback(context.Background(), "fake", "valid-code", issuer.authorize(t, service))
+	assert.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Nil(t, result.Login.Tokens)
 
-	provider := &mockOAuthProvider{
-		token:      &oauth2.Token{AccessToken: "test-token"},
-		httpClient: server.Client(),
-	}
-	// Override the client to use our test server
-	provider.httpClient = &http.Client{
-		Transport: &testTransport{server: server},
-	}
+	challengedID, err := tokens.VerifyChallenge(result.Login.ChallengeToken)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, challengedID)
+}
 
-	service := NewServiceWithProvider(userStore, provider, "secret", 60)
+func TestService_HandleCallback_LinkExistingEmailUser(t *testing.T) {
+	userID := uuid.Must(uuid.NewV7())
+	verifiedAt := time.Now()
+	existingUser := &store.User{
+		ID:              userID,
+		Email:           "test@example.com",
+		Password:        strPtr("hashedpassword"),
+		EmailVerifiedAt: &verifiedAt,
+	}
+	userStore := &mockUserStore{user: existingUser}
+	identities := &mockIdentityStore{}
+	service, issuer := newService(t, userStore, identities)
+	service.Providers()[0].LinkByEmail = true
 
-	token, err := service.HandleGoogleCallback(context.Background(), "valid-code")
+	result, err := service.HandleCallback(context.Background(), "fake", "valid-code", issuer.authorize(t, service))
 	assert.NoError(t, err)
-	assert.NotEmpty(t, token)
+	require.NotNil(t, result)
+	assert.NotNil(t, result.Login.Tokens)
+	require.Len(t, identities.identities, 1)
+	assert.Equal(t, identityStore.Identity{UserID: userID, Provider: "fake", Subject: "subject-123", Email: "test@example.com"}, identities.identities[0])
 }
 
-func TestService_HandleGoogleCallback_LinkExistingEmailUser(t *testing.T) {
-	userID := uuid.Must(uuid.NewV7())
+func TestService_HandleCallback_UnverifiedExistingEmailUser(t *testing.T) {
+	// Registered by someone else with the address of the owner of the identity
 	existingUser := &store.User{
-		ID:       userID,
+		ID:       uuid.Must(uuid.NewV7()),
 		Email:    "test@example.com",
 		Password: strPtr("hashedpassword"),
 	}
+	userStore := &mockUserStore{user: existingUser}
+	identities := &mockIdentityStore{}
+	service, issuer := newService(t, userStore, identities)
+	service.Providers()[0].LinkByEmail = true
+
+	result, err := service.HandleCallback(context.Background(), "fake", "valid-code", issuer.authorize(t, service))
+	assert.ErrorIs(t, err, ErrUnverifiedAccount)
+	assert.Nil(t, result)
+	assert.Empty(t, identities.identities)
+	assert.Nil(t, userStore.created)
+}
 
-	userStore := &mockUserStore{
-		user:              existingUser,
-		findByGoogleIDErr: errors.New("not found"), // No Google ID yet
-	}
-
-	// Create a test server that returns Google user info
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		userInfo := GoogleUserInfo{
-			ID:            "google456",
-			Email:         "test@example.com",
-			VerifiedEmail: true,
-			Name:          "Test User",
-		}
-		json.NewEncoder(w).Encode(userInfo)
-	}))
-	defer server.Close()
-
-	provider := &mockOAuthProvider{
-		token: &oauth2.Token{AccessToken: "test-token"},
-		httpClient: &http.Client{
-			Transport: &testTransport{server: server},
-		},
+func TestService_HandleCallback_LinkByEmailDisabled(t *testing.T) {
+	verifiedAt := time.Now()
+	existingUser := &store.User{
+		ID:              uuid.Must(uuid.NewV7()),
+		Email:           "test@example.com",
+		EmailVerifiedAt: &verifiedAt,
 	}
+	userStore := &mockUserStore{user: existingUser}
+	identities := &mockIdentityStore{}
+	service, issuer := newService(t, userStore, identities)
+
+	result, err := service.HandleCallback(context.Background(), "fake", "valid-code", issuer.authorize(t, service))
+	assert.ErrorIs(t, err, ErrAccountExists)
+	assert.Nil(t, result)
+	assert.Empty(t, identities.identities)
+	assert.Nil(t, userStore.created)
+}
 
-	service := NewServiceWithProvider(userStore, provider, "secret", 60)
+func TestService_HandleCallback_NewUser(t *testing.T) {
+	userStore := &mockUserStore{findByEmailErr: errors.New("not found")}
+	identities := &mockIdentityStore{}
+	service, issuer := newService(t, userStore, identities)
+	issuer.claims["email"] = "newuser@example.com"
 
-	token, err := service.HandleGoogleCallback(context.Background(), "valid-code")
+	result, err := service.HandleCallback(context.Background(), "fake", "valid-code", issuer.authorize(t, service))
 	assert.NoError(t, err)
-	assert.NotEmpty(t, token)
+	require.NotNil(t, result)
+	assert.NotNil(t, result.Login.Tokens)
+	require.NotNil(t, userStore.created)
+	assert.Equal(t, "newuser@example.com", userStore.created.Email)
+	assert.NotNil(t, userStore.created.EmailVerifiedAt)
+	require.Len(t, identities.identities, 1)
+	assert.Equal(t, userStore.created.ID, identities.identities[0].UserID)
 }
 
-func TestService_HandleGoogleCallback_NewUser(t *testing.T) {
-	userStore := &mockUserStore{
-		findByGoogleIDErr: errors.New("not found"),
-		findByEmailErr:    errors.New("not found"),
-	}
-
-	// Create a test server that returns Google user info
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		userInfo := GoogleUserInfo{
-			ID:            "google789",
-			Email:         "newuser@example.com",
-			VerifiedEmail: true,
-			Name:          "New User",
-		}
-		json.NewEncoder(w).Encode(userInfo)
-	}))
-	defer server.Close()
-
-	provider := &mockOAuthProvider{
-		token: &oauth2.Token{AccessToken: "test-token"},
-		httpClient: &http.Client{
-			Transport: &testTransport{server: server},
-		},
-	}
-
-	service := NewServiceWithProvider(userStore, provider, "secret", 60)
+func TestService_HandleCallback_UserInfoFallback(t *testing.T) {
+	userStore := &mockUserStore{findByEmailErr: errors.New("not found")}
+	service, issuer := newService(t, userStore, &mockIdentityStore{})
+	delete(issuer.claims, "email")
+	delete(issuer.claims, "email_verified")
+	issuer.userInfo = map[string]any{"sub": "subject-123", "email": "userinfo@example.com", "email_verified": true}
 
-	token, err := service.HandleGoogleCallback(context.Background(), "valid-code")
+	result, err := service.HandleCallback(context.Background(), "fake", "valid-code", issuer.authorize(t, service))
 	assert.NoError(t, err)
-	assert.NotEmpty(t, token)
+	require.NotNil(t, result)
+	require.NotNil(t, userStore.created)
+	assert.Equal(t, "userinfo@example.com", userStore.created.Email)
 }
 
-func TestService_HandleGoogleCallback_UnverifiedEmail(t *testing.T) {
-	userStore := &mockUserStore{}
+func TestService_HandleCallback_UserInfoFails(t *testing.T) {
+	service, issuer := newService(t, &mockUserStore{}, &mockIdentityStore{})
+	delete(issuer.claims, "email")
 
-	// Create a test server that returns unverified Google user info
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		userInfo := GoogleUserInfo{
-			ID:            "google123",
-			Email:         "unverified@example.com",
-			VerifiedEmail: false,
-			Name:          "Unverified User",
-		}
-		json.NewEncoder(w).Encode(userInfo)
-	}))
-	defer server.Close()
-
-	provider := &mockOAuthProvider{
-		token: &oauth2.Token{AccessToken: "test-token"},
-		httpClient: &http.Client{
-			Transport: &testTransport{server: server},
-		},
-	}
+	result, err := service.HandleCallback(context.Background(), "fake", "valid-code", issuer.authorize(t, service))
+	assert.Equal(t, ErrFailedUserInfo, err)
+	assert.Nil(t, result)
+
+	// The userinfo must describe the account of the ID token
+	issuer.userInfo = map[string]any{"sub": "someone-else", "email": "userinfo@example.com", "email_verified": true}
+	result, err = service.HandleCallback(context.Background(), "fake", "valid-code", issuer.authorize(t, service))
+	assert.Equal(t, ErrFailedUserInfo, err)
+	assert.Nil(t, result)
+}
 
-	service := NewServiceWithProvider(userStore, provider, "secret", 60)
+func TestService_HandleCallback_UnverifiedEmail(t *testing.T) {
+	userStore := &mockUserStore{user: &store.User{ID: uuid.Must(uuid.NewV7()), Email: "test@example.com"}}
+	identities := &mockIdentityStore{}
+	service, issuer := newService(t, userStore, identities)
+	issuer.claims["email_verified"] = false
 
-	token, err := service.HandleGoogleCallback(context.Background(), "valid-code")
-	assert.Error(t, err)
+	result, err := service.HandleCallback(context.Background(), "fake", "valid-code", issuer.authorize(t, service))
 	assert.Equal(t, ErrUnverifiedEmail, err)
-	assert.Empty(t, token)
+	assert.Nil(t, result)
+	assert.Empty(t, identities.identities)
+	assert.Nil(t, userStore.created)
 }
 
-func TestService_HandleGoogleCallback_CreateUserFails(t *testing.T) {
+func TestService_HandleCallback_CreateUserFails(t *testing.T) {
 	userStore := &mockUserStore{
-		findByGoogleIDErr: errors.New("not found"),
-		findByEmailErr:    errors.New("not found"),
-		createErr:         errors.New("database error"),
+		findByEmailErr: errors.New("not found"),
+		createErr:      errors.New("database error"),
 	}
+	service, issuer := newService(t, userStore, &mockIdentityStore{})
 
-	// Create a test server that returns Google user info
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		userInfo := GoogleUserInfo{
-			ID:            "google123",
-			Email:         "test@example.com",
-			VerifiedEmail: true,
-			Name:          "Test User",
-		}
-		json.NewEncoder(w).Encode(userInfo)
-	}))
-	defer server.Close()
-
-	provider := &mockOAuthProvider{
-		token: &oauth2.Token{AccessToken: "test-token"},
-		httpClient: &http.Client{
-			Transport: &testTransport{server: server},
-		},
-	}
+	result, err := service.HandleCallback(context.Background(), "fake", "valid-code", issuer.authorize(t, service))
+	assert.Error(t, err)
+	assert.Equal(t, "database error", err.Error())
+	assert.Nil(t, result)
+}
 
-	service := NewServiceWithProvider(userStore, provider, "secret", 60)
+func TestService_HandleCallback_CreateIdentityFails(t *testing.T) {
+	userStore := &mockUserStore{findByEmailErr: errors.New("not found")}
+	service, issuer := newService(t, userStore, &mockIdentityStore{createErr: errors.New("database error")})
 
-	token, err := service.HandleGoogleCallback(context.Background(), "valid-code")
+	result, err := service.HandleCallback(context.Background(), "fake", "valid-code", issuer.authorize(t, service))
 	assert.Error(t, err)
-	assert.Equal(t, "database error", err.Error())
-	assert.Empty(t, token)
+	assert.Nil(t, result)
+	// The new account is removed again
+	assert.Equal(t, userStore.created, userStore.deleted)
 }
 
-func TestService_HandleGoogleCallback_GoogleAPIFails(t *testing.T) {
-	userStore := &mockUserStore{}
+func TestService_HandleCallback_WrongNonce(t *testing.T) {
+	service, issuer := newService(t, &mockUserStore{}, &mockIdentityStore{})
+	req := issuer.authorize(t, service)
+	// The ID token of another login
+	issuer.claims["nonce"] = "other-nonce"
 
-	// Create a test server that returns an error
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusInternalServerError)
-	}))
-	defer server.Close()
+	result, err := service.HandleCallback(context.Background(), "fake", "valid-code", req)
+	assert.Equal(t, ErrInvalidIDToken, err)
+	assert.Nil(t, result)
+}
 
-	provider := &mockOAuthProvider{
-		token: &oauth2.Token{AccessToken: "test-token"},
-		httpClient: &http.Client{
-			Transport: &testTransport{server: server},
-		},
+func TestService_HandleCallback_WrongVerifier(t *testing.T) {
+	service, issuer := newService(t, &mockUserStore{}, &mockIdentityStore{})
+	req := issuer.authorize(t, service)
+	// An authorization code of another login
+	other := *req
+	other.Verifier = oauth2.GenerateVerifier()
+
+	result, err := service.HandleCallback(context.Background(), "fake", "valid-code", &other)
+	assert.Equal(t, ErrFailedExchange, err)
+	assert.Nil(t, result)
+}
+
+func TestService_NewAuthRequest(t *testing.T) {
+	service, _ := newService(t, &mockUserStore{}, &mockIdentityStore{})
+	service.redirectURIs = []string{"pcast://login"}
+	challenge := oauth2.S256ChallengeFromVerifier(oauth2.GenerateVerifier())
+
+	req, err := service.NewAuthRequest("", "", false)
+	require.NoError(t, err)
+	assert.NotEmpty(t, req.State)
+	assert.NotEmpty(t, req.Verifier)
+	assert.NotEmpty(t, req.Nonce)
+	assert.Empty(t, req.RedirectURI)
+
+	other, err := service.NewAuthRequest("", "", false)
+	require.NoError(t, err)
+	assert.NotEqual(t, req.State, other.State)
+	assert.NotEqual(t, req.Nonce, other.Nonce)
+
+	req, err = service.NewAuthRequest("pcast://login", challenge, false)
+	require.NoError(t, err)
+	assert.Equal(t, "pcast://login", req.RedirectURI)
+	assert.Equal(t, challenge, req.CodeChallenge)
+
+	_, err = service.NewAuthRequest("evil://login", challenge, false)
+	assert.Equal(t, ErrRedirectURINotAllowed, err)
+
+	_, err = service.NewAuthRequest("pcast://login", "", false)
+	assert.Equal(t, ErrInvalidCodeChallenge, err)
+
+	// Link codes are always bound to a challenge
+	_, err = service.NewAuthRequest("", "", true)
+	assert.Equal(t, ErrInvalidCodeChallenge, err)
+
+	req, err = service.NewAuthRequest("", challenge, true)
+	require.NoError(t, err)
+	assert.True(t, req.Link)
+	assert.Equal(t, challenge, req.CodeChallenge)
+}
+
+func TestRedirectURIAllowed(t *testing.T) {
+	allowed := []string{"pcast://login", "https://app.example.com/login", "http://127.0.0.1/callback", "http://[::1]/callback"}
+
+	for uri, expected := range map[string]bool{
+		"pcast://login":                      true,
+		"https://app.example.com/login":      true,
+		"http://127.0.0.1/callback":          true,
+		"http://127.0.0.1:51234/callback":    true,
+		"http://[::1]:51234/callback":        true,
+		"pcast://other":                      false,
+		"pcast://login#fragment":             false,
+		"https://app.example.com:8443/login": false,
+		"https://app.example.com/login/":     false,
+		"http://127.0.0.1:51234/other":       false,
+		"http://localhost:51234/callback":    false,
+		"https://127.0.0.1/callback":         false,
+		"/login":                             false,
+		"":                                   false,
+	} {
+		assert.Equal(t, expected, redirectURIAllowed(allowed, uri), uri)
 	}
+}
 
-	service := NewServiceWithProvider(userStore, provider, "secret", 60)
+func TestService_HandleCallback_RedirectURI(t *testing.T) {
+	userID := uuid.Must(uuid.NewV7())
+	userStore := &mockUserStore{user: &store.User{ID: userID, Email: "test@example.com"}}
+	identities := &mockIdentityStore{identities: []identityStore.Identity{
+		{UserID: userID, Provider: "fake", Subject: "subject-123", Email: "test@example.com"},
+	}}
+	service, issuer := newService(t, userStore, identities)
+	service.redirectURIs = []string{"pcast://login"}
+	verifier := oauth2.GenerateVerifier()
+
+	req := issuer.authorize(t, service)
+	req.RedirectURI = "pcast://login"
+	req.CodeChallenge = oauth2.S256ChallengeFromVerifier(verifier)
+
+	result, err := service.HandleCallback(context.Background(), "fake", "valid-code", req)
+	require.NoError(t, err)
+	// The browser only gets a code for the app, no tokens
+	assert.Nil(t, result.Login)
+	assert.Equal(t, "pcast://login", result.RedirectURI)
+	require.NotEmpty(t, result.LoginCode)
+
+	login, err := service.ExchangeLoginCode(context.Background(), result.LoginCode, verifier)
+	assert.NoError(t, err)
+	require.NotNil(t, login)
+	assert.NotNil(t, login.Tokens)
 
-	token, err := service.HandleGoogleCallback(context.Background(), "valid-code")
-	assert.Error(t, err)
-	assert.Equal(t, ErrFailedUserInfo, err)
-	assert.Empty(t, token)
+	_, err = service.ExchangeLoginCode(context.Background(), result.LoginCode, oauth2.GenerateVerifier())
+	assert.ErrorIs(t, err, auth.ErrInvalidLoginCode)
 }
 
-// testTransport redirects all requests to the test server
-type testTransport struct {
-	server *httptest.Server
+func TestService_ExchangeLoginCode_TwoFactor(t *testing.T) {
+	userID := uuid.Must(uuid.NewV7())
+	enabledAt := time.Now()
+	userStore := &mockUserStore{user: &store.User{ID: userID, Email: "test@example.com", TOTPEnabledAt: &enabledAt}}
+	tokens := newTokenService()
+	service := NewServiceWithProviders(userStore, &mockIdentityStore{}, tokens)
+	verifier := oauth2.GenerateVerifier()
+
+	code, err := tokens.IssueLoginCode(userID, oauth2.S256ChallengeFromVerifier(verifier))
+	require.NoError(t, err)
+
+	login, err := service.ExchangeLoginCode(context.Background(), code, verifier)
+	assert.NoError(t, err)
+	require.NotNil(t, login)
+	assert.Nil(t, login.Tokens)
+
+	challengedID, err := tokens.VerifyChallenge(login.ChallengeToken)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, challengedID)
 }
 
-func (t *testTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	// Redirect the request to our test server
-	req.URL.Scheme = "http"
-	req.URL.Host = t.server.Listener.Addr().String()
-	return http.DefaultTransport.RoundTrip(req)
+func TestService_HandleCallback_Link(t *testing.T) {
+	userStore := &mockUserStore{findByEmailErr: errors.New("not found")}
+	identities := &mockIdentityStore{}
+	service, issuer := newService(t, userStore, identities)
+	// Linking does not rely on the email
+	issuer.claims["email_verified"] = false
+
+	req := issuer.authorize(t, service)
+	req.Link = true
+
+	// The link code must be bound to the challenge of the app
+	_, err := service.HandleCallback(context.Background(), "fake", "valid-code", req)
+	assert.Equal(t, ErrInvalidCodeChallenge, err)
+
+	verifier := oauth2.GenerateVerifier()
+	req.CodeChallenge = oauth2.S256ChallengeFromVerifier(verifier)
+	result, err := service.HandleCallback(context.Background(), "fake", "valid-code", req)
+	require.NoError(t, err)
+	// Nobody is signed in or created
+	assert.Nil(t, result.Login)
+	assert.Empty(t, result.LoginCode)
+	assert.NotEmpty(t, result.LinkCode)
+	assert.Nil(t, userStore.created)
+	assert.Empty(t, identities.identities)
+
+	userID := uuid.Must(uuid.NewV7())
+	_, err = service.LinkIdentity(context.Background(), userID, result.LinkCode, "")
+	assert.ErrorIs(t, err, auth.ErrInvalidLinkCode)
+
+	identity, err := service.LinkIdentity(context.Background(), userID, result.LinkCode, verifier)
+	assert.NoError(t, err)
+	require.NotNil(t, identity)
+	assert.Equal(t, identityStore.Identity{UserID: userID, Provider: "fake", Subject: "subject-123", Email: "test@example.com"}, identities.identities[0])
+
+	// Linking again is a no-op
+	_, err = service.LinkIdentity(context.Background(), userID, result.LinkCode, verifier)
+	assert.NoError(t, err)
+	assert.Len(t, identities.identities, 1)
+
+	// The identity belongs to the first user now
+	_, err = service.LinkIdentity(context.Background(), uuid.Must(uuid.NewV7()), result.LinkCode, verifier)
+	assert.Equal(t, ErrIdentityLinked, err)
+}
+
+func TestService_LinkIdentity_Invalid(t *testing.T) {
+	userID := uuid.Must(uuid.NewV7())
+	identities := &mockIdentityStore{identities: []identityStore.Identity{
+		{UserID: userID, Provider: "fake", Subject: "subject-123", Email: "test@example.com"},
+	}}
+	tokens := newTokenService()
+	issuer := newFakeIssuer(t)
+	service := NewServiceWithProviders(&mockUserStore{}, identities, tokens, issuer.provider())
+
+	_, err := service.LinkIdentity(context.Background(), userID, "invalid", "")
+	assert.ErrorIs(t, err, auth.ErrInvalidLinkCode)
+
+	verifier := oauth2.GenerateVerifier()
+	challenge := oauth2.S256ChallengeFromVerifier(verifier)
+
+	// A second account at the same provider
+	code, err := tokens.IssueLinkCode(&auth.LinkCode{Provider: "fake", Subject: "subject-456", Email: "other@example.com"}, challenge)
+	require.NoError(t, err)
+	_, err = service.LinkIdentity(context.Background(), userID, code, verifier)
+	assert.Equal(t, ErrProviderLinked, err)
+
+	// A provider that was removed from the config
+	code, err = tokens.IssueLinkCode(&auth.LinkCode{Provider: "removed", Subject: "subject-123"}, challenge)
+	require.NoError(t, err)
+	_, err = service.LinkIdentity(context.Background(), userID, code, verifier)
+	assert.Equal(t, ErrUnknownProvider, err)
+
+	// Codes need the verifier of their challenge
+	code, err = tokens.IssueLinkCode(&auth.LinkCode{Provider: "fake", Subject: "subject-789"}, challenge)
+	require.NoError(t, err)
+	_, err = service.LinkIdentity(context.Background(), uuid.Must(uuid.NewV7()), code, oauth2.GenerateVerifier())
+	assert.ErrorIs(t, err, auth.ErrInvalidLinkCode)
+	_, err = service.LinkIdentity(context.Background(), uuid.Must(uuid.NewV7()), code, "")
+	assert.ErrorIs(t, err, auth.ErrInvalidLinkCode)
+	assert.Len(t, identities.identities, 1)
+}
+
+func TestService_LinkIdentity_VerifiesEmail(t *testing.T) {
+	verifier := oauth2.GenerateVerifier()
+	challenge := oauth2.S256ChallengeFromVerifier(verifier)
+
+	for name, tc := range map[string]struct {
+		link     *auth.LinkCode
+		verified bool
+	}{
+		"verified":    {&auth.LinkCode{Provider: "fake", Subject: "subject-123", Email: "test@example.com", EmailVerified: true}, true},
+		"unverified":  {&auth.LinkCode{Provider: "fake", Subject: "subject-123", Email: "test@example.com"}, false},
+		"other email": {&auth.LinkCode{Provider: "fake", Subject: "subject-123", Email: "other@example.com", EmailVerified: true}, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			user := &store.User{ID: uuid.Must(uuid.NewV7()), Email: "test@example.com"}
+			userStore := &mockUserStore{user: user}
+			tokens := newTokenService()
+			service := NewServiceWithProviders(userStore, &mockIdentityStore{}, tokens, newFakeIssuer(t).provider())
+
+			code, err := tokens.IssueLinkCode(tc.link, challenge)
+			require.NoError(t, err)
+			_, err = service.LinkIdentity(context.Background(), user.ID, code, verifier)
+			require.NoError(t, err)
+			assert.Equal(t, tc.verified, userStore.verified)
+		})
+	}
+}
+
+func TestService_UnlinkIdentity(t *testing.T) {
+	userID := uuid.Must(uuid.NewV7())
+	identities := &mockIdentityStore{identities: []identityStore.Identity{
+		{UserID: userID, Provider: "fake", Subject: "subject-123", Email: "test@example.com"},
+		{UserID: userID, Provider: "other", Subject: "subject-456", Email: "test@example.com"},
+	}}
+	service, _ := newService(t, &mockUserStore{}, identities)
+
+	err := service.UnlinkIdentity(context.Background(), userID, "fake")
+	assert.NoError(t, err)
+
+	linked, err := service.Identities(context.Background(), userID)
+	assert.NoError(t, err)
+	require.Len(t, linked, 1)
+	assert.Equal(t, "other", linked[0].Provider)
+
+	// The user has no password, the last identity stays
+	err = service.UnlinkIdentity(context.Background(), userID, "other")
+	assert.Equal(t, ErrLastLoginMethod, err)
+
+	err = service.UnlinkIdentity(context.Background(), userID, "fake")
+	assert.Equal(t, ErrIdentityNotFound, err)
+
+	identities.password = true
+	err = service.UnlinkIdentity(context.Background(), userID, "other")
+	assert.NoError(t, err)
+	assert.Empty(t, identities.identities)
 }
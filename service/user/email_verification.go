@@ -0,0 +1,113 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pcast-api/service/auth"
+	"pcast-api/service/mail"
+	store "pcast-api/store/emailverification"
+	userStore "pcast-api/store/user"
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid email verification token")
+	ErrEmailNotVerified         = errors.New("email not verified")
+)
+
+// SendVerification mails a link to confirm the address of the user. Nothing is sent if it is already verified.
+func (s *Service) SendVerification(ctx context.Context, user *userStore.User) error {
+	ctx, span := tracer.Start(ctx, "user.SendVerification")
+	defer span.End()
+
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	token, err := auth.GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	verification := &store.EmailVerificationToken{
+		UserID:    user.ID,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(s.emailVerificationExpiration),
+	}
+	if err := s.verifications.Create(ctx, verification); err != nil {
+		return err
+	}
+
+	msg, err := s.verificationMail(user, token)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, msg)
+}
+
+// ResendVerification mails a new verification link in the background. Like ForgotPassword it does not reveal
+// whether the address has an account, failures are only logged.
+func (s *Service) ResendVerification(ctx context.Context, email string) error {
+	ctx, span := tracer.Start(ctx, "user.ResendVerification")
+	defer span.End()
+
+	user, err := s.store.FindByEmail(ctx, email)
+	if err != nil {
+		return nil
+	}
+
+	s.sendInBackground(ctx, "email verification error", func(ctx context.Context) error {
+		return s.SendVerification(ctx, user)
+	})
+
+	return nil
+}
+
+// VerifyEmail confirms the address of the user the token was mailed to
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	ctx, span := tracer.Start(ctx, "user.VerifyEmail")
+	defer span.End()
+
+	verification, err := s.verifications.FindByHash(ctx, auth.HashToken(token))
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+	if verification.UsedAt != nil || time.Now().After(verification.ExpiresAt) {
+		return ErrInvalidVerificationToken
+	}
+
+	marked, err := s.verifications.MarkUsed(ctx, verification)
+	if err != nil {
+		return err
+	}
+	if !marked {
+		return ErrInvalidVerificationToken
+	}
+
+	user, err := s.GetUser(ctx, verification.UserID)
+	if err != nil {
+		return err
+	}
+
+	return s.store.MarkEmailVerified(ctx, user)
+}
+
+func (s *Service) verificationMail(user *userStore.User, token string) (*mail.Message, error) {
+	link, err := tokenLink(s.emailVerificationURL, token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email verification url: %w", err)
+	}
+
+	return &mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your pcast email address",
+		Body: fmt.Sprintf("Hello,\n\n"+
+			"please confirm the email address of your pcast account by opening the following link within %d hours:\n\n"+
+			"%s\n\n"+
+			"If you did not create an account, you can ignore this mail.\n",
+			int(s.emailVerificationExpiration.Hours()), link),
+	}, nil
+}
@@ -0,0 +1,186 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/argon2id"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pcast-api/config"
+	"pcast-api/service/auth"
+	"pcast-api/service/mail"
+	verificationStore "pcast-api/store/emailverification"
+	store "pcast-api/store/user"
+)
+
+// mockEmailVerificationStore implements modelInterface.EmailVerification in memory
+type mockEmailVerificationStore struct {
+	tokens []*verificationStore.EmailVerificationToken
+}
+
+func (m *mockEmailVerificationStore) Create(ctx context.Context, token *verificationStore.EmailVerificationToken) error {
+	token.ID = uuid.Must(uuid.NewV7())
+	m.tokens = append(m.tokens, token)
+	return nil
+}
+
+func (m *mockEmailVerificationStore) FindByHash(ctx context.Context, tokenHash string) (*verificationStore.EmailVerificationToken, error) {
+	for _, token := range m.tokens {
+		if token.TokenHash == tokenHash {
+			found := *token
+			return &found, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (m *mockEmailVerificationStore) MarkUsed(ctx context.Context, token *verificationStore.EmailVerificationToken) (bool, error) {
+	for _, stored := range m.tokens {
+		if stored.ID == token.ID {
+			if stored.UsedAt != nil {
+				return false, nil
+			}
+			now := time.Now()
+			stored.UsedAt = &now
+			token.UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+var verificationConfig = &config.Config{
+	Auth: config.Auth{
+		RequireEmailVerification:         true,
+		EmailVerificationURL:             "https://pcast.example.com/verify",
+		EmailVerificationExpirationHours: 48,
+	},
+}
+
+// verificationTokenFromMail extracts the token from the link in the verification mail
+func verificationTokenFromMail(t *testing.T, msg *mail.Message) string {
+	link, err := url.Parse(tokenPattern.FindString(msg.Body))
+	require.NoError(t, err)
+	assert.Equal(t, "/verify", link.Path)
+	return link.Query().Get("token")
+}
+
+func newUserWithPassword(t *testing.T, password string) *store.User {
+	hash, err := argon2id.CreateHash(password, argon2id.DefaultParams)
+	require.NoError(t, err)
+	return &store.User{ID: uuid.Must(uuid.NewV7()), Email: "foo@bar.com", Password: &hash}
+}
+
+func TestService_SendVerification(t *testing.T) {
+	user := &store.User{ID: uuid.Must(uuid.NewV7()), Email: "foo@bar.com"}
+	verifications := &mockEmailVerificationStore{}
+	mailer := &mockMailer{}
+	service := NewService(verificationConfig, &mockStore{user: user}, newTokenService(), &mockPasswordResetStore{}, verifications, &mockRecoveryCodeStore{}, nil, mailer)
+
+	err := service.SendVerification(context.Background(), user)
+	require.NoError(t, err)
+
+	require.Len(t, mailer.messages, 1)
+	assert.Equal(t, "foo@bar.com", mailer.messages[0].To)
+	assert.Contains(t, mailer.messages[0].Body, "48 hours")
+
+	token := verificationTokenFromMail(t, mailer.messages[0])
+	require.Len(t, verifications.tokens, 1)
+	assert.Equal(t, user.ID, verifications.tokens[0].UserID)
+	assert.Equal(t, auth.HashToken(token), verifications.tokens[0].TokenHash)
+	assert.WithinDuration(t, time.Now().Add(48*time.Hour), verifications.tokens[0].ExpiresAt, time.Minute)
+}
+
+func TestService_SendVerification_AlreadyVerified(t *testing.T) {
+	now := time.Now()
+	user := &store.User{ID: uuid.Must(uuid.NewV7()), Email: "foo@bar.com", EmailVerifiedAt: &now}
+	verifications := &mockEmailVerificationStore{}
+	mailer := &mockMailer{}
+	service := NewService(verificationConfig, &mockStore{user: user}, newTokenService(), &mockPasswordResetStore{}, verifications, &mockRecoveryCodeStore{}, nil, mailer)
+
+	err := service.SendVerification(context.Background(), user)
+	assert.NoError(t, err)
+	assert.Empty(t, verifications.tokens)
+	assert.Empty(t, mailer.messages)
+}
+
+func TestService_ResendVerification_UnknownEmail(t *testing.T) {
+	mailer := &mockMailer{}
+	service := NewService(verificationConfig, &mockStore{err: assert.AnError}, newTokenService(), &mockPasswordResetStore{}, &mockEmailVerificationStore{}, &mockRecoveryCodeStore{}, nil, mailer)
+
+	err := service.ResendVerification(context.Background(), "unknown@bar.com")
+	service.mails.Wait()
+	assert.NoError(t, err)
+	assert.Empty(t, mailer.messages)
+}
+
+func TestService_ResendVerification_MailFails(t *testing.T) {
+	user := &store.User{ID: uuid.Must(uuid.NewV7()), Email: "foo@bar.com"}
+	mailer := &mockMailer{err: assert.AnError}
+	service := NewService(verificationConfig, &mockStore{user: user}, newTokenService(), &mockPasswordResetStore{}, &mockEmailVerificationStore{}, &mockRecoveryCodeStore{}, nil, mailer)
+
+	// Answers like for an unknown address
+	err := service.ResendVerification(context.Background(), user.Email)
+	service.mails.Wait()
+	assert.NoError(t, err)
+}
+
+func TestService_VerifyEmail(t *testing.T) {
+	user := newUserWithPassword(t, "password")
+	mailer := &mockMailer{}
+	service := NewService(verificationConfig, &mockStore{user: user}, newTokenService(), &mockPasswordResetStore{}, &mockEmailVerificationStore{}, &mockRecoveryCodeStore{}, nil, mailer)
+
+	// Login is blocked until the address is verified
+	_, err := service.Login(context.Background(), user.Email, "password")
+	assert.ErrorIs(t, err, ErrEmailNotVerified)
+
+	require.NoError(t, service.ResendVerification(context.Background(), user.Email))
+	service.mails.Wait()
+	require.Len(t, mailer.messages, 1)
+	token := verificationTokenFromMail(t, mailer.messages[0])
+
+	err = service.VerifyEmail(context.Background(), token)
+	require.NoError(t, err)
+	assert.NotNil(t, user.EmailVerifiedAt)
+
+	result, err := service.Login(context.Background(), user.Email, "password")
+	assert.NoError(t, err)
+	assert.NotNil(t, result.Tokens)
+
+	// The token can be used once
+	err = service.VerifyEmail(context.Background(), token)
+	assert.ErrorIs(t, err, ErrInvalidVerificationToken)
+}
+
+func TestService_VerifyEmail_Expired(t *testing.T) {
+	user := &store.User{ID: uuid.Must(uuid.NewV7()), Email: "foo@bar.com"}
+	verifications := &mockEmailVerificationStore{tokens: []*verificationStore.EmailVerificationToken{{
+		ID:        uuid.Must(uuid.NewV7()),
+		UserID:    user.ID,
+		TokenHash: auth.HashToken("expired"),
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}}}
+	service := NewService(verificationConfig, &mockStore{user: user}, newTokenService(), &mockPasswordResetStore{}, verifications, &mockRecoveryCodeStore{}, nil, &mockMailer{})
+
+	err := service.VerifyEmail(context.Background(), "expired")
+	assert.ErrorIs(t, err, ErrInvalidVerificationToken)
+	assert.Nil(t, user.EmailVerifiedAt)
+
+	err = service.VerifyEmail(context.Background(), "unknown")
+	assert.ErrorIs(t, err, ErrInvalidVerificationToken)
+}
+
+func TestService_Login_VerificationNotRequired(t *testing.T) {
+	user := newUserWithPassword(t, "password")
+	service := newService(&mockStore{user: user})
+
+	result, err := service.Login(context.Background(), user.Email, "password")
+	assert.NoError(t, err)
+	assert.NotNil(t, result.Tokens)
+}
@@ -0,0 +1,123 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/alexedwards/argon2id"
+
+	"pcast-api/service/auth"
+	"pcast-api/service/mail"
+	store "pcast-api/store/passwordreset"
+	userStore "pcast-api/store/user"
+)
+
+var ErrInvalidResetToken = errors.New("invalid password reset token")
+
+// ForgotPassword mails a password reset link to the user in the background. Unknown addresses are ignored and
+// failures are only logged, so the endpoint does not reveal which addresses have an account.
+func (s *Service) ForgotPassword(ctx context.Context, email string) error {
+	ctx, span := tracer.Start(ctx, "user.ForgotPassword")
+	defer span.End()
+
+	user, err := s.store.FindByEmail(ctx, email)
+	if err != nil {
+		return nil
+	}
+
+	s.sendInBackground(ctx, "password reset mail error", func(ctx context.Context) error {
+		return s.sendPasswordReset(ctx, user)
+	})
+
+	return nil
+}
+
+func (s *Service) sendPasswordReset(ctx context.Context, user *userStore.User) error {
+	token, err := auth.GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	reset := &store.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(s.passwordResetExpiration),
+	}
+	if err := s.resets.Create(ctx, reset); err != nil {
+		return err
+	}
+
+	msg, err := s.passwordResetMail(user, token)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, msg)
+}
+
+// ResetPassword sets a new password with a token from the reset mail. The token can be used once,
+// all other reset tokens and all sessions of the user are revoked.
+func (s *Service) ResetPassword(ctx context.Context, token string, newPassword string) error {
+	ctx, span := tracer.Start(ctx, "user.ResetPassword")
+	defer span.End()
+
+	reset, err := s.resets.FindByHash(ctx, auth.HashToken(token))
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+	if reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	hash, err := argon2id.CreateHash(newPassword, argon2id.DefaultParams)
+	if err != nil {
+		return err
+	}
+
+	// The token is only used up together with the password update, a failed update leaves it valid
+	redeemed, err := s.resets.Redeem(ctx, reset, hash)
+	if err != nil {
+		return err
+	}
+	if !redeemed {
+		// Redeemed concurrently
+		return ErrInvalidResetToken
+	}
+
+	return s.tokens.RevokeAll(ctx, reset.UserID)
+}
+
+func (s *Service) passwordResetMail(user *userStore.User, token string) (*mail.Message, error) {
+	link, err := tokenLink(s.passwordResetURL, token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid password reset url: %w", err)
+	}
+
+	return &mail.Message{
+		To:      user.Email,
+		Subject: "Reset your pcast password",
+		Body: fmt.Sprintf("Hello,\n\n"+
+			"someone requested to reset the password of your pcast account. "+
+			"To choose a new password, open the following link within %d minutes:\n\n"+
+			"%s\n\n"+
+			"If you did not request this, you can ignore this mail. Your password stays unchanged.\n",
+			int(s.passwordResetExpiration.Minutes()), link),
+	}, nil
+}
+
+// tokenLink appends the token as query parameter to a page of the client
+func tokenLink(page string, token string) (string, error) {
+	link, err := url.Parse(page)
+	if err != nil {
+		return "", err
+	}
+
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return link.String(), nil
+}
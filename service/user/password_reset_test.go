@@ -0,0 +1,259 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/argon2id"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pcast-api/config"
+	"pcast-api/service/auth"
+	"pcast-api/service/mail"
+	resetStore "pcast-api/store/passwordreset"
+	store "pcast-api/store/user"
+)
+
+// mockPasswordResetStore implements modelInterface.PasswordReset in memory
+type mockPasswordResetStore struct {
+	tokens []*resetStore.PasswordResetToken
+	// passwords are the hashes set by redeemed tokens
+	passwords   map[uuid.UUID]string
+	invalidated []uuid.UUID
+	err         error
+}
+
+func (m *mockPasswordResetStore) Create(ctx context.Context, token *resetStore.PasswordResetToken) error {
+	token.ID = uuid.Must(uuid.NewV7())
+	m.tokens = append(m.tokens, token)
+	return nil
+}
+
+func (m *mockPasswordResetStore) FindByHash(ctx context.Context, tokenHash string) (*resetStore.PasswordResetToken, error) {
+	for _, token := range m.tokens {
+		if token.TokenHash == tokenHash {
+			found := *token
+			return &found, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (m *mockPasswordResetStore) Redeem(ctx context.Context, token *resetStore.PasswordResetToken, passwordHash string) (bool, error) {
+	if m.err != nil {
+		// The transaction is rolled back
+		return false, m.err
+	}
+
+	for _, stored := range m.tokens {
+		if stored.ID == token.ID {
+			if stored.UsedAt != nil {
+				return false, nil
+			}
+			now := time.Now()
+			stored.UsedAt = &now
+			token.UsedAt = &now
+			if m.passwords == nil {
+				m.passwords = map[uuid.UUID]string{}
+			}
+			m.passwords[token.UserID] = passwordHash
+			m.invalidated = append(m.invalidated, token.UserID)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// mockMailer records sent mails
+type mockMailer struct {
+	messages []*mail.Message
+	err      error
+	// block delays the delivery until it is closed
+	block chan struct{}
+}
+
+func (m *mockMailer) Send(ctx context.Context, msg *mail.Message) error {
+	if m.block != nil {
+		<-m.block
+	}
+	if m.err != nil {
+		return m.err
+	}
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// mockRevocationStore records users whose tokens were revoked
+type mockRevocationStore struct {
+	revokedUsers []uuid.UUID
+}
+
+func (m *mockRevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return nil
+}
+
+func (m *mockRevocationStore) RevokeUserTokens(ctx context.Context, userID uuid.UUID, issuedBefore time.Time) error {
+	m.revokedUsers = append(m.revokedUsers, userID)
+	return nil
+}
+
+func (m *mockRevocationStore) IsRevoked(ctx context.Context, jti string, userID uuid.UUID, issuedAt time.Time) (bool, error) {
+	return false, nil
+}
+
+var resetConfig = &config.Config{
+	Auth: config.Auth{
+		PasswordResetURL:           "https://pcast.example.com/reset?lang=en",
+		PasswordResetExpirationMin: 30,
+	},
+}
+
+var tokenPattern = regexp.MustCompile(`https://\S+`)
+
+// resetTokenFromMail extracts the token from the link in the reset mail
+func resetTokenFromMail(t *testing.T, msg *mail.Message) string {
+	link, err := url.Parse(tokenPattern.FindString(msg.Body))
+	require.NoError(t, err)
+	assert.Equal(t, "en", link.Query().Get("lang"))
+	return link.Query().Get("token")
+}
+
+func TestService_ForgotPassword(t *testing.T) {
+	user := &store.User{ID: uuid.Must(uuid.NewV7()), Email: "foo@bar.com", Password: strPtr("password")}
+	resets := &mockPasswordResetStore{}
+	mailer := &mockMailer{}
+	service := NewService(resetConfig, &mockStore{user: user}, newTokenService(), resets, &mockEmailVerificationStore{}, &mockRecoveryCodeStore{}, nil, mailer)
+
+	err := service.ForgotPassword(context.Background(), user.Email)
+	service.mails.Wait()
+	require.NoError(t, err)
+
+	require.Len(t, mailer.messages, 1)
+	assert.Equal(t, "foo@bar.com", mailer.messages[0].To)
+	assert.Contains(t, mailer.messages[0].Body, "30 minutes")
+
+	token := resetTokenFromMail(t, mailer.messages[0])
+	require.NotEmpty(t, token)
+	require.Len(t, resets.tokens, 1)
+	assert.Equal(t, user.ID, resets.tokens[0].UserID)
+	assert.Equal(t, auth.HashToken(token), resets.tokens[0].TokenHash)
+	assert.WithinDuration(t, time.Now().Add(30*time.Minute), resets.tokens[0].ExpiresAt, time.Minute)
+}
+
+func TestService_ForgotPassword_DoesNotWaitForMail(t *testing.T) {
+	user := &store.User{ID: uuid.Must(uuid.NewV7()), Email: "foo@bar.com", Password: strPtr("password")}
+	mailer := &mockMailer{block: make(chan struct{})}
+	service := NewService(resetConfig, &mockStore{user: user}, newTokenService(), &mockPasswordResetStore{}, &mockEmailVerificationStore{}, &mockRecoveryCodeStore{}, nil, mailer)
+
+	// Returns while the mail server is still busy, like for an unknown address
+	ctx, cancel := context.WithCancel(context.Background())
+	err := service.ForgotPassword(ctx, user.Email)
+	assert.NoError(t, err)
+	cancel()
+
+	close(mailer.block)
+	service.mails.Wait()
+	assert.Len(t, mailer.messages, 1)
+}
+
+func TestService_ForgotPassword_UnknownEmail(t *testing.T) {
+	resets := &mockPasswordResetStore{}
+	mailer := &mockMailer{}
+	service := NewService(resetConfig, &mockStore{err: assert.AnError}, newTokenService(), resets, &mockEmailVerificationStore{}, &mockRecoveryCodeStore{}, nil, mailer)
+
+	err := service.ForgotPassword(context.Background(), "unknown@bar.com")
+	service.mails.Wait()
+	assert.NoError(t, err)
+	assert.Empty(t, resets.tokens)
+	assert.Empty(t, mailer.messages)
+}
+
+func TestService_ForgotPassword_MailFails(t *testing.T) {
+	user := &store.User{ID: uuid.Must(uuid.NewV7()), Email: "foo@bar.com", Password: strPtr("password")}
+	mailer := &mockMailer{err: assert.AnError}
+	service := NewService(resetConfig, &mockStore{user: user}, newTokenService(), &mockPasswordResetStore{}, &mockEmailVerificationStore{}, &mockRecoveryCodeStore{}, nil, mailer)
+
+	// Answers like for an unknown address
+	err := service.ForgotPassword(context.Background(), user.Email)
+	service.mails.Wait()
+	assert.NoError(t, err)
+}
+
+func TestService_ResetPassword(t *testing.T) {
+	user := &store.User{ID: uuid.Must(uuid.NewV7()), Email: "foo@bar.com", Password: strPtr("password")}
+	resets := &mockPasswordResetStore{}
+	mailer := &mockMailer{}
+	revocations := &mockRevocationStore{}
+	tokens := auth.NewTokenService(&mockRefreshTokenStore{}, revocations, auth.NewHMACKeys("testsecret"), 10, 30)
+	service := NewService(resetConfig, &mockStore{user: user}, tokens, resets, &mockEmailVerificationStore{}, &mockRecoveryCodeStore{}, nil, mailer)
+
+	require.NoError(t, service.ForgotPassword(context.Background(), user.Email))
+	service.mails.Wait()
+	token := resetTokenFromMail(t, mailer.messages[0])
+
+	err := service.ResetPassword(context.Background(), token, "newpassword")
+	require.NoError(t, err)
+
+	match, err := argon2id.ComparePasswordAndHash("newpassword", resets.passwords[user.ID])
+	require.NoError(t, err)
+	assert.True(t, match)
+	assert.Equal(t, []uuid.UUID{user.ID}, resets.invalidated)
+	assert.Equal(t, []uuid.UUID{user.ID}, revocations.revokedUsers)
+
+	// The token can be used once
+	err = service.ResetPassword(context.Background(), token, "otherpassword")
+	assert.ErrorIs(t, err, ErrInvalidResetToken)
+}
+
+func TestService_ResetPassword_UpdateFails(t *testing.T) {
+	user := &store.User{ID: uuid.Must(uuid.NewV7()), Email: "foo@bar.com", Password: strPtr("password")}
+	resets := &mockPasswordResetStore{}
+	mailer := &mockMailer{}
+	revocations := &mockRevocationStore{}
+	tokens := auth.NewTokenService(&mockRefreshTokenStore{}, revocations, auth.NewHMACKeys("testsecret"), 10, 30)
+	service := NewService(resetConfig, &mockStore{user: user}, tokens, resets, &mockEmailVerificationStore{}, &mockRecoveryCodeStore{}, nil, mailer)
+
+	require.NoError(t, service.ForgotPassword(context.Background(), user.Email))
+	service.mails.Wait()
+	token := resetTokenFromMail(t, mailer.messages[0])
+
+	resets.err = assert.AnError
+	err := service.ResetPassword(context.Background(), token, "newpassword")
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Empty(t, revocations.revokedUsers)
+
+	// The token was not used up by the failed attempt
+	resets.err = nil
+	err = service.ResetPassword(context.Background(), token, "newpassword")
+	assert.NoError(t, err)
+}
+
+func TestService_ResetPassword_InvalidToken(t *testing.T) {
+	user := &store.User{ID: uuid.Must(uuid.NewV7()), Email: "foo@bar.com", Password: strPtr("password")}
+	service := NewService(resetConfig, &mockStore{user: user}, newTokenService(), &mockPasswordResetStore{}, &mockEmailVerificationStore{}, &mockRecoveryCodeStore{}, nil, &mockMailer{})
+
+	err := service.ResetPassword(context.Background(), "unknown", "newpassword")
+	assert.ErrorIs(t, err, ErrInvalidResetToken)
+	assert.Equal(t, "password", *user.Password)
+}
+
+func TestService_ResetPassword_Expired(t *testing.T) {
+	user := &store.User{ID: uuid.Must(uuid.NewV7()), Email: "foo@bar.com", Password: strPtr("password")}
+	resets := &mockPasswordResetStore{tokens: []*resetStore.PasswordResetToken{{
+		ID:        uuid.Must(uuid.NewV7()),
+		UserID:    user.ID,
+		TokenHash: auth.HashToken("expired"),
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}}}
+	service := NewService(resetConfig, &mockStore{user: user}, newTokenService(), resets, &mockEmailVerificationStore{}, &mockRecoveryCodeStore{}, nil, &mockMailer{})
+
+	err := service.ResetPassword(context.Background(), "expired", "newpassword")
+	assert.ErrorIs(t, err, ErrInvalidResetToken)
+	assert.Equal(t, "password", *user.Password)
+}
@@ -3,32 +3,73 @@ package user
 import (
 	"context"
 	"errors"
+	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/alexedwards/argon2id"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
 
+	"pcast-api/config"
+	"pcast-api/metrics"
 	"pcast-api/service/auth"
+	"pcast-api/service/mail"
 	modelInterface "pcast-api/service/model_interface"
 	store "pcast-api/store/user"
 )
 
+var tracer = otel.Tracer("pcast-api/service/user")
+
+// reauthenticationWindow is how long after signing in a user may delete the account without the password
+const reauthenticationWindow = 5 * time.Minute
+
 var (
-	ErrInvalidPassword = errors.New("invalid password")
-	ErrUserNotFound    = errors.New("user not found")
-	ErrNoPassword      = errors.New("user has no password (OAuth account)")
+	ErrInvalidPassword          = errors.New("invalid password")
+	ErrUserNotFound             = errors.New("user not found")
+	ErrNoPassword               = errors.New("user has no password (OAuth account)")
+	ErrReauthenticationRequired = errors.New("recent authentication required")
 )
 
 type Service struct {
-	store            modelInterface.User
-	jwtSecret        string
-	jwtExpirationMin int
+	store         modelInterface.User
+	tokens        *auth.TokenService
+	resets        modelInterface.PasswordReset
+	verifications modelInterface.EmailVerification
+	recoveryCodes modelInterface.RecoveryCode
+	// cipher encrypts the TOTP secrets, 2FA is unavailable without it
+	cipher                      *auth.Cipher
+	mailer                      mail.Mailer
+	passwordResetURL            string
+	passwordResetExpiration     time.Duration
+	emailVerificationURL        string
+	emailVerificationExpiration time.Duration
+	requireEmailVerification    bool
+	// mails tracks the mails sent in the background
+	mails sync.WaitGroup
 }
 
-func NewService(store modelInterface.User, jwtSecret string, jwtExpirationMin int) *Service {
-	return &Service{store: store, jwtSecret: jwtSecret, jwtExpirationMin: jwtExpirationMin}
+func NewService(cfg *config.Config, store modelInterface.User, tokens *auth.TokenService, resets modelInterface.PasswordReset, verifications modelInterface.EmailVerification, recoveryCodes modelInterface.RecoveryCode, cipher *auth.Cipher, mailer mail.Mailer) *Service {
+	return &Service{
+		store:                       store,
+		tokens:                      tokens,
+		resets:                      resets,
+		verifications:               verifications,
+		recoveryCodes:               recoveryCodes,
+		cipher:                      cipher,
+		mailer:                      mailer,
+		passwordResetURL:            cfg.Auth.PasswordResetURL,
+		passwordResetExpiration:     time.Duration(cfg.Auth.PasswordResetExpirationMin) * time.Minute,
+		emailVerificationURL:        cfg.Auth.EmailVerificationURL,
+		emailVerificationExpiration: time.Duration(cfg.Auth.EmailVerificationExpirationHours) * time.Hour,
+		requireEmailVerification:    cfg.Auth.RequireEmailVerification,
+	}
 }
 
 func (s *Service) GetUser(ctx context.Context, id uuid.UUID) (*store.User, error) {
+	ctx, span := tracer.Start(ctx, "user.GetUser")
+	defer span.End()
+
 	u, err := s.store.FindByID(ctx, id)
 	if err != nil {
 		return nil, ErrUserNotFound
@@ -37,10 +78,16 @@ func (s *Service) GetUser(ctx context.Context, id uuid.UUID) (*store.User, error
 }
 
 func (s *Service) GetUsers(ctx context.Context) ([]store.User, error) {
+	ctx, span := tracer.Start(ctx, "user.GetUsers")
+	defer span.End()
+
 	return s.store.FindAll(ctx)
 }
 
 func (s *Service) CreateUser(ctx context.Context, email, password string) (*store.User, error) {
+	ctx, span := tracer.Start(ctx, "user.CreateUser")
+	defer span.End()
+
 	hash, err := argon2id.CreateHash(password, argon2id.DefaultParams)
 	if err != nil {
 		return nil, err
@@ -60,10 +107,16 @@ func (s *Service) CreateUser(ctx context.Context, email, password string) (*stor
 }
 
 func (s *Service) UpdateUser(ctx context.Context, user *store.User) error {
+	ctx, span := tracer.Start(ctx, "user.UpdateUser")
+	defer span.End()
+
 	return s.store.Update(ctx, user)
 }
 
 func (s *Service) UpdatePassword(ctx context.Context, userID uuid.UUID, oldPassword string, newPassword string) error {
+	ctx, span := tracer.Start(ctx, "user.UpdatePassword")
+	defer span.End()
+
 	user, err := s.GetUser(ctx, userID)
 	if err != nil {
 		return err
@@ -92,6 +145,9 @@ func (s *Service) UpdatePassword(ctx context.Context, userID uuid.UUID, oldPassw
 }
 
 func (s *Service) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "user.DeleteUser")
+	defer span.End()
+
 	user, err := s.store.FindByID(ctx, id)
 	if err != nil {
 		return err
@@ -100,24 +156,122 @@ func (s *Service) DeleteUser(ctx context.Context, id uuid.UUID) error {
 	return s.store.Delete(ctx, user)
 }
 
-func (s *Service) Login(ctx context.Context, email string, password string) (string, error) {
+// DeleteAccount deletes the user with all feeds, episodes, identities and keys after checking the password.
+// Users without password, or who do not enter it, must have signed in within the last minutes instead,
+// authenticatedAt is the login time of the access token.
+func (s *Service) DeleteAccount(ctx context.Context, userID uuid.UUID, password string, authenticatedAt time.Time) error {
+	ctx, span := tracer.Start(ctx, "user.DeleteAccount")
+	defer span.End()
+
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if password != "" {
+		if user.Password == nil {
+			return ErrInvalidPassword
+		}
+		match, err := argon2id.ComparePasswordAndHash(password, *user.Password)
+		if err != nil {
+			return err
+		}
+		if !match {
+			return ErrInvalidPassword
+		}
+	} else if time.Since(authenticatedAt) > reauthenticationWindow {
+		return ErrReauthenticationRequired
+	}
+
+	// Revoke first, a failed deletion then only logs the user out
+	if err := s.tokens.RevokeAll(ctx, user.ID); err != nil {
+		return err
+	}
+
+	return s.store.Delete(ctx, user)
+}
+
+// Login checks the password and returns an access token with a refresh token.
+// With 2FA enabled it returns a challenge token instead, see LoginTwoFactor.
+func (s *Service) Login(ctx context.Context, email string, password string) (_ *LoginResult, err error) {
+	ctx, span := tracer.Start(ctx, "user.Login")
+	defer span.End()
+
+	defer func() { metrics.ObserveLogin(metrics.LoginPassword, err) }()
+
 	u, err := s.store.FindByEmail(ctx, email)
 	if err != nil {
-		return "", ErrInvalidPassword // Return generic error for security
+		return nil, ErrInvalidPassword // Return generic error for security
 	}
 
 	// Check if user has a password (OAuth-only users can't login with password)
 	if u.Password == nil {
-		return "", ErrInvalidPassword
+		return nil, ErrInvalidPassword
 	}
 
 	match, err := argon2id.ComparePasswordAndHash(password, *u.Password)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if !match {
-		return "", ErrInvalidPassword
+		return nil, ErrInvalidPassword
+	}
+
+	if s.requireEmailVerification && u.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+
+	if u.TOTPEnabledAt != nil {
+		challenge, err := s.tokens.IssueChallenge(u.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{ChallengeToken: challenge}, nil
 	}
 
-	return auth.CreateJWTToken(u.ID, s.jwtSecret, s.jwtExpirationMin)
+	tokens, err := s.tokens.Issue(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResult{Tokens: tokens}, nil
+}
+
+// RefreshToken rotates the refresh token and returns a new token pair
+func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (*auth.TokenPair, error) {
+	ctx, span := tracer.Start(ctx, "user.RefreshToken")
+	defer span.End()
+
+	return s.tokens.Refresh(ctx, refreshToken)
+}
+
+// Logout revokes the access token with the given ID and the refresh tokens of the same login
+func (s *Service) Logout(ctx context.Context, userID uuid.UUID, tokenID string, expiresAt time.Time, refreshToken string) error {
+	ctx, span := tracer.Start(ctx, "user.Logout")
+	defer span.End()
+
+	return s.tokens.Revoke(ctx, userID, tokenID, expiresAt, refreshToken)
+}
+
+// LogoutAll revokes all access and refresh tokens of the user
+func (s *Service) LogoutAll(ctx context.Context, userID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "user.LogoutAll")
+	defer span.End()
+
+	return s.tokens.RevokeAll(ctx, userID)
+}
+
+// sendInBackground sends a mail after the request returned, so the response time does not reveal whether
+// the address has an account. Failures are logged with msg.
+func (s *Service) sendInBackground(ctx context.Context, msg string, send func(ctx context.Context) error) {
+	ctx = context.WithoutCancel(ctx)
+
+	s.mails.Add(1)
+	go func() {
+		defer s.mails.Done()
+
+		if err := send(ctx); err != nil {
+			slog.ErrorContext(ctx, msg, "error", err)
+		}
+	}()
 }
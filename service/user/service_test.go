@@ -2,14 +2,20 @@ package user
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/alexedwards/argon2id"
 	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"pcast-api/config"
+	"pcast-api/service/auth"
+	tokenStore "pcast-api/store/token"
 	store "pcast-api/store/user"
 )
 
@@ -21,6 +27,11 @@ func strPtr(s string) *string {
 type mockStore struct {
 	user *store.User
 	err  error
+	// totpStep is the last accepted TOTP time step
+	totpStep int64
+	// totpAttempts counts the second factor checks since the last successful one
+	totpAttempts int
+	deleted      bool
 }
 
 func (m *mockStore) FindByEmail(ctx context.Context, email string) (*store.User, error) {
@@ -44,25 +55,97 @@ func (m *mockStore) Update(ctx context.Context, user *store.User) error {
 }
 
 func (m *mockStore) Delete(ctx context.Context, user *store.User) error {
+	m.deleted = m.err == nil
 	return m.err
 }
 
-func (m *mockStore) FindByGoogleID(ctx context.Context, googleID string) (*store.User, error) {
-	return m.user, m.err
+func (m *mockStore) CreateOAuthUser(ctx context.Context, user *store.User) error {
+	return m.err
 }
 
-func (m *mockStore) UpdateGoogleID(ctx context.Context, userID uuid.UUID, googleID string) error {
+func (m *mockStore) SetTOTPSecret(ctx context.Context, user *store.User, secret []byte) error {
+	user.TOTPSecret = secret
+	user.TOTPEnabledAt = nil
 	return m.err
 }
 
-func (m *mockStore) CreateOAuthUser(ctx context.Context, user *store.User) error {
+func (m *mockStore) EnableTOTP(ctx context.Context, user *store.User) error {
+	now := time.Now()
+	user.TOTPEnabledAt = &now
+	return m.err
+}
+
+func (m *mockStore) DisableTOTP(ctx context.Context, user *store.User) error {
+	user.TOTPSecret = nil
+	user.TOTPEnabledAt = nil
 	return m.err
 }
 
+func (m *mockStore) UseTOTPStep(ctx context.Context, user *store.User, step int64) (bool, error) {
+	if step <= m.totpStep {
+		return false, m.err
+	}
+	m.totpStep = step
+	return true, m.err
+}
+
+func (m *mockStore) TakeTOTPAttempt(ctx context.Context, user *store.User, maxAttempts int, lockout time.Duration) (bool, error) {
+	if m.totpAttempts >= maxAttempts {
+		return false, m.err
+	}
+	m.totpAttempts++
+	return true, m.err
+}
+
+func (m *mockStore) ResetTOTPAttempts(ctx context.Context, user *store.User) error {
+	m.totpAttempts = 0
+	return m.err
+}
+
+func (m *mockStore) MarkEmailVerified(ctx context.Context, user *store.User) error {
+	if m.err != nil {
+		return m.err
+	}
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	return nil
+}
+
+// mockRefreshTokenStore implements modelInterface.RefreshToken for testing
+type mockRefreshTokenStore struct{}
+
+func (m *mockRefreshTokenStore) Create(ctx context.Context, token *tokenStore.RefreshToken) error {
+	return nil
+}
+
+func (m *mockRefreshTokenStore) FindByHash(ctx context.Context, tokenHash string) (*tokenStore.RefreshToken, error) {
+	return nil, errors.New("not found")
+}
+
+func (m *mockRefreshTokenStore) MarkUsed(ctx context.Context, token *tokenStore.RefreshToken) (bool, error) {
+	return true, nil
+}
+
+func (m *mockRefreshTokenStore) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	return nil
+}
+
+func (m *mockRefreshTokenStore) RevokeByUserID(ctx context.Context, userID uuid.UUID) error {
+	return nil
+}
+
+func newTokenService() *auth.TokenService {
+	return auth.NewTokenService(&mockRefreshTokenStore{}, nil, auth.NewHMACKeys("testsecret"), 10, 30)
+}
+
+func newService(s *mockStore) *Service {
+	return NewService(&config.Config{}, s, newTokenService(), &mockPasswordResetStore{}, &mockEmailVerificationStore{}, &mockRecoveryCodeStore{}, nil, &mockMailer{})
+}
+
 func TestService_GetUser(t *testing.T) {
 	user := &store.User{Email: "foo@bar.com", Password: strPtr("password")}
 	s := &mockStore{user: user}
-	service := NewService(s, "testsecret", 10)
+	service := newService(s)
 
 	result, err := service.GetUser(context.Background(), user.ID)
 	assert.NoError(t, err)
@@ -72,7 +155,7 @@ func TestService_GetUser(t *testing.T) {
 func TestService_GetUsers(t *testing.T) {
 	user := &store.User{Email: "foo@bar.com", Password: strPtr("password")}
 	s := &mockStore{user: user}
-	service := NewService(s, "testsecret", 10)
+	service := newService(s)
 
 	result, err := service.GetUsers(context.Background())
 	assert.NoError(t, err)
@@ -82,7 +165,7 @@ func TestService_GetUsers(t *testing.T) {
 func TestService_CreateUser(t *testing.T) {
 	user := &store.User{Email: "foo@bar.com", Password: strPtr("password")}
 	s := &mockStore{user: user}
-	service := NewService(s, "testsecret", 10)
+	service := newService(s)
 
 	result, err := service.CreateUser(context.Background(), user.Email, "password")
 	assert.NoError(t, err)
@@ -92,7 +175,7 @@ func TestService_CreateUser(t *testing.T) {
 func TestService_UpdateUser(t *testing.T) {
 	user := &store.User{Email: "foo@bar.com", Password: strPtr("password")}
 	s := &mockStore{user: user}
-	service := NewService(s, "testsecret", 10)
+	service := newService(s)
 
 	err := service.UpdateUser(context.Background(), user)
 	assert.NoError(t, err)
@@ -101,7 +184,7 @@ func TestService_UpdateUser(t *testing.T) {
 func TestService_DeleteUser(t *testing.T) {
 	user := &store.User{Email: "foo@bar.com", Password: strPtr("password")}
 	s := &mockStore{user: user}
-	service := NewService(s, "testsecret", 10)
+	service := newService(s)
 
 	err := service.DeleteUser(context.Background(), user.ID)
 	assert.NoError(t, err)
@@ -110,16 +193,55 @@ func TestService_DeleteUser(t *testing.T) {
 func TestService_DeleteUser_Error(t *testing.T) {
 	user := &store.User{Email: "foo@bar.com", Password: strPtr("password")}
 	s := &mockStore{user: user, err: assert.AnError}
-	service := NewService(s, "testsecret", 10)
+	service := newService(s)
 
 	err := service.DeleteUser(context.Background(), user.ID)
 	assert.Error(t, err)
 }
 
+func TestService_DeleteAccount(t *testing.T) {
+	hash, err := argon2id.CreateHash("password", argon2id.DefaultParams)
+	require.NoError(t, err)
+
+	for name, tc := range map[string]struct {
+		password        *string
+		enteredPassword string
+		authenticatedAt time.Time
+		err             error
+	}{
+		"password":                {password: &hash, enteredPassword: "password"},
+		"wrong password":          {password: &hash, enteredPassword: "wrong", authenticatedAt: time.Now(), err: ErrInvalidPassword},
+		"password of oauth user":  {enteredPassword: "password", err: ErrInvalidPassword},
+		"recent login":            {password: &hash, authenticatedAt: time.Now().Add(-time.Minute)},
+		"recent login oauth user": {authenticatedAt: time.Now().Add(-time.Minute)},
+		"old login":               {password: &hash, authenticatedAt: time.Now().Add(-time.Hour), err: ErrReauthenticationRequired},
+		"unknown login":           {err: ErrReauthenticationRequired},
+	} {
+		t.Run(name, func(t *testing.T) {
+			user := &store.User{ID: uuid.Must(uuid.NewV7()), Email: "foo@bar.com", Password: tc.password}
+			s := &mockStore{user: user}
+			revocations := &mockRevocationStore{}
+			tokens := auth.NewTokenService(&mockRefreshTokenStore{}, revocations, auth.NewHMACKeys("testsecret"), 10, 30)
+			service := NewService(&config.Config{}, s, tokens, &mockPasswordResetStore{}, &mockEmailVerificationStore{}, &mockRecoveryCodeStore{}, nil, &mockMailer{})
+
+			err := service.DeleteAccount(context.Background(), user.ID, tc.enteredPassword, tc.authenticatedAt)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				assert.False(t, s.deleted)
+				assert.Empty(t, revocations.revokedUsers)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, s.deleted)
+			assert.Equal(t, []uuid.UUID{user.ID}, revocations.revokedUsers)
+		})
+	}
+}
+
 func TestService_CreateUser_Error(t *testing.T) {
 	user := &store.User{Email: "foo@bar.com", Password: strPtr("password")}
 	s := &mockStore{user: user, err: assert.AnError}
-	service := NewService(s, "testsecret", 10)
+	service := newService(s)
 
 	_, err := service.CreateUser(context.Background(), user.Email, "password")
 	assert.Error(t, err)
@@ -128,7 +250,7 @@ func TestService_CreateUser_Error(t *testing.T) {
 func TestService_UpdateUser_Error(t *testing.T) {
 	user := &store.User{Email: "foo@bar.com", Password: strPtr("password")}
 	s := &mockStore{user: user, err: assert.AnError}
-	service := NewService(s, "testsecret", 10)
+	service := newService(s)
 
 	err := service.UpdateUser(context.Background(), user)
 	assert.Error(t, err)
@@ -137,7 +259,7 @@ func TestService_UpdateUser_Error(t *testing.T) {
 func TestService_GetUser_Error(t *testing.T) {
 	user := &store.User{Email: "foo@bar.com", Password: strPtr("password")}
 	s := &mockStore{user: user, err: assert.AnError}
-	service := NewService(s, "testsecret", 10)
+	service := newService(s)
 
 	_, err := service.GetUser(context.Background(), user.ID)
 	assert.Error(t, err)
@@ -146,7 +268,7 @@ func TestService_GetUser_Error(t *testing.T) {
 func TestService_GetUsers_Error(t *testing.T) {
 	user := &store.User{Email: "foo@bar.com", Password: strPtr("password")}
 	s := &mockStore{user: user, err: assert.AnError}
-	service := NewService(s, "testsecret", 10)
+	service := newService(s)
 
 	_, err := service.GetUsers(context.Background())
 	assert.Error(t, err)
@@ -162,13 +284,19 @@ func TestService_Login(t *testing.T) {
 
 	user := &store.User{ID: userID, Email: "foo@bar.com", Password: &hash}
 	s := &mockStore{user: user}
-	service := NewService(s, "testsecret", 10)
+	service := newService(s)
 
-	tokenString, err := service.Login(context.Background(), user.Email, password)
+	result, err := service.Login(context.Background(), user.Email, password)
 	assert.NoError(t, err)
-	assert.NotEmpty(t, tokenString)
+	if !assert.NotNil(t, result) || !assert.NotNil(t, result.Tokens) {
+		t.FailNow()
+	}
+	assert.Empty(t, result.ChallengeToken)
+	tokens := result.Tokens
+	assert.NotEmpty(t, tokens.RefreshToken)
+	assert.Equal(t, 600, tokens.ExpiresIn)
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+	token, err := jwt.Parse(tokens.AccessToken, func(token *jwt.Token) (interface{}, error) {
 		// Don't forget to validate the alg is what you expect:
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -188,12 +316,12 @@ func TestService_Login(t *testing.T) {
 
 func TestService_Login_UserNotFound(t *testing.T) {
 	s := &mockStore{err: assert.AnError}
-	service := NewService(s, "testsecret", 10)
+	service := newService(s)
 
-	tokenString, err := service.Login(context.Background(), "nonexistent@bar.com", "password")
+	tokens, err := service.Login(context.Background(), "nonexistent@bar.com", "password")
 	assert.Error(t, err)
 	assert.Equal(t, ErrInvalidPassword, err)
-	assert.Empty(t, tokenString)
+	assert.Nil(t, tokens)
 }
 
 func TestService_Login_WrongPassword(t *testing.T) {
@@ -204,26 +332,26 @@ func TestService_Login_WrongPassword(t *testing.T) {
 
 	user := &store.User{ID: userID, Email: "foo@bar.com", Password: &hash}
 	s := &mockStore{user: user}
-	service := NewService(s, "testsecret", 10)
+	service := newService(s)
 
-	tokenString, err := service.Login(context.Background(), user.Email, "wrongpassword")
+	tokens, err := service.Login(context.Background(), user.Email, "wrongpassword")
 	assert.Error(t, err)
 	assert.Equal(t, ErrInvalidPassword, err)
-	assert.Empty(t, tokenString)
+	assert.Nil(t, tokens)
 }
 
 func TestService_Login_OAuthUserNoPassword(t *testing.T) {
 	userID := uuid.Must(uuid.NewV7())
 
 	// OAuth user has no password
-	user := &store.User{ID: userID, Email: "foo@bar.com", Password: nil, GoogleID: strPtr("google123")}
+	user := &store.User{ID: userID, Email: "foo@bar.com", Password: nil}
 	s := &mockStore{user: user}
-	service := NewService(s, "testsecret", 10)
+	service := newService(s)
 
-	tokenString, err := service.Login(context.Background(), user.Email, "anypassword")
+	tokens, err := service.Login(context.Background(), user.Email, "anypassword")
 	assert.Error(t, err)
 	assert.Equal(t, ErrInvalidPassword, err)
-	assert.Empty(t, tokenString)
+	assert.Nil(t, tokens)
 }
 
 func TestService_UpdatePassword(t *testing.T) {
@@ -236,7 +364,7 @@ func TestService_UpdatePassword(t *testing.T) {
 
 	user := &store.User{ID: userID, Email: "foo@bar.com", Password: &hash}
 	s := &mockStore{user: user}
-	service := NewService(s, "testsecret", 10)
+	service := newService(s)
 
 	err = service.UpdatePassword(context.Background(), userID, oldPassword, newPassword)
 	assert.NoError(t, err)
@@ -255,7 +383,7 @@ func TestService_UpdatePassword_WrongOldPassword(t *testing.T) {
 
 	user := &store.User{ID: userID, Email: "foo@bar.com", Password: &hash}
 	s := &mockStore{user: user}
-	service := NewService(s, "testsecret", 10)
+	service := newService(s)
 
 	err = service.UpdatePassword(context.Background(), userID, "wrongpassword", "newpassword")
 	assert.Error(t, err)
@@ -264,7 +392,7 @@ func TestService_UpdatePassword_WrongOldPassword(t *testing.T) {
 
 func TestService_UpdatePassword_UserNotFound(t *testing.T) {
 	s := &mockStore{err: assert.AnError}
-	service := NewService(s, "testsecret", 10)
+	service := newService(s)
 
 	err := service.UpdatePassword(context.Background(), uuid.Must(uuid.NewV7()), "old", "new")
 	assert.Error(t, err)
@@ -275,9 +403,9 @@ func TestService_UpdatePassword_OAuthUserNoPassword(t *testing.T) {
 	userID := uuid.Must(uuid.NewV7())
 
 	// OAuth user has no password
-	user := &store.User{ID: userID, Email: "foo@bar.com", Password: nil, GoogleID: strPtr("google123")}
+	user := &store.User{ID: userID, Email: "foo@bar.com", Password: nil}
 	s := &mockStore{user: user}
-	service := NewService(s, "testsecret", 10)
+	service := newService(s)
 
 	err := service.UpdatePassword(context.Background(), userID, "old", "new")
 	assert.Error(t, err)
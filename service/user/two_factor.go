@@ -0,0 +1,327 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"pcast-api/metrics"
+	"pcast-api/service/auth"
+	store "pcast-api/store/user"
+)
+
+// totpIssuer is the name authenticator apps show for the account
+const totpIssuer = "pcast"
+
+// recoveryCodeCount is the number of recovery codes generated on enrollment
+const recoveryCodeCount = 10
+
+// maxTwoFactorAttempts is the number of wrong second factors after which checks are refused for twoFactorLockout.
+// A new challenge only needs the password, so the limit is kept per user.
+const (
+	maxTwoFactorAttempts = 5
+	twoFactorLockout     = 15 * time.Minute
+)
+
+var (
+	ErrTwoFactorUnsupported = errors.New("two-factor authentication requires an encryption key")
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication is not enrolled")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	ErrTwoFactorLocked      = errors.New("too many invalid two-factor codes, try again later")
+)
+
+// recoveryCodeEncoding renders recovery codes without the easily confused characters 0, 1, 8 and 9
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// LoginResult is the outcome of a password login: the tokens or, if 2FA is enabled,
+// a challenge token to exchange for the tokens together with the second factor
+type LoginResult struct {
+	Tokens         *auth.TokenPair
+	ChallengeToken string
+}
+
+// TwoFactorEnrollment is the secret of a new authenticator, in manual entry form and as otpauth:// URI
+type TwoFactorEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// TwoFactorStatus tells whether 2FA is enabled and how many recovery codes are left
+type TwoFactorStatus struct {
+	Enabled                bool
+	RecoveryCodesRemaining int
+}
+
+// LoginTwoFactor completes a login with a challenge token from Login and a TOTP or recovery code
+func (s *Service) LoginTwoFactor(ctx context.Context, challenge string, code string) (_ *auth.TokenPair, err error) {
+	ctx, span := tracer.Start(ctx, "user.LoginTwoFactor")
+	defer span.End()
+
+	defer func() { metrics.ObserveLogin(metrics.LoginTwoFactor, err) }()
+
+	userID, err := s.tokens.VerifyChallenge(challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, auth.ErrInvalidChallenge
+	}
+
+	// 2FA may have been disabled since the password check, which is all that is required then
+	if user.TOTPEnabledAt != nil {
+		if err := s.verifySecondFactor(ctx, user, code); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.tokens.Issue(ctx, user.ID)
+}
+
+// EnrollTwoFactor creates a new TOTP secret for the user. 2FA stays disabled until a code is confirmed,
+// so a user who does not finish the setup is not locked out.
+func (s *Service) EnrollTwoFactor(ctx context.Context, userID uuid.UUID) (*TwoFactorEnrollment, error) {
+	ctx, span := tracer.Start(ctx, "user.EnrollTwoFactor")
+	defer span.End()
+
+	if s.cipher == nil {
+		return nil, ErrTwoFactorUnsupported
+	}
+
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabledAt != nil {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := s.cipher.Encrypt(secret, user.ID[:])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store.SetTOTPSecret(ctx, user, encrypted); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorEnrollment{
+		Secret: auth.EncodeTOTPSecret(secret),
+		URI:    auth.TOTPURI(totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor enables 2FA once the user entered a code of the enrolled authenticator.
+// Returns the recovery codes, they are only stored hashed and cannot be shown again.
+func (s *Service) ConfirmTwoFactor(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "user.ConfirmTwoFactor")
+	defer span.End()
+
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabledAt != nil {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == nil {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	if err := s.verifyTOTP(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	if err := s.store.EnableTOTP(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return s.replaceRecoveryCodes(ctx, user)
+}
+
+// DisableTwoFactor turns 2FA off after checking a TOTP or recovery code
+func (s *Service) DisableTwoFactor(ctx context.Context, userID uuid.UUID, code string) error {
+	ctx, span := tracer.Start(ctx, "user.DisableTwoFactor")
+	defer span.End()
+
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabledAt == nil {
+		return ErrTwoFactorNotEnrolled
+	}
+
+	if err := s.verifySecondFactor(ctx, user, code); err != nil {
+		return err
+	}
+
+	if err := s.store.DisableTOTP(ctx, user); err != nil {
+		return err
+	}
+
+	return s.recoveryCodes.DeleteByUserID(ctx, user.ID)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the user after checking a TOTP or recovery code
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "user.RegenerateRecoveryCodes")
+	defer span.End()
+
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabledAt == nil {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	if err := s.verifySecondFactor(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	return s.replaceRecoveryCodes(ctx, user)
+}
+
+// GetTwoFactorStatus returns the 2FA state of the user
+func (s *Service) GetTwoFactorStatus(ctx context.Context, userID uuid.UUID) (*TwoFactorStatus, error) {
+	ctx, span := tracer.Start(ctx, "user.GetTwoFactorStatus")
+	defer span.End()
+
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabledAt == nil {
+		return &TwoFactorStatus{}, nil
+	}
+
+	remaining, err := s.recoveryCodes.CountUnused(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorStatus{Enabled: true, RecoveryCodesRemaining: remaining}, nil
+}
+
+// verifySecondFactor accepts a 6 digit TOTP code or one of the recovery codes. Once maxTwoFactorAttempts
+// checks failed, all codes are refused until the lockout is over.
+func (s *Service) verifySecondFactor(ctx context.Context, user *store.User, code string) error {
+	allowed, err := s.store.TakeTOTPAttempt(ctx, user, maxTwoFactorAttempts, twoFactorLockout)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrTwoFactorLocked
+	}
+
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if isTOTPCode(code) {
+		err = s.verifyTOTP(ctx, user, code)
+	} else {
+		err = s.verifyRecoveryCode(ctx, user, code)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.store.ResetTOTPAttempts(ctx, user)
+}
+
+func (s *Service) verifyRecoveryCode(ctx context.Context, user *store.User, code string) error {
+	used, err := s.recoveryCodes.Use(ctx, user.ID, auth.HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+// verifyTOTP checks the code against the secret of the user. Every code is accepted once.
+func (s *Service) verifyTOTP(ctx context.Context, user *store.User, code string) error {
+	if s.cipher == nil {
+		return ErrTwoFactorUnsupported
+	}
+
+	secret, err := s.cipher.Decrypt(user.TOTPSecret, user.ID[:])
+	if err != nil {
+		return err
+	}
+
+	step, ok := auth.ValidateTOTP(secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	fresh, err := s.store.UseTOTPStep(ctx, user, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+func (s *Service) replaceRecoveryCodes(ctx context.Context, user *store.User) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = auth.HashToken(normalizeRecoveryCode(code))
+	}
+
+	if err := s.recoveryCodes.Replace(ctx, user.ID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// generateRecoveryCode returns 80 random bits as 16 base32 characters in groups of four, e.g. ABCD-EFGH-IJKL-MNOP
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	encoded := recoveryCodeEncoding.EncodeToString(b)
+	return encoded[0:4] + "-" + encoded[4:8] + "-" + encoded[8:12] + "-" + encoded[12:16], nil
+}
+
+// normalizeRecoveryCode makes the check independent of case and grouping
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != 6 {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
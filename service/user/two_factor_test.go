@@ -0,0 +1,281 @@
+package user
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pcast-api/config"
+	"pcast-api/service/auth"
+	store "pcast-api/store/user"
+)
+
+// mockRecoveryCodeStore keeps the unused recovery code hashes per user in memory
+type mockRecoveryCodeStore struct {
+	codes map[uuid.UUID]map[string]bool
+}
+
+func (m *mockRecoveryCodeStore) Replace(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	if m.codes == nil {
+		m.codes = map[uuid.UUID]map[string]bool{}
+	}
+	m.codes[userID] = map[string]bool{}
+	for _, hash := range codeHashes {
+		m.codes[userID][hash] = true
+	}
+	return nil
+}
+
+func (m *mockRecoveryCodeStore) Use(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	if !m.codes[userID][codeHash] {
+		return false, nil
+	}
+	delete(m.codes[userID], codeHash)
+	return true, nil
+}
+
+func (m *mockRecoveryCodeStore) CountUnused(ctx context.Context, userID uuid.UUID) (int, error) {
+	return len(m.codes[userID]), nil
+}
+
+func (m *mockRecoveryCodeStore) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	delete(m.codes, userID)
+	return nil
+}
+
+func newTwoFactorService(t *testing.T, user *store.User) (*Service, *mockRecoveryCodeStore) {
+	cipher, err := auth.NewCipher([]byte("0123456789abcdef0123456789abcdef"), auth.PurposeTOTPSecret)
+	require.NoError(t, err)
+
+	recoveryCodes := &mockRecoveryCodeStore{}
+	service := NewService(&config.Config{}, &mockStore{user: user}, newTokenService(), &mockPasswordResetStore{}, &mockEmailVerificationStore{}, recoveryCodes, cipher, &mockMailer{})
+	return service, recoveryCodes
+}
+
+// enableTwoFactor enrolls and confirms 2FA, returning the secret, the recovery codes and the confirmed code
+func enableTwoFactor(t *testing.T, service *Service, user *store.User) ([]byte, []string, string) {
+	enrollment, err := service.EnrollTwoFactor(context.Background(), user.ID)
+	require.NoError(t, err)
+
+	uri, err := url.Parse(enrollment.URI)
+	require.NoError(t, err)
+	assert.Equal(t, enrollment.Secret, uri.Query().Get("secret"))
+	assert.Equal(t, "/pcast:"+user.Email, uri.Path)
+
+	secret, err := recoveryCodeEncoding.DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+
+	code := auth.TOTPCode(secret, time.Now())
+	codes, err := service.ConfirmTwoFactor(context.Background(), user.ID, code)
+	require.NoError(t, err)
+
+	return secret, codes, code
+}
+
+func TestService_EnrollTwoFactor(t *testing.T) {
+	user := newUserWithPassword(t, "password")
+	service, recoveryCodes := newTwoFactorService(t, user)
+
+	enrollment, err := service.EnrollTwoFactor(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.Len(t, enrollment.Secret, 32)
+	assert.NotNil(t, user.TOTPSecret)
+	assert.NotContains(t, string(user.TOTPSecret), enrollment.Secret)
+	assert.Nil(t, user.TOTPEnabledAt)
+
+	// Not enabled before the first code is confirmed
+	result, err := service.Login(context.Background(), user.Email, "password")
+	require.NoError(t, err)
+	assert.NotNil(t, result.Tokens)
+
+	_, err = service.ConfirmTwoFactor(context.Background(), user.ID, "000000")
+	assert.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+	assert.Nil(t, user.TOTPEnabledAt)
+
+	secret, err := recoveryCodeEncoding.DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+	codes, err := service.ConfirmTwoFactor(context.Background(), user.ID, auth.TOTPCode(secret, time.Now()))
+	require.NoError(t, err)
+	assert.NotNil(t, user.TOTPEnabledAt)
+	assert.Len(t, codes, 10)
+	assert.Len(t, recoveryCodes.codes[user.ID], 10)
+	assert.Regexp(t, `^[A-Z2-7]{4}-[A-Z2-7]{4}-[A-Z2-7]{4}-[A-Z2-7]{4}$`, codes[0])
+
+	_, err = service.EnrollTwoFactor(context.Background(), user.ID)
+	assert.ErrorIs(t, err, ErrTwoFactorEnabled)
+}
+
+func TestService_EnrollTwoFactor_NoCipher(t *testing.T) {
+	user := newUserWithPassword(t, "password")
+	service := newService(&mockStore{user: user})
+
+	_, err := service.EnrollTwoFactor(context.Background(), user.ID)
+	assert.ErrorIs(t, err, ErrTwoFactorUnsupported)
+}
+
+func TestService_ConfirmTwoFactor_SecretOfOtherUser(t *testing.T) {
+	user := newUserWithPassword(t, "password")
+	service, _ := newTwoFactorService(t, user)
+
+	enrollment, err := service.EnrollTwoFactor(context.Background(), user.ID)
+	require.NoError(t, err)
+	secret, err := recoveryCodeEncoding.DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+
+	// The secret is bound to the user, copied to another account it does not decrypt
+	user.ID = uuid.Must(uuid.NewV7())
+	_, err = service.ConfirmTwoFactor(context.Background(), user.ID, auth.TOTPCode(secret, time.Now()))
+	assert.ErrorIs(t, err, auth.ErrDecryptFailed)
+	assert.Nil(t, user.TOTPEnabledAt)
+}
+
+func TestService_ConfirmTwoFactor_NotEnrolled(t *testing.T) {
+	user := newUserWithPassword(t, "password")
+	service, _ := newTwoFactorService(t, user)
+
+	_, err := service.ConfirmTwoFactor(context.Background(), user.ID, "123456")
+	assert.ErrorIs(t, err, ErrTwoFactorNotEnrolled)
+}
+
+func TestService_LoginTwoFactor(t *testing.T) {
+	user := newUserWithPassword(t, "password")
+	service, _ := newTwoFactorService(t, user)
+	secret, _, confirmed := enableTwoFactor(t, service, user)
+
+	result, err := service.Login(context.Background(), user.Email, "password")
+	require.NoError(t, err)
+	assert.Nil(t, result.Tokens)
+	require.NotEmpty(t, result.ChallengeToken)
+
+	// The code used for the confirmation cannot be used again
+	_, err = service.LoginTwoFactor(context.Background(), result.ChallengeToken, confirmed)
+	assert.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+
+	tokens, err := service.LoginTwoFactor(context.Background(), result.ChallengeToken, auth.TOTPCode(secret, time.Now().Add(30*time.Second)))
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+}
+
+func TestService_LoginTwoFactor_RecoveryCode(t *testing.T) {
+	user := newUserWithPassword(t, "password")
+	service, _ := newTwoFactorService(t, user)
+	_, codes, _ := enableTwoFactor(t, service, user)
+
+	result, err := service.Login(context.Background(), user.Email, "password")
+	require.NoError(t, err)
+
+	// Recovery codes are accepted regardless of case and grouping
+	code := strings.ToLower(strings.ReplaceAll(codes[0], "-", ""))
+	tokens, err := service.LoginTwoFactor(context.Background(), result.ChallengeToken, code)
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+
+	_, err = service.LoginTwoFactor(context.Background(), result.ChallengeToken, codes[0])
+	assert.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+
+	status, err := service.GetTwoFactorStatus(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.True(t, status.Enabled)
+	assert.Equal(t, 9, status.RecoveryCodesRemaining)
+}
+
+func TestService_LoginTwoFactor_Locked(t *testing.T) {
+	user := newUserWithPassword(t, "password")
+	service, _ := newTwoFactorService(t, user)
+	secret, codes, _ := enableTwoFactor(t, service, user)
+
+	// The budget is per user, new challenges do not reset it
+	for range maxTwoFactorAttempts {
+		result, err := service.Login(context.Background(), user.Email, "password")
+		require.NoError(t, err)
+
+		_, err = service.LoginTwoFactor(context.Background(), result.ChallengeToken, "AAAA-AAAA-AAAA-AAAA")
+		assert.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+	}
+
+	result, err := service.Login(context.Background(), user.Email, "password")
+	require.NoError(t, err)
+
+	// Even correct codes are refused now
+	_, err = service.LoginTwoFactor(context.Background(), result.ChallengeToken, auth.TOTPCode(secret, time.Now().Add(30*time.Second)))
+	assert.ErrorIs(t, err, ErrTwoFactorLocked)
+	_, err = service.LoginTwoFactor(context.Background(), result.ChallengeToken, codes[0])
+	assert.ErrorIs(t, err, ErrTwoFactorLocked)
+}
+
+func TestService_LoginTwoFactor_SuccessResetsAttempts(t *testing.T) {
+	user := newUserWithPassword(t, "password")
+	service, _ := newTwoFactorService(t, user)
+	_, codes, _ := enableTwoFactor(t, service, user)
+
+	result, err := service.Login(context.Background(), user.Email, "password")
+	require.NoError(t, err)
+
+	for range maxTwoFactorAttempts - 1 {
+		_, err = service.LoginTwoFactor(context.Background(), result.ChallengeToken, "AAAA-AAAA-AAAA-AAAA")
+		assert.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+	}
+	_, err = service.LoginTwoFactor(context.Background(), result.ChallengeToken, codes[0])
+	require.NoError(t, err)
+
+	_, err = service.LoginTwoFactor(context.Background(), result.ChallengeToken, "AAAA-AAAA-AAAA-AAAA")
+	assert.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+	_, err = service.LoginTwoFactor(context.Background(), result.ChallengeToken, codes[1])
+	assert.NoError(t, err)
+}
+
+func TestService_LoginTwoFactor_InvalidChallenge(t *testing.T) {
+	user := newUserWithPassword(t, "password")
+	service, _ := newTwoFactorService(t, user)
+	enableTwoFactor(t, service, user)
+
+	_, err := service.LoginTwoFactor(context.Background(), "invalid", "123456")
+	assert.ErrorIs(t, err, auth.ErrInvalidChallenge)
+}
+
+func TestService_DisableTwoFactor(t *testing.T) {
+	user := newUserWithPassword(t, "password")
+	service, recoveryCodes := newTwoFactorService(t, user)
+	secret, _, _ := enableTwoFactor(t, service, user)
+
+	err := service.DisableTwoFactor(context.Background(), user.ID, "000000")
+	assert.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+
+	err = service.DisableTwoFactor(context.Background(), user.ID, auth.TOTPCode(secret, time.Now().Add(30*time.Second)))
+	require.NoError(t, err)
+	assert.Nil(t, user.TOTPSecret)
+	assert.Nil(t, user.TOTPEnabledAt)
+	assert.Empty(t, recoveryCodes.codes[user.ID])
+
+	result, err := service.Login(context.Background(), user.Email, "password")
+	require.NoError(t, err)
+	assert.NotNil(t, result.Tokens)
+
+	status, err := service.GetTwoFactorStatus(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.False(t, status.Enabled)
+}
+
+func TestService_RegenerateRecoveryCodes(t *testing.T) {
+	user := newUserWithPassword(t, "password")
+	service, _ := newTwoFactorService(t, user)
+	_, codes, _ := enableTwoFactor(t, service, user)
+
+	newCodes, err := service.RegenerateRecoveryCodes(context.Background(), user.ID, codes[0])
+	require.NoError(t, err)
+	assert.Len(t, newCodes, 10)
+
+	// The old codes are gone
+	err = service.DisableTwoFactor(context.Background(), user.ID, codes[1])
+	assert.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+
+	err = service.DisableTwoFactor(context.Background(), user.ID, newCodes[0])
+	assert.NoError(t, err)
+}
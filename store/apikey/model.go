@@ -0,0 +1,53 @@
+package apikey
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"pcast-api/store"
+)
+
+// APIKey is a personal key of a user for scripts and integrations. Only the hash of the key is stored.
+type APIKey struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Name      string
+	KeyHash   string
+	// KeyPrefix is the start of the key, so users can tell their keys apart
+	KeyPrefix string
+	Scopes    []string
+	// ExpiresAt is nil for keys that do not expire
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+}
+
+func (k *APIKey) SetID(id uuid.UUID) {
+	k.ID = id
+}
+
+func (k *APIKey) GetID() uuid.UUID {
+	return k.ID
+}
+
+func (k *APIKey) SetCreatedAt(createdAt time.Time) {
+	k.CreatedAt = createdAt
+}
+
+func (k *APIKey) GetCreatedAt() time.Time {
+	return k.CreatedAt
+}
+
+func (k *APIKey) SetUpdatedAt(updatedAt time.Time) {
+	k.UpdatedAt = updatedAt
+}
+
+func (k *APIKey) GetUpdatedAt() time.Time {
+	return k.UpdatedAt
+}
+
+func (k *APIKey) BeforeCreate() error {
+	return store.BeforeCreate(k)
+}
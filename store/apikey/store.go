@@ -0,0 +1,129 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"pcast-api/db"
+	"pcast-api/db/sqlcgen"
+)
+
+type Store struct {
+	queries *sqlcgen.Queries
+}
+
+func New(database *sql.DB) *Store {
+	return &Store{
+		queries: sqlcgen.New(db.Trace(database)),
+	}
+}
+
+func (s *Store) Create(ctx context.Context, key *APIKey) error {
+	if err := key.BeforeCreate(); err != nil {
+		return err
+	}
+
+	_, err := s.queries.CreateAPIKey(ctx, sqlcgen.CreateAPIKeyParams{
+		ID:        key.ID,
+		CreatedAt: key.CreatedAt,
+		UpdatedAt: key.UpdatedAt,
+		UserID:    key.UserID,
+		Name:      key.Name,
+		KeyHash:   key.KeyHash,
+		KeyPrefix: key.KeyPrefix,
+		Scopes:    key.Scopes,
+		ExpiresAt: timePtrToNullTime(key.ExpiresAt),
+	})
+
+	return err
+}
+
+func (s *Store) FindByHash(ctx context.Context, keyHash string) (*APIKey, error) {
+	row, err := s.queries.FindAPIKeyByHash(ctx, keyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertAPIKeyRowToModelPtr(*row), nil
+}
+
+func (s *Store) FindByUserID(ctx context.Context, userID uuid.UUID) ([]APIKey, error) {
+	rows, err := s.queries.FindAPIKeysByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]APIKey, len(rows))
+	for i, row := range rows {
+		keys[i] = convertAPIKeyRowToModel(*row)
+	}
+	return keys, nil
+}
+
+// MarkUsed sets the last use of the key to now
+func (s *Store) MarkUsed(ctx context.Context, key *APIKey) error {
+	now := time.Now()
+
+	err := s.queries.UpdateAPIKeyLastUsed(ctx, sqlcgen.UpdateAPIKeyLastUsedParams{
+		ID:         key.ID,
+		LastUsedAt: sql.NullTime{Time: now, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+
+	key.LastUsedAt = &now
+	return nil
+}
+
+// Delete removes the key of the user. Returns false if the user has no key with this ID.
+func (s *Store) Delete(ctx context.Context, userID uuid.UUID, id uuid.UUID) (bool, error) {
+	rows, err := s.queries.DeleteAPIKey(ctx, sqlcgen.DeleteAPIKeyParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+func timePtrToNullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{Valid: false}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+func nullTimeToTimePtr(nt sql.NullTime) *time.Time {
+	if !nt.Valid {
+		return nil
+	}
+	return &nt.Time
+}
+
+// Helper function to convert sqlcgen.ApiKey to APIKey
+func convertAPIKeyRowToModel(row sqlcgen.ApiKey) APIKey {
+	return APIKey{
+		ID:         row.ID,
+		CreatedAt:  row.CreatedAt,
+		UpdatedAt:  row.UpdatedAt,
+		UserID:     row.UserID,
+		Name:       row.Name,
+		KeyHash:    row.KeyHash,
+		KeyPrefix:  row.KeyPrefix,
+		Scopes:     row.Scopes,
+		ExpiresAt:  nullTimeToTimePtr(row.ExpiresAt),
+		LastUsedAt: nullTimeToTimePtr(row.LastUsedAt),
+	}
+}
+
+// Helper function to convert sqlcgen.ApiKey to *APIKey
+func convertAPIKeyRowToModelPtr(row sqlcgen.ApiKey) *APIKey {
+	key := convertAPIKeyRowToModel(row)
+	return &key
+}
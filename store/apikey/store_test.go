@@ -0,0 +1,177 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"pcast-api/db"
+)
+
+var d *sql.DB
+var ks *Store
+
+const testDSN = "host=localhost port=5432 user=pcast password=pcast dbname=pcast_test sslmode=disable"
+
+func TestMain(m *testing.M) {
+	setup()
+
+	code := m.Run()
+
+	tearDown()
+
+	os.Exit(code)
+}
+
+func setup() {
+	d = db.NewTestDB(testDSN)
+
+	runMigrations()
+	truncateTable()
+
+	ks = New(d)
+}
+
+func tearDown() {
+	truncateTable()
+	d.Close()
+}
+
+func runMigrations() {
+	d.Exec(`
+		CREATE TABLE IF NOT EXISTS users (
+			id UUID PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			email VARCHAR(255) UNIQUE NOT NULL,
+			password VARCHAR(255),
+			email_verified_at TIMESTAMP,
+			totp_secret BYTEA,
+			totp_enabled_at TIMESTAMP,
+			totp_last_step BIGINT,
+			totp_attempts INT NOT NULL DEFAULT 0,
+			totp_attempted_at TIMESTAMP
+		)
+	`)
+	d.Exec(`
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id UUID PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(255) NOT NULL,
+			key_hash VARCHAR(64) UNIQUE NOT NULL,
+			key_prefix VARCHAR(16) NOT NULL,
+			scopes TEXT[] NOT NULL,
+			expires_at TIMESTAMP,
+			last_used_at TIMESTAMP
+		)
+	`)
+}
+
+func truncateTable() {
+	d.Exec("TRUNCATE TABLE api_keys")
+	d.Exec("TRUNCATE TABLE users CASCADE")
+}
+
+func createUser(t *testing.T) uuid.UUID {
+	userID := uuid.Must(uuid.NewV7())
+	_, err := d.Exec(
+		"INSERT INTO users (id, created_at, updated_at, email, password) VALUES ($1, $2, $3, $4, $5)",
+		userID, time.Now(), time.Now(), fmt.Sprintf("apikey-%s@example.com", userID), "password",
+	)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return userID
+}
+
+func newKey(userID uuid.UUID) *APIKey {
+	return &APIKey{
+		UserID:    userID,
+		Name:      "cron",
+		KeyHash:   uuid.NewString(),
+		KeyPrefix: "pcast_abcdef",
+		Scopes:    []string{"feeds:read", "feeds:write"},
+	}
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	t.Cleanup(truncateTable)
+	key := newKey(createUser(t))
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	key.ExpiresAt = &expiresAt
+
+	err := ks.Create(context.Background(), key)
+	assert.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, key.ID)
+
+	found, err := ks.FindByHash(context.Background(), key.KeyHash)
+	assert.NoError(t, err)
+	assert.Equal(t, key.ID, found.ID)
+	assert.Equal(t, "cron", found.Name)
+	assert.Equal(t, []string{"feeds:read", "feeds:write"}, found.Scopes)
+	assert.WithinDuration(t, expiresAt, *found.ExpiresAt, time.Millisecond)
+	assert.Nil(t, found.LastUsedAt)
+}
+
+func TestFindAPIKeyByHash_NotFound(t *testing.T) {
+	_, err := ks.FindByHash(context.Background(), "unknown")
+	assert.Error(t, err)
+}
+
+func TestFindAPIKeysByUserID(t *testing.T) {
+	t.Cleanup(truncateTable)
+	userID := createUser(t)
+	first := newKey(userID)
+	second := newKey(userID)
+	for _, key := range []*APIKey{first, second, newKey(createUser(t))} {
+		assert.NoError(t, ks.Create(context.Background(), key))
+	}
+
+	keys, err := ks.FindByUserID(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, first.ID, keys[0].ID)
+	assert.Equal(t, second.ID, keys[1].ID)
+	assert.Nil(t, keys[0].ExpiresAt)
+}
+
+func TestMarkAPIKeyUsed(t *testing.T) {
+	t.Cleanup(truncateTable)
+	key := newKey(createUser(t))
+	assert.NoError(t, ks.Create(context.Background(), key))
+
+	err := ks.MarkUsed(context.Background(), key)
+	assert.NoError(t, err)
+	assert.NotNil(t, key.LastUsedAt)
+
+	found, err := ks.FindByHash(context.Background(), key.KeyHash)
+	assert.NoError(t, err)
+	assert.NotNil(t, found.LastUsedAt)
+}
+
+func TestDeleteAPIKey(t *testing.T) {
+	t.Cleanup(truncateTable)
+	userID := createUser(t)
+	key := newKey(userID)
+	assert.NoError(t, ks.Create(context.Background(), key))
+
+	// Only the owner can delete the key
+	deleted, err := ks.Delete(context.Background(), createUser(t), key.ID)
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+
+	deleted, err = ks.Delete(context.Background(), userID, key.ID)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+
+	_, err = ks.FindByHash(context.Background(), key.KeyHash)
+	assert.Error(t, err)
+}
@@ -0,0 +1,48 @@
+package emailverification
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"pcast-api/store"
+)
+
+// EmailVerificationToken is a single use token mailed to a user to confirm the address. Only the hash of the token is stored.
+type EmailVerificationToken struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+func (t *EmailVerificationToken) SetID(id uuid.UUID) {
+	t.ID = id
+}
+
+func (t *EmailVerificationToken) GetID() uuid.UUID {
+	return t.ID
+}
+
+func (t *EmailVerificationToken) SetCreatedAt(createdAt time.Time) {
+	t.CreatedAt = createdAt
+}
+
+func (t *EmailVerificationToken) GetCreatedAt() time.Time {
+	return t.CreatedAt
+}
+
+func (t *EmailVerificationToken) SetUpdatedAt(updatedAt time.Time) {
+	t.UpdatedAt = updatedAt
+}
+
+func (t *EmailVerificationToken) GetUpdatedAt() time.Time {
+	return t.UpdatedAt
+}
+
+func (t *EmailVerificationToken) BeforeCreate() error {
+	return store.BeforeCreate(t)
+}
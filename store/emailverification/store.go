@@ -0,0 +1,92 @@
+package emailverification
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"pcast-api/db"
+	"pcast-api/db/sqlcgen"
+)
+
+type Store struct {
+	queries *sqlcgen.Queries
+}
+
+func New(database *sql.DB) *Store {
+	return &Store{
+		queries: sqlcgen.New(db.Trace(database)),
+	}
+}
+
+func (s *Store) Create(ctx context.Context, token *EmailVerificationToken) error {
+	if err := token.BeforeCreate(); err != nil {
+		return err
+	}
+
+	_, err := s.queries.CreateEmailVerificationToken(ctx, sqlcgen.CreateEmailVerificationTokenParams{
+		ID:        token.ID,
+		CreatedAt: token.CreatedAt,
+		UpdatedAt: token.UpdatedAt,
+		UserID:    token.UserID,
+		TokenHash: token.TokenHash,
+		ExpiresAt: token.ExpiresAt,
+	})
+
+	return err
+}
+
+func (s *Store) FindByHash(ctx context.Context, tokenHash string) (*EmailVerificationToken, error) {
+	row, err := s.queries.FindEmailVerificationTokenByHash(ctx, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertEmailVerificationTokenRowToModelPtr(*row), nil
+}
+
+// MarkUsed redeems the token. Returns false if it was already used.
+func (s *Store) MarkUsed(ctx context.Context, token *EmailVerificationToken) (bool, error) {
+	now := time.Now()
+
+	rows, err := s.queries.MarkEmailVerificationTokenUsed(ctx, sqlcgen.MarkEmailVerificationTokenUsedParams{
+		ID:        token.ID,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return false, err
+	}
+	if rows == 0 {
+		return false, nil
+	}
+
+	token.UpdatedAt = now
+	token.UsedAt = &now
+	return true, nil
+}
+
+func nullTimeToTimePtr(nt sql.NullTime) *time.Time {
+	if !nt.Valid {
+		return nil
+	}
+	return &nt.Time
+}
+
+// Helper function to convert sqlcgen.EmailVerificationToken to EmailVerificationToken
+func convertEmailVerificationTokenRowToModel(row sqlcgen.EmailVerificationToken) EmailVerificationToken {
+	return EmailVerificationToken{
+		ID:        row.ID,
+		CreatedAt: row.CreatedAt,
+		UpdatedAt: row.UpdatedAt,
+		UserID:    row.UserID,
+		TokenHash: row.TokenHash,
+		ExpiresAt: row.ExpiresAt,
+		UsedAt:    nullTimeToTimePtr(row.UsedAt),
+	}
+}
+
+// Helper function to convert sqlcgen.EmailVerificationToken to *EmailVerificationToken
+func convertEmailVerificationTokenRowToModelPtr(row sqlcgen.EmailVerificationToken) *EmailVerificationToken {
+	token := convertEmailVerificationTokenRowToModel(row)
+	return &token
+}
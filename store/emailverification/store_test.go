@@ -0,0 +1,134 @@
+package emailverification
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"pcast-api/db"
+)
+
+var d *sql.DB
+var vs *Store
+
+const testDSN = "host=localhost port=5432 user=pcast password=pcast dbname=pcast_test sslmode=disable"
+
+func TestMain(m *testing.M) {
+	setup()
+
+	code := m.Run()
+
+	tearDown()
+
+	os.Exit(code)
+}
+
+func setup() {
+	d = db.NewTestDB(testDSN)
+
+	runMigrations()
+	truncateTable()
+
+	vs = New(d)
+}
+
+func tearDown() {
+	truncateTable()
+	d.Close()
+}
+
+func runMigrations() {
+	d.Exec(`
+		CREATE TABLE IF NOT EXISTS users (
+			id UUID PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			email VARCHAR(255) UNIQUE NOT NULL,
+			password VARCHAR(255),
+			email_verified_at TIMESTAMP,
+			totp_secret BYTEA,
+			totp_enabled_at TIMESTAMP,
+			totp_last_step BIGINT,
+			totp_attempts INT NOT NULL DEFAULT 0,
+			totp_attempted_at TIMESTAMP
+		)
+	`)
+	d.Exec(`
+		CREATE TABLE IF NOT EXISTS email_verification_tokens (
+			id UUID PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP
+		)
+	`)
+}
+
+func truncateTable() {
+	d.Exec("TRUNCATE TABLE email_verification_tokens")
+	d.Exec("TRUNCATE TABLE users CASCADE")
+}
+
+func createUser(t *testing.T) uuid.UUID {
+	userID := uuid.Must(uuid.NewV7())
+	_, err := d.Exec(
+		"INSERT INTO users (id, created_at, updated_at, email, password) VALUES ($1, $2, $3, $4, $5)",
+		userID, time.Now(), time.Now(), fmt.Sprintf("verification-%s@example.com", userID), "password",
+	)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return userID
+}
+
+func newToken(userID uuid.UUID) *EmailVerificationToken {
+	return &EmailVerificationToken{
+		UserID:    userID,
+		TokenHash: uuid.NewString(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+}
+
+func TestCreateEmailVerificationToken(t *testing.T) {
+	t.Cleanup(truncateTable)
+	token := newToken(createUser(t))
+
+	err := vs.Create(context.Background(), token)
+	assert.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, token.ID)
+
+	found, err := vs.FindByHash(context.Background(), token.TokenHash)
+	assert.NoError(t, err)
+	assert.Equal(t, token.ID, found.ID)
+	assert.Equal(t, token.UserID, found.UserID)
+	assert.Nil(t, found.UsedAt)
+}
+
+func TestFindEmailVerificationTokenByHash_NotFound(t *testing.T) {
+	_, err := vs.FindByHash(context.Background(), "unknown")
+	assert.Error(t, err)
+}
+
+func TestMarkEmailVerificationTokenUsed(t *testing.T) {
+	t.Cleanup(truncateTable)
+	token := newToken(createUser(t))
+	assert.NoError(t, vs.Create(context.Background(), token))
+
+	marked, err := vs.MarkUsed(context.Background(), token)
+	assert.NoError(t, err)
+	assert.True(t, marked)
+	assert.NotNil(t, token.UsedAt)
+
+	// A token can only be used once
+	marked, err = vs.MarkUsed(context.Background(), token)
+	assert.NoError(t, err)
+	assert.False(t, marked)
+}
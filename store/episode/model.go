@@ -12,6 +12,11 @@ type Episode struct {
 	UpdatedAt       time.Time
 	FeedID          uuid.UUID
 	FeedGUID        string
+	Title           string
+	Description     string
+	URL             string
+	Duration        *int // Duration in seconds
+	PublishedAt     *time.Time
 	CurrentPosition *int
 	Played          bool
 }
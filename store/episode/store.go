@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"pcast-api/db"
 	"pcast-api/db/sqlcgen"
 )
 
@@ -15,7 +16,7 @@ type Store struct {
 
 func New(database *sql.DB) *Store {
 	return &Store{
-		queries: sqlcgen.New(database),
+		queries: sqlcgen.New(db.Trace(database)),
 	}
 }
 
@@ -28,15 +29,7 @@ func (s *Store) FindAll(ctx context.Context) ([]Episode, error) {
 	// Convert sqlc models to domain models
 	episodes := make([]Episode, len(rows))
 	for i, row := range rows {
-		episodes[i] = Episode{
-			ID:              row.ID,
-			CreatedAt:       row.CreatedAt,
-			UpdatedAt:       row.UpdatedAt,
-			FeedID:          row.FeedID,
-			FeedGUID:        row.FeedGuid,
-			CurrentPosition: nullInt32ToIntPtr(row.CurrentPosition),
-			Played:          row.Played,
-		}
+		episodes[i] = convertEpisodeRowToModel(*row)
 	}
 	return episodes, nil
 }
@@ -47,15 +40,34 @@ func (s *Store) FindByID(ctx context.Context, id uuid.UUID) (*Episode, error) {
 		return nil, err
 	}
 
-	return &Episode{
-		ID:              row.ID,
-		CreatedAt:       row.CreatedAt,
-		UpdatedAt:       row.UpdatedAt,
-		FeedID:          row.FeedID,
-		FeedGUID:        row.FeedGuid,
-		CurrentPosition: nullInt32ToIntPtr(row.CurrentPosition),
-		Played:          row.Played,
-	}, nil
+	return convertEpisodeRowToModelPtr(*row), nil
+}
+
+func (s *Store) FindByFeedID(ctx context.Context, feedID uuid.UUID) ([]Episode, error) {
+	rows, err := s.queries.FindEpisodesByFeedID(ctx, feedID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert sqlc models to domain models
+	episodes := make([]Episode, len(rows))
+	for i, row := range rows {
+		episodes[i] = convertEpisodeRowToModel(*row)
+	}
+	return episodes, nil
+}
+
+// FindByIDAndUserID finds an episode by ID, scoped to the user owning its feed
+func (s *Store) FindByIDAndUserID(ctx context.Context, id, userID uuid.UUID) (*Episode, error) {
+	row, err := s.queries.FindEpisodeByIDAndUserID(ctx, sqlcgen.FindEpisodeByIDAndUserIDParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return convertEpisodeRowToModelPtr(*row), nil
 }
 
 func (s *Store) Create(ctx context.Context, episode *Episode) error {
@@ -69,6 +81,11 @@ func (s *Store) Create(ctx context.Context, episode *Episode) error {
 		UpdatedAt:       episode.UpdatedAt,
 		FeedID:          episode.FeedID,
 		FeedGuid:        episode.FeedGUID,
+		Title:           episode.Title,
+		Description:     episode.Description,
+		Url:             episode.URL,
+		Duration:        intPtrToNullInt32(episode.Duration),
+		PublishedAt:     timePtrToNullTime(episode.PublishedAt),
 		CurrentPosition: intPtrToNullInt32(episode.CurrentPosition),
 		Played:          episode.Played,
 	})
@@ -76,6 +93,34 @@ func (s *Store) Create(ctx context.Context, episode *Episode) error {
 	return err
 }
 
+// Upsert inserts the episode or, if the feed already has an episode with the same GUID,
+// refreshes its metadata. Playback state and updated_at of an existing episode are left untouched.
+func (s *Store) Upsert(ctx context.Context, episode *Episode) error {
+	if err := episode.BeforeCreate(); err != nil {
+		return err
+	}
+
+	row, err := s.queries.UpsertEpisode(ctx, sqlcgen.UpsertEpisodeParams{
+		ID:          episode.ID,
+		CreatedAt:   episode.CreatedAt,
+		UpdatedAt:   episode.UpdatedAt,
+		FeedID:      episode.FeedID,
+		FeedGuid:    episode.FeedGUID,
+		Title:       episode.Title,
+		Description: episode.Description,
+		Url:         episode.URL,
+		Duration:    intPtrToNullInt32(episode.Duration),
+		PublishedAt: timePtrToNullTime(episode.PublishedAt),
+	})
+	if err != nil {
+		return err
+	}
+
+	*episode = convertEpisodeRowToModel(*row)
+
+	return nil
+}
+
 func (s *Store) Update(ctx context.Context, episode *Episode) error {
 	episode.UpdatedAt = time.Now()
 
@@ -84,11 +129,48 @@ func (s *Store) Update(ctx context.Context, episode *Episode) error {
 		UpdatedAt:       episode.UpdatedAt,
 		FeedID:          episode.FeedID,
 		FeedGuid:        episode.FeedGUID,
+		Title:           episode.Title,
+		Description:     episode.Description,
+		Url:             episode.URL,
+		Duration:        intPtrToNullInt32(episode.Duration),
+		PublishedAt:     timePtrToNullTime(episode.PublishedAt),
 		CurrentPosition: intPtrToNullInt32(episode.CurrentPosition),
 		Played:          episode.Played,
 	})
 }
 
+// UpdateProgress stores the playback state of the episode using episode.UpdatedAt as the write timestamp.
+// The update is only applied if no newer state is stored, it returns false otherwise.
+func (s *Store) UpdateProgress(ctx context.Context, episode *Episode) (bool, error) {
+	rows, err := s.queries.UpdateEpisodeProgress(ctx, sqlcgen.UpdateEpisodeProgressParams{
+		ID:              episode.ID,
+		UpdatedAt:       episode.UpdatedAt,
+		CurrentPosition: intPtrToNullInt32(episode.CurrentPosition),
+		Played:          episode.Played,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// PatchProgress sets the given playback values of the episode, nil values are left unchanged.
+// Like UpdateProgress, it only applies if no state newer than updatedAt is stored and returns false otherwise.
+func (s *Store) PatchProgress(ctx context.Context, id uuid.UUID, currentPosition *int, played *bool, updatedAt time.Time) (bool, error) {
+	rows, err := s.queries.PatchEpisodeProgress(ctx, sqlcgen.PatchEpisodeProgressParams{
+		ID:              id,
+		UpdatedAt:       updatedAt,
+		CurrentPosition: intPtrToNullInt32(currentPosition),
+		Played:          boolPtrToNullBool(played),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
 func (s *Store) Delete(ctx context.Context, episode *Episode) error {
 	return s.queries.DeleteEpisode(ctx, episode.ID)
 }
@@ -100,6 +182,13 @@ func intPtrToNullInt32(i *int) sql.NullInt32 {
 	return sql.NullInt32{Int32: int32(*i), Valid: true}
 }
 
+func boolPtrToNullBool(b *bool) sql.NullBool {
+	if b == nil {
+		return sql.NullBool{Valid: false}
+	}
+	return sql.NullBool{Bool: *b, Valid: true}
+}
+
 func nullInt32ToIntPtr(n sql.NullInt32) *int {
 	if !n.Valid {
 		return nil
@@ -107,3 +196,41 @@ func nullInt32ToIntPtr(n sql.NullInt32) *int {
 	i := int(n.Int32)
 	return &i
 }
+
+func timePtrToNullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{Valid: false}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+func nullTimeToTimePtr(nt sql.NullTime) *time.Time {
+	if !nt.Valid {
+		return nil
+	}
+	return &nt.Time
+}
+
+// Helper function to convert sqlcgen.Episode to Episode
+func convertEpisodeRowToModel(row sqlcgen.Episode) Episode {
+	return Episode{
+		ID:              row.ID,
+		CreatedAt:       row.CreatedAt,
+		UpdatedAt:       row.UpdatedAt,
+		FeedID:          row.FeedID,
+		FeedGUID:        row.FeedGuid,
+		Title:           row.Title,
+		Description:     row.Description,
+		URL:             row.Url,
+		Duration:        nullInt32ToIntPtr(row.Duration),
+		PublishedAt:     nullTimeToTimePtr(row.PublishedAt),
+		CurrentPosition: nullInt32ToIntPtr(row.CurrentPosition),
+		Played:          row.Played,
+	}
+}
+
+// Helper function to convert sqlcgen.Episode to *Episode
+func convertEpisodeRowToModelPtr(row sqlcgen.Episode) *Episode {
+	episode := convertEpisodeRowToModel(row)
+	return &episode
+}
@@ -7,7 +7,9 @@ import (
 	"math/rand"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -53,13 +55,19 @@ func runMigrations() {
 			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
 			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
 			feed_id UUID NOT NULL,
-			feed_guid VARCHAR(255) NOT NULL,
+			feed_guid TEXT NOT NULL,
 			current_position INTEGER,
-			played BOOLEAN NOT NULL DEFAULT FALSE
+			played BOOLEAN NOT NULL DEFAULT FALSE,
+			title TEXT NOT NULL DEFAULT '',
+			description TEXT NOT NULL DEFAULT '',
+			url TEXT NOT NULL DEFAULT '',
+			duration INTEGER,
+			published_at TIMESTAMP
 		)
 	`)
 	d.Exec(`CREATE INDEX IF NOT EXISTS idx_episodes_feed_id ON episodes(feed_id)`)
 	d.Exec(`CREATE INDEX IF NOT EXISTS idx_episodes_feed_guid ON episodes(feed_guid)`)
+	d.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_episodes_feed_id_feed_guid ON episodes(feed_id, feed_guid)`)
 }
 
 func truncateTable() {
@@ -128,3 +136,117 @@ func TestUpdateEpisode(t *testing.T) {
 
 	truncateTable()
 }
+
+func TestUpsertEpisode(t *testing.T) {
+	episode := newEpisode()
+	episode.Title = "Episode 1"
+	err := es.Upsert(context.Background(), episode)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	position := 42
+	episode.CurrentPosition = &position
+	err = es.Update(context.Background(), episode)
+	assert.NoError(t, err)
+
+	updated := &Episode{FeedID: episode.FeedID, FeedGUID: episode.FeedGUID, Title: "Episode 1 (updated)"}
+	err = es.Upsert(context.Background(), updated)
+	assert.NoError(t, err)
+
+	assert.Equal(t, episode.ID, updated.ID)
+	assert.Equal(t, "Episode 1 (updated)", updated.Title)
+	assert.Equal(t, &position, updated.CurrentPosition)
+
+	truncateTable()
+}
+
+func TestUpsertEpisode_LongValues(t *testing.T) {
+	episode := newEpisode()
+	episode.FeedGUID = "https://cdn.example.com/episode.mp3?" + strings.Repeat("utm_source=x&", 100)
+	episode.Title = strings.Repeat("t", 2000)
+	episode.URL = episode.FeedGUID
+
+	err := es.Upsert(context.Background(), episode)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	found, err := es.FindByID(context.Background(), episode.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, episode.Title, found.Title)
+	assert.Equal(t, episode.URL, found.URL)
+	assert.Equal(t, episode.FeedGUID, found.FeedGUID)
+
+	truncateTable()
+}
+
+func TestFindEpisodesByFeedID(t *testing.T) {
+	episode := newEpisode()
+	err := es.Create(context.Background(), episode)
+	assert.NoError(t, err)
+
+	other := newEpisode()
+	err = es.Create(context.Background(), other)
+	assert.NoError(t, err)
+
+	foundEpisodes, err := es.FindByFeedID(context.Background(), episode.FeedID)
+	assert.NoError(t, err)
+	if assert.Len(t, foundEpisodes, 1) {
+		assert.Equal(t, episode.ID, foundEpisodes[0].ID)
+	}
+
+	truncateTable()
+}
+
+func TestUpdateEpisodeProgress(t *testing.T) {
+	episode := newEpisode()
+	err := es.Create(context.Background(), episode)
+	assert.NoError(t, err)
+
+	position := 120
+	episode.CurrentPosition = &position
+	episode.UpdatedAt = episode.UpdatedAt.Add(time.Minute)
+	updated, err := es.UpdateProgress(context.Background(), episode)
+	assert.NoError(t, err)
+	assert.True(t, updated)
+
+	stalePosition := 60
+	stale := *episode
+	stale.CurrentPosition = &stalePosition
+	stale.UpdatedAt = episode.UpdatedAt.Add(-time.Second)
+	updated, err = es.UpdateProgress(context.Background(), &stale)
+	assert.NoError(t, err)
+	assert.False(t, updated)
+
+	foundEpisode, err := es.FindByID(context.Background(), episode.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, &position, foundEpisode.CurrentPosition)
+
+	truncateTable()
+}
+
+func TestPatchEpisodeProgress(t *testing.T) {
+	episode := newEpisode()
+	position := 120
+	episode.CurrentPosition = &position
+	err := es.Create(context.Background(), episode)
+	assert.NoError(t, err)
+
+	played := true
+	updated, err := es.PatchProgress(context.Background(), episode.ID, nil, &played, episode.UpdatedAt.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, updated)
+
+	stalePosition := 60
+	updated, err = es.PatchProgress(context.Background(), episode.ID, &stalePosition, nil, episode.UpdatedAt)
+	assert.NoError(t, err)
+	assert.False(t, updated)
+
+	foundEpisode, err := es.FindByID(context.Background(), episode.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, &position, foundEpisode.CurrentPosition)
+	assert.True(t, foundEpisode.Played)
+
+	truncateTable()
+}
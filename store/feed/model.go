@@ -14,6 +14,20 @@ type Feed struct {
 	Title     string
 	URL       string
 	SyncedAt  *time.Time
+	// SyncAttemptedAt is the start of the last sync, also of a failed one
+	SyncAttemptedAt *time.Time
+	// ETag and LastModified are the cache validators of the last successful download
+	ETag         string
+	LastModified string
+	// Credentials are the encrypted Credentials of a private feed, nil for public feeds
+	Credentials []byte
+}
+
+// Credentials authenticate the download of a private feed with either HTTP Basic auth or a bearer token
+type Credentials struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
 }
 
 func (f *Feed) SetID(id uuid.UUID) {
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"pcast-api/db"
 	"pcast-api/db/sqlcgen"
 )
 
@@ -16,7 +17,7 @@ type Store struct {
 
 func New(database *sql.DB) *Store {
 	return &Store{
-		queries: sqlcgen.New(database),
+		queries: sqlcgen.New(db.Trace(database)),
 	}
 }
 
@@ -69,24 +70,59 @@ func (s *Store) FindByIDAndUserID(ctx context.Context, id, userID uuid.UUID) (*F
 	return convertFeedRowToModelPtr(*row), nil
 }
 
+// FindStale returns up to limit feeds whose sync was never attempted or not since attemptedBefore,
+// least recently attempted first. Failed syncs count as attempts, so broken feeds do not crowd out the others.
+func (s *Store) FindStale(ctx context.Context, attemptedBefore time.Time, limit int) ([]Feed, error) {
+	rows, err := s.queries.FindFeedsToSync(ctx, sqlcgen.FindFeedsToSyncParams{
+		SyncAttemptedAt: sql.NullTime{Time: attemptedBefore, Valid: true},
+		Limit:           int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert sqlc models to domain models
+	feeds := make([]Feed, len(rows))
+	for i, row := range rows {
+		feeds[i] = convertFeedRowToModel(*row)
+	}
+	return feeds, nil
+}
+
 func (s *Store) Create(ctx context.Context, feed *Feed) error {
 	if err := feed.BeforeCreate(); err != nil {
 		return err
 	}
+	// A feed synced before it was created was attempted then
+	if feed.SyncAttemptedAt == nil {
+		feed.SyncAttemptedAt = feed.SyncedAt
+	}
 
 	_, err := s.queries.CreateFeed(ctx, sqlcgen.CreateFeedParams{
-		ID:        feed.ID,
-		CreatedAt: feed.CreatedAt,
-		UpdatedAt: feed.UpdatedAt,
-		UserID:    feed.UserID,
-		Title:     feed.Title,
-		Url:       feed.URL,
-		SyncedAt:  timePtrToNullTime(feed.SyncedAt),
+		ID:              feed.ID,
+		CreatedAt:       feed.CreatedAt,
+		UpdatedAt:       feed.UpdatedAt,
+		UserID:          feed.UserID,
+		Title:           feed.Title,
+		Url:             feed.URL,
+		SyncedAt:        timePtrToNullTime(feed.SyncedAt),
+		SyncAttemptedAt: timePtrToNullTime(feed.SyncAttemptedAt),
+		Credentials:     feed.Credentials,
 	})
 
 	return err
 }
 
+// MarkSyncAttempted records the start of a sync. Update does not change it, so it is set even if the sync fails.
+func (s *Store) MarkSyncAttempted(ctx context.Context, feed *Feed, at time.Time) error {
+	feed.SyncAttemptedAt = &at
+
+	return s.queries.MarkFeedSyncAttempted(ctx, sqlcgen.MarkFeedSyncAttemptedParams{
+		ID:              feed.ID,
+		SyncAttemptedAt: sql.NullTime{Time: at, Valid: true},
+	})
+}
+
 func (s *Store) Update(ctx context.Context, feed *Feed) error {
 	if feed.URL == "" {
 		return fmt.Errorf("url cannot be empty")
@@ -95,12 +131,30 @@ func (s *Store) Update(ctx context.Context, feed *Feed) error {
 	feed.UpdatedAt = time.Now()
 
 	return s.queries.UpdateFeed(ctx, sqlcgen.UpdateFeedParams{
-		ID:        feed.ID,
-		UpdatedAt: feed.UpdatedAt,
-		UserID:    feed.UserID,
-		Title:     feed.Title,
-		Url:       feed.URL,
-		SyncedAt:  timePtrToNullTime(feed.SyncedAt),
+		ID:           feed.ID,
+		UpdatedAt:    feed.UpdatedAt,
+		UserID:       feed.UserID,
+		Title:        feed.Title,
+		Url:          feed.URL,
+		SyncedAt:     timePtrToNullTime(feed.SyncedAt),
+		Etag:         feed.ETag,
+		LastModified: feed.LastModified,
+		Credentials:  feed.Credentials,
+	})
+}
+
+// UpdateSyncResult stores only what a sync learned about the feed, so a sync does not
+// revert the url or credentials the user changed while the feed was fetched
+func (s *Store) UpdateSyncResult(ctx context.Context, feed *Feed) error {
+	feed.UpdatedAt = time.Now()
+
+	return s.queries.UpdateFeedSyncResult(ctx, sqlcgen.UpdateFeedSyncResultParams{
+		ID:           feed.ID,
+		UpdatedAt:    feed.UpdatedAt,
+		Title:        feed.Title,
+		SyncedAt:     timePtrToNullTime(feed.SyncedAt),
+		Etag:         feed.ETag,
+		LastModified: feed.LastModified,
 	})
 }
 
@@ -125,13 +179,17 @@ func nullTimeToTimePtr(nt sql.NullTime) *time.Time {
 // Helper function to convert sqlcgen.Feed to Feed
 func convertFeedRowToModel(row sqlcgen.Feed) Feed {
 	return Feed{
-		ID:        row.ID,
-		CreatedAt: row.CreatedAt,
-		UpdatedAt: row.UpdatedAt,
-		UserID:    row.UserID,
-		Title:     row.Title,
-		URL:       row.Url,
-		SyncedAt:  nullTimeToTimePtr(row.SyncedAt),
+		ID:              row.ID,
+		CreatedAt:       row.CreatedAt,
+		UpdatedAt:       row.UpdatedAt,
+		UserID:          row.UserID,
+		Title:           row.Title,
+		URL:             row.Url,
+		SyncedAt:        nullTimeToTimePtr(row.SyncedAt),
+		SyncAttemptedAt: nullTimeToTimePtr(row.SyncAttemptedAt),
+		ETag:            row.Etag,
+		LastModified:    row.LastModified,
+		Credentials:     row.Credentials,
 	}
 }
 
@@ -71,13 +71,19 @@ func runMigrations() {
 			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
 			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
 			feed_id UUID NOT NULL,
-			feed_guid VARCHAR(255) NOT NULL,
+			feed_guid TEXT NOT NULL,
 			current_position INTEGER,
-			played BOOLEAN NOT NULL DEFAULT FALSE
+			played BOOLEAN NOT NULL DEFAULT FALSE,
+			title TEXT NOT NULL DEFAULT '',
+			description TEXT NOT NULL DEFAULT '',
+			url TEXT NOT NULL DEFAULT '',
+			duration INTEGER,
+			published_at TIMESTAMP
 		)
 	`)
 	d.Exec(`CREATE INDEX IF NOT EXISTS idx_episodes_feed_id ON episodes(feed_id)`)
 	d.Exec(`CREATE INDEX IF NOT EXISTS idx_episodes_feed_guid ON episodes(feed_guid)`)
+	d.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_episodes_feed_id_feed_guid ON episodes(feed_id, feed_guid)`)
 
 	d.Exec(`
 		CREATE TABLE IF NOT EXISTS feeds (
@@ -85,9 +91,13 @@ func runMigrations() {
 			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
 			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
 			user_id UUID NOT NULL,
-			title VARCHAR(500) NOT NULL,
+			title TEXT NOT NULL,
 			url VARCHAR(1000) NOT NULL,
-			synced_at TIMESTAMP
+			synced_at TIMESTAMP,
+			sync_attempted_at TIMESTAMP,
+			etag VARCHAR(500) NOT NULL DEFAULT '',
+			last_modified VARCHAR(100) NOT NULL DEFAULT '',
+			credentials BYTEA
 		)
 	`)
 	d.Exec(`CREATE INDEX IF NOT EXISTS idx_feeds_user_id ON feeds(user_id)`)
@@ -246,6 +256,82 @@ func TestUpdateFeed(t *testing.T) {
 	truncateTable()
 }
 
+func TestUpdateFeed_CacheValidators(t *testing.T) {
+	userID := uuid.Must(uuid.NewV7())
+	ensureUserExists(t, userID)
+
+	feed := &Feed{URL: testFeedURL, Title: testFeedTitle, UserID: userID}
+	err := fs.Create(context.Background(), feed)
+	assert.NoError(t, err)
+
+	feed.ETag = `"abc123"`
+	feed.LastModified = "Wed, 03 Jan 2024 10:00:00 GMT"
+	err = fs.Update(context.Background(), feed)
+	assert.NoError(t, err)
+
+	foundFeed, err := fs.FindByID(context.Background(), feed.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, feed.ETag, foundFeed.ETag)
+	assert.Equal(t, feed.LastModified, foundFeed.LastModified)
+
+	truncateTable()
+}
+
+func TestUpdateFeedSyncResult_KeepsCredentials(t *testing.T) {
+	userID := uuid.Must(uuid.NewV7())
+	ensureUserExists(t, userID)
+
+	feed := &Feed{URL: testFeedURL, Title: testFeedTitle, UserID: userID, Credentials: []byte{1, 2, 3}}
+	err := fs.Create(context.Background(), feed)
+	assert.NoError(t, err)
+
+	// The credentials are removed while the feed is synced
+	stored, err := fs.FindByID(context.Background(), feed.ID)
+	assert.NoError(t, err)
+	stored.Credentials = nil
+	err = fs.Update(context.Background(), stored)
+	assert.NoError(t, err)
+
+	syncedAt := time.Now()
+	feed.Title = "Synced Title"
+	feed.SyncedAt = &syncedAt
+	feed.ETag = `"abc123"`
+	err = fs.UpdateSyncResult(context.Background(), feed)
+	assert.NoError(t, err)
+
+	foundFeed, err := fs.FindByID(context.Background(), feed.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Synced Title", foundFeed.Title)
+	assert.Equal(t, `"abc123"`, foundFeed.ETag)
+	assert.NotNil(t, foundFeed.SyncedAt)
+	assert.Nil(t, foundFeed.Credentials)
+
+	truncateTable()
+}
+
+func TestCreateFeed_Credentials(t *testing.T) {
+	userID := uuid.Must(uuid.NewV7())
+	ensureUserExists(t, userID)
+
+	feed := &Feed{URL: testFeedURL, Title: testFeedTitle, UserID: userID, Credentials: []byte{1, 2, 3}}
+	err := fs.Create(context.Background(), feed)
+	assert.NoError(t, err)
+
+	foundFeed, err := fs.FindByID(context.Background(), feed.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3}, foundFeed.Credentials)
+
+	foundFeed.Credentials = nil
+	err = fs.Update(context.Background(), foundFeed)
+	assert.NoError(t, err)
+
+	foundFeed, err = fs.FindByID(context.Background(), feed.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, foundFeed.Credentials)
+
+	truncateTable()
+}
+
 func TestUpdateFeed_InvalidURL(t *testing.T) {
 	userID := uuid.Must(uuid.NewV7())
 	ensureUserExists(t, userID)
@@ -265,3 +351,57 @@ func TestUpdateFeed_InvalidURL(t *testing.T) {
 
 	truncateTable()
 }
+
+func TestFindStaleFeeds(t *testing.T) {
+	userID := uuid.Must(uuid.NewV7())
+	ensureUserExists(t, userID)
+
+	recent := time.Now()
+	old := recent.Add(-2 * time.Hour)
+
+	neverSynced := &Feed{URL: testFeedURL, Title: "Never synced", UserID: userID}
+	syncedLongAgo := &Feed{URL: testFeedURL, Title: "Synced long ago", UserID: userID, SyncedAt: &old}
+	syncedRecently := &Feed{URL: testFeedURL, Title: "Synced recently", UserID: userID, SyncedAt: &recent}
+	for _, feed := range []*Feed{syncedLongAgo, syncedRecently, neverSynced} {
+		err := fs.Create(context.Background(), feed)
+		assert.NoError(t, err)
+	}
+
+	staleFeeds, err := fs.FindStale(context.Background(), recent.Add(-time.Hour), 10)
+	assert.NoError(t, err)
+	if assert.Len(t, staleFeeds, 2) {
+		assert.Equal(t, neverSynced.ID, staleFeeds[0].ID)
+		assert.Equal(t, syncedLongAgo.ID, staleFeeds[1].ID)
+	}
+
+	staleFeeds, err = fs.FindStale(context.Background(), recent.Add(-time.Hour), 1)
+	assert.NoError(t, err)
+	assert.Len(t, staleFeeds, 1)
+
+	truncateTable()
+}
+
+func TestFindStaleFeeds_FailedAttempt(t *testing.T) {
+	userID := uuid.Must(uuid.NewV7())
+	ensureUserExists(t, userID)
+
+	old := time.Now().Add(-2 * time.Hour)
+	broken := &Feed{URL: testFeedURL, Title: "Broken", UserID: userID}
+	healthy := &Feed{URL: testFeedURL, Title: "Healthy", UserID: userID, SyncedAt: &old}
+	for _, feed := range []*Feed{broken, healthy} {
+		err := fs.Create(context.Background(), feed)
+		assert.NoError(t, err)
+	}
+
+	// The failed sync of the broken feed never set SyncedAt, it still goes to the back of the queue
+	err := fs.MarkSyncAttempted(context.Background(), broken, time.Now())
+	assert.NoError(t, err)
+
+	staleFeeds, err := fs.FindStale(context.Background(), time.Now().Add(-time.Hour), 1)
+	assert.NoError(t, err)
+	if assert.Len(t, staleFeeds, 1) {
+		assert.Equal(t, healthy.ID, staleFeeds[0].ID)
+	}
+
+	truncateTable()
+}
@@ -0,0 +1,51 @@
+package identity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"pcast-api/store"
+)
+
+// Identity links a user to the account of an OpenID Connect provider
+type Identity struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	// Provider is the name of the provider in the config
+	Provider string
+	// Subject is the ID of the account at the provider
+	Subject string
+	// Email is the address reported by the provider when the identity was linked
+	Email string
+}
+
+func (i *Identity) SetID(id uuid.UUID) {
+	i.ID = id
+}
+
+func (i *Identity) GetID() uuid.UUID {
+	return i.ID
+}
+
+func (i *Identity) SetCreatedAt(createdAt time.Time) {
+	i.CreatedAt = createdAt
+}
+
+func (i *Identity) GetCreatedAt() time.Time {
+	return i.CreatedAt
+}
+
+func (i *Identity) SetUpdatedAt(updatedAt time.Time) {
+	i.UpdatedAt = updatedAt
+}
+
+func (i *Identity) GetUpdatedAt() time.Time {
+	return i.UpdatedAt
+}
+
+func (i *Identity) BeforeCreate() error {
+	return store.BeforeCreate(i)
+}
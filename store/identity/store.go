@@ -0,0 +1,97 @@
+package identity
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+
+	"pcast-api/db"
+	"pcast-api/db/sqlcgen"
+)
+
+type Store struct {
+	queries *sqlcgen.Queries
+}
+
+func New(database *sql.DB) *Store {
+	return &Store{
+		queries: sqlcgen.New(db.Trace(database)),
+	}
+}
+
+func (s *Store) Create(ctx context.Context, identity *Identity) error {
+	if err := identity.BeforeCreate(); err != nil {
+		return err
+	}
+
+	_, err := s.queries.CreateUserIdentity(ctx, sqlcgen.CreateUserIdentityParams{
+		ID:        identity.ID,
+		CreatedAt: identity.CreatedAt,
+		UpdatedAt: identity.UpdatedAt,
+		UserID:    identity.UserID,
+		Provider:  identity.Provider,
+		Subject:   identity.Subject,
+		Email:     identity.Email,
+	})
+
+	return err
+}
+
+func (s *Store) FindByProviderSubject(ctx context.Context, provider string, subject string) (*Identity, error) {
+	row, err := s.queries.FindUserIdentityByProviderSubject(ctx, sqlcgen.FindUserIdentityByProviderSubjectParams{
+		Provider: provider,
+		Subject:  subject,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return convertIdentityRowToModelPtr(*row), nil
+}
+
+func (s *Store) FindByUserID(ctx context.Context, userID uuid.UUID) ([]Identity, error) {
+	rows, err := s.queries.FindUserIdentitiesByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	identities := make([]Identity, len(rows))
+	for i, row := range rows {
+		identities[i] = convertIdentityRowToModel(*row)
+	}
+	return identities, nil
+}
+
+// DeleteKeepingLogin unlinks the identity of the provider from the user. Returns false if the user
+// has no such identity or it is the last way to sign in, without password and other identities.
+func (s *Store) DeleteKeepingLogin(ctx context.Context, userID uuid.UUID, provider string) (bool, error) {
+	rows, err := s.queries.DeleteUserIdentityKeepingLogin(ctx, sqlcgen.DeleteUserIdentityKeepingLoginParams{
+		UserID:   userID,
+		Provider: provider,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// Helper function to convert sqlcgen.UserIdentity to Identity
+func convertIdentityRowToModel(row sqlcgen.UserIdentity) Identity {
+	return Identity{
+		ID:        row.ID,
+		CreatedAt: row.CreatedAt,
+		UpdatedAt: row.UpdatedAt,
+		UserID:    row.UserID,
+		Provider:  row.Provider,
+		Subject:   row.Subject,
+		Email:     row.Email,
+	}
+}
+
+// Helper function to convert sqlcgen.UserIdentity to *Identity
+func convertIdentityRowToModelPtr(row sqlcgen.UserIdentity) *Identity {
+	identity := convertIdentityRowToModel(row)
+	return &identity
+}
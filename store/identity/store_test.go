@@ -0,0 +1,176 @@
+package identity
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"pcast-api/db"
+)
+
+var d *sql.DB
+var is *Store
+
+const testDSN = "host=localhost port=5432 user=pcast password=pcast dbname=pcast_test sslmode=disable"
+
+func TestMain(m *testing.M) {
+	setup()
+
+	code := m.Run()
+
+	tearDown()
+
+	os.Exit(code)
+}
+
+func setup() {
+	d = db.NewTestDB(testDSN)
+
+	runMigrations()
+	truncateTable()
+
+	is = New(d)
+}
+
+func tearDown() {
+	truncateTable()
+	d.Close()
+}
+
+func runMigrations() {
+	d.Exec(`
+		CREATE TABLE IF NOT EXISTS users (
+			id UUID PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			email VARCHAR(255) UNIQUE NOT NULL,
+			password VARCHAR(255),
+			email_verified_at TIMESTAMP,
+			totp_secret BYTEA,
+			totp_enabled_at TIMESTAMP,
+			totp_last_step BIGINT,
+			totp_attempts INT NOT NULL DEFAULT 0,
+			totp_attempted_at TIMESTAMP
+		)
+	`)
+	d.Exec(`
+		CREATE TABLE IF NOT EXISTS user_identities (
+			id UUID PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			provider VARCHAR(64) NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			email VARCHAR(255) NOT NULL
+		)
+	`)
+	d.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_user_identities_provider_subject ON user_identities(provider, subject)`)
+	d.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_user_identities_user_id_provider ON user_identities(user_id, provider)`)
+}
+
+func truncateTable() {
+	d.Exec("TRUNCATE TABLE user_identities")
+	d.Exec("TRUNCATE TABLE users CASCADE")
+}
+
+func createUser(t *testing.T) uuid.UUID {
+	userID := uuid.Must(uuid.NewV7())
+	_, err := d.Exec(
+		"INSERT INTO users (id, created_at, updated_at, email) VALUES ($1, $2, $3, $4)",
+		userID, time.Now(), time.Now(), fmt.Sprintf("identity-%s@example.com", userID),
+	)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return userID
+}
+
+func TestCreateIdentity(t *testing.T) {
+	t.Cleanup(truncateTable)
+	userID := createUser(t)
+	identity := &Identity{UserID: userID, Provider: "keycloak", Subject: "subject-1", Email: "foo@example.com"}
+
+	err := is.Create(context.Background(), identity)
+	assert.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, identity.ID)
+
+	found, err := is.FindByProviderSubject(context.Background(), "keycloak", "subject-1")
+	assert.NoError(t, err)
+	assert.Equal(t, identity.ID, found.ID)
+	assert.Equal(t, userID, found.UserID)
+	assert.Equal(t, "foo@example.com", found.Email)
+
+	// The subject is only unique per provider
+	_, err = is.FindByProviderSubject(context.Background(), "authentik", "subject-1")
+	assert.Error(t, err)
+}
+
+func TestCreateIdentity_Duplicate(t *testing.T) {
+	t.Cleanup(truncateTable)
+	userID := createUser(t)
+	assert.NoError(t, is.Create(context.Background(), &Identity{UserID: userID, Provider: "keycloak", Subject: "subject-1", Email: "foo@example.com"}))
+
+	// A provider account belongs to one user
+	err := is.Create(context.Background(), &Identity{UserID: createUser(t), Provider: "keycloak", Subject: "subject-1", Email: "foo@example.com"})
+	assert.Error(t, err)
+
+	// A user has one account per provider
+	err = is.Create(context.Background(), &Identity{UserID: userID, Provider: "keycloak", Subject: "subject-2", Email: "foo@example.com"})
+	assert.Error(t, err)
+}
+
+func TestFindIdentitiesByUserID(t *testing.T) {
+	t.Cleanup(truncateTable)
+	userID := createUser(t)
+	for _, provider := range []string{"google", "keycloak"} {
+		assert.NoError(t, is.Create(context.Background(), &Identity{UserID: userID, Provider: provider, Subject: "subject", Email: "foo@example.com"}))
+	}
+
+	identities, err := is.FindByUserID(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.Len(t, identities, 2)
+	assert.Equal(t, "google", identities[0].Provider)
+	assert.Equal(t, "keycloak", identities[1].Provider)
+
+	identities, err = is.FindByUserID(context.Background(), createUser(t))
+	assert.NoError(t, err)
+	assert.Empty(t, identities)
+}
+
+func TestDeleteIdentityKeepingLogin(t *testing.T) {
+	t.Cleanup(truncateTable)
+	userID := createUser(t)
+	for _, provider := range []string{"google", "keycloak"} {
+		assert.NoError(t, is.Create(context.Background(), &Identity{UserID: userID, Provider: provider, Subject: "subject", Email: "foo@example.com"}))
+	}
+
+	deleted, err := is.DeleteKeepingLogin(context.Background(), userID, "google")
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+
+	// Without password the last identity is the only way to sign in
+	deleted, err = is.DeleteKeepingLogin(context.Background(), userID, "keycloak")
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+
+	identities, err := is.FindByUserID(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.Len(t, identities, 1)
+
+	// With a password it can go
+	_, err = d.Exec("UPDATE users SET password = 'hash' WHERE id = $1", userID)
+	assert.NoError(t, err)
+	deleted, err = is.DeleteKeepingLogin(context.Background(), userID, "keycloak")
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+
+	deleted, err = is.DeleteKeepingLogin(context.Background(), userID, "keycloak")
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+}
@@ -0,0 +1,48 @@
+package passwordreset
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"pcast-api/store"
+)
+
+// PasswordResetToken is a single use token mailed to a user to set a new password. Only the hash of the token is stored.
+type PasswordResetToken struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+func (t *PasswordResetToken) SetID(id uuid.UUID) {
+	t.ID = id
+}
+
+func (t *PasswordResetToken) GetID() uuid.UUID {
+	return t.ID
+}
+
+func (t *PasswordResetToken) SetCreatedAt(createdAt time.Time) {
+	t.CreatedAt = createdAt
+}
+
+func (t *PasswordResetToken) GetCreatedAt() time.Time {
+	return t.CreatedAt
+}
+
+func (t *PasswordResetToken) SetUpdatedAt(updatedAt time.Time) {
+	t.UpdatedAt = updatedAt
+}
+
+func (t *PasswordResetToken) GetUpdatedAt() time.Time {
+	return t.UpdatedAt
+}
+
+func (t *PasswordResetToken) BeforeCreate() error {
+	return store.BeforeCreate(t)
+}
@@ -0,0 +1,133 @@
+package passwordreset
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"pcast-api/db"
+	"pcast-api/db/sqlcgen"
+)
+
+type Store struct {
+	db      *sql.DB
+	queries *sqlcgen.Queries
+}
+
+func New(database *sql.DB) *Store {
+	return &Store{
+		db:      database,
+		queries: sqlcgen.New(db.Trace(database)),
+	}
+}
+
+func (s *Store) Create(ctx context.Context, token *PasswordResetToken) error {
+	if err := token.BeforeCreate(); err != nil {
+		return err
+	}
+
+	_, err := s.queries.CreatePasswordResetToken(ctx, sqlcgen.CreatePasswordResetTokenParams{
+		ID:        token.ID,
+		CreatedAt: token.CreatedAt,
+		UpdatedAt: token.UpdatedAt,
+		UserID:    token.UserID,
+		TokenHash: token.TokenHash,
+		ExpiresAt: token.ExpiresAt,
+	})
+
+	return err
+}
+
+func (s *Store) FindByHash(ctx context.Context, tokenHash string) (*PasswordResetToken, error) {
+	row, err := s.queries.FindPasswordResetTokenByHash(ctx, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertPasswordResetTokenRowToModelPtr(*row), nil
+}
+
+// Redeem sets the new password hash of the user and marks the token and all other outstanding tokens
+// of the user as used, in one transaction. Returns false if the token was already used.
+func (s *Store) Redeem(ctx context.Context, token *PasswordResetToken, passwordHash string) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	queries := sqlcgen.New(db.Trace(tx))
+	now := time.Now()
+
+	rows, err := queries.MarkPasswordResetTokenUsed(ctx, sqlcgen.MarkPasswordResetTokenUsedParams{
+		ID:        token.ID,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return false, err
+	}
+	if rows == 0 {
+		return false, nil
+	}
+
+	err = queries.SetUserPassword(ctx, sqlcgen.SetUserPasswordParams{
+		ID:        token.UserID,
+		Password:  sql.NullString{String: passwordHash, Valid: true},
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	err = queries.InvalidatePasswordResetTokensByUserID(ctx, sqlcgen.InvalidatePasswordResetTokensByUserIDParams{
+		UserID:    token.UserID,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	token.UpdatedAt = now
+	token.UsedAt = &now
+	return true, nil
+}
+
+// InvalidateByUserID marks all outstanding tokens of the user as used
+func (s *Store) InvalidateByUserID(ctx context.Context, userID uuid.UUID) error {
+	return s.queries.InvalidatePasswordResetTokensByUserID(ctx, sqlcgen.InvalidatePasswordResetTokensByUserIDParams{
+		UserID:    userID,
+		UpdatedAt: time.Now(),
+	})
+}
+
+func nullTimeToTimePtr(nt sql.NullTime) *time.Time {
+	if !nt.Valid {
+		return nil
+	}
+	return &nt.Time
+}
+
+// Helper function to convert sqlcgen.PasswordResetToken to PasswordResetToken
+func convertPasswordResetTokenRowToModel(row sqlcgen.PasswordResetToken) PasswordResetToken {
+	return PasswordResetToken{
+		ID:        row.ID,
+		CreatedAt: row.CreatedAt,
+		UpdatedAt: row.UpdatedAt,
+		UserID:    row.UserID,
+		TokenHash: row.TokenHash,
+		ExpiresAt: row.ExpiresAt,
+		UsedAt:    nullTimeToTimePtr(row.UsedAt),
+	}
+}
+
+// Helper function to convert sqlcgen.PasswordResetToken to *PasswordResetToken
+func convertPasswordResetTokenRowToModelPtr(row sqlcgen.PasswordResetToken) *PasswordResetToken {
+	token := convertPasswordResetTokenRowToModel(row)
+	return &token
+}
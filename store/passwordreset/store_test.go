@@ -0,0 +1,174 @@
+package passwordreset
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"pcast-api/db"
+)
+
+var d *sql.DB
+var ps *Store
+
+const testDSN = "host=localhost port=5432 user=pcast password=pcast dbname=pcast_test sslmode=disable"
+
+func TestMain(m *testing.M) {
+	setup()
+
+	code := m.Run()
+
+	tearDown()
+
+	os.Exit(code)
+}
+
+func setup() {
+	d = db.NewTestDB(testDSN)
+
+	runMigrations()
+	truncateTable()
+
+	ps = New(d)
+}
+
+func tearDown() {
+	truncateTable()
+	d.Close()
+}
+
+func runMigrations() {
+	d.Exec(`
+		CREATE TABLE IF NOT EXISTS users (
+			id UUID PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			email VARCHAR(255) UNIQUE NOT NULL,
+			password VARCHAR(255),
+			email_verified_at TIMESTAMP,
+			totp_secret BYTEA,
+			totp_enabled_at TIMESTAMP,
+			totp_last_step BIGINT,
+			totp_attempts INT NOT NULL DEFAULT 0,
+			totp_attempted_at TIMESTAMP
+		)
+	`)
+	d.Exec(`
+		CREATE TABLE IF NOT EXISTS password_reset_tokens (
+			id UUID PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP
+		)
+	`)
+}
+
+func truncateTable() {
+	d.Exec("TRUNCATE TABLE password_reset_tokens")
+	d.Exec("TRUNCATE TABLE users CASCADE")
+}
+
+func createUser(t *testing.T) uuid.UUID {
+	userID := uuid.Must(uuid.NewV7())
+	_, err := d.Exec(
+		"INSERT INTO users (id, created_at, updated_at, email, password) VALUES ($1, $2, $3, $4, $5)",
+		userID, time.Now(), time.Now(), fmt.Sprintf("reset-%s@example.com", userID), "password",
+	)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return userID
+}
+
+func newToken(userID uuid.UUID) *PasswordResetToken {
+	return &PasswordResetToken{
+		UserID:    userID,
+		TokenHash: uuid.NewString(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+}
+
+func TestCreatePasswordResetToken(t *testing.T) {
+	t.Cleanup(truncateTable)
+	token := newToken(createUser(t))
+
+	err := ps.Create(context.Background(), token)
+	assert.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, token.ID)
+
+	found, err := ps.FindByHash(context.Background(), token.TokenHash)
+	assert.NoError(t, err)
+	assert.Equal(t, token.ID, found.ID)
+	assert.Equal(t, token.UserID, found.UserID)
+	assert.Nil(t, found.UsedAt)
+}
+
+func TestFindPasswordResetTokenByHash_NotFound(t *testing.T) {
+	_, err := ps.FindByHash(context.Background(), "unknown")
+	assert.Error(t, err)
+}
+
+func TestRedeemPasswordResetToken(t *testing.T) {
+	t.Cleanup(truncateTable)
+	userID := createUser(t)
+	token := newToken(userID)
+	other := newToken(userID)
+	for _, tk := range []*PasswordResetToken{token, other} {
+		assert.NoError(t, ps.Create(context.Background(), tk))
+	}
+
+	redeemed, err := ps.Redeem(context.Background(), token, "newhash")
+	assert.NoError(t, err)
+	assert.True(t, redeemed)
+	assert.NotNil(t, token.UsedAt)
+
+	var password string
+	assert.NoError(t, d.QueryRow("SELECT password FROM users WHERE id = $1", userID).Scan(&password))
+	assert.Equal(t, "newhash", password)
+
+	// The other tokens of the user are invalidated with it
+	found, err := ps.FindByHash(context.Background(), other.TokenHash)
+	assert.NoError(t, err)
+	assert.NotNil(t, found.UsedAt)
+
+	// A token can only be used once, the password stays unchanged
+	redeemed, err = ps.Redeem(context.Background(), token, "otherhash")
+	assert.NoError(t, err)
+	assert.False(t, redeemed)
+	assert.NoError(t, d.QueryRow("SELECT password FROM users WHERE id = $1", userID).Scan(&password))
+	assert.Equal(t, "newhash", password)
+}
+
+func TestInvalidatePasswordResetTokensByUserID(t *testing.T) {
+	t.Cleanup(truncateTable)
+	userID := createUser(t)
+
+	first := newToken(userID)
+	second := newToken(userID)
+	other := newToken(createUser(t))
+	for _, token := range []*PasswordResetToken{first, second, other} {
+		assert.NoError(t, ps.Create(context.Background(), token))
+	}
+
+	err := ps.InvalidateByUserID(context.Background(), userID)
+	assert.NoError(t, err)
+
+	for _, token := range []*PasswordResetToken{first, second} {
+		found, err := ps.FindByHash(context.Background(), token.TokenHash)
+		assert.NoError(t, err)
+		assert.NotNil(t, found.UsedAt)
+	}
+
+	found, err := ps.FindByHash(context.Background(), other.TokenHash)
+	assert.NoError(t, err)
+	assert.Nil(t, found.UsedAt)
+}
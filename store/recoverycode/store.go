@@ -0,0 +1,88 @@
+package recoverycode
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"pcast-api/db"
+	"pcast-api/db/sqlcgen"
+)
+
+// Store keeps the hashes of the 2FA recovery codes of a user. Each code can be used once.
+type Store struct {
+	db      *sql.DB
+	queries *sqlcgen.Queries
+}
+
+func New(database *sql.DB) *Store {
+	return &Store{
+		db:      database,
+		queries: sqlcgen.New(db.Trace(database)),
+	}
+}
+
+// Replace deletes the codes of the user and stores the new ones in one transaction
+func (s *Store) Replace(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := sqlcgen.New(db.Trace(tx))
+	if err := queries.DeleteRecoveryCodesByUserID(ctx, userID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, codeHash := range codeHashes {
+		id, err := uuid.NewV7()
+		if err != nil {
+			return err
+		}
+
+		err = queries.CreateRecoveryCode(ctx, sqlcgen.CreateRecoveryCodeParams{
+			ID:        id,
+			CreatedAt: now,
+			UpdatedAt: now,
+			UserID:    userID,
+			CodeHash:  codeHash,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Use redeems a code of the user. Returns false if the code is unknown or was already used.
+func (s *Store) Use(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	rows, err := s.queries.UseRecoveryCode(ctx, sqlcgen.UseRecoveryCodeParams{
+		UserID:   userID,
+		CodeHash: codeHash,
+		UsedAt:   sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// CountUnused returns the number of codes the user has left
+func (s *Store) CountUnused(ctx context.Context, userID uuid.UUID) (int, error) {
+	count, err := s.queries.CountUnusedRecoveryCodes(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(count), nil
+}
+
+func (s *Store) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	return s.queries.DeleteRecoveryCodesByUserID(ctx, userID)
+}
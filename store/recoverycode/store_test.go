@@ -0,0 +1,152 @@
+package recoverycode
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"pcast-api/db"
+)
+
+var d *sql.DB
+var rs *Store
+
+const testDSN = "host=localhost port=5432 user=pcast password=pcast dbname=pcast_test sslmode=disable"
+
+func TestMain(m *testing.M) {
+	setup()
+
+	code := m.Run()
+
+	tearDown()
+
+	os.Exit(code)
+}
+
+func setup() {
+	d = db.NewTestDB(testDSN)
+
+	runMigrations()
+	truncateTable()
+
+	rs = New(d)
+}
+
+func tearDown() {
+	truncateTable()
+	d.Close()
+}
+
+func runMigrations() {
+	d.Exec(`
+		CREATE TABLE IF NOT EXISTS users (
+			id UUID PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			email VARCHAR(255) UNIQUE NOT NULL,
+			password VARCHAR(255),
+			email_verified_at TIMESTAMP,
+			totp_secret BYTEA,
+			totp_enabled_at TIMESTAMP,
+			totp_last_step BIGINT,
+			totp_attempts INT NOT NULL DEFAULT 0,
+			totp_attempted_at TIMESTAMP
+		)
+	`)
+	d.Exec(`
+		CREATE TABLE IF NOT EXISTS recovery_codes (
+			id UUID PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			code_hash VARCHAR(64) NOT NULL,
+			used_at TIMESTAMP
+		)
+	`)
+	d.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_recovery_codes_user_id_code_hash ON recovery_codes(user_id, code_hash)`)
+}
+
+func truncateTable() {
+	d.Exec("TRUNCATE TABLE recovery_codes")
+	d.Exec("TRUNCATE TABLE users CASCADE")
+}
+
+func createUser(t *testing.T) uuid.UUID {
+	userID := uuid.Must(uuid.NewV7())
+	_, err := d.Exec(
+		"INSERT INTO users (id, created_at, updated_at, email, password) VALUES ($1, $2, $3, $4, $5)",
+		userID, time.Now(), time.Now(), fmt.Sprintf("recovery-%s@example.com", userID), "password",
+	)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return userID
+}
+
+func TestReplaceRecoveryCodes(t *testing.T) {
+	t.Cleanup(truncateTable)
+	userID := createUser(t)
+
+	err := rs.Replace(context.Background(), userID, []string{"a", "b", "c"})
+	assert.NoError(t, err)
+
+	count, err := rs.CountUnused(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	// Replacing drops the old codes
+	err = rs.Replace(context.Background(), userID, []string{"d", "e"})
+	assert.NoError(t, err)
+
+	count, err = rs.CountUnused(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	used, err := rs.Use(context.Background(), userID, "a")
+	assert.NoError(t, err)
+	assert.False(t, used)
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	t.Cleanup(truncateTable)
+	userID := createUser(t)
+	otherID := createUser(t)
+	assert.NoError(t, rs.Replace(context.Background(), userID, []string{"a", "b"}))
+
+	// Codes belong to a single user
+	used, err := rs.Use(context.Background(), otherID, "a")
+	assert.NoError(t, err)
+	assert.False(t, used)
+
+	used, err = rs.Use(context.Background(), userID, "a")
+	assert.NoError(t, err)
+	assert.True(t, used)
+
+	// A code can only be used once
+	used, err = rs.Use(context.Background(), userID, "a")
+	assert.NoError(t, err)
+	assert.False(t, used)
+
+	count, err := rs.CountUnused(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestDeleteRecoveryCodesByUserID(t *testing.T) {
+	t.Cleanup(truncateTable)
+	userID := createUser(t)
+	assert.NoError(t, rs.Replace(context.Background(), userID, []string{"a", "b"}))
+
+	err := rs.DeleteByUserID(context.Background(), userID)
+	assert.NoError(t, err)
+
+	count, err := rs.CountUnused(context.Background(), userID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
@@ -0,0 +1,67 @@
+package revocation
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	tokenKeyPrefix = "pcast:revoked:token:"
+	userKeyPrefix  = "pcast:revoked:user:"
+)
+
+// RedisStore keeps revoked access tokens in Redis. All keys expire once the revoked tokens would have expired anyway.
+type RedisStore struct {
+	client *redis.Client
+	// tokenLifetime is the lifetime of an access token, it bounds how long a "log out all sessions" has to be kept
+	tokenLifetime time.Duration
+}
+
+func NewRedis(client *redis.Client, tokenLifetime time.Duration) *RedisStore {
+	return &RedisStore{client: client, tokenLifetime: tokenLifetime}
+}
+
+func (s *RedisStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	return s.client.Set(ctx, tokenKeyPrefix+jti, 1, ttl).Err()
+}
+
+// RevokeUserTokens stores the cutoff in unix milliseconds
+func (s *RedisStore) RevokeUserTokens(ctx context.Context, userID uuid.UUID, issuedBefore time.Time) error {
+	return s.client.Set(ctx, userKeyPrefix+userID.String(), issuedBefore.UnixMilli(), s.tokenLifetime).Err()
+}
+
+func (s *RedisStore) IsRevoked(ctx context.Context, jti string, userID uuid.UUID, issuedAt time.Time) (bool, error) {
+	values, err := s.client.MGet(ctx, tokenKeyPrefix+jti, userKeyPrefix+userID.String()).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if values[0] != nil {
+		return true, nil
+	}
+
+	if values[1] == nil {
+		return false, nil
+	}
+
+	cutoff, ok := values[1].(string)
+	if !ok {
+		return false, errors.New("unexpected value of user revocation")
+	}
+	revokedBefore, err := strconv.ParseInt(cutoff, 10, 64)
+	if err != nil {
+		return false, err
+	}
+
+	return issuedAt.UnixMilli() <= revokedBefore, nil
+}
@@ -0,0 +1,78 @@
+package revocation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRedisStore(t *testing.T) (*RedisStore, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return NewRedis(client, 10*time.Minute), server
+}
+
+func TestRedisStore_RevokeToken(t *testing.T) {
+	s, server := newRedisStore(t)
+	userID := uuid.Must(uuid.NewV7())
+	jti := uuid.NewString()
+
+	revoked, err := s.IsRevoked(context.Background(), jti, userID, time.Now())
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	err = s.RevokeToken(context.Background(), jti, time.Now().Add(5*time.Minute))
+	require.NoError(t, err)
+
+	revoked, err = s.IsRevoked(context.Background(), jti, userID, time.Now())
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	// The revocation is dropped once the token has expired
+	server.FastForward(6 * time.Minute)
+	revoked, err = s.IsRevoked(context.Background(), jti, userID, time.Now())
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+}
+
+func TestRedisStore_RevokeToken_Expired(t *testing.T) {
+	s, server := newRedisStore(t)
+
+	err := s.RevokeToken(context.Background(), uuid.NewString(), time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Empty(t, server.Keys())
+}
+
+func TestRedisStore_RevokeUserTokens(t *testing.T) {
+	s, server := newRedisStore(t)
+	userID := uuid.Must(uuid.NewV7())
+	issuedAt := time.Now()
+	cutoff := issuedAt.Add(time.Millisecond)
+
+	err := s.RevokeUserTokens(context.Background(), userID, cutoff)
+	require.NoError(t, err)
+
+	revoked, err := s.IsRevoked(context.Background(), uuid.NewString(), userID, issuedAt)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = s.IsRevoked(context.Background(), uuid.NewString(), userID, cutoff.Add(time.Millisecond))
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	// Other users are not affected
+	revoked, err = s.IsRevoked(context.Background(), uuid.NewString(), uuid.Must(uuid.NewV7()), issuedAt)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	// All tokens issued before the cutoff have expired after one token lifetime
+	assert.Equal(t, 10*time.Minute, server.TTL(userKeyPrefix+userID.String()))
+}
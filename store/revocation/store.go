@@ -0,0 +1,53 @@
+package revocation
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"pcast-api/db"
+	"pcast-api/db/sqlcgen"
+)
+
+// Store keeps revoked access tokens in Postgres
+type Store struct {
+	queries *sqlcgen.Queries
+}
+
+func New(database *sql.DB) *Store {
+	return &Store{
+		queries: sqlcgen.New(db.Trace(database)),
+	}
+}
+
+// RevokeToken revokes a single access token until it expires. Revocations of expired tokens are cleaned up on the way.
+func (s *Store) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	err := s.queries.RevokeToken(ctx, sqlcgen.RevokeTokenParams{
+		Jti:       jti,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.queries.DeleteExpiredRevokedTokens(ctx, time.Now())
+}
+
+// RevokeUserTokens revokes all access tokens of the user issued up to issuedBefore
+func (s *Store) RevokeUserTokens(ctx context.Context, userID uuid.UUID, issuedBefore time.Time) error {
+	return s.queries.RevokeUserTokens(ctx, sqlcgen.RevokeUserTokensParams{
+		UserID:        userID,
+		RevokedBefore: issuedBefore,
+	})
+}
+
+// IsRevoked reports whether the token was revoked on its own or with all tokens of the user
+func (s *Store) IsRevoked(ctx context.Context, jti string, userID uuid.UUID, issuedAt time.Time) (bool, error) {
+	return s.queries.IsTokenRevoked(ctx, sqlcgen.IsTokenRevokedParams{
+		Jti:      jti,
+		UserID:   userID,
+		IssuedAt: issuedAt,
+	})
+}
@@ -0,0 +1,169 @@
+package revocation
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"pcast-api/db"
+)
+
+var d *sql.DB
+var rs *Store
+
+const testDSN = "host=localhost port=5432 user=pcast password=pcast dbname=pcast_test sslmode=disable"
+
+func TestMain(m *testing.M) {
+	setup()
+
+	code := m.Run()
+
+	tearDown()
+
+	os.Exit(code)
+}
+
+func setup() {
+	d = db.NewTestDB(testDSN)
+
+	runMigrations()
+	truncateTable()
+
+	rs = New(d)
+}
+
+func tearDown() {
+	truncateTable()
+	d.Close()
+}
+
+func runMigrations() {
+	d.Exec(`
+		CREATE TABLE IF NOT EXISTS users (
+			id UUID PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			email VARCHAR(255) UNIQUE NOT NULL,
+			password VARCHAR(255),
+			email_verified_at TIMESTAMP,
+			totp_secret BYTEA,
+			totp_enabled_at TIMESTAMP,
+			totp_last_step BIGINT,
+			totp_attempts INT NOT NULL DEFAULT 0,
+			totp_attempted_at TIMESTAMP
+		)
+	`)
+	d.Exec(`
+		CREATE TABLE IF NOT EXISTS revoked_tokens (
+			jti VARCHAR(64) PRIMARY KEY,
+			expires_at TIMESTAMP NOT NULL
+		)
+	`)
+	d.Exec(`
+		CREATE TABLE IF NOT EXISTS user_token_revocations (
+			user_id UUID PRIMARY KEY,
+			revoked_before TIMESTAMP NOT NULL
+		)
+	`)
+}
+
+func truncateTable() {
+	d.Exec("TRUNCATE TABLE revoked_tokens")
+	d.Exec("TRUNCATE TABLE user_token_revocations")
+	d.Exec("TRUNCATE TABLE users CASCADE")
+}
+
+func createUser(t *testing.T) uuid.UUID {
+	userID := uuid.Must(uuid.NewV7())
+	_, err := d.Exec(
+		"INSERT INTO users (id, created_at, updated_at, email, password) VALUES ($1, $2, $3, $4, $5)",
+		userID, time.Now(), time.Now(), fmt.Sprintf("revocation-%s@example.com", userID), "password",
+	)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return userID
+}
+
+func TestRevokeToken(t *testing.T) {
+	t.Cleanup(truncateTable)
+	userID := createUser(t)
+	jti := uuid.NewString()
+
+	revoked, err := rs.IsRevoked(context.Background(), jti, userID, time.Now())
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	err = rs.RevokeToken(context.Background(), jti, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+
+	// Revoking twice is fine
+	err = rs.RevokeToken(context.Background(), jti, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+
+	revoked, err = rs.IsRevoked(context.Background(), jti, userID, time.Now())
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestRevokeToken_CleansUpExpired(t *testing.T) {
+	t.Cleanup(truncateTable)
+	expired := uuid.NewString()
+
+	assert.NoError(t, rs.RevokeToken(context.Background(), expired, time.Now().Add(-time.Minute)))
+	assert.NoError(t, rs.RevokeToken(context.Background(), uuid.NewString(), time.Now().Add(time.Hour)))
+
+	var count int
+	err := d.QueryRow("SELECT COUNT(*) FROM revoked_tokens WHERE jti = $1", expired).Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	t.Cleanup(truncateTable)
+	userID := createUser(t)
+	issuedAt := time.Now()
+	cutoff := issuedAt.Add(time.Millisecond)
+
+	err := rs.RevokeUserTokens(context.Background(), userID, cutoff)
+	assert.NoError(t, err)
+
+	revoked, err := rs.IsRevoked(context.Background(), uuid.NewString(), userID, issuedAt)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = rs.IsRevoked(context.Background(), uuid.NewString(), userID, cutoff.Add(time.Millisecond))
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	// A later logout moves the cutoff
+	err = rs.RevokeUserTokens(context.Background(), userID, cutoff.Add(time.Second))
+	assert.NoError(t, err)
+
+	revoked, err = rs.IsRevoked(context.Background(), uuid.NewString(), userID, cutoff.Add(time.Millisecond))
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestRevokeUserTokens_DeletedUser(t *testing.T) {
+	t.Cleanup(truncateTable)
+	userID := createUser(t)
+	issuedAt := time.Now()
+
+	err := rs.RevokeUserTokens(context.Background(), userID, issuedAt.Add(time.Millisecond))
+	assert.NoError(t, err)
+
+	// The tokens of a deleted account stay revoked until they expire
+	_, err = d.Exec("DELETE FROM users WHERE id = $1", userID)
+	assert.NoError(t, err)
+
+	revoked, err := rs.IsRevoked(context.Background(), uuid.NewString(), userID, issuedAt)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+}
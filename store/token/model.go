@@ -0,0 +1,52 @@
+package token
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"pcast-api/store"
+)
+
+// RefreshToken is a single use token to renew an access token. Only the hash of the token is stored.
+type RefreshToken struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	// AuthenticatedAt is the time of the login the family was issued for, nil for older tokens
+	AuthenticatedAt *time.Time
+}
+
+func (t *RefreshToken) SetID(id uuid.UUID) {
+	t.ID = id
+}
+
+func (t *RefreshToken) GetID() uuid.UUID {
+	return t.ID
+}
+
+func (t *RefreshToken) SetCreatedAt(createdAt time.Time) {
+	t.CreatedAt = createdAt
+}
+
+func (t *RefreshToken) GetCreatedAt() time.Time {
+	return t.CreatedAt
+}
+
+func (t *RefreshToken) SetUpdatedAt(updatedAt time.Time) {
+	t.UpdatedAt = updatedAt
+}
+
+func (t *RefreshToken) GetUpdatedAt() time.Time {
+	return t.UpdatedAt
+}
+
+func (t *RefreshToken) BeforeCreate() error {
+	return store.BeforeCreate(t)
+}
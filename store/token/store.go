@@ -0,0 +1,122 @@
+package token
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"pcast-api/db"
+	"pcast-api/db/sqlcgen"
+)
+
+type Store struct {
+	queries *sqlcgen.Queries
+}
+
+func New(database *sql.DB) *Store {
+	return &Store{
+		queries: sqlcgen.New(db.Trace(database)),
+	}
+}
+
+func (s *Store) Create(ctx context.Context, token *RefreshToken) error {
+	if err := token.BeforeCreate(); err != nil {
+		return err
+	}
+
+	_, err := s.queries.CreateRefreshToken(ctx, sqlcgen.CreateRefreshTokenParams{
+		ID:              token.ID,
+		CreatedAt:       token.CreatedAt,
+		UpdatedAt:       token.UpdatedAt,
+		UserID:          token.UserID,
+		FamilyID:        token.FamilyID,
+		TokenHash:       token.TokenHash,
+		ExpiresAt:       token.ExpiresAt,
+		AuthenticatedAt: timePtrToNullTime(token.AuthenticatedAt),
+	})
+
+	return err
+}
+
+func (s *Store) FindByHash(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	row, err := s.queries.FindRefreshTokenByHash(ctx, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertRefreshTokenRowToModelPtr(*row), nil
+}
+
+// MarkUsed marks the token as rotated. Returns false if it was already used or revoked.
+func (s *Store) MarkUsed(ctx context.Context, token *RefreshToken) (bool, error) {
+	now := time.Now()
+
+	rows, err := s.queries.MarkRefreshTokenUsed(ctx, sqlcgen.MarkRefreshTokenUsedParams{
+		ID:        token.ID,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return false, err
+	}
+	if rows == 0 {
+		return false, nil
+	}
+
+	token.UpdatedAt = now
+	token.UsedAt = &now
+	return true, nil
+}
+
+// RevokeFamily revokes all tokens rotated from the same login
+func (s *Store) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	return s.queries.RevokeRefreshTokenFamily(ctx, sqlcgen.RevokeRefreshTokenFamilyParams{
+		FamilyID:  familyID,
+		UpdatedAt: time.Now(),
+	})
+}
+
+// RevokeByUserID revokes all refresh tokens of the user
+func (s *Store) RevokeByUserID(ctx context.Context, userID uuid.UUID) error {
+	return s.queries.RevokeRefreshTokensByUserID(ctx, sqlcgen.RevokeRefreshTokensByUserIDParams{
+		UserID:    userID,
+		UpdatedAt: time.Now(),
+	})
+}
+
+func timePtrToNullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+func nullTimeToTimePtr(nt sql.NullTime) *time.Time {
+	if !nt.Valid {
+		return nil
+	}
+	return &nt.Time
+}
+
+// Helper function to convert sqlcgen.RefreshToken to RefreshToken
+func convertRefreshTokenRowToModel(row sqlcgen.RefreshToken) RefreshToken {
+	return RefreshToken{
+		ID:              row.ID,
+		CreatedAt:       row.CreatedAt,
+		UpdatedAt:       row.UpdatedAt,
+		UserID:          row.UserID,
+		FamilyID:        row.FamilyID,
+		TokenHash:       row.TokenHash,
+		ExpiresAt:       row.ExpiresAt,
+		UsedAt:          nullTimeToTimePtr(row.UsedAt),
+		RevokedAt:       nullTimeToTimePtr(row.RevokedAt),
+		AuthenticatedAt: nullTimeToTimePtr(row.AuthenticatedAt),
+	}
+}
+
+// Helper function to convert sqlcgen.RefreshToken to *RefreshToken
+func convertRefreshTokenRowToModelPtr(row sqlcgen.RefreshToken) *RefreshToken {
+	token := convertRefreshTokenRowToModel(row)
+	return &token
+}
@@ -0,0 +1,174 @@
+package token
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"pcast-api/db"
+)
+
+var d *sql.DB
+var ts *Store
+
+const testDSN = "host=localhost port=5432 user=pcast password=pcast dbname=pcast_test sslmode=disable"
+
+func TestMain(m *testing.M) {
+	setup()
+
+	code := m.Run()
+
+	tearDown()
+
+	os.Exit(code)
+}
+
+func setup() {
+	d = db.NewTestDB(testDSN)
+
+	runMigrations()
+	truncateTable()
+
+	ts = New(d)
+}
+
+func tearDown() {
+	truncateTable()
+	d.Close()
+}
+
+func runMigrations() {
+	d.Exec(`
+		CREATE TABLE IF NOT EXISTS users (
+			id UUID PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			email VARCHAR(255) UNIQUE NOT NULL,
+			password VARCHAR(255),
+			email_verified_at TIMESTAMP,
+			totp_secret BYTEA,
+			totp_enabled_at TIMESTAMP,
+			totp_last_step BIGINT,
+			totp_attempts INT NOT NULL DEFAULT 0,
+			totp_attempted_at TIMESTAMP
+		)
+	`)
+	d.Exec(`
+		CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id UUID PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			family_id UUID NOT NULL,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP,
+			revoked_at TIMESTAMP,
+			authenticated_at TIMESTAMP
+		)
+	`)
+}
+
+func truncateTable() {
+	d.Exec("TRUNCATE TABLE refresh_tokens")
+	d.Exec("TRUNCATE TABLE users CASCADE")
+}
+
+func createUser(t *testing.T) uuid.UUID {
+	userID := uuid.Must(uuid.NewV7())
+	_, err := d.Exec(
+		"INSERT INTO users (id, created_at, updated_at, email, password) VALUES ($1, $2, $3, $4, $5)",
+		userID, time.Now(), time.Now(), fmt.Sprintf("token-%s@example.com", userID), "password",
+	)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return userID
+}
+
+func newToken(userID, familyID uuid.UUID) *RefreshToken {
+	return &RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: uuid.NewString(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+}
+
+func TestCreateRefreshToken(t *testing.T) {
+	t.Cleanup(truncateTable)
+	token := newToken(createUser(t), uuid.Must(uuid.NewV7()))
+	authenticatedAt := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+	token.AuthenticatedAt = &authenticatedAt
+
+	err := ts.Create(context.Background(), token)
+	assert.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, token.ID)
+
+	found, err := ts.FindByHash(context.Background(), token.TokenHash)
+	assert.NoError(t, err)
+	assert.Equal(t, token.ID, found.ID)
+	assert.Equal(t, token.FamilyID, found.FamilyID)
+	assert.Nil(t, found.UsedAt)
+	assert.Nil(t, found.RevokedAt)
+	if assert.NotNil(t, found.AuthenticatedAt) {
+		assert.WithinDuration(t, authenticatedAt, *found.AuthenticatedAt, time.Millisecond)
+	}
+}
+
+func TestFindRefreshTokenByHash_NotFound(t *testing.T) {
+	_, err := ts.FindByHash(context.Background(), "unknown")
+	assert.Error(t, err)
+}
+
+func TestMarkRefreshTokenUsed(t *testing.T) {
+	t.Cleanup(truncateTable)
+	token := newToken(createUser(t), uuid.Must(uuid.NewV7()))
+	assert.NoError(t, ts.Create(context.Background(), token))
+
+	marked, err := ts.MarkUsed(context.Background(), token)
+	assert.NoError(t, err)
+	assert.True(t, marked)
+	assert.NotNil(t, token.UsedAt)
+
+	// A token can only be used once
+	marked, err = ts.MarkUsed(context.Background(), token)
+	assert.NoError(t, err)
+	assert.False(t, marked)
+}
+
+func TestRevokeRefreshTokenFamily(t *testing.T) {
+	t.Cleanup(truncateTable)
+	userID := createUser(t)
+	familyID := uuid.Must(uuid.NewV7())
+
+	first := newToken(userID, familyID)
+	second := newToken(userID, familyID)
+	other := newToken(userID, uuid.Must(uuid.NewV7()))
+	for _, token := range []*RefreshToken{first, second, other} {
+		assert.NoError(t, ts.Create(context.Background(), token))
+	}
+
+	err := ts.RevokeFamily(context.Background(), familyID)
+	assert.NoError(t, err)
+
+	for _, token := range []*RefreshToken{first, second} {
+		found, err := ts.FindByHash(context.Background(), token.TokenHash)
+		assert.NoError(t, err)
+		assert.NotNil(t, found.RevokedAt)
+	}
+
+	found, err := ts.FindByHash(context.Background(), other.TokenHash)
+	assert.NoError(t, err)
+	assert.Nil(t, found.RevokedAt)
+
+	marked, err := ts.MarkUsed(context.Background(), first)
+	assert.NoError(t, err)
+	assert.False(t, marked)
+}
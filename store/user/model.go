@@ -14,7 +14,11 @@ type User struct {
 	UpdatedAt time.Time
 	Email     string
 	Password  *string // Nullable for OAuth-only users
-	GoogleID  *string // Google OAuth subject ID
+	// EmailVerifiedAt is set once the user proved ownership of the address, by mail or by signing in with an OpenID Connect provider
+	EmailVerifiedAt *time.Time
+	// TOTPSecret is the encrypted shared secret of the authenticator app, 2FA is active once TOTPEnabledAt is set
+	TOTPSecret    []byte
+	TOTPEnabledAt *time.Time
 }
 
 func (u *User) SetID(id uuid.UUID) {
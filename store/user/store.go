@@ -7,6 +7,7 @@ import (
 
 	"github.com/google/uuid"
 
+	"pcast-api/db"
 	"pcast-api/db/sqlcgen"
 )
 
@@ -16,7 +17,7 @@ type Store struct {
 
 func New(database *sql.DB) *Store {
 	return &Store{
-		queries: sqlcgen.New(database),
+		queries: sqlcgen.New(db.Trace(database)),
 	}
 }
 
@@ -83,47 +84,140 @@ func (s *Store) Delete(ctx context.Context, user *User) error {
 	return s.queries.DeleteUser(ctx, user.ID)
 }
 
-func (s *Store) FindByGoogleID(ctx context.Context, googleID string) (*User, error) {
-	row, err := s.queries.FindUserByGoogleID(ctx, sql.NullString{String: googleID, Valid: true})
+func (s *Store) CreateOAuthUser(ctx context.Context, user *User) error {
+	if err := user.BeforeCreate(); err != nil {
+		return err
+	}
+
+	_, err := s.queries.CreateOAuthUser(ctx, sqlcgen.CreateOAuthUserParams{
+		ID:              user.ID,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
+		Email:           user.Email,
+		EmailVerifiedAt: toNullTime(user.EmailVerifiedAt),
+	})
+
+	return err
+}
+
+// MarkEmailVerified records that the user verified the address. An earlier verification is kept.
+func (s *Store) MarkEmailVerified(ctx context.Context, user *User) error {
+	now := time.Now()
+
+	err := s.queries.MarkUserEmailVerified(ctx, sqlcgen.MarkUserEmailVerifiedParams{
+		ID:        user.ID,
+		UpdatedAt: now,
+	})
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return convertUserRowToModelPtr(*row), nil
+	user.UpdatedAt = now
+	if user.EmailVerifiedAt == nil {
+		user.EmailVerifiedAt = &now
+	}
+	return nil
 }
 
-func (s *Store) UpdateGoogleID(ctx context.Context, userID uuid.UUID, googleID string) error {
-	return s.queries.UpdateUserGoogleID(ctx, sqlcgen.UpdateUserGoogleIDParams{
-		GoogleID: sql.NullString{String: googleID, Valid: true},
-		ID:       userID,
+// SetTOTPSecret stores the encrypted secret of a new authenticator. 2FA is disabled until EnableTOTP is called.
+func (s *Store) SetTOTPSecret(ctx context.Context, user *User, secret []byte) error {
+	now := time.Now()
+
+	err := s.queries.SetUserTOTPSecret(ctx, sqlcgen.SetUserTOTPSecretParams{
+		ID:         user.ID,
+		TotpSecret: secret,
+		UpdatedAt:  now,
 	})
+	if err != nil {
+		return err
+	}
+
+	user.UpdatedAt = now
+	user.TOTPSecret = secret
+	user.TOTPEnabledAt = nil
+	return nil
 }
 
-func (s *Store) CreateOAuthUser(ctx context.Context, user *User) error {
-	if err := user.BeforeCreate(); err != nil {
+func (s *Store) EnableTOTP(ctx context.Context, user *User) error {
+	now := time.Now()
+
+	err := s.queries.EnableUserTOTP(ctx, sqlcgen.EnableUserTOTPParams{
+		ID:            user.ID,
+		TotpEnabledAt: sql.NullTime{Time: now, Valid: true},
+	})
+	if err != nil {
 		return err
 	}
 
-	_, err := s.queries.CreateOAuthUser(ctx, sqlcgen.CreateOAuthUserParams{
+	user.UpdatedAt = now
+	user.TOTPEnabledAt = &now
+	return nil
+}
+
+func (s *Store) DisableTOTP(ctx context.Context, user *User) error {
+	now := time.Now()
+
+	err := s.queries.DisableUserTOTP(ctx, sqlcgen.DisableUserTOTPParams{
 		ID:        user.ID,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-		Email:     user.Email,
-		GoogleID:  toNullString(user.GoogleID),
+		UpdatedAt: now,
 	})
+	if err != nil {
+		return err
+	}
 
-	return err
+	user.UpdatedAt = now
+	user.TOTPSecret = nil
+	user.TOTPEnabledAt = nil
+	return nil
+}
+
+// UseTOTPStep records the time step of an accepted code. Returns false if a code of this or a later step was already used.
+func (s *Store) UseTOTPStep(ctx context.Context, user *User, step int64) (bool, error) {
+	rows, err := s.queries.UseUserTOTPStep(ctx, sqlcgen.UseUserTOTPStepParams{
+		ID:           user.ID,
+		TotpLastStep: sql.NullInt64{Int64: step, Valid: true},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// TakeTOTPAttempt counts a second factor check of the user. Returns false without counting if maxAttempts
+// checks were made since the last successful one and the last check is less than lockout ago.
+func (s *Store) TakeTOTPAttempt(ctx context.Context, user *User, maxAttempts int, lockout time.Duration) (bool, error) {
+	now := time.Now()
+
+	rows, err := s.queries.TakeUserTOTPAttempt(ctx, sqlcgen.TakeUserTOTPAttemptParams{
+		ID:           user.ID,
+		AttemptedAt:  sql.NullTime{Time: now, Valid: true},
+		LockoutStart: sql.NullTime{Time: now.Add(-lockout), Valid: true},
+		MaxAttempts:  int32(maxAttempts),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// ResetTOTPAttempts restores the full budget of second factor checks after a successful one
+func (s *Store) ResetTOTPAttempts(ctx context.Context, user *User) error {
+	return s.queries.ResetUserTOTPAttempts(ctx, user.ID)
 }
 
 // Helper function to convert sqlcgen.User to User
 func convertUserRowToModel(row sqlcgen.User) User {
 	return User{
-		ID:        row.ID,
-		CreatedAt: row.CreatedAt,
-		UpdatedAt: row.UpdatedAt,
-		Email:     row.Email,
-		Password:  fromNullString(row.Password),
-		GoogleID:  fromNullString(row.GoogleID),
+		ID:              row.ID,
+		CreatedAt:       row.CreatedAt,
+		UpdatedAt:       row.UpdatedAt,
+		Email:           row.Email,
+		Password:        fromNullString(row.Password),
+		EmailVerifiedAt: fromNullTime(row.EmailVerifiedAt),
+		TOTPSecret:      row.TotpSecret,
+		TOTPEnabledAt:   fromNullTime(row.TotpEnabledAt),
 	}
 }
 
@@ -148,3 +242,19 @@ func fromNullString(ns sql.NullString) *string {
 	}
 	return &ns.String
 }
+
+// toNullTime converts a *time.Time to sql.NullTime
+func toNullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{Valid: false}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+// fromNullTime converts sql.NullTime to *time.Time
+func fromNullTime(nt sql.NullTime) *time.Time {
+	if !nt.Valid {
+		return nil
+	}
+	return &nt.Time
+}
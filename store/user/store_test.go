@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -59,11 +60,15 @@ func runMigrations() {
 			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
 			email VARCHAR(255) UNIQUE NOT NULL,
 			password VARCHAR(255),
-			google_id VARCHAR(255) UNIQUE
+			email_verified_at TIMESTAMP,
+			totp_secret BYTEA,
+			totp_enabled_at TIMESTAMP,
+			totp_last_step BIGINT,
+			totp_attempts INT NOT NULL DEFAULT 0,
+			totp_attempted_at TIMESTAMP
 		)
 	`)
 	d.Exec(`CREATE INDEX IF NOT EXISTS idx_users_email ON users(email)`)
-	d.Exec(`CREATE INDEX IF NOT EXISTS idx_users_google_id ON users(google_id)`)
 }
 
 func truncateTable() {
@@ -137,39 +142,129 @@ func TestUpdateUser(t *testing.T) {
 func TestCreateOAuthUser(t *testing.T) {
 	t.Cleanup(truncateTable)
 
-	user := &User{Email: "oauth@test.com", GoogleID: strPtr("google123")}
+	now := time.Now()
+	user := &User{Email: "oauth@test.com", EmailVerifiedAt: &now}
 	err := us.CreateOAuthUser(context.Background(), user)
 	assert.NoError(t, err)
 	assert.Nil(t, user.Password)
+
+	foundUser, err := us.FindByID(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, foundUser.Password)
+	assert.NotNil(t, foundUser.EmailVerifiedAt)
 }
 
-func TestFindUserByGoogleID(t *testing.T) {
+func TestMarkEmailVerified(t *testing.T) {
 	t.Cleanup(truncateTable)
 
-	googleID := "google-find-123"
-	user := &User{Email: "oauth-find@test.com", GoogleID: &googleID}
-	err := us.CreateOAuthUser(context.Background(), user)
+	user := &User{Email: "verify@test.com", Password: strPtr("password")}
+	err := us.Create(context.Background(), user)
 	assert.NoError(t, err)
+	assert.Nil(t, user.EmailVerifiedAt)
 
-	foundUser, err := us.FindByGoogleID(context.Background(), googleID)
+	err = us.MarkEmailVerified(context.Background(), user)
 	assert.NoError(t, err)
-	assert.Equal(t, user.Email, foundUser.Email)
-	assert.Equal(t, googleID, *foundUser.GoogleID)
+	assert.NotNil(t, user.EmailVerifiedAt)
+
+	foundUser, err := us.FindByID(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, foundUser.EmailVerifiedAt)
+
+	// Verifying again keeps the first verification time
+	err = us.MarkEmailVerified(context.Background(), &User{ID: user.ID})
+	assert.NoError(t, err)
+
+	verifiedAgain, err := us.FindByID(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, *foundUser.EmailVerifiedAt, *verifiedAgain.EmailVerifiedAt)
 }
 
-func TestUpdateGoogleID(t *testing.T) {
+func TestTOTP(t *testing.T) {
 	t.Cleanup(truncateTable)
 
-	user := &User{Email: "update-google@test.com", Password: strPtr("password")}
+	user := &User{Email: "totp@test.com", Password: strPtr("password")}
 	err := us.Create(context.Background(), user)
 	assert.NoError(t, err)
 
-	googleID := "google-update-456"
-	err = us.UpdateGoogleID(context.Background(), user.ID, googleID)
+	err = us.SetTOTPSecret(context.Background(), user, []byte("secret"))
 	assert.NoError(t, err)
 
-	foundUser, err := us.FindByGoogleID(context.Background(), googleID)
+	foundUser, err := us.FindByID(context.Background(), user.ID)
 	assert.NoError(t, err)
-	assert.Equal(t, user.Email, foundUser.Email)
-	assert.Equal(t, googleID, *foundUser.GoogleID)
+	assert.Equal(t, []byte("secret"), foundUser.TOTPSecret)
+	assert.Nil(t, foundUser.TOTPEnabledAt)
+
+	err = us.EnableTOTP(context.Background(), user)
+	assert.NoError(t, err)
+
+	foundUser, err = us.FindByID(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, foundUser.TOTPEnabledAt)
+
+	err = us.DisableTOTP(context.Background(), user)
+	assert.NoError(t, err)
+
+	foundUser, err = us.FindByID(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, foundUser.TOTPSecret)
+	assert.Nil(t, foundUser.TOTPEnabledAt)
+}
+
+func TestUseTOTPStep(t *testing.T) {
+	t.Cleanup(truncateTable)
+
+	user := &User{Email: "totp-step@test.com", Password: strPtr("password")}
+	err := us.Create(context.Background(), user)
+	assert.NoError(t, err)
+
+	used, err := us.UseTOTPStep(context.Background(), user, 100)
+	assert.NoError(t, err)
+	assert.True(t, used)
+
+	// A step cannot be used twice, neither can an earlier one
+	used, err = us.UseTOTPStep(context.Background(), user, 100)
+	assert.NoError(t, err)
+	assert.False(t, used)
+
+	used, err = us.UseTOTPStep(context.Background(), user, 99)
+	assert.NoError(t, err)
+	assert.False(t, used)
+
+	used, err = us.UseTOTPStep(context.Background(), user, 101)
+	assert.NoError(t, err)
+	assert.True(t, used)
+}
+
+func TestTakeTOTPAttempt(t *testing.T) {
+	t.Cleanup(truncateTable)
+
+	user := &User{Email: "totp-attempt@test.com", Password: strPtr("password")}
+	err := us.Create(context.Background(), user)
+	assert.NoError(t, err)
+
+	for range 3 {
+		allowed, err := us.TakeTOTPAttempt(context.Background(), user, 3, time.Hour)
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+	}
+
+	allowed, err := us.TakeTOTPAttempt(context.Background(), user, 3, time.Hour)
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+
+	// The count starts over once the last attempt is older than the lockout
+	allowed, err = us.TakeTOTPAttempt(context.Background(), user, 3, -time.Second)
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+
+	// A successful check restores the budget
+	for range 2 {
+		_, err := us.TakeTOTPAttempt(context.Background(), user, 3, time.Hour)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, us.ResetTOTPAttempts(context.Background(), user))
+
+	allowed, err = us.TakeTOTPAttempt(context.Background(), user, 3, time.Hour)
+	assert.NoError(t, err)
+	assert.True(t, allowed)
 }
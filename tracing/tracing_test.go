@@ -0,0 +1,63 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"pcast-api/config"
+)
+
+func TestNew_None(t *testing.T) {
+	provider, err := New(t.Context(), &config.Tracing{Exporter: config.TracingExporterNone})
+	require.NoError(t, err)
+	assert.NoError(t, provider.Close())
+}
+
+func TestNew_Stdout(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	provider, err := New(t.Context(), &config.Tracing{Exporter: config.TracingExporterStdout, ServiceName: "pcast-test", SampleRatio: 0.5})
+	require.NoError(t, err)
+	assert.Same(t, provider.provider, otel.GetTracerProvider())
+	assert.NoError(t, provider.Close())
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(tracerProvider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	e := echo.New()
+	e.Use(Middleware("pcast-test"))
+	e.GET("/api/feeds/:id", func(c echo.Context) error {
+		// Spans of the services are children of the request
+		_, span := tracerProvider.Tracer("test").Start(c.Request().Context(), "feed.GetFeed")
+		span.End()
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/readyz", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	for _, target := range []string{"/api/feeds/1", "/readyz"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	// The probe is not traced
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "feed.GetFeed", spans[0].Name())
+	assert.Equal(t, "GET /api/feeds/:id", spans[1].Name())
+	assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+}